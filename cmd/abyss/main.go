@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/aiwuxian/project-abyss/internal/services"
+	"github.com/aiwuxian/project-abyss/internal/services/prompts"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+)
+
+const usage = `用法: abyss <命令> [参数]
+
+命令:
+  play    在终端里交互式跑完整一局（无需前端）
+
+运行 abyss play -h 查看参数`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "play":
+		if err := play(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
+
+// play 终端版的完整流程：创建角色 → 解析小说 → 开始故事 → 循环选择行动直到故事结束
+func play(args []string) error {
+	fs := flag.NewFlagSet("play", flag.ExitOnError)
+	configPath := fs.String("config", "config.yml", "配置文件路径")
+	novelPath := fs.String("novel", "小说示例-跑团风格.md", "小说段落文件，不存在时从终端读取")
+	memory := fs.Bool("memory", true, "使用内存数据库（退出后不保留），设为 false 时使用配置文件中的数据库")
+	dbPath := fs.String("db", "", "数据库路径（指定后不再使用内存数据库）")
+	verbose := fs.Bool("v", false, "显示服务日志（提示词、AI回复等）")
+	fs.Parse(args)
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	config, err := services.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
+	path := *dbPath
+	if path == "" {
+		path = config.Database.Path
+		if *memory || config.Database.InMemory {
+			path = storage.MemoryPath
+		}
+	}
+	store, err := storage.New(path)
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer store.Close()
+
+	llmService := services.NewLLMService(config.LLM)
+	promptStore, err := prompts.Load(config.LLM.PromptDir)
+	if err != nil {
+		return fmt.Errorf("加载提示词模板失败: %w", err)
+	}
+	llmService.SetPrompts(promptStore)
+	ruleEngine := services.NewRuleEngine()
+	ruleEngine.SetRules(config.Rules)
+	metaService := services.NewMetaService(store, ruleEngine, config.Game)
+	worldService := services.NewWorldService(store, llmService)
+	storyService := services.NewStoryService(store, llmService, ruleEngine, metaService)
+
+	ctx := context.Background()
+	in := bufio.NewReader(os.Stdin)
+
+	fmt.Println("━━━━━━━━━━ 无限深渊 · 终端版 ━━━━━━━━━━")
+
+	// 创建角色
+	name := ask(in, "角色名", "旅人")
+	gender := ask(in, "性别（male/female）", "male")
+	age, _ := strconv.Atoi(ask(in, "年龄", "20"))
+	character, err := metaService.CreateCharacter(&models.Character{
+		Name:        name,
+		Gender:      gender,
+		Age:         age,
+		Personality: ask(in, "性格", "冷静谨慎"),
+	})
+	if err != nil {
+		return fmt.Errorf("创建角色失败: %w", err)
+	}
+
+	// 解析小说段落
+	segment, err := readSegment(in, *novelPath)
+	if err != nil {
+		return err
+	}
+	fmt.Println("\n⏳ 正在解析小说，生成世界……")
+	world, err := worldService.CreateWorldFromSegment(ctx, segment)
+	if err != nil {
+		return fmt.Errorf("解析小说失败: %w", err)
+	}
+	fmt.Printf("\n🌍 %s（难度 %d）\n%s\n", world.Name, world.Difficulty, world.Description)
+	for _, goal := range world.Goals {
+		fmt.Printf("  🎯 %s\n", goal)
+	}
+
+	// 开始故事
+	fmt.Println("\n⏳ 正在生成开场……")
+	story, scene, err := storyService.StartStory(ctx, character.ID, world.ID, false, "")
+	if err != nil {
+		return fmt.Errorf("开始故事失败: %w", err)
+	}
+	fmt.Printf("\n📍 %s\n", scene.Name)
+	printNarrative(story.Narrative)
+
+	options, err := storyService.CurrentOptions(ctx, story.ID)
+	if err != nil {
+		return fmt.Errorf("生成选项失败: %w", err)
+	}
+
+	for {
+		printOptions(options)
+		line := ask(in, "你的行动（编号或自由输入，q 退出）", "")
+		switch {
+		case line == "q":
+			fmt.Println("👋 再见")
+			return nil
+		case line == "":
+			continue
+		}
+
+		action := models.Action{Type: "custom", Content: line}
+		if n, err := strconv.Atoi(line); err == nil {
+			if n < 1 || n > len(options) {
+				fmt.Println("⚠️ 没有这个选项")
+				continue
+			}
+			opt := options[n-1]
+			action = models.Action{Type: opt.ActionType, Content: opt.Description, Trivial: opt.Trivial,
+				RequiresConfirm: opt.RequiresConfirm}
+			if action.Content == "" {
+				action.Content = opt.Label
+			}
+		}
+
+		fmt.Println("\n⏳ ……")
+		result, err := storyService.ProcessAction(ctx, story.ID, action, story.Version)
+		if errors.Is(err, services.ErrConfirmRequired) {
+			fmt.Printf("⚠️ %v\n", err)
+			if ask(in, "确定要这么做吗？(y/N)", "n") != "y" {
+				continue
+			}
+			action.Confirmed = true
+			fmt.Println("\n⏳ ……")
+			result, err = storyService.ProcessAction(ctx, story.ID, action, story.Version)
+		}
+		if err != nil {
+			fmt.Printf("⚠️ 行动失败: %v\n", err)
+			continue
+		}
+		printResult(result)
+
+		// 叙事中的快速选择：回答后续写一小段，不推进回合
+		if choice := result.QuickChoice; choice != nil {
+			fmt.Printf("\n❓ %s\n", choice.Prompt)
+			for i, opt := range choice.Options {
+				fmt.Printf("  %d. %s\n", i+1, opt)
+			}
+			n, _ := strconv.Atoi(ask(in, "你的回答", "1"))
+			if resolved, err := storyService.ResolveQuickChoice(ctx, story.ID, choice.ID, n-1); err != nil {
+				fmt.Printf("⚠️ 回答失败: %v\n", err)
+			} else if len(resolved.Narrative) > 0 {
+				printNarrative(resolved.Narrative[len(resolved.Narrative)-1:])
+			}
+		}
+
+		if story, err = storyService.GetStory(story.ID); err != nil {
+			return fmt.Errorf("获取故事失败: %w", err)
+		}
+		if result.SceneEnd {
+			fmt.Printf("\n━━━━━━━━━━ 故事结束（%s）━━━━━━━━━━\n", story.Status)
+			return nil
+		}
+		options = result.NextOptions
+	}
+}
+
+// ask 读取一行输入，直接回车时使用默认值
+func ask(in *bufio.Reader, prompt, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", prompt, def)
+	} else {
+		fmt.Printf("%s: ", prompt)
+	}
+	line, _ := in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+// readSegment 从文件读取小说段落；文件不存在时从终端读取，以单独一行 END 结束
+func readSegment(in *bufio.Reader, path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		fmt.Printf("\n📖 使用小说文件: %s\n", path)
+		return string(data), nil
+	}
+
+	fmt.Println("\n📖 请粘贴小说段落，单独一行输入 END 结束：")
+	var lines []string
+	for {
+		line, err := in.ReadString('\n')
+		if strings.TrimSpace(line) == "END" {
+			break
+		}
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			break
+		}
+	}
+	segment := strings.TrimSpace(strings.Join(lines, "\n"))
+	if segment == "" {
+		return "", fmt.Errorf("小说段落不能为空")
+	}
+	return segment, nil
+}
+
+// printNarrative 打印叙事日志
+func printNarrative(logs []models.NarrativeLog) {
+	for _, entry := range logs {
+		fmt.Printf("\n%s\n", entry.Content)
+	}
+}
+
+// printOptions 打印可选行动
+func printOptions(options []models.Option) {
+	fmt.Println()
+	for i, opt := range options {
+		line := fmt.Sprintf("  %d. %s", i+1, opt.Label)
+		if opt.Risk != "" {
+			line += fmt.Sprintf("（风险：%s）", opt.Risk)
+		}
+		if opt.Trivial {
+			line += "（无需检定）"
+		}
+		if opt.PersonalityConflict != "" {
+			line += fmt.Sprintf(" ⚠️违背本性：%s", opt.PersonalityConflict)
+		}
+		if opt.RequiresConfirm {
+			line += " ⚠️无法挽回"
+		}
+		fmt.Println(line)
+		if opt.Description != "" {
+			fmt.Printf("     %s\n", opt.Description)
+		}
+	}
+}
+
+// printResult 打印一回合的结算：检定、叙事、事件、结局
+func printResult(result *models.ActionResult) {
+	if result.Blocked != "" {
+		fmt.Printf("🚫 %s\n", result.Blocked)
+	}
+	if result.AutoSuccess {
+		fmt.Println("✅ 无需检定，直接成功")
+	}
+	if roll := result.DiceRoll; roll != nil {
+		outcome := "失败"
+		if roll.Success {
+			outcome = "成功"
+		}
+		if roll.Critical {
+			outcome = "大" + outcome
+		}
+		fmt.Printf("🎲 d20=%d %+d vs %d → %s\n", roll.Result, roll.Modifier, roll.Target, outcome)
+		if roll.BonusSource != "" {
+			fmt.Printf("💡 %s\n", roll.BonusSource)
+		}
+	}
+	fmt.Printf("\n%s\n", result.Narrative)
+
+	for _, event := range result.Events {
+		fmt.Printf("🔔 %s\n", event.Message)
+	}
+	if changes := result.Changes; changes.HPChange != 0 || changes.SANChange != 0 {
+		fmt.Printf("💫 HP %+d，理智 %+d\n", changes.HPChange, changes.SANChange)
+	}
+	if progress := result.PlotProgress; progress != nil {
+		fmt.Printf("📜 %s %.0f%%\n", progress.CurrentNodeName, progress.Progress*100)
+	}
+	if result.Ending != "" {
+		fmt.Printf("\n🏁 %s\n", result.Ending)
+	}
+}
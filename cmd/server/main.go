@@ -3,26 +3,31 @@ package main
 import (
 	"fmt"
 	"log"
-	"os"
 
 	"github.com/gin-gonic/gin"
-	"gopkg.in/yaml.v3"
 
 	"github.com/aiwuxian/project-abyss/internal/api"
-	"github.com/aiwuxian/project-abyss/internal/models"
 	"github.com/aiwuxian/project-abyss/internal/services"
+	"github.com/aiwuxian/project-abyss/internal/services/prompts"
 	"github.com/aiwuxian/project-abyss/internal/storage"
 )
 
+const configPath = "config.yml"
+
 func main() {
 	// 加载配置
-	config, err := loadConfig("config.yml")
+	config, err := services.LoadConfig(configPath)
 	if err != nil {
 		log.Fatalf("加载配置失败: %v", err)
 	}
 
 	// 初始化数据库
-	store, err := storage.New(config.Database.Path)
+	dbPath := config.Database.Path
+	if config.Database.InMemory {
+		dbPath = storage.MemoryPath
+		log.Println("⚠️ 使用内存数据库，服务重启后数据将丢失")
+	}
+	store, err := storage.New(dbPath)
 	if err != nil {
 		log.Fatalf("初始化数据库失败: %v", err)
 	}
@@ -30,17 +35,37 @@ func main() {
 
 	// 初始化服务
 	llmService := services.NewLLMService(config.LLM)
+	llmService.SetUsageRecorder(store)
+	promptStore, err := prompts.Load(config.LLM.PromptDir)
+	if err != nil {
+		log.Fatalf("加载提示词模板失败: %v", err)
+	}
+	llmService.SetPrompts(promptStore)
 	ruleEngine := services.NewRuleEngine()
-	metaService := services.NewMetaService(store, config.Game)
+	ruleEngine.SetRules(config.Rules)
+	metaService := services.NewMetaService(store, ruleEngine, config.Game)
 	worldService := services.NewWorldService(store, llmService)
 	storyService := services.NewStoryService(store, llmService, ruleEngine, metaService)
+	configService := services.NewConfigService(configPath, config, llmService, ruleEngine, metaService)
+	taskService := services.NewTaskService(store)
+	taskService.Start()
+	statsService := services.NewStatsService(store)
+	backupService := services.NewBackupService(store)
+	shareService := services.NewShareService(store)
 
 	// 初始化API处理器
-	handler := api.NewHandler(worldService, storyService, metaService, llmService)
+	handler := api.NewHandler(worldService, storyService, metaService, llmService, configService, taskService, statsService, backupService, shareService)
 
 	// 设置Gin路由
 	r := gin.Default()
 
+	// 请求体大小限制，需要大文本或上传文件的接口单独放宽
+	r.Use(api.BodyLimit(config.Server.BodyLimits, map[string]string{
+		"POST /api/worlds/parse":      api.BodyText,
+		"POST /api/worlds/:id/extend": api.BodyText,
+		"POST /api/admin/restore":     api.BodyUpload,
+	}))
+
 	// 静态文件
 	r.Static("/web", "./web")
 	r.GET("/", func(c *gin.Context) {
@@ -50,27 +75,92 @@ func main() {
 	// API路由
 	apiGroup := r.Group("/api")
 	{
+		// 服务状态
+		apiGroup.GET("/status", handler.GetStatus)
+
 		// 角色相关
 		apiGroup.POST("/characters", handler.CreateCharacter)
 		apiGroup.POST("/characters/generate", handler.GenerateCharacter)
 		apiGroup.GET("/characters", handler.ListCharacters)
 		apiGroup.GET("/characters/:id", handler.GetCharacter)
+		apiGroup.GET("/characters/:id/reputation", handler.GetReputation)
+		apiGroup.POST("/characters/:id/equip", handler.EquipItem)
+		apiGroup.POST("/characters/:id/unequip", handler.UnequipItem)
+		apiGroup.POST("/characters/:id/use-item", handler.UseItem)
+		apiGroup.POST("/characters/:id/train", handler.TrainAttribute)
+		apiGroup.GET("/characters/:id/active-stories", handler.ListActiveStories)
+		apiGroup.POST("/characters/:id/continue", handler.ContinueStory)
+
+		// 只读分享
+		apiGroup.POST("/share", handler.CreateShare)
+		apiGroup.GET("/share/:token", handler.GetShared)
+		apiGroup.DELETE("/share/:token", handler.RevokeShare)
 
 		// 世界相关
+		apiGroup.GET("/worlds", handler.ListWorlds)
 		apiGroup.POST("/worlds/parse", handler.ParseSegment)
+		apiGroup.DELETE("/worlds/:id", handler.DeleteWorld)
+		apiGroup.PUT("/worlds/:id/endings", handler.UpdateWorldEndings)
+		apiGroup.POST("/worlds/:id/regenerate-plotlines", handler.RegenerateWorldPlotLines)
+		apiGroup.POST("/worlds/:id/extend", handler.ExtendWorld)
+		apiGroup.GET("/worlds/:id/leaderboard", handler.GetWorldLeaderboard)
+		apiGroup.PUT("/worlds/:id/tags", handler.UpdateWorldTags)
+		apiGroup.PUT("/worlds/:id/rules", handler.UpdateWorldRules)
+		apiGroup.POST("/worlds/:id/cover-prompt", handler.GenerateWorldCoverPrompt)
+		apiGroup.PUT("/worlds/:id/cover", handler.UpdateWorldCover)
+		apiGroup.PUT("/worlds/:id/favorite", handler.SetWorldFavorite)
+		apiGroup.PUT("/worlds/:id/attribute-modifiers", handler.UpdateWorldAttributeModifiers)
+		apiGroup.PUT("/worlds/:id/universe", handler.SetWorldUniverse)
+		apiGroup.GET("/worlds/:id/scenes", handler.ListWorldScenes)
+		apiGroup.PUT("/scenes/:id/template", handler.SetSceneTemplate)
+
+		// 世界宇宙（同一部小说的多个世界）
+		apiGroup.GET("/universes", handler.ListUniverses)
+		apiGroup.POST("/universes", handler.CreateUniverse)
+		apiGroup.GET("/universes/:id", handler.GetUniverse)
+		apiGroup.DELETE("/universes/:id", handler.DeleteUniverse)
 
 		// 故事相关
 		apiGroup.POST("/stories/start", handler.StartStory)
 		apiGroup.GET("/stories/:id", handler.GetStory)
+		apiGroup.POST("/stories/:id/quick-choice", handler.ResolveQuickChoice)
+		apiGroup.POST("/stories/:id/auto-step", handler.AutoStep)
+		apiGroup.POST("/stories/:id/branch", handler.BranchStory)
+		apiGroup.PUT("/stories/:id/attribute-map", handler.SetStoryAttributeMap)
+		apiGroup.PUT("/stories/:id/notes", handler.SetStoryNotes)
+		apiGroup.POST("/stories/:id/set-plot", handler.DebugOnly(), handler.SetStoryPlot)
+		apiGroup.GET("/stories/:id/chapters", handler.ListChapters)
+		apiGroup.GET("/stories/:id/chapters/:index", handler.GetChapter)
+		apiGroup.GET("/stories/:id/dice-timeline", handler.GetDiceTimeline)
+		apiGroup.GET("/stories/:id/report", handler.GetStoryReport)
+		apiGroup.GET("/stories/:id/changelog", handler.GetChangeLog)
+		apiGroup.GET("/stories/:id/state-timeline", handler.GetStateTimeline)
+		apiGroup.GET("/stories/:id/romance", handler.GetRomance)
+		apiGroup.GET("/stories/:id/npc/:npcId/history", handler.GetNPCHistory)
+		apiGroup.GET("/stories/:id/search", handler.SearchNarrative)
 		apiGroup.POST("/stories/action", handler.TakeAction)
+		apiGroup.POST("/stories/action/stream", handler.TakeActionStream)
 		apiGroup.POST("/stories/undo", handler.UndoTurn)
 
+		// 异步任务
+		apiGroup.GET("/tasks/:id", handler.GetTask)
+
 		// 存档相关
 		apiGroup.POST("/saves", handler.SaveGame)
 		apiGroup.GET("/saves", handler.ListSaves)
 		apiGroup.POST("/saves/load", handler.LoadGame)
 	}
 
+	// 管理接口（需要 X-Admin-Token）
+	adminGroup := r.Group("/api/admin", handler.AdminAuth())
+	{
+		adminGroup.POST("/reload-config", handler.ReloadConfig)
+		adminGroup.GET("/stats", handler.AdminStats)
+		adminGroup.GET("/backup", handler.BackupDatabase)
+		adminGroup.POST("/restore", handler.PrepareRestore)
+		adminGroup.POST("/restore/confirm", handler.ConfirmRestore)
+	}
+
 	// 启动服务器
 	addr := fmt.Sprintf("%s:%s", config.Server.Host, config.Server.Port)
 	log.Printf("🎮 Project Abyss 启动成功！访问 http://localhost:%s", config.Server.Port)
@@ -80,17 +170,3 @@ func main() {
 		log.Fatalf("启动服务器失败: %v", err)
 	}
 }
-
-func loadConfig(path string) (*models.Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
-	var config models.Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, err
-	}
-
-	return &config, nil
-}
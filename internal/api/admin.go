@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth 管理接口鉴权：校验 X-Admin-Token 请求头，未配置令牌时拒绝所有管理请求
+func (h *Handler) AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := h.configService.AdminToken()
+		if token == "" {
+			respondError(c, http.StatusForbidden, ErrCodeForbidden, "未配置管理员令牌，管理接口已禁用")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Admin-Token")), []byte(token)) != 1 {
+			respondError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "管理员令牌错误")
+			return
+		}
+		c.Next()
+	}
+}
+
+// DebugOnly GM/调试工具接口只在调试模式（server.debug）下开放，否则返回 403
+func (h *Handler) DebugOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.configService.DebugMode() {
+			respondError(c, http.StatusForbidden, ErrCodeForbidden, "调试模式未开启，GM工具已禁用")
+			return
+		}
+		c.Next()
+	}
+}
+
+// ReloadConfig 重新加载配置文件
+func (h *Handler) ReloadConfig(c *gin.Context) {
+	result, err := h.configService.Reload()
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// AdminStats 获取运营统计（故事状态、世界类型分布、今日LLM用量）
+func (h *Handler) AdminStats(c *gin.Context) {
+	stats, err := h.statsService.AdminStats()
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// BackupDatabase 生成数据库的一致性快照并作为附件下载
+func (h *Handler) BackupDatabase(c *gin.Context) {
+	path, err := h.backupService.Backup()
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+
+	c.FileAttachment(path, filepath.Base(path))
+}
+
+// PrepareRestore 上传备份文件（表单字段 file），返回数据对比和确认令牌；此时不会修改数据
+func (h *Handler) PrepareRestore(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		respondBadRequest(c, "需要上传备份文件（表单字段 file）")
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		respondBadRequest(c, "读取备份文件失败")
+		return
+	}
+	defer file.Close()
+
+	preview, err := h.backupService.PrepareRestore(file)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// ConfirmRestore 用确认令牌执行恢复，当前数据会被备份中的数据覆盖
+func (h *Handler) ConfirmRestore(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	result, err := h.backupService.ConfirmRestore(req.Token)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
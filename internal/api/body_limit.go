@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// 请求体上限档位（按路由指定，未指定的路由使用普通档）
+const (
+	BodyText   = "text"   // 提交小说原文等大文本的接口
+	BodyUpload = "upload" // 上传备份文件
+)
+
+// bodyLimitKey 请求体读到超限时在 gin.Context 中记下的上限（字节）
+const bodyLimitKey = "body_limit_exceeded"
+
+// defaultBodyLimitConfig 请求体上限的默认值（KB）
+func defaultBodyLimitConfig() models.BodyLimitConfig {
+	return models.BodyLimitConfig{DefaultKB: 1024, TextKB: 8 * 1024, UploadKB: 512 * 1024}
+}
+
+// bodyLimitSettings 返回生效的请求体上限配置，未配置的项使用默认值
+func bodyLimitSettings(cfg models.BodyLimitConfig) models.BodyLimitConfig {
+	defaults := defaultBodyLimitConfig()
+	if cfg.DefaultKB == 0 {
+		cfg.DefaultKB = defaults.DefaultKB
+	}
+	if cfg.TextKB == 0 {
+		cfg.TextKB = defaults.TextKB
+	}
+	if cfg.UploadKB == 0 {
+		cfg.UploadKB = defaults.UploadKB
+	}
+	return cfg
+}
+
+// limitedBody 包装 http.MaxBytesReader，读到超限时在请求上下文中记下上限，
+// 使处理函数随后输出的参数错误改为 413
+type limitedBody struct {
+	io.ReadCloser
+	c     *gin.Context
+	limit int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		b.c.Set(bodyLimitKey, b.limit)
+	}
+	return n, err
+}
+
+// respondTooLarge 输出请求体过大
+func respondTooLarge(c *gin.Context, limit int64) {
+	respondError(c, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge,
+		fmt.Sprintf("请求体过大，上限为 %d KB", limit/1024))
+}
+
+// BodyLimit 限制请求体大小，防止超大请求撑爆内存：声明的 Content-Length 超限时直接返回 413，
+// 未声明长度的请求读到上限即停止，处理函数的参数错误随之改为 413。
+// routes 为需要更高上限的路由（"METHOD 完整路径" -> BodyText/BodyUpload），负数上限表示不限制
+func BodyLimit(cfg models.BodyLimitConfig, routes map[string]string) gin.HandlerFunc {
+	cfg = bodyLimitSettings(cfg)
+	return func(c *gin.Context) {
+		limitKB := cfg.DefaultKB
+		switch routes[c.Request.Method+" "+c.FullPath()] {
+		case BodyText:
+			limitKB = cfg.TextKB
+		case BodyUpload:
+			limitKB = cfg.UploadKB
+		}
+		if limitKB < 0 || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		limit := limitKB * 1024
+		if c.Request.ContentLength > limit {
+			respondTooLarge(c, limit)
+			return
+		}
+		c.Request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Request.Body, limit), c: c, limit: limit}
+		c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/aiwuxian/project-abyss/internal/services"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// 错误码（前端据此做差异化处理和国际化）
+const (
+	ErrCodeInvalidParams      = "INVALID_PARAMS"       // 请求参数错误
+	ErrCodeNotFound           = "NOT_FOUND"            // 资源不存在
+	ErrCodeUnauthorized       = "UNAUTHORIZED"         // 未授权（管理接口令牌错误）
+	ErrCodeForbidden          = "FORBIDDEN"            // 功能未开启或无权访问
+	ErrCodeLLMFailed          = "LLM_FAILED"           // LLM调用失败
+	ErrCodeLLMTimeout         = "LLM_TIMEOUT"          // LLM请求超时
+	ErrCodeLLMInvalidResponse = "LLM_INVALID_RESPONSE" // LLM返回内容无法解析
+	ErrCodeStoryEnded         = "STORY_ENDED"          // 故事已结束
+	ErrCodeVersionConflict    = "VERSION_CONFLICT"     // 数据已被其他请求更新，需刷新重试
+	ErrCodeInUse              = "IN_USE"               // 资源仍被其他数据引用，不能删除
+	ErrCodeNotEnoughXP        = "NOT_ENOUGH_XP"        // 经验值不足
+	ErrCodeUndoUnavailable    = "UNDO_UNAVAILABLE"     // 无法回退（没有历史或次数已用完）
+	ErrCodeConfirmRequired    = "CONFIRM_REQUIRED"     // 重大不可逆行动，需带 confirmed=true 重新提交
+	ErrCodeDataCorrupted      = "DATA_CORRUPTED"       // 存储的数据已损坏，需要管理员修复或从备份恢复
+	ErrCodePayloadTooLarge    = "PAYLOAD_TOO_LARGE"    // 请求体超过上限
+	ErrCodeInternal           = "INTERNAL_ERROR"       // 服务器内部错误
+)
+
+// ErrorResponse 统一的错误响应结构
+type ErrorResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// respondError 输出统一格式的错误响应
+func respondError(c *gin.Context, status int, code, message string, details ...interface{}) {
+	resp := ErrorResponse{
+		Code:    code,
+		Message: message,
+	}
+	if len(details) > 0 {
+		resp.Details = details[0]
+	}
+	c.AbortWithStatusJSON(status, resp)
+}
+
+// respondBadRequest 输出参数错误；参数读取失败是因为请求体超过上限时改为输出 413
+func respondBadRequest(c *gin.Context, message string) {
+	if limit := c.GetInt64(bodyLimitKey); limit > 0 {
+		respondTooLarge(c, limit)
+		return
+	}
+	respondError(c, http.StatusBadRequest, ErrCodeInvalidParams, message)
+}
+
+// respondServiceError 根据服务层返回的错误类别选择状态码和错误码，details 可附带额外信息
+func respondServiceError(c *gin.Context, err error, details ...interface{}) {
+	status, code := serviceErrorStatus(err)
+	respondError(c, status, code, err.Error(), details...)
+}
+
+// serviceErrorStatus 服务层错误对应的状态码和错误码（流式接口已经开始输出后只能用错误码通知前端）
+func serviceErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound, ErrCodeNotFound
+	case errors.Is(err, services.ErrForbidden):
+		return http.StatusForbidden, ErrCodeForbidden
+	case errors.Is(err, services.ErrInvalidInput):
+		return http.StatusBadRequest, ErrCodeInvalidParams
+	case errors.Is(err, storage.ErrVersionConflict):
+		return http.StatusConflict, ErrCodeVersionConflict
+	case errors.Is(err, storage.ErrInUse):
+		return http.StatusConflict, ErrCodeInUse
+	case errors.Is(err, services.ErrStoryEnded):
+		return http.StatusConflict, ErrCodeStoryEnded
+	case errors.Is(err, services.ErrNotEnoughXP):
+		return http.StatusConflict, ErrCodeNotEnoughXP
+	case errors.Is(err, services.ErrUndoUnavailable):
+		return http.StatusConflict, ErrCodeUndoUnavailable
+	case errors.Is(err, services.ErrConfirmRequired):
+		return http.StatusPreconditionRequired, ErrCodeConfirmRequired
+	case errors.Is(err, services.ErrLLMInvalidResponse):
+		return http.StatusBadGateway, ErrCodeLLMInvalidResponse
+	case errors.Is(err, services.ErrLLMTimeout):
+		return http.StatusGatewayTimeout, ErrCodeLLMTimeout
+	case errors.Is(err, services.ErrLLMUnavailable):
+		return http.StatusBadGateway, ErrCodeLLMFailed
+	case errors.Is(err, storage.ErrCorruptData):
+		log.Printf("⚠️ [数据损坏] %v\n", err)
+		return http.StatusInternalServerError, ErrCodeDataCorrupted
+	default:
+		log.Printf("❌ 请求处理失败: %v\n", err)
+		return http.StatusInternalServerError, ErrCodeInternal
+	}
+}
+
+// respondReadError 读取接口的错误处理：记录不存在返回404并提示资源名，
+// 其他错误（无权访问、数据库故障等）按 respondServiceError 的规则处理
+func respondReadError(c *gin.Context, err error, resource string) {
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, services.ErrNotFound) {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, resource+"不存在")
+		return
+	}
+	respondServiceError(c, err)
+}
@@ -1,8 +1,14 @@
 package api
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aiwuxian/project-abyss/internal/models"
 	"github.com/aiwuxian/project-abyss/internal/services"
@@ -14,28 +20,47 @@ type Handler struct {
 	storyService  *services.StoryService
 	metaService   *services.MetaService
 	llmService    *services.LLMService
+	configService *services.ConfigService
+	taskService   *services.TaskService
+	statsService  *services.StatsService
+	backupService *services.BackupService
+	shareService  *services.ShareService
 	defaultConfig models.LLMConfig
 }
 
 func NewHandler(worldService *services.WorldService, storyService *services.StoryService,
-	metaService *services.MetaService, llmService *services.LLMService) *Handler {
+	metaService *services.MetaService, llmService *services.LLMService, configService *services.ConfigService,
+	taskService *services.TaskService, statsService *services.StatsService, backupService *services.BackupService,
+	shareService *services.ShareService) *Handler {
 	return &Handler{
-		worldService: worldService,
-		storyService: storyService,
-		metaService:  metaService,
-		llmService:   llmService,
+		worldService:  worldService,
+		storyService:  storyService,
+		metaService:   metaService,
+		llmService:    llmService,
+		configService: configService,
+		taskService:   taskService,
+		statsService:  statsService,
+		backupService: backupService,
+		shareService:  shareService,
 	}
 }
 
+// GetStatus 获取服务状态：当前请求使用的LLM是否处于离线演示模式（前端据此标注"演示模式"）
+func (h *Handler) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"demo_mode": h.getCustomLLMService(c).DemoMode(),
+	})
+}
+
 // getCustomLLMService 从请求头获取自定义API配置并创建LLMService
 func (h *Handler) getCustomLLMService(c *gin.Context) *services.LLMService {
 	apiKey := c.GetHeader("X-Custom-API-Key")
 	apiBase := c.GetHeader("X-Custom-API-Base")
 	model := c.GetHeader("X-Custom-API-Model")
 
-	// 如果没有自定义配置，返回默认服务
+	// 如果没有自定义配置，使用默认服务
 	if apiKey == "" {
-		return h.llmService
+		return h.applyDebugOverride(c, h.llmService)
 	}
 
 	// 创建自定义配置
@@ -49,7 +74,34 @@ func (h *Handler) getCustomLLMService(c *gin.Context) *services.LLMService {
 	}
 
 	// 创建并返回新的LLMService实例
-	return services.NewLLMService(config)
+	return h.applyDebugOverride(c, h.llmService.WithConfig(config))
+}
+
+// applyDebugOverride 调试模式下按 X-Debug-Model / X-Debug-Temperature 请求头覆盖本次调用的模型和温度，
+// 非调试模式忽略这些请求头
+func (h *Handler) applyDebugOverride(c *gin.Context, llm *services.LLMService) *services.LLMService {
+	model := strings.TrimSpace(c.GetHeader("X-Debug-Model"))
+	rawTemp := strings.TrimSpace(c.GetHeader("X-Debug-Temperature"))
+	if (model == "" && rawTemp == "") || !h.configService.DebugMode() {
+		return llm
+	}
+
+	var temp *float32
+	if rawTemp != "" {
+		value, err := strconv.ParseFloat(rawTemp, 32)
+		if err != nil || value < 0 || value > 2 {
+			log.Printf("⚠️ [调试] 忽略无效的 X-Debug-Temperature: %s\n", rawTemp)
+		} else {
+			t := float32(value)
+			temp = &t
+		}
+	}
+	if model == "" && temp == nil {
+		return llm
+	}
+
+	log.Printf("🐞 [调试] %s %s 覆盖模型=%q 温度=%s\n", c.Request.Method, c.Request.URL.Path, model, rawTemp)
+	return llm.WithOverride(model, temp)
 }
 
 // CreateCharacter 创建角色（手动创建）
@@ -65,7 +117,7 @@ func (h *Handler) CreateCharacter(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		respondBadRequest(c, "参数错误")
 		return
 	}
 
@@ -81,7 +133,7 @@ func (h *Handler) CreateCharacter(c *gin.Context) {
 
 	char, err := h.metaService.CreateCharacter(char)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err)
 		return
 	}
 
@@ -89,34 +141,47 @@ func (h *Handler) CreateCharacter(c *gin.Context) {
 }
 
 // GenerateCharacter AI自动生成角色
+// 请求可带 request_id 作为幂等键：同一 request_id 已生成过角色时直接返回该角色，不会重复生成
 func (h *Handler) GenerateCharacter(c *gin.Context) {
 	var req struct {
-		Name   string `json:"name" binding:"required"`
-		Gender string `json:"gender" binding:"required"`
-		Age    int    `json:"age" binding:"required"`
-		Prompt string `json:"prompt"` // 可选的额外提示
+		Name      string `json:"name" binding:"required"`
+		Gender    string `json:"gender" binding:"required"`
+		Age       int    `json:"age" binding:"required"`
+		Prompt    string `json:"prompt"`     // 可选的额外提示
+		RequestID string `json:"request_id"` // 可选的幂等键，重试时保持不变
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	if char, ok := h.metaService.GeneratedCharacter(req.RequestID); ok {
+		c.JSON(http.StatusOK, char)
 		return
 	}
 
 	// 使用自定义LLM配置（如果有）
 	llmService := h.getCustomLLMService(c)
 
-	char, err := llmService.GenerateCharacter(c.Request.Context(), req.Name, req.Gender, req.Age, req.Prompt)
+	char, err := llmService.GenerateCharacter(c.Request.Context(), req.Name, req.Gender, req.Age, req.Prompt,
+		h.metaService.AttributeSettings())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// 回显原始输入，客户端可直接用相同内容重试
+		respondServiceError(c, err, gin.H{
+			"input":     req,
+			"retryable": true,
+		})
 		return
 	}
 
 	// 保存到数据库
 	char, err = h.metaService.CreateCharacter(char)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err, gin.H{"input": req})
 		return
 	}
+	h.metaService.RememberGeneratedCharacter(req.RequestID, char.ID)
 
 	c.JSON(http.StatusOK, char)
 }
@@ -127,22 +192,111 @@ func (h *Handler) GetCharacter(c *gin.Context) {
 
 	char, err := h.metaService.GetCharacter(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		respondReadError(c, err, "角色")
+		return
+	}
+	char.TraitGroups = services.GroupTraits(char.Traits)
+
+	c.JSON(http.StatusOK, char)
+}
+
+// EquipItem 装备背包中的道具
+func (h *Handler) EquipItem(c *gin.Context) {
+	var req struct {
+		ItemID string `json:"item_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "需要item_id参数")
+		return
+	}
+
+	char, err := h.metaService.EquipItem(c.Param("id"), req.ItemID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, char)
+}
+
+// UseItem 使用背包中的道具（消耗品、关键道具或装备），结果写入角色进行中的故事
+func (h *Handler) UseItem(c *gin.Context) {
+	var req struct {
+		ItemID string `json:"item_id" binding:"required"`
+		Target string `json:"target"` // 使用对象（可选）
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "需要item_id参数")
+		return
+	}
+
+	result, err := h.metaService.UseItem(c.Param("id"), req.ItemID, strings.TrimSpace(req.Target))
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// UnequipItem 卸下装备槽上的道具
+func (h *Handler) UnequipItem(c *gin.Context) {
+	var req struct {
+		Slot string `json:"slot" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "需要slot参数")
+		return
+	}
+
+	char, err := h.metaService.UnequipItem(c.Param("id"), req.Slot)
+	if err != nil {
+		respondServiceError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, char)
 }
 
-// ListCharacters 获取所有角色列表
+// GetReputation 获取角色在指定世界中的声望
+func (h *Handler) GetReputation(c *gin.Context) {
+	worldID := c.Query("world_id")
+	if worldID == "" {
+		respondBadRequest(c, "需要world_id参数")
+		return
+	}
+
+	state, err := h.metaService.GetCharacterState(c.Param("id"), worldID)
+	if err != nil {
+		respondReadError(c, err, "角色状态")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"character_id": state.CharacterID,
+		"world_id":     state.WorldID,
+		"reputation":   state.Reputation,
+		"title":        services.ReputationTitle(state.Reputation),
+	})
+}
+
+// ListCharacters 分页获取角色列表，支持 ?limit=&offset=
 func (h *Handler) ListCharacters(c *gin.Context) {
-	characters, err := h.metaService.GetAllCharacters()
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	characters, count, err := h.metaService.GetAllCharacters(page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, characters)
+	respondPage(c, "characters", characters, count, page)
 }
 
 // ParseSegment 解析小说段落，创建世界
@@ -152,7 +306,7 @@ func (h *Handler) ParseSegment(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "段落文本不能为空"})
+		respondBadRequest(c, "段落文本不能为空")
 		return
 	}
 
@@ -162,206 +316,1080 @@ func (h *Handler) ParseSegment(c *gin.Context) {
 	// 创建临时的worldService使用自定义LLM
 	worldService := services.NewWorldService(h.worldService.GetStorage(), llmService)
 
+	// 异步模式：立即返回任务ID，客户端通过 GET /api/tasks/:id 轮询结果
+	if c.Query("async") == "true" {
+		task, err := h.taskService.Submit("parse_segment", func(ctx context.Context) (interface{}, error) {
+			return worldService.CreateWorldFromSegment(ctx, req.SegmentText)
+		})
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"task_id": task.ID, "status": task.Status})
+		return
+	}
+
 	world, err := worldService.CreateWorldFromSegment(c.Request.Context(), req.SegmentText)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, world)
 }
 
-// StartStory 开始新故事
-func (h *Handler) StartStory(c *gin.Context) {
+// GetTask 查询异步任务状态与结果
+func (h *Handler) GetTask(c *gin.Context) {
+	task, err := h.taskService.GetTask(c.Param("id"))
+	if err != nil {
+		respondReadError(c, err, "任务")
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+// UpdateWorldEndings 设置世界的条件结局
+func (h *Handler) UpdateWorldEndings(c *gin.Context) {
 	var req struct {
-		CharacterID string `json:"character_id" binding:"required"`
-		WorldID     string `json:"world_id" binding:"required"`
+		Endings []models.EndingDef `json:"endings"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		respondBadRequest(c, "参数错误")
 		return
 	}
 
-	// 使用自定义LLM配置（如果有）
-	llmService := h.getCustomLLMService(c)
+	world, err := h.worldService.UpdateEndings(c.Param("id"), req.Endings)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
 
-	// 创建临时的storyService使用自定义LLM
-	storage, ruleEngine, metaService := h.storyService.GetDependencies()
-	storyService := services.NewStoryService(storage, llmService, ruleEngine, metaService)
+	c.JSON(http.StatusOK, world)
+}
 
-	story, scene, err := storyService.StartStory(c.Request.Context(), req.CharacterID, req.WorldID)
+// RegenerateWorldPlotLines 基于原始段落和现有NPC重新生成世界的剧情线，其他信息不变
+func (h *Handler) RegenerateWorldPlotLines(c *gin.Context) {
+	// 使用自定义LLM配置（如果有）
+	worldService := services.NewWorldService(h.worldService.GetStorage(), h.getCustomLLMService(c))
+
+	world, err := worldService.RegeneratePlotLines(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		log.Printf("❌ StartStory失败: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondReadError(c, err, "世界")
 		return
 	}
 
-	log.Printf("✅ Story创建成功, ID: %s\n", story.ID)
+	c.JSON(http.StatusOK, world)
+}
 
-	// 获取角色状态
-	charState, err := h.metaService.GetCharacterState(req.CharacterID, req.WorldID)
-	if err != nil {
-		log.Printf("❌ GetCharacterState失败: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色状态失败: " + err.Error()})
+// ExtendWorld 解析小说后续段落，把新NPC和剧情节点追加到已有世界
+func (h *Handler) ExtendWorld(c *gin.Context) {
+	var req struct {
+		SegmentText string `json:"segment_text" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "段落文本不能为空")
 		return
 	}
 
-	if charState == nil {
-		log.Println("❌ charState为nil")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "角色状态不存在"})
+	// 使用自定义LLM配置（如果有）
+	worldService := services.NewWorldService(h.worldService.GetStorage(), h.getCustomLLMService(c))
+
+	world, err := worldService.ExtendWorld(c.Request.Context(), c.Param("id"), req.SegmentText)
+	if err != nil {
+		respondReadError(c, err, "世界")
 		return
 	}
 
-	log.Printf("✅ 角色状态获取成功, HP: %d, SAN: %d\n", charState.HP, charState.SAN)
+	c.JSON(http.StatusOK, world)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"story":      story,
-		"scene":      scene,
-		"char_state": charState,
-	})
+// GenerateWorldCoverPrompt 让AI生成世界的封面绘图提示词和主题色
+func (h *Handler) GenerateWorldCoverPrompt(c *gin.Context) {
+	// 使用自定义LLM配置（如果有）
+	worldService := services.NewWorldService(h.worldService.GetStorage(), h.getCustomLLMService(c))
+
+	world, err := worldService.GenerateCoverPrompt(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondReadError(c, err, "世界")
+		return
+	}
+
+	c.JSON(http.StatusOK, world)
 }
 
-// TakeAction 执行行动
-func (h *Handler) TakeAction(c *gin.Context) {
+// UpdateWorldCover 回填外部生成的封面地址和主题色
+func (h *Handler) UpdateWorldCover(c *gin.Context) {
 	var req struct {
-		StoryID string        `json:"story_id" binding:"required"`
-		Action  models.Action `json:"action" binding:"required"`
+		CoverURL   string `json:"cover_url"`
+		ThemeColor string `json:"theme_color"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		respondBadRequest(c, "参数错误")
 		return
 	}
 
-	// 使用自定义LLM配置（如果有）
-	llmService := h.getCustomLLMService(c)
+	world, err := h.worldService.UpdateCover(c.Param("id"), req.CoverURL, req.ThemeColor)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
 
-	// 创建临时的storyService使用自定义LLM
-	storage, ruleEngine, metaService := h.storyService.GetDependencies()
-	storyService := services.NewStoryService(storage, llmService, ruleEngine, metaService)
+	c.JSON(http.StatusOK, world)
+}
+
+// ListWorlds 分页获取世界列表，支持 ?tag=xxx 按标签过滤、?favorite=true 只看收藏、?universe_id=xxx 只看某个宇宙
+func (h *Handler) ListWorlds(c *gin.Context) {
+	filter := models.WorldFilter{
+		Tag:          c.Query("tag"),
+		FavoriteOnly: c.Query("favorite") == "true",
+		UniverseID:   c.Query("universe_id"),
+	}
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
 
-	result, err := storyService.ProcessAction(c.Request.Context(), req.StoryID, req.Action)
+	worlds, count, err := h.worldService.ListWorlds(filter, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err)
 		return
 	}
 
-	// 获取更新后的故事状态
-	story, _ := storyService.GetStory(req.StoryID)
+	respondPage(c, "worlds", worlds, count, page)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"result": result,
-		"story":  story,
-	})
+// DeleteWorld 删除世界（世界中还有故事时返回409）
+func (h *Handler) DeleteWorld(c *gin.Context) {
+	if err := h.worldService.DeleteWorld(c.Param("id")); err != nil {
+		respondReadError(c, err, "世界")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "世界已删除"})
 }
 
-// GetStory 获取故事状态
-func (h *Handler) GetStory(c *gin.Context) {
-	id := c.Param("id")
+// ListWorldScenes 列出世界中已生成的场景，?template=true 时只列出场景库中可复用的场景
+func (h *Handler) ListWorldScenes(c *gin.Context) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
 
-	story, err := h.storyService.GetStory(id)
+	scenes, count, err := h.worldService.ListScenes(c.Param("id"), c.Query("template") == "true", page)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "故事不存在"})
+		respondReadError(c, err, "世界")
 		return
 	}
 
-	// 获取场景和角色状态
-	scene, _ := h.worldService.GetWorld(story.WorldID)
-	charState, _ := h.metaService.GetCharacterState(story.CharacterID, story.WorldID)
+	respondPage(c, "scenes", scenes, count, page)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"story":      story,
-		"world":      scene,
-		"char_state": charState,
-	})
+// SetSceneTemplate 把场景收入或移出世界场景库
+func (h *Handler) SetSceneTemplate(c *gin.Context) {
+	var req struct {
+		IsTemplate bool `json:"is_template"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	scene, err := h.worldService.SetSceneTemplate(c.Param("id"), req.IsTemplate)
+	if err != nil {
+		respondReadError(c, err, "场景")
+		return
+	}
+
+	c.JSON(http.StatusOK, scene)
 }
 
-// UndoTurn 回退到上一个回合
-func (h *Handler) UndoTurn(c *gin.Context) {
+// UpdateWorldTags 设置世界标签
+func (h *Handler) UpdateWorldTags(c *gin.Context) {
 	var req struct {
-		StoryID string `json:"story_id" binding:"required"`
+		Tags []string `json:"tags"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		respondBadRequest(c, "参数错误")
 		return
 	}
 
-	story, err := h.storyService.UndoTurn(req.StoryID)
+	world, err := h.worldService.UpdateTags(c.Param("id"), req.Tags)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err)
 		return
 	}
 
-	// 获取更新后的角色状态
-	charState, _ := h.metaService.GetCharacterState(story.CharacterID, story.WorldID)
+	c.JSON(http.StatusOK, world)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"story":      story,
-		"char_state": charState,
-	})
+// UpdateWorldRules 替换世界的禁忌规则
+func (h *Handler) UpdateWorldRules(c *gin.Context) {
+	var req struct {
+		Rules []string `json:"rules"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	world, err := h.worldService.UpdateRules(c.Param("id"), req.Rules)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, world)
 }
 
-// SaveGame 保存游戏
-func (h *Handler) SaveGame(c *gin.Context) {
+// UpdateWorldAttributeModifiers 设置世界自定义属性加成
+func (h *Handler) UpdateWorldAttributeModifiers(c *gin.Context) {
 	var req struct {
-		StoryID     string `json:"story_id" binding:"required"`
-		Name        string `json:"name" binding:"required"`
-		Description string `json:"description"`
+		AttributeModifiers map[string]int `json:"attribute_modifiers"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		respondBadRequest(c, "参数错误")
 		return
 	}
 
-	save, err := h.storyService.CreateSaveGame(req.StoryID, req.Name, req.Description)
+	world, err := h.worldService.UpdateAttributeModifiers(c.Param("id"), req.AttributeModifiers)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, save)
+	c.JSON(http.StatusOK, world)
 }
 
-// ListSaves 列出存档
-func (h *Handler) ListSaves(c *gin.Context) {
-	characterID := c.Query("character_id")
-	if characterID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "需要character_id参数"})
+// SetWorldFavorite 收藏或取消收藏世界
+func (h *Handler) SetWorldFavorite(c *gin.Context) {
+	var req struct {
+		Favorite bool `json:"favorite"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
 		return
 	}
 
-	saves, err := h.storyService.ListSaveGames(characterID)
+	world, err := h.worldService.SetFavorite(c.Param("id"), req.Favorite)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"saves": saves})
+	c.JSON(http.StatusOK, world)
 }
 
-// LoadGame 读取存档
-func (h *Handler) LoadGame(c *gin.Context) {
+// SetWorldUniverse 把世界归入宇宙，universe_id 为空时移出所属宇宙
+func (h *Handler) SetWorldUniverse(c *gin.Context) {
 	var req struct {
-		StoryID string `json:"story_id" binding:"required"`
+		UniverseID string `json:"universe_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		respondBadRequest(c, "参数错误")
 		return
 	}
 
-	story, scene, charState, err := h.storyService.LoadStory(c.Request.Context(), req.StoryID)
+	world, err := h.worldService.SetWorldUniverse(c.Param("id"), req.UniverseID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"story":      story,
-		"scene":      scene,
-		"char_state": charState,
-	})
+	c.JSON(http.StatusOK, world)
+}
+
+// CreateUniverse 创建世界宇宙
+func (h *Handler) CreateUniverse(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	universe, err := h.worldService.CreateUniverse(req.Name, req.Description)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, universe)
+}
+
+// ListUniverses 分页获取宇宙列表（宇宙中的世界用 GET /api/worlds?universe_id= 查询）
+func (h *Handler) ListUniverses(c *gin.Context) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	universes, count, err := h.worldService.ListUniverses(page)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	respondPage(c, "universes", universes, count, page)
+}
+
+// GetUniverse 获取宇宙信息
+func (h *Handler) GetUniverse(c *gin.Context) {
+	universe, err := h.worldService.GetUniverse(c.Param("id"))
+	if err != nil {
+		respondReadError(c, err, "宇宙")
+		return
+	}
+
+	c.JSON(http.StatusOK, universe)
+}
+
+// DeleteUniverse 删除宇宙，归属的世界变回独立世界
+func (h *Handler) DeleteUniverse(c *gin.Context) {
+	if err := h.worldService.DeleteUniverse(c.Param("id")); err != nil {
+		respondReadError(c, err, "宇宙")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "宇宙已删除"})
+}
+
+// StartStory 开始新故事
+func (h *Handler) StartStory(c *gin.Context) {
+	var req struct {
+		CharacterID string `json:"character_id" binding:"required"`
+		WorldID     string `json:"world_id" binding:"required"`
+		NewGamePlus bool   `json:"new_game_plus"` // 对已通关的世界开启周目+
+		SceneID     string `json:"scene_id"`      // 从世界场景库中的场景起步（可选）
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	// 使用自定义LLM配置（如果有）
+	llmService := h.getCustomLLMService(c)
+
+	// 创建临时的storyService使用自定义LLM
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, llmService, ruleEngine, metaService)
+
+	story, scene, err := storyService.StartStory(c.Request.Context(), req.CharacterID, req.WorldID, req.NewGamePlus, req.SceneID)
+	if err != nil {
+		log.Printf("❌ StartStory失败: %v\n", err)
+		respondServiceError(c, err)
+		return
+	}
+
+	log.Printf("✅ Story创建成功, ID: %s\n", story.ID)
+
+	// 获取角色状态
+	charState, err := h.metaService.GetCharacterState(req.CharacterID, req.WorldID)
+	if err != nil {
+		log.Printf("❌ GetCharacterState失败: %v\n", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "获取角色状态失败: "+err.Error())
+		return
+	}
+
+	if charState == nil {
+		log.Println("❌ charState为nil")
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "角色状态不存在")
+		return
+	}
+
+	log.Printf("✅ 角色状态获取成功, HP: %d, SAN: %d\n", charState.HP, charState.SAN)
+
+	c.JSON(http.StatusOK, gin.H{
+		"story":      story,
+		"scene":      scene,
+		"char_state": charState,
+	})
+}
+
+// TakeAction 执行行动
+func (h *Handler) TakeAction(c *gin.Context) {
+	var req struct {
+		StoryID   string        `json:"story_id" binding:"required"`
+		Action    models.Action `json:"action" binding:"required"`
+		Version   int           `json:"version"`   // 客户端已知的故事版本（乐观锁，必填）
+		Confirmed bool          `json:"confirmed"` // 玩家已确认执行重大不可逆行动
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+	req.Action.Confirmed = req.Confirmed
+
+	// 使用自定义LLM配置（如果有）
+	llmService := h.getCustomLLMService(c)
+
+	// 创建临时的storyService使用自定义LLM
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, llmService, ruleEngine, metaService)
+
+	result, err := storyService.ProcessAction(c.Request.Context(), req.StoryID, req.Action, req.Version)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	// 获取更新后的故事状态
+	story, _ := storyService.GetStory(req.StoryID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+		"story":  story,
+	})
+}
+
+// actionOutcome 流式行动处理结束后的结果
+type actionOutcome struct {
+	result *models.ActionResult
+	err    error
+}
+
+// TakeActionStream 执行行动，叙事以 Server-Sent Events 流式返回：
+// 生成过程中逐段发送 delta 事件（{"text": 片段}，未经清洗，仅用于即时显示），
+// 处理完成后发送 result 事件（与 TakeAction 的响应相同，叙事以其中为准），出错时发送 error 事件。
+// 开始输出之前就失败的请求（参数错误、版本冲突等）按普通接口返回错误。
+// 客户端中途断开时停止推送，但行动照常处理完并保存
+func (h *Handler) TakeActionStream(c *gin.Context) {
+	var req struct {
+		StoryID   string        `json:"story_id" binding:"required"`
+		Action    models.Action `json:"action" binding:"required"`
+		Version   int           `json:"version"`   // 客户端已知的故事版本（乐观锁，必填）
+		Confirmed bool          `json:"confirmed"` // 玩家已确认执行重大不可逆行动
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+	req.Action.Confirmed = req.Confirmed
+
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, h.getCustomLLMService(c), ruleEngine, metaService)
+
+	deltas := make(chan string, 16)
+	done := make(chan actionOutcome, 1)
+	// 处理过程不随请求取消：客户端断开后仍要把这一回合完整保存
+	processCtx := context.WithoutCancel(c.Request.Context())
+	go func() {
+		result, err := storyService.ProcessActionStream(processCtx, req.StoryID, req.Action, req.Version, deltas)
+		done <- actionOutcome{result: result, err: err}
+	}()
+
+	clientGone := c.Request.Context().Done()
+	abandon := func() {
+		log.Printf("🔌 [流式叙事] 客户端已断开，故事 %s 的行动继续在后台处理\n", req.StoryID)
+		go func() {
+			for range deltas {
+			}
+		}()
+	}
+
+	// 等到第一段叙事再开始输出，在此之前出错仍可返回普通的错误响应
+	var first string
+	var finished *actionOutcome
+	select {
+	case delta, ok := <-deltas:
+		if !ok {
+			outcome := <-done
+			if outcome.err != nil {
+				respondServiceError(c, outcome.err)
+				return
+			}
+			finished = &outcome
+		}
+		first = delta
+	case <-clientGone:
+		abandon()
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	send := func(event string, data interface{}) {
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+	if first != "" {
+		send("delta", gin.H{"text": first})
+	}
+
+	for streaming := finished == nil; streaming; {
+		select {
+		case delta, ok := <-deltas:
+			if !ok {
+				streaming = false
+				continue
+			}
+			send("delta", gin.H{"text": delta})
+		case <-clientGone:
+			abandon()
+			return
+		}
+	}
+
+	if finished == nil {
+		outcome := <-done
+		finished = &outcome
+	}
+	if finished.err != nil {
+		status, code := serviceErrorStatus(finished.err)
+		log.Printf("❌ [流式叙事] 行动处理失败（%d）: %v\n", status, finished.err)
+		send("error", ErrorResponse{Code: code, Message: finished.err.Error()})
+		return
+	}
+
+	story, _ := storyService.GetStory(req.StoryID)
+	send("result", gin.H{
+		"result": finished.result,
+		"story":  story,
+	})
+}
+
+// AutoStep 自动模式：由AI替角色选择行动，连续推进 steps 回合（默认1）
+func (h *Handler) AutoStep(c *gin.Context) {
+	storyID := c.Param("id")
+	steps := 1
+	if raw := c.Query("steps"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			respondBadRequest(c, "steps 参数错误")
+			return
+		}
+		steps = n
+	}
+
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, h.getCustomLLMService(c), ruleEngine, metaService)
+
+	results, err := storyService.AutoStep(c.Request.Context(), storyID, steps)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	story, _ := storyService.GetStory(storyID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"steps": results,
+		"story": story,
+	})
+}
+
+// GetStoryReport 生成故事战报，?format=markdown 时以 Markdown 文件导出
+func (h *Handler) GetStoryReport(c *gin.Context) {
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, h.getCustomLLMService(c), ruleEngine, metaService)
+
+	report, err := storyService.GenerateReport(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondReadError(c, err, "故事")
+		return
+	}
+
+	if c.Query("format") == "markdown" {
+		c.Header("Content-Disposition", `attachment; filename="report-`+report.StoryID+`.md"`)
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(services.RenderReportMarkdown(report)))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ResolveQuickChoice 回答叙事中的快速选择
+func (h *Handler) ResolveQuickChoice(c *gin.Context) {
+	var req struct {
+		ChoiceID string `json:"choice_id" binding:"required"`
+		Option   int    `json:"option"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	// 使用自定义LLM配置（如果有）
+	llmService := h.getCustomLLMService(c)
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, llmService, ruleEngine, metaService)
+
+	story, err := storyService.ResolveQuickChoice(c.Request.Context(), c.Param("id"), req.ChoiceID, req.Option)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"story": story})
+}
+
+// GetStory 获取故事状态
+func (h *Handler) GetStory(c *gin.Context) {
+	id := c.Param("id")
+
+	story, err := h.storyService.GetStory(id)
+	if err != nil {
+		respondReadError(c, err, "故事")
+		return
+	}
+
+	// 获取当前场景（前端渲染必需，缺失时报错）
+	scene, err := h.worldService.GetScene(story.SceneID)
+	if err != nil {
+		respondReadError(c, err, "故事的当前场景")
+		return
+	}
+
+	// 获取世界和角色状态（关联记录缺失时返回空，数据库故障时报错）
+	world, err := h.worldService.GetWorld(story.WorldID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondServiceError(c, err)
+		return
+	}
+	charState, err := h.metaService.GetCharacterState(story.CharacterID, story.WorldID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"story":      story,
+		"scene":      scene,
+		"world":      world,
+		"char_state": charState,
+	})
+}
+
+// SetStoryAttributeMap 设置故事的自定义检定属性映射
+func (h *Handler) SetStoryAttributeMap(c *gin.Context) {
+	var req struct {
+		AttributeMap map[string]string `json:"attribute_map"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	story, err := h.storyService.SetAttributeMap(c.Param("id"), req.AttributeMap)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"story": story})
+}
+
+// SetStoryNotes 保存玩家在故事上的私人备注
+func (h *Handler) SetStoryNotes(c *gin.Context) {
+	var req struct {
+		Notes string `json:"notes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	story, err := h.storyService.SetNotes(c.Param("id"), req.Notes)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"story": story})
+}
+
+// SetStoryPlot GM工具：直接设置故事的剧情节点和推进度，可选生成对应节点的新场景
+func (h *Handler) SetStoryPlot(c *gin.Context) {
+	var req struct {
+		PlotNodeID    string  `json:"plot_node_id" binding:"required"`
+		PlotProgress  float64 `json:"plot_progress"`
+		GenerateScene bool    `json:"generate_scene"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, h.getCustomLLMService(c), ruleEngine, metaService)
+
+	loaded, err := storyService.SetPlot(c.Request.Context(), c.Param("id"), req.PlotNodeID, req.PlotProgress, req.GenerateScene)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, loaded)
+}
+
+// ListChapters 获取故事章节列表
+func (h *Handler) ListChapters(c *gin.Context) {
+	chapters, err := h.storyService.GetChapters(c.Param("id"))
+	if err != nil {
+		respondReadError(c, err, "故事")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chapters": chapters})
+}
+
+// GetDiceTimeline 获取故事的检定历史，供前端绘制运势曲线，?limit=N 只取最近N次
+func (h *Handler) GetDiceTimeline(c *gin.Context) {
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			respondBadRequest(c, "limit必须是非负整数")
+			return
+		}
+		limit = value
+	}
+
+	points, err := h.storyService.GetDiceTimeline(c.Param("id"), limit)
+	if err != nil {
+		respondReadError(c, err, "故事")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"timeline": points})
+}
+
+// GetChapter 获取章节内容
+func (h *Handler) GetChapter(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		respondBadRequest(c, "章节序号必须是数字")
+		return
+	}
+
+	chapter, narrative, err := h.storyService.GetChapter(c.Param("id"), index)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"chapter":   chapter,
+		"narrative": narrative,
+	})
+}
+
+// UndoTurn 回退到上一个回合
+func (h *Handler) UndoTurn(c *gin.Context) {
+	var req struct {
+		StoryID string `json:"story_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	story, err := h.storyService.UndoTurn(req.StoryID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	// 获取更新后的角色状态
+	charState, _ := h.metaService.GetCharacterState(story.CharacterID, story.WorldID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"story":      story,
+		"char_state": charState,
+		"undo":       h.storyService.UndoStatus(story),
+	})
+}
+
+// SaveGame 保存游戏
+func (h *Handler) SaveGame(c *gin.Context) {
+	var req struct {
+		StoryID     string `json:"story_id" binding:"required"`
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	save, err := h.storyService.CreateSaveGame(req.StoryID, req.Name, req.Description)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, save)
+}
+
+// ListSaves 列出存档
+func (h *Handler) ListSaves(c *gin.Context) {
+	characterID := c.Query("character_id")
+	if characterID == "" {
+		respondBadRequest(c, "需要character_id参数")
+		return
+	}
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	saves, count, err := h.storyService.ListSaveGames(characterID, page)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	respondPage(c, "saves", saves, count, page)
+}
+
+// BranchStory 从存档所在回合分叉出一条新故事（?from_save=存档ID），原故事保留
+func (h *Handler) BranchStory(c *gin.Context) {
+	saveID := c.Query("from_save")
+	if saveID == "" {
+		respondBadRequest(c, "缺少 from_save 参数")
+		return
+	}
+
+	story, charState, err := h.storyService.BranchStory(c.Param("id"), saveID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"story":      story,
+		"char_state": charState,
+	})
+}
+
+// LoadGame 读取存档
+func (h *Handler) LoadGame(c *gin.Context) {
+	var req struct {
+		StoryID string `json:"story_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	// 读档时重新生成选项，使用自定义LLM配置（如果有）
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, h.getCustomLLMService(c), ruleEngine, metaService)
+
+	loaded, err := storyService.LoadStory(c.Request.Context(), req.StoryID)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, loaded)
+}
+
+// GetChangeLog 获取故事每回合的状态变更日志（最新的在前），支持 ?limit=&offset=
+func (h *Handler) GetChangeLog(c *gin.Context) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	entries, count, err := h.storyService.GetChangeLog(c.Param("id"), page)
+	if err != nil {
+		respondReadError(c, err, "故事")
+		return
+	}
+
+	respondPage(c, "changelog", entries, count, page)
+}
+
+// SearchNarrative 全文搜索故事的叙事日志（?q=关键词），支持 ?limit=&offset=
+func (h *Handler) SearchNarrative(c *gin.Context) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	matches, count, err := h.storyService.SearchNarrative(c.Param("id"), c.Query("q"), page)
+	if err != nil {
+		respondReadError(c, err, "故事")
+		return
+	}
+
+	respondPage(c, "matches", matches, count, page)
+}
+
+// GetStateTimeline 获取故事每回合结算后的角色状态轨迹（HP/SAN/属性/好感总和），用于观测数值平衡
+func (h *Handler) GetStateTimeline(c *gin.Context) {
+	points, err := h.storyService.GetStateTimeline(c.Param("id"))
+	if err != nil {
+		respondReadError(c, err, "故事")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"timeline": points})
+}
+
+// GetRomance 获取故事中每个可攻略NPC的当前攻略阶段
+func (h *Handler) GetRomance(c *gin.Context) {
+	statuses, err := h.storyService.RomanceStatus(c.Param("id"))
+	if err != nil {
+		respondReadError(c, err, "故事")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"romance": statuses})
+}
+
+// GetNPCHistory 获取玩家与某个NPC的互动档案：好感度、攻略阶段和涉及该NPC的全部叙事
+func (h *Handler) GetNPCHistory(c *gin.Context) {
+	history, err := h.storyService.NPCHistory(c.Param("id"), c.Param("npcId"))
+	if err != nil {
+		respondReadError(c, err, "故事或NPC")
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// TrainAttribute 消耗经验值训练角色的一项基础属性
+func (h *Handler) TrainAttribute(c *gin.Context) {
+	var req struct {
+		Attribute string `json:"attribute" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	result, err := h.metaService.TrainAttribute(c.Param("id"), req.Attribute)
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// CreateShare 为角色或世界生成只读分享链接，expires_in_hours 为0表示永不过期
+func (h *Handler) CreateShare(c *gin.Context) {
+	var req struct {
+		ResourceType   string `json:"resource_type" binding:"required"`
+		ResourceID     string `json:"resource_id" binding:"required"`
+		ExpiresInHours int    `json:"expires_in_hours"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	share, err := h.shareService.CreateShare(req.ResourceType, req.ResourceID, time.Duration(req.ExpiresInHours)*time.Hour)
+	if err != nil {
+		respondReadError(c, err, "分享的资源")
+		return
+	}
+
+	c.JSON(http.StatusOK, share)
+}
+
+// GetShared 通过分享令牌只读查看角色或世界，无需鉴权
+func (h *Handler) GetShared(c *gin.Context) {
+	shared, err := h.shareService.GetShared(c.Param("token"))
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, shared)
+}
+
+// RevokeShare 撤销分享链接，需要通过 ?resource_id= 提供被分享资源的ID
+func (h *Handler) RevokeShare(c *gin.Context) {
+	if err := h.shareService.RevokeShare(c.Param("token"), c.Query("resource_id")); err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "分享已撤销"})
+}
+
+// GetWorldLeaderboard 获取世界的通关排行榜（按回合数升序），支持 ?limit=&offset=
+func (h *Handler) GetWorldLeaderboard(c *gin.Context) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	clears, count, err := h.storyService.WorldLeaderboard(c.Param("id"), page)
+	if err != nil {
+		respondReadError(c, err, "世界")
+		return
+	}
+
+	respondPage(c, "leaderboard", clears, count, page)
+}
+
+// ListActiveStories 列出角色在各个世界中进行中的故事
+func (h *Handler) ListActiveStories(c *gin.Context) {
+	stories, err := h.storyService.ActiveStories(c.Param("id"))
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stories": stories})
+}
+
+// ContinueStory 继续角色在指定世界中的故事；未指定世界且有多条进行中的故事时，在 details 中返回可选的故事
+func (h *Handler) ContinueStory(c *gin.Context) {
+	var req struct {
+		WorldID string `json:"world_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBadRequest(c, "参数错误")
+		return
+	}
+
+	// 继续时重新生成选项，使用自定义LLM配置（如果有）
+	storage, ruleEngine, metaService := h.storyService.GetDependencies()
+	storyService := services.NewStoryService(storage, h.getCustomLLMService(c), ruleEngine, metaService)
+
+	characterID := c.Param("id")
+	loaded, err := storyService.ContinueStory(c.Request.Context(), characterID, req.WorldID)
+	if errors.Is(err, services.ErrInvalidInput) {
+		stories, _ := h.storyService.ActiveStories(characterID)
+		respondServiceError(c, err, gin.H{"stories": stories})
+		return
+	}
+	if err != nil {
+		respondServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, loaded)
 }
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// parsePage 读取 ?limit=&offset= 分页参数，格式错误时直接输出参数错误并返回 false
+func parsePage(c *gin.Context) (models.Page, bool) {
+	var page models.Page
+	for _, param := range []struct {
+		name string
+		dest *int
+	}{
+		{"limit", &page.Limit},
+		{"offset", &page.Offset},
+	} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			respondBadRequest(c, param.name+"必须是非负整数")
+			return page, false
+		}
+		*param.dest = value
+	}
+	return storage.NormalizePage(page), true
+}
+
+// respondPage 输出统一格式的分页列表；本页有因数据损坏跳过的记录时附带 corrupt 条数
+func respondPage(c *gin.Context, key string, items interface{}, count models.ListCount, page models.Page) {
+	body := gin.H{
+		key:      items,
+		"total":  count.Total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+	}
+	if count.Corrupt > 0 {
+		body["corrupt"] = count.Corrupt
+	}
+	c.JSON(http.StatusOK, body)
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// allActions 表示状态禁止所有行动
+const allActions = "*"
+
+// statusRestriction 状态对行动的限制
+type statusRestriction struct {
+	Blocked []string // 被禁止的行动类型（allActions 表示全部）
+	Allowed []string // 只允许的行动类型（为空表示不限制），用于危机阶段
+	Recover bool     // 是否为短暂失能：耗掉一个无法行动的回合后自动解除
+}
+
+// statusRestrictions 角色状态 -> 行动限制
+var statusRestrictions = map[string]statusRestriction{
+	"眩晕": {Blocked: []string{allActions}, Recover: true},
+	"昏迷": {Blocked: []string{allActions}, Recover: true},
+	"麻痹": {Blocked: []string{"attack", "move", "sneak", "help", "touch"}, Recover: true},
+	"束缚": {Blocked: []string{"attack", "move", "sneak", "touch"}},
+	"沉默": {Blocked: []string{"talk", "persuade", "flirt", "seduce"}},
+	"失明": {Blocked: []string{"observe", "investigate", "study"}},
+	"恐惧": {Blocked: []string{"attack"}},
+	// 危机阶段：HP/SAN过低时自动进入，回升后解除（见 crisis.go）
+	statusDying:    {Allowed: []string{actionStruggle, actionCallHelp, "talk", "move"}},
+	statusPanicked: {Allowed: []string{actionStruggle, actionCallHelp, "talk", "move", "observe"}},
+}
+
+// actionTypeNames 行动类型的中文名（用于无法行动的提示）
+var actionTypeNames = map[string]string{
+	"attack":      "攻击",
+	"move":        "移动",
+	"sneak":       "潜行",
+	"help":        "帮助他人",
+	"touch":       "触碰",
+	"talk":        "交谈",
+	"persuade":    "说服",
+	"flirt":       "调情",
+	"seduce":      "诱惑",
+	"observe":     "观察",
+	"investigate": "调查",
+	"study":       "研究",
+	"work":        "工作",
+	"date":        "约会",
+	"struggle":    "挣扎",
+	"call_help":   "求救",
+}
+
+// actionBlockReason 检查角色当前状态是否允许该行动，返回不允许的原因（允许时为空）。
+// fatal 为 true 表示角色已倒下或理智崩溃，场景应当结束
+func actionBlockReason(charState *models.CharacterState, action models.Action) (reason string, fatal bool) {
+	if charState.HP <= 0 {
+		return "你已经倒下了，再也站不起来", true
+	}
+	if charState.SAN <= 0 {
+		return "你的理智已经崩溃，无法再做出任何有意义的举动", true
+	}
+
+	types := []string{actionTypeOf(action)}
+	for _, sub := range action.SubActions {
+		types = append(types, actionTypeOf(models.Action{Type: sub.Type, Content: sub.Content}))
+	}
+	for _, status := range charState.Status {
+		restriction, ok := statusRestrictions[status]
+		if !ok {
+			continue
+		}
+		if containsString(restriction.Blocked, allActions) {
+			return fmt.Sprintf("你处于「%s」状态，什么也做不了", status), false
+		}
+		for _, actionType := range types {
+			if containsString(restriction.Blocked, actionType) ||
+				(len(restriction.Allowed) > 0 && !containsString(restriction.Allowed, actionType)) {
+				name := actionTypeNames[actionType]
+				if name == "" {
+					name = "这样做"
+				}
+				return fmt.Sprintf("你处于「%s」状态，无法%s", status, name), false
+			}
+		}
+	}
+	return "", false
+}
+
+// recoveringStatuses 返回耗掉一个回合后会自动解除的状态
+func recoveringStatuses(charState *models.CharacterState) []string {
+	var recovered []string
+	for _, status := range charState.Status {
+		if statusRestrictions[status].Recover {
+			recovered = append(recovered, status)
+		}
+	}
+	return recovered
+}
+
+// blockAction 结算一个无法行动的回合：不检定、不调用LLM，记录"你无法行动"并消耗回合。
+// 短暂失能的状态随之解除；角色已倒下或理智崩溃时直接结束场景
+func (ss *StoryService) blockAction(ctx context.Context, story *models.StoryState, world *models.World, scene *models.Scene,
+	character *models.Character, charState *models.CharacterState, action models.Action,
+	reason string, fatal bool) (*models.ActionResult, error) {
+
+	log.Printf("🚫 [无法行动] %s（行动：%s）\n", reason, action.Content)
+
+	snapshot := takeSnapshot(story, character, charState, scene)
+	story.Snapshots = append(story.Snapshots, snapshot)
+
+	narrative := "你无法行动：" + reason + "。"
+	story.PendingChoice = nil
+	story.Turn++
+	story.Narrative = append(story.Narrative, models.NarrativeLog{
+		Turn:      story.Turn,
+		Type:      "action",
+		Content:   actionLogContent(action),
+		Timestamp: time.Now(),
+	})
+	story.Narrative = append(story.Narrative, models.NarrativeLog{
+		Turn:      story.Turn,
+		Type:      "result",
+		Content:   narrative,
+		Timestamp: time.Now(),
+	})
+
+	var changes models.StateChanges
+	if !fatal {
+		changes.StatusRemoved = recoveringStatuses(charState)
+	}
+	charAfter := cloneCharacter(character)
+	charState = cloneCharacterState(charState)
+	if len(changes.StatusRemoved) > 0 {
+		ss.meta.ApplyChanges(charAfter, charState, changes)
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   fmt.Sprintf("💫 你渐渐缓了过来，「%s」状态解除", strings.Join(changes.StatusRemoved, "、")),
+			Timestamp: time.Now(),
+		})
+	}
+	story.CharState = charState
+
+	events := collectGameEvents(eventContext{
+		world:      world,
+		changes:    changes,
+		before:     snapshot,
+		story:      story,
+		charState:  charState,
+		charBefore: character,
+		charAfter:  charAfter,
+	})
+	recordTurnEvents(story, events)
+
+	var ending string
+	if fatal {
+		story.Status = ss.resolveOutcome(story, charState)
+		ending = ss.resolveEnding(ctx, world, character, charState, story)
+	}
+
+	if err := ss.assertSnapshots(story, "行动"); err != nil {
+		return nil, err
+	}
+
+	ss.settleSnapshot(story, charAfter)
+	story.UpdatedAt = time.Now()
+	if err := ss.storage.CommitStory(story, charAfter, charState); err != nil {
+		return nil, fmt.Errorf("更新故事状态失败: %w", err)
+	}
+	ss.recordChangeLog(story, action, changes)
+	ss.recordStatePoint(story, charState)
+
+	var nextOptions []models.Option
+	if !fatal {
+		nextOptions = ss.fitSceneOptions(scene, injectEnvironmentOptions(scene, ss.fallbackOptions(world, scene, story)))
+		nextOptions = applyCrisisOptions(charState, nextOptions)
+		ss.markTrivialOptions(world, scene, character, nextOptions)
+		ss.previewConsequences(world, scene, character, charState, nextOptions, action.AttributeMap)
+	}
+
+	return &models.ActionResult{
+		Narrative:    narrative,
+		Paragraphs:   splitParagraphs(narrative),
+		Changes:      changes,
+		NextOptions:  nextOptions,
+		SceneEnd:     fatal,
+		Ending:       ending,
+		PlotProgress: ss.plotProgressInfo(world, story),
+		GameTime:     gameTimeInfo(story),
+		Events:       events,
+		Blocked:      reason,
+	}, nil
+}
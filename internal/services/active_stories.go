@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// ActiveStories 列出角色所有进行中的故事（每个世界可以各有一条），补充世界名称
+func (ss *StoryService) ActiveStories(characterID string) ([]models.ActiveStory, error) {
+	stories, err := ss.storage.ListActiveStoriesByCharacter(characterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取进行中的故事失败: %w", err)
+	}
+
+	worldIDs := make([]string, 0, len(stories))
+	for _, story := range stories {
+		worldIDs = append(worldIDs, story.WorldID)
+	}
+	worlds, err := ss.storage.GetWorldsByIDs(worldIDs)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+	for i := range stories {
+		if world, ok := worlds[stories[i].WorldID]; ok {
+			stories[i].WorldName = world.Name
+		}
+	}
+	return stories, nil
+}
+
+// ContinueStory 继续角色在指定世界中进行中的故事。
+// 不指定世界时只有一条进行中的故事才能直接继续，有多条时返回 ErrInvalidInput，由玩家选择世界
+func (ss *StoryService) ContinueStory(ctx context.Context, characterID, worldID string) (*models.LoadedStory, error) {
+	if worldID == "" {
+		stories, err := ss.storage.ListActiveStoriesByCharacter(characterID)
+		if err != nil {
+			return nil, fmt.Errorf("获取进行中的故事失败: %w", err)
+		}
+		switch len(stories) {
+		case 0:
+			return nil, fmt.Errorf("%w: 角色没有进行中的故事", ErrNotFound)
+		case 1:
+			return ss.LoadStory(ctx, stories[0].StoryID)
+		default:
+			return nil, fmt.Errorf("%w: 角色在 %d 个世界都有进行中的故事，请指定 world_id", ErrInvalidInput, len(stories))
+		}
+	}
+
+	story, err := ss.storage.GetActiveStoryByCharacter(characterID, worldID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: 角色在该世界没有进行中的故事", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	return ss.LoadStory(ctx, story.ID)
+}
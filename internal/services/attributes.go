@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// defaultAttributeConfig 未配置时的角色初始属性规则
+func defaultAttributeConfig() models.AttributeConfig {
+	return models.AttributeConfig{
+		Default:   10,
+		BudgetMin: 50,
+		BudgetMax: 60,
+		Min:       1,
+		Max:       20,
+	}
+}
+
+// attributeSettings 返回生效的属性规则，未配置（或配置不合法）的项使用默认值
+func attributeSettings(cfg models.AttributeConfig) models.AttributeConfig {
+	defaults := defaultAttributeConfig()
+	if cfg.Min <= 0 {
+		cfg.Min = defaults.Min
+	}
+	if cfg.Max < cfg.Min {
+		cfg.Max = max(defaults.Max, cfg.Min)
+	}
+	if cfg.Default <= 0 {
+		cfg.Default = defaults.Default
+	}
+	cfg.Default = max(cfg.Min, min(cfg.Default, cfg.Max))
+
+	total := len(attributeNames)
+	if cfg.BudgetMin <= 0 {
+		cfg.BudgetMin = defaults.BudgetMin
+	}
+	if cfg.BudgetMax < cfg.BudgetMin {
+		cfg.BudgetMax = max(defaults.BudgetMax, cfg.BudgetMin)
+	}
+	// 预算必须能用单项上下限凑出来
+	cfg.BudgetMin = max(cfg.Min*total, min(cfg.BudgetMin, cfg.Max*total))
+	cfg.BudgetMax = max(cfg.BudgetMin, min(cfg.BudgetMax, cfg.Max*total))
+	return cfg
+}
+
+// AttributeSettings 返回当前生效的角色初始属性规则
+func (ms *MetaService) AttributeSettings() models.AttributeConfig {
+	return attributeSettings(ms.GameConfig().Attributes)
+}
+
+// defaultBaseAttributes 每项属性都取默认值的基础属性
+func defaultBaseAttributes(cfg models.AttributeConfig) map[string]int {
+	attrs := make(map[string]int, len(attributeNames))
+	for _, name := range attributeNames {
+		attrs[name] = cfg.Default
+	}
+	return attrs
+}
+
+// clampAttributes 补齐缺失的属性（取默认值），并把每项限制在上下限内
+func clampAttributes(attrs map[string]int, cfg models.AttributeConfig) map[string]int {
+	result := make(map[string]int, len(attributeNames))
+	for _, name := range attributeNames {
+		value, ok := attrs[name]
+		if !ok {
+			value = cfg.Default
+		}
+		result[name] = max(cfg.Min, min(value, cfg.Max))
+	}
+	return result
+}
+
+// fitAttributeBudget 把属性调整到总点数预算内：超出时从最高的属性逐点扣减，不足时给最低的属性逐点补充
+func fitAttributeBudget(attrs map[string]int, cfg models.AttributeConfig) map[string]int {
+	attrs = clampAttributes(attrs, cfg)
+	total := 0
+	for _, value := range attrs {
+		total += value
+	}
+
+	for ; total > cfg.BudgetMax; total-- {
+		highest := attributeNames[0]
+		for _, name := range attributeNames {
+			if attrs[name] > attrs[highest] {
+				highest = name
+			}
+		}
+		attrs[highest]--
+	}
+	for ; total < cfg.BudgetMin; total++ {
+		lowest := attributeNames[0]
+		for _, name := range attributeNames {
+			if attrs[name] < attrs[lowest] {
+				lowest = name
+			}
+		}
+		attrs[lowest]++
+	}
+	return attrs
+}
+
+// describeAttributeBudget 生成角色生成提示词中的属性规则说明
+func describeAttributeBudget(cfg models.AttributeConfig) (scale, budget string) {
+	return fmt.Sprintf("%d-%d分制", cfg.Min, cfg.Max), fmt.Sprintf("%d-%d", cfg.BudgetMin, cfg.BudgetMax)
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+const (
+	maxAutoSteps = 5 // 单次请求最多自动推进的回合数
+	// autoDangerRatio HP或理智低于上限的这个比例时，自动模式不选高风险行动
+	autoDangerRatio = 0.3
+)
+
+// AutoStep 自动模式：由AI按角色性格和主线目标从当前选项中挑选行动并执行，连续推进 steps 回合。
+// 场景结束时提前停止，返回已执行的回合
+func (ss *StoryService) AutoStep(ctx context.Context, storyID string, steps int) ([]models.AutoStep, error) {
+	if steps < 1 || steps > maxAutoSteps {
+		return nil, fmt.Errorf("%w: 自动推进回合数需在1-%d之间", ErrInvalidInput, maxAutoSteps)
+	}
+
+	var results []models.AutoStep
+	for i := 0; i < steps; i++ {
+		story, err := ss.storage.GetStoryState(storyID)
+		if err != nil {
+			return nil, fmt.Errorf("获取故事状态失败: %w", err)
+		}
+		if story.Status != "active" {
+			if len(results) == 0 {
+				return nil, ErrStoryEnded
+			}
+			break
+		}
+
+		option, reason, err := ss.autoChoose(ctx, story)
+		if err != nil {
+			return nil, err
+		}
+
+		content := option.Description
+		if content == "" {
+			content = option.Label
+		}
+		log.Printf("🤖 [自动模式] 第%d步选择「%s」：%s\n", i+1, option.Label, reason)
+
+		result, err := ss.ProcessAction(ctx, storyID, models.Action{Type: option.ActionType, Content: content, Trivial: option.Trivial}, story.Version)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, models.AutoStep{Choice: option, Reason: reason, Result: result})
+		if result.SceneEnd {
+			break
+		}
+	}
+
+	return results, nil
+}
+
+// autoChoose 生成当前局面的选项并让AI挑选；AI不可用时退回到最稳妥的选项。
+// 不替玩家做需要二次确认的重大抉择；角色状态危险时，不采纳AI挑中的高风险选项
+func (ss *StoryService) autoChoose(ctx context.Context, story *models.StoryState) (models.Option, string, error) {
+	current, err := ss.loadStoryScene(story)
+	if err != nil {
+		return models.Option{}, "", err
+	}
+	options := ss.generateOptions(ctx, story, current)
+
+	index, reason, err := ss.llm.ChooseOption(ctx, current.world, current.character, current.charState, current.scene, options)
+	if err != nil {
+		log.Printf("⚠️ 自动模式选择失败，改选最稳妥的行动: %v\n", err)
+		return safestOption(options), "稳妥起见，先选风险最低的行动", nil
+	}
+
+	chosen := options[index]
+	if chosen.RequiresConfirm {
+		safe := safestOption(options)
+		log.Printf("🛡️ [自动模式] 「%s」是无法挽回的重大行动，留给玩家决定，改为「%s」\n", chosen.Label, safe.Label)
+		return safe, "重大抉择留给玩家亲自决定", nil
+	}
+	if chosen.Risk == "high" && inDanger(current.charState) {
+		safe := safestOption(options)
+		log.Printf("🛡️ [自动模式] 状态危险，放弃高风险行动「%s」，改为「%s」\n", chosen.Label, safe.Label)
+		return safe, "状态太差，不宜冒险", nil
+	}
+	return chosen, reason, nil
+}
+
+// inDanger 判断角色的HP或理智是否已经低到不宜冒险
+func inDanger(charState *models.CharacterState) bool {
+	return float64(charState.HP) < float64(charState.MaxHP)*autoDangerRatio ||
+		float64(charState.SAN) < float64(charState.MaxSAN)*autoDangerRatio
+}
+
+// safestOption 挑出风险最低、不违背本性且无需二次确认的选项（同等条件下取靠前的）
+func safestOption(options []models.Option) models.Option {
+	riskRank := map[string]int{"low": 0, "medium": 1, "high": 2}
+	best := 0
+	score := func(opt models.Option) int {
+		rank, ok := riskRank[opt.Risk]
+		if !ok {
+			rank = 1
+		}
+		if opt.PersonalityConflict != "" {
+			rank += 3
+		}
+		if opt.RequiresConfirm {
+			rank += 6
+		}
+		return rank
+	}
+	for i := range options {
+		if score(options[i]) < score(options[best]) {
+			best = i
+		}
+	}
+	return options[best]
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+	"github.com/google/uuid"
+)
+
+// restoreConfirmWindow 上传备份后确认恢复的有效期
+const restoreConfirmWindow = 10 * time.Minute
+
+// pendingRestore 已上传、等待二次确认的备份
+type pendingRestore struct {
+	path      string
+	expiresAt time.Time
+}
+
+// BackupService 数据库备份与恢复。恢复分两步：上传备份得到预览和确认令牌，确认后才真正覆盖数据
+type BackupService struct {
+	storage *storage.Storage
+
+	mu      sync.Mutex
+	pending map[string]pendingRestore
+}
+
+func NewBackupService(storage *storage.Storage) *BackupService {
+	return &BackupService{storage: storage, pending: make(map[string]pendingRestore)}
+}
+
+// Backup 生成一份数据库快照，返回快照文件路径；调用方用完后负责删除所在的临时目录
+func (bs *BackupService) Backup() (string, error) {
+	dir, err := os.MkdirTemp("", "abyss-backup-")
+	if err != nil {
+		return "", fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	path := filepath.Join(dir, backupFileName(time.Now()))
+	if err := bs.storage.Backup(path); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	log.Printf("💾 [备份] 已生成数据库快照: %s\n", path)
+	return path, nil
+}
+
+// backupFileName 备份文件名，如 abyss-20250101-150405.db
+func backupFileName(t time.Time) string {
+	return "abyss-" + t.Format("20060102-150405") + ".db"
+}
+
+// PrepareRestore 保存上传的备份并校验，返回备份与当前数据的记录数对比和确认令牌，此时不修改任何数据
+func (bs *BackupService) PrepareRestore(r io.Reader) (*models.RestorePreview, error) {
+	bs.purgeExpired()
+
+	file, err := os.CreateTemp("", "abyss-restore-*.db")
+	if err != nil {
+		return nil, fmt.Errorf("保存备份失败: %w", err)
+	}
+	path := file.Name()
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("保存备份失败: %w", err)
+	}
+
+	backupCounts, err := inspectBackup(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("%w: 不是有效的备份文件（%v）", ErrInvalidInput, err)
+	}
+	currentCounts, err := bs.storage.TableCounts()
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("统计当前数据失败: %w", err)
+	}
+
+	preview := &models.RestorePreview{
+		Token:     uuid.New().String(),
+		ExpiresAt: time.Now().Add(restoreConfirmWindow),
+		Backup:    backupCounts,
+		Current:   currentCounts,
+	}
+	bs.mu.Lock()
+	bs.pending[preview.Token] = pendingRestore{path: path, expiresAt: preview.ExpiresAt}
+	bs.mu.Unlock()
+
+	log.Printf("💾 [恢复] 备份已上传，等待确认（令牌 %s）\n", preview.Token)
+	return preview, nil
+}
+
+// sqliteHeader SQLite 数据库文件的开头
+const sqliteHeader = "SQLite format 3\x00"
+
+// inspectBackup 打开备份（升级到当前表结构）并做完整性检查，返回每张表的记录数
+func inspectBackup(path string) (map[string]int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(sqliteHeader))
+	_, err = io.ReadFull(file, header)
+	file.Close()
+	if err != nil || string(header) != sqliteHeader {
+		return nil, fmt.Errorf("不是SQLite数据库")
+	}
+
+	backup, err := storage.New(path)
+	if err != nil {
+		return nil, err
+	}
+	defer backup.Close()
+
+	if err := backup.CheckIntegrity(); err != nil {
+		return nil, err
+	}
+	return backup.TableCounts()
+}
+
+// ConfirmRestore 用令牌对应的备份覆盖当前数据。覆盖前先把当前数据库备份到数据库文件旁边，以便反悔
+func (bs *BackupService) ConfirmRestore(token string) (*models.RestoreResult, error) {
+	bs.mu.Lock()
+	pending, ok := bs.pending[token]
+	delete(bs.pending, token)
+	bs.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: 确认令牌无效或已使用", ErrNotFound)
+	}
+	defer os.Remove(pending.path)
+	if time.Now().After(pending.expiresAt) {
+		return nil, fmt.Errorf("%w: 确认令牌已过期，请重新上传备份", ErrInvalidInput)
+	}
+
+	result := &models.RestoreResult{}
+	if dbPath := bs.storage.Path(); dbPath != storage.MemoryPath {
+		result.SafetyBackup = filepath.Join(filepath.Dir(dbPath), "pre-restore-"+backupFileName(time.Now()))
+		if err := bs.storage.Backup(result.SafetyBackup); err != nil {
+			return nil, fmt.Errorf("恢复前备份当前数据失败: %w", err)
+		}
+	}
+
+	restored, err := bs.storage.RestoreFrom(pending.path)
+	if err != nil {
+		return nil, fmt.Errorf("恢复数据失败: %w", err)
+	}
+	result.Restored = restored
+
+	log.Printf("💾 [恢复] 已从备份恢复数据（恢复前的数据已备份到 %s）\n", result.SafetyBackup)
+	return result, nil
+}
+
+// purgeExpired 清理过期未确认的备份
+func (bs *BackupService) purgeExpired() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	for token, pending := range bs.pending {
+		if time.Now().After(pending.expiresAt) {
+			os.Remove(pending.path)
+			delete(bs.pending, token)
+		}
+	}
+}
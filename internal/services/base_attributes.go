@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// maxBaseAttributeChange 一次重大剧情对单项基础属性的最大改变量
+const maxBaseAttributeChange = 2
+
+// attributeDisplayNames 属性的中文名
+var attributeDisplayNames = map[string]string{
+	"strength":     "力量",
+	"dexterity":    "敏捷",
+	"intelligence": "智力",
+	"charisma":     "魅力",
+	"perception":   "感知",
+}
+
+// sanitizeBaseAttributeChange 只保留已知属性的非零变化，并把幅度限制在 ±maxBaseAttributeChange 以内
+func sanitizeBaseAttributeChange(change map[string]int) map[string]int {
+	var result map[string]int
+	for attr, delta := range change {
+		if !containsString(attributeNames, attr) || delta == 0 {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]int)
+		}
+		result[attr] = max(-maxBaseAttributeChange, min(delta, maxBaseAttributeChange))
+	}
+	return result
+}
+
+// describeBaseAttributeChange 按属性顺序描述基础属性变化，如"力量 +1、智力 -1"
+func describeBaseAttributeChange(change map[string]int) string {
+	attrs := make([]string, 0, len(change))
+	for attr := range change {
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return indexOfString(attributeNames, attrs[i]) < indexOfString(attributeNames, attrs[j])
+	})
+
+	parts := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		parts = append(parts, fmt.Sprintf("%s %+d", attributeDisplayNames[attr], change[attr]))
+	}
+	return strings.Join(parts, "、")
+}
+
+// applyBaseAttributeChange 永久改变角色的基础属性（跨世界继承），同时让当前世界的属性立即生效，
+// 两者都限制在属性上下限之内
+func applyBaseAttributeChange(char *models.Character, state *models.CharacterState, change map[string]int,
+	cfg models.AttributeConfig) {
+	if char.BaseAttributes == nil {
+		char.BaseAttributes = defaultBaseAttributes(cfg)
+	}
+	if state.Attributes == nil {
+		state.Attributes = make(map[string]int)
+	}
+	for attr, delta := range change {
+		char.BaseAttributes[attr] = max(cfg.Min, min(char.BaseAttributes[attr]+delta, cfg.Max))
+		if value, ok := state.Attributes[attr]; ok {
+			state.Attributes[attr] = max(cfg.Min, value+delta)
+		}
+	}
+}
+
+// indexOfString 返回字符串在切片中的下标，不存在时返回切片长度
+func indexOfString(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return len(list)
+}
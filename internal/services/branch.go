@@ -0,0 +1,173 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/google/uuid"
+)
+
+// BranchStory 从存档所在的回合分叉出一条新故事，原故事保留不变，之后两条线独立发展。
+// 分叉时故事进度和角色在该世界的状态（HP/SAN/关系/道德等）回到分叉点；
+// 角色元信息（等级、经验、道具、特质）跨世界继承，分叉不会回滚
+func (ss *StoryService) BranchStory(storyID, saveID string) (*models.StoryState, *models.CharacterState, error) {
+	save, err := ss.storage.GetSaveGame(saveID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("%w: 存档不存在", ErrNotFound)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取存档失败: %w", err)
+	}
+	if save.StoryID != storyID {
+		return nil, nil, fmt.Errorf("%w: 存档不属于该故事", ErrInvalidInput)
+	}
+
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+
+	// 原故事线先记下当前的角色世界状态，之后读档时可以恢复
+	current, err := ss.activateCharState(story)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取角色状态失败: %w", err)
+	}
+	if story.CharState == nil {
+		story.CharState = current
+		if err := ss.storage.UpdateStoryState(story); err != nil {
+			return nil, nil, fmt.Errorf("更新故事状态失败: %w", err)
+		}
+	}
+
+	branch := &models.StoryState{
+		ID:                uuid.New().String(),
+		CharacterID:       story.CharacterID,
+		WorldID:           story.WorldID,
+		SceneID:           story.SceneID,
+		CurrentPlotNodeID: story.CurrentPlotNodeID,
+		PlotProgress:      story.PlotProgress,
+		StalledTurns:      story.StalledTurns,
+		UndoCount:         story.UndoCount,
+		Turn:              story.Turn,
+		Day:               story.Day,
+		Period:            story.Period,
+		PeriodActions:     story.PeriodActions,
+		Narrative:         append([]models.NarrativeLog{}, story.Narrative...),
+		Snapshots:         append([]models.StateSnapshot{}, story.Snapshots...),
+		Flags:             append([]string{}, story.Flags...),
+		Chapters:          append([]models.Chapter{}, story.Chapters...),
+		AttributeMap:      story.AttributeMap,
+		NPCMemories:       cloneNPCMemories(story.NPCMemories),
+		RomanceStages:     cloneRomanceStages(story.RomanceStages),
+		BranchedFrom:      story.ID,
+		BranchTurn:        save.Turn,
+		Cycle:             story.Cycle,
+		Notes:             story.Notes,
+		Status:            "active",
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+	charState := *current
+	sceneID := story.SceneID
+	var forkObjectives []models.Objective
+	var forkThreats []models.Threat
+
+	// 存档之后又进行过的回合，用存档回合的快照还原到分叉点
+	if save.Turn != story.Turn {
+		index := -1
+		for i, snapshot := range story.Snapshots {
+			if snapshot.Turn == save.Turn {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, nil, fmt.Errorf("%w: 找不到第%d回合的快照，无法从该存档分叉", ErrInvalidInput, save.Turn)
+		}
+
+		snapshot := story.Snapshots[index]
+		branch.Turn = snapshot.Turn
+		branch.Narrative = append([]models.NarrativeLog{}, snapshot.Narrative...)
+		branch.Snapshots = append([]models.StateSnapshot{}, story.Snapshots[:index]...)
+		branch.Flags = append([]string{}, snapshot.Flags...)
+		branch.CurrentPlotNodeID = snapshot.PlotNodeID
+		branch.PlotProgress = snapshot.PlotProgress
+		branch.StalledTurns = snapshot.StalledTurns
+		branch.Chapters = append([]models.Chapter{}, snapshot.Chapters...)
+		branch.Day = snapshot.Day
+		branch.Period = snapshot.Period
+		branch.PeriodActions = snapshot.PeriodActions
+		branch.NPCMemories = cloneNPCMemories(snapshot.NPCMemories)
+		branch.RomanceStages = cloneRomanceStages(snapshot.RomanceStages)
+		charState = snapshot.CharState
+		forkObjectives = snapshot.Objectives
+		forkThreats = snapshot.Threats
+		if snapshot.SceneID != "" {
+			sceneID = snapshot.SceneID
+		}
+	}
+	branch.CharState = &charState
+
+	// 场景目标的完成状态属于各自的故事线，分叉时复制一份场景
+	scene, err := ss.storage.GetScene(sceneID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取场景失败: %w", err)
+	}
+	if forkObjectives != nil {
+		scene.Objectives = forkObjectives
+	}
+	if forkThreats != nil {
+		scene.Threats = forkThreats
+	}
+	scene.ID = uuid.New().String()
+	if err := ss.storage.CreateScene(scene); err != nil {
+		return nil, nil, fmt.Errorf("保存场景失败: %w", err)
+	}
+	branch.SceneID = scene.ID
+
+	branch.Narrative = append(branch.Narrative, models.NarrativeLog{
+		Turn:      branch.Turn,
+		Type:      "system",
+		Content:   fmt.Sprintf("🔀 从存档「%s」（第%d回合）分叉出新的故事线", save.Name, save.Turn),
+		Timestamp: time.Now(),
+	})
+
+	if err := ss.assertSnapshots(branch, "分叉"); err != nil {
+		return nil, nil, err
+	}
+
+	if err := ss.meta.RestoreCharacterState(branch.CharacterID, branch.WorldID, &charState); err != nil {
+		return nil, nil, fmt.Errorf("恢复角色状态失败: %w", err)
+	}
+	if err := ss.storage.CreateStoryState(branch); err != nil {
+		return nil, nil, fmt.Errorf("保存故事状态失败: %w", err)
+	}
+
+	log.Printf("🔀 [分叉] 故事 %s 从第%d回合分叉出 %s\n", story.ID, save.Turn, branch.ID)
+
+	return branch, &charState, nil
+}
+
+// activateCharState 让共享的角色世界状态切换到该故事线记录的状态并返回；
+// 旧数据没有记录时直接使用当前的共享状态
+func (ss *StoryService) activateCharState(story *models.StoryState) (*models.CharacterState, error) {
+	if story.CharState == nil {
+		return ss.meta.GetCharacterState(story.CharacterID, story.WorldID)
+	}
+
+	// 故事线记录的状态必须属于本故事的角色和世界，否则说明数据串了，改用共享状态
+	if story.CharState.CharacterID != story.CharacterID || story.CharState.WorldID != story.WorldID {
+		log.Printf("⚠️ [故事隔离] 故事 %s 记录的角色状态属于其他角色或世界，已改用共享状态\n", story.ID)
+		return ss.meta.GetCharacterState(story.CharacterID, story.WorldID)
+	}
+
+	state := *story.CharState
+	if err := ss.meta.RestoreCharacterState(story.CharacterID, story.WorldID, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// recordChangeLog 把本回合应用的状态变化记入变更日志；记录失败只打日志，不影响本回合
+func (ss *StoryService) recordChangeLog(story *models.StoryState, action models.Action, changes models.StateChanges) {
+	entry := &models.ChangeLogEntry{
+		StoryID:   story.ID,
+		Turn:      story.Turn,
+		Action:    actionLogContent(action),
+		Changes:   changes,
+		CreatedAt: time.Now(),
+	}
+	if err := ss.storage.RecordStateChanges(entry); err != nil {
+		log.Printf("⚠️ 记录状态变更日志失败: %v\n", err)
+	}
+}
+
+// recordStatePoint 记下本回合结算后的角色状态轨迹点；记录失败只打日志，不影响本回合
+func (ss *StoryService) recordStatePoint(story *models.StoryState, charState *models.CharacterState) {
+	point := &models.StatePoint{
+		StoryID:    story.ID,
+		Turn:       story.Turn,
+		HP:         charState.HP,
+		MaxHP:      charState.MaxHP,
+		SAN:        charState.SAN,
+		MaxSAN:     charState.MaxSAN,
+		Attributes: charState.Attributes,
+		Morality:   charState.Morality,
+		CreatedAt:  time.Now(),
+	}
+	for _, relation := range charState.Relations {
+		point.RelationTotal += relation
+	}
+	if err := ss.storage.RecordStatePoint(point); err != nil {
+		log.Printf("⚠️ 记录状态轨迹失败: %v\n", err)
+	}
+}
+
+// GetStateTimeline 获取故事每回合结算后的角色状态轨迹（按回合先后，回退撤销的点带 undone 标记）
+func (ss *StoryService) GetStateTimeline(storyID string) ([]models.StatePoint, error) {
+	if _, err := ss.storage.GetStoryState(storyID); err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	points, err := ss.storage.GetStateTimeline(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取状态轨迹失败: %w", err)
+	}
+	return points, nil
+}
+
+// GetChangeLog 分页获取故事每回合的状态变更日志（最新的在前）及记录计数
+func (ss *StoryService) GetChangeLog(storyID string, page models.Page) ([]models.ChangeLogEntry, models.ListCount, error) {
+	if _, err := ss.storage.GetStoryState(storyID); err != nil {
+		return nil, models.ListCount{}, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	entries, count, err := ss.storage.GetStateChangeLog(storyID, page)
+	if err != nil {
+		return nil, count, fmt.Errorf("获取状态变更日志失败: %w", err)
+	}
+	return entries, count, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// openChapter 结束当前章节并从 startTurn 开始新章节
+func openChapter(story *models.StoryState, title, plotNodeID string, startTurn int) {
+	if n := len(story.Chapters); n > 0 && !story.Chapters[n-1].Closed {
+		story.Chapters[n-1].EndTurn = startTurn - 1
+		story.Chapters[n-1].Closed = true
+	}
+	story.Chapters = append(story.Chapters, models.Chapter{
+		Index:      len(story.Chapters) + 1,
+		Title:      title,
+		PlotNodeID: plotNodeID,
+		StartTurn:  startTurn,
+	})
+}
+
+// storyChapters 返回故事的章节列表，进行中的章节截止到当前回合；
+// 旧数据没有章节记录时整局视为一章
+func storyChapters(story *models.StoryState) []models.Chapter {
+	chapters := append([]models.Chapter{}, story.Chapters...)
+	if len(chapters) == 0 {
+		chapters = append(chapters, models.Chapter{Index: 1, Title: "第一章"})
+	}
+	if last := &chapters[len(chapters)-1]; !last.Closed {
+		last.EndTurn = story.Turn
+	}
+	return chapters
+}
+
+// chapterNarrative 返回章节回合区间内的叙事日志
+func chapterNarrative(story *models.StoryState, chapter models.Chapter) []models.NarrativeLog {
+	logs := []models.NarrativeLog{}
+	for _, entry := range story.Narrative {
+		if entry.Turn >= chapter.StartTurn && entry.Turn <= chapter.EndTurn {
+			logs = append(logs, entry)
+		}
+	}
+	return logs
+}
+
+// GetChapters 获取故事的章节列表
+func (ss *StoryService) GetChapters(storyID string) ([]models.Chapter, error) {
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	return storyChapters(story), nil
+}
+
+// GetDiceTimeline 获取故事的检定历史（按回合顺序），limit > 0 时只取最近 limit 次
+func (ss *StoryService) GetDiceTimeline(storyID string, limit int) ([]models.DicePoint, error) {
+	points, err := ss.storage.GetDiceTimeline(storyID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("获取检定历史失败: %w", err)
+	}
+	return points, nil
+}
+
+// GetChapter 获取单个章节及其叙事日志
+func (ss *StoryService) GetChapter(storyID string, index int) (*models.Chapter, []models.NarrativeLog, error) {
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+
+	chapters := storyChapters(story)
+	if index < 1 || index > len(chapters) {
+		return nil, nil, fmt.Errorf("%w: 第%d章不存在", ErrNotFound, index)
+	}
+
+	chapter := chapters[index-1]
+	return &chapter, chapterNarrative(story, chapter), nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig 从YAML文件读取配置
+func LoadConfig(path string) (*models.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// ConfigService 管理配置文件的热重载
+type ConfigService struct {
+	path       string
+	mu         sync.Mutex
+	current    models.Config
+	llm        *LLMService
+	ruleEngine *RuleEngine
+	meta       *MetaService
+}
+
+func NewConfigService(path string, config *models.Config, llm *LLMService,
+	ruleEngine *RuleEngine, meta *MetaService) *ConfigService {
+	return &ConfigService{
+		path:       path,
+		current:    *config,
+		llm:        llm,
+		ruleEngine: ruleEngine,
+		meta:       meta,
+	}
+}
+
+// AdminToken 返回当前的管理员令牌
+func (cs *ConfigService) AdminToken() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.current.Admin.Token
+}
+
+// DebugMode 是否开启调试模式
+func (cs *ConfigService) DebugMode() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.current.Server.Debug
+}
+
+// Reload 重新读取配置文件，应用可热更新的部分（LLM、游戏参数、难度规则、管理员令牌）。
+// 服务地址和数据库路径需要重启才能生效，有变化时只记录在结果中
+func (cs *ConfigService) Reload() (*models.ConfigReloadResult, error) {
+	config, err := LoadConfig(cs.path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置失败: %w", err)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	result := &models.ConfigReloadResult{}
+
+	cs.llm.UpdateConfig(config.LLM)
+	cs.meta.SetGameConfig(config.Game)
+	cs.ruleEngine.SetRules(config.Rules)
+	result.Reloaded = append(result.Reloaded, "llm", "game", "rules", "admin")
+
+	if config.Server != cs.current.Server {
+		result.Ignored = append(result.Ignored, "server")
+	}
+	if config.Database != cs.current.Database {
+		result.Ignored = append(result.Ignored, "database")
+	}
+
+	// 不可热更新的部分保持运行中的值
+	config.Server = cs.current.Server
+	config.Database = cs.current.Database
+	cs.current = *config
+
+	log.Printf("🔄 配置已重载: %v\n", result.Reloaded)
+	if len(result.Ignored) > 0 {
+		log.Printf("⚠️ 以下配置需要重启服务才能生效: %v\n", result.Ignored)
+	}
+
+	return result, nil
+}
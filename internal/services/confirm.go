@@ -0,0 +1,47 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// irreversibleKeywords 不可挽回的重大行动关键词，LLM漏标或玩家自由输入时兜底识别
+var irreversibleKeywords = []string{
+	"杀死", "杀掉", "处决", "自杀", "自尽", "自毁", "同归于尽", "献祭", "签下契约", "签订契约", "接受契约", "出卖灵魂",
+}
+
+// isIrreversible 判断行动内容是否命中不可挽回的关键词
+func isIrreversible(content string) bool {
+	for _, kw := range irreversibleKeywords {
+		if strings.Contains(content, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+// markIrreversibleOptions 标记需要二次确认的选项：LLM已标记的保留，其余按关键词补标
+func markIrreversibleOptions(options []models.Option) {
+	for i := range options {
+		if !options[i].RequiresConfirm {
+			options[i].RequiresConfirm = isIrreversible(options[i].Label + options[i].Description)
+		}
+	}
+}
+
+// confirmationReason 重大不可逆行动未经确认时返回提示（无需确认或已确认时为空）
+func confirmationReason(action models.Action) string {
+	if action.Confirmed {
+		return ""
+	}
+	contents := []string{action.Content}
+	for _, sub := range action.SubActions {
+		contents = append(contents, sub.Content)
+	}
+	if action.RequiresConfirm || isIrreversible(strings.Join(contents, "\n")) {
+		return fmt.Sprintf("「%s」是无法挽回的重大行动，请确认后再执行", action.Content)
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// 危机阶段：HP或SAN跌到上限的一定比例以下时进入，回升后自动解除
+const (
+	statusDying    = "濒死" // HP过低
+	statusPanicked = "恐慌" // SAN过低
+)
+
+// 危机阶段专用的自救行动类型
+const (
+	actionStruggle = "struggle"  // 挣扎：咬牙撑住、强压恐惧
+	actionCallHelp = "call_help" // 求救：向周围的人呼救
+)
+
+// crisisRecoveryRatio 自救成功时恢复的HP/SAN占上限的比例
+const crisisRecoveryRatio = 0.25
+
+// crisisActions 危机阶段的自救行动，任何场景都允许
+var crisisActions = []string{actionStruggle, actionCallHelp}
+
+// crisisMeter 危机状态对应的数值
+type crisisMeter struct {
+	status string
+	value  func(*models.CharacterState) (current, max int)
+}
+
+var crisisMeters = []crisisMeter{
+	{statusDying, func(s *models.CharacterState) (int, int) { return s.HP, s.MaxHP }},
+	{statusPanicked, func(s *models.CharacterState) (int, int) { return s.SAN, s.MaxSAN }},
+}
+
+// isCrisisAction 判断是否为危机阶段的自救行动
+func isCrisisAction(actionType string) bool {
+	return containsString(crisisActions, actionType)
+}
+
+// activeCrisis 返回角色当前所处的危机状态
+func activeCrisis(charState *models.CharacterState) []string {
+	var statuses []string
+	for _, meter := range crisisMeters {
+		if containsString(charState.Status, meter.status) {
+			statuses = append(statuses, meter.status)
+		}
+	}
+	return statuses
+}
+
+// crisisStatusChanges 按当前HP/SAN计算危机状态的进入与解除：数值不高于上限 × threshold 时进入，
+// 回升到阈值以上时解除；threshold 不大于0表示关闭危机阶段（已有的危机状态全部解除）
+func crisisStatusChanges(charState *models.CharacterState, threshold float64) models.StateChanges {
+	var changes models.StateChanges
+	for _, meter := range crisisMeters {
+		current, max := meter.value(charState)
+		inCrisis := threshold > 0 && max > 0 && float64(current) <= float64(max)*threshold
+		has := containsString(charState.Status, meter.status)
+		switch {
+		case inCrisis && !has:
+			changes.StatusAdded = append(changes.StatusAdded, meter.status)
+		case !inCrisis && has:
+			changes.StatusRemoved = append(changes.StatusRemoved, meter.status)
+		}
+	}
+	return changes
+}
+
+// crisisRecovery 自救行动成功时恢复所处危机对应的数值（大成功翻倍），让角色有机会脱离危机
+func crisisRecovery(charState *models.CharacterState, action models.Action, diceRoll *models.DiceRoll) models.StateChanges {
+	var changes models.StateChanges
+	if !isCrisisAction(actionTypeOf(action)) || !diceRoll.Success {
+		return changes
+	}
+	ratio := crisisRecoveryRatio
+	if diceRoll.Critical {
+		ratio *= 2
+	}
+	for _, status := range activeCrisis(charState) {
+		switch status {
+		case statusDying:
+			changes.HPChange += int(math.Ceil(float64(charState.MaxHP) * ratio))
+		case statusPanicked:
+			changes.SANChange += int(math.Ceil(float64(charState.MaxSAN) * ratio))
+		}
+	}
+	return changes
+}
+
+// syncCrisis 结算后按最新的HP/SAN进入或解除危机阶段（在内存中应用到角色状态上），并写一条系统日志；
+// 返回状态变化（没有变化时为零值）
+func (ss *StoryService) syncCrisis(story *models.StoryState, char *models.Character, charState *models.CharacterState) models.StateChanges {
+	changes := crisisStatusChanges(charState, ss.ruleEngine.CrisisThreshold())
+	if len(changes.StatusAdded) == 0 && len(changes.StatusRemoved) == 0 {
+		return changes
+	}
+	ss.meta.ApplyChanges(char, charState, changes)
+
+	var messages []string
+	for _, status := range changes.StatusAdded {
+		switch status {
+		case statusDying:
+			messages = append(messages, "🩸 你伤势过重，陷入「濒死」状态：只能挣扎、求救或勉强移动")
+		case statusPanicked:
+			messages = append(messages, "😱 恐惧压垮了你，陷入「恐慌」状态：难以做出冷静的举动")
+		}
+	}
+	if len(changes.StatusRemoved) > 0 {
+		messages = append(messages, fmt.Sprintf("💪 你挺了过来，「%s」状态解除", strings.Join(changes.StatusRemoved, "、")))
+	}
+	for _, message := range messages {
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   message,
+			Timestamp: time.Now(),
+		})
+	}
+	log.Printf("🩸 [危机] 进入%v 解除%v\n", changes.StatusAdded, changes.StatusRemoved)
+	return changes
+}
+
+// crisisOptions 危机阶段的自救选项
+func crisisOptions(charState *models.CharacterState) []models.Option {
+	statuses := activeCrisis(charState)
+	if len(statuses) == 0 {
+		return nil
+	}
+	var options []models.Option
+	if containsString(statuses, statusDying) {
+		options = append(options, models.Option{
+			ID:          "crisis_struggle",
+			Label:       "咬牙挣扎",
+			Description: "忍住剧痛撑起身子，拼尽最后的力气稳住伤势",
+			ActionType:  actionStruggle,
+			Difficulty:  12,
+			Risk:        "high",
+		})
+	} else {
+		options = append(options, models.Option{
+			ID:          "crisis_struggle",
+			Label:       "强压恐惧",
+			Description: "深呼吸，逼自己从恐惧中找回一丝清醒",
+			ActionType:  actionStruggle,
+			Difficulty:  12,
+			Risk:        "medium",
+		})
+	}
+	options = append(options, models.Option{
+		ID:          "crisis_call_help",
+		Label:       "大声求救",
+		Description: "向周围呼救，也许有人能拉你一把",
+		ActionType:  actionCallHelp,
+		Difficulty:  12,
+		Risk:        "medium",
+	})
+	return options
+}
+
+// applyCrisisOptions 危机阶段过滤掉状态不允许的选项，并把自救选项放在最前面
+func applyCrisisOptions(charState *models.CharacterState, options []models.Option) []models.Option {
+	rescue := crisisOptions(charState)
+	if len(rescue) == 0 {
+		return options
+	}
+	fitted := rescue
+	for _, opt := range options {
+		if isCrisisAction(opt.ActionType) {
+			continue
+		}
+		if reason, _ := actionBlockReason(charState, models.Action{Type: opt.ActionType, Content: opt.Label}); reason == "" {
+			fitted = append(fitted, opt)
+		}
+	}
+	return fitted
+}
+
+// describeCrisis 给叙事prompt说明角色正处于危机阶段，要求突出危机感（不在危机中时为空）
+func describeCrisis(charState *models.CharacterState) string {
+	var parts []string
+	for _, status := range activeCrisis(charState) {
+		switch status {
+		case statusDying:
+			parts = append(parts, fmt.Sprintf("角色重伤濒死（HP %d/%d）：突出剧痛、失血、视野发黑、意识随时可能中断的生死一线", charState.HP, charState.MaxHP))
+		case statusPanicked:
+			parts = append(parts, fmt.Sprintf("角色陷入恐慌（SAN %d/%d）：突出心跳失控、呼吸急促、幻听幻视、难以思考的崩溃边缘", charState.SAN, charState.MaxSAN))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n**危机状态（必须体现）：**%s。\n", strings.Join(parts, "；"))
+}
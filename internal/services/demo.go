@@ -0,0 +1,123 @@
+package services
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// placeholderAPIKey 示例配置中的占位密钥，视为未配置
+const placeholderAPIKey = "your-openai-api-key-here"
+
+// demoModeEnabled 判断是否使用离线演示模式：显式开启，或没有配置有效的API Key
+func demoModeEnabled(enabled bool, apiKey string) bool {
+	apiKey = strings.TrimSpace(apiKey)
+	return enabled || apiKey == "" || apiKey == placeholderAPIKey
+}
+
+// demoWorld 演示模式的预置世界。解析小说、重新生成剧情线、扩展世界共用这一份数据（各自只取需要的字段）
+const demoWorld = `{
+  "name": "雾港旧城（演示）",
+  "description": "常年被浓雾笼罩的港口旧城，夜里钟楼会无故敲响。你作为新来的调查员抵达这里，寻找失踪的灯塔守夜人。旧城里有热情的酒馆老板娘、沉默的钟楼看守，以及在雾中游荡的不明之物。",
+  "genre": "mystery",
+  "difficulty": 3,
+  "tags": ["悬疑", "港口", "演示"],
+  "rules": ["钟声响起时不要回头"],
+  "goals": ["查明灯塔守夜人失踪的真相", "赢得旧城居民的信任"],
+  "npcs": [
+    {
+      "name": "艾琳",
+      "description": "海鸥酒馆的老板娘，二十七八岁，红色卷发随意挽起，笑起来眼角弯弯。消息灵通，对外乡人格外热情，却对灯塔的事讳莫如深。",
+      "role": "love_interest",
+      "traits": ["热情", "消息灵通", "隐瞒着过去"],
+      "periods": [],
+      "relations": [{"target": "老霍", "type": "ally", "description": "多年的老邻居"}]
+    },
+    {
+      "name": "老霍",
+      "description": "钟楼看守，头发花白，背有些驼，总是提着一盏油灯。话不多，但每句话都像在警告什么。",
+      "role": "mentor",
+      "traits": ["沉默", "警惕", "知道钟声的秘密"],
+      "periods": ["evening", "night"],
+      "relations": []
+    }
+  ],
+  "plot_lines": [
+    {"id": "plot_1", "order": 1, "name": "抵达雾港", "description": "调查员乘末班船抵达旧城，在酒馆打听守夜人的下落。", "location": "海鸥酒馆", "key_npcs": ["艾琳"], "difficulty": 2, "is_playable": true, "periods": []},
+    {"id": "plot_2", "order": 2, "name": "午夜钟声", "description": "钟楼在午夜无故敲响，老霍警告调查员不要靠近灯塔。", "location": "钟楼", "key_npcs": ["老霍"], "difficulty": 4, "is_playable": true, "periods": ["night"]},
+    {"id": "plot_3", "order": 3, "name": "灯塔之下", "description": "调查员登上废弃的灯塔，找到守夜人留下的日记。", "location": "灯塔", "key_npcs": ["艾琳", "老霍"], "difficulty": 6, "is_playable": false, "periods": []}
+  ]
+}`
+
+// demoScene 演示模式的预置场景
+const demoScene = `{
+  "name": "海鸥酒馆",
+  "description": "木门推开时带进一股潮湿的海风。酒馆里光线昏黄，几个渔夫围着炉火低声交谈，看到你这个外乡人便不约而同地安静下来。吧台后的艾琳擦着酒杯朝你笑了笑：\"雾这么大还来旧城，你是来找人的吧？\"墙上挂着一幅褪色的灯塔画，画框下压着一张寻人启事。",
+  "type": "social",
+  "threats": [{"text": "渔夫们对外乡人的戒备", "severity": 2}],
+  "objectives": [
+    {"text": "从艾琳口中打听守夜人的下落", "reward": 40},
+    {"text": "弄清寻人启事是谁贴的", "reward": 30}
+  ],
+  "interactables": ["墙上的灯塔画", "寻人启事", "吧台上的旧账本"],
+  "exits": ["雾中的码头", "通往钟楼的石阶"]
+}`
+
+// demoOptions 演示模式的预置行动选项
+const demoOptions = `[
+  {"label": "向艾琳打听", "description": "点一杯酒，顺势问起灯塔守夜人的事", "action_type": "talk", "difficulty": 10, "risk": "low"},
+  {"label": "查看寻人启事", "description": "走到墙边仔细看看那张寻人启事", "action_type": "investigate", "difficulty": 9, "risk": "low"},
+  {"label": "观察渔夫们", "description": "假装烤火，留意渔夫们在低声谈论什么", "action_type": "observe", "difficulty": 11, "risk": "low"},
+  {"label": "偷看旧账本", "description": "趁艾琳转身时翻一翻吧台上的账本", "action_type": "sneak", "difficulty": 13, "risk": "medium"}
+]`
+
+// demoNarratives 演示模式的预置叙事，每次随机取一段
+var demoNarratives = []string{
+	"你放慢动作，把注意力集中在眼前的事情上。炉火噼啪作响，窗外的雾气贴着玻璃缓缓流动。艾琳的目光在你身上停留了片刻，像是在衡量你值不值得信任。终于，她压低声音说：\"守夜人失踪那晚，钟楼响了十三下。\"",
+	"你的举动引来了几道打量的目光。一个满脸胡茬的渔夫哼了一声，把酒杯重重放在桌上：\"外乡人，别多管闲事。\"不过你还是注意到，他说这话时下意识地瞥了一眼墙上的灯塔画。",
+	"远处传来低沉的钟声，酒馆里的谈话声戛然而止。所有人都低下头，仿佛在躲避什么。等钟声散去，艾琳若无其事地继续擦着杯子，只是手指微微发抖。你意识到，这座城里的人都知道些什么。",
+	"你在角落里发现了一张被揉皱的纸条，上面用潦草的字迹写着：\"灯不能灭。\"纸条背面沾着一点干涸的蜡油，闻起来有股淡淡的海盐味。",
+}
+
+// demoTexts 演示模式下其余返回纯文本或简单JSON的调用类型
+var demoTexts = map[string]string{
+	callCharacter: `{"appearance": "身形修长，穿着洗得发白的风衣，眼神沉静。", "personality": "冷静、谨慎，好奇心强，一句话：先观察再行动。", "background": "曾在城里做过几年私家侦探，接到一封没有署名的委托信后，独自来到雾港旧城寻找失踪的守夜人。", "base_attributes": {"strength": 10, "dexterity": 12, "intelligence": 14, "charisma": 11, "perception": 13}}`,
+	callSummary:   "调查员来到雾港旧城寻找失踪的灯塔守夜人，在酒馆、钟楼和灯塔之间逐步揭开旧城居民隐瞒的秘密。",
+	callCover:     `{"cover_prompt": "a foggy old harbor town at night, a distant lighthouse with a faint light, cobblestone streets, warm tavern windows, mysterious atmosphere, painterly illustration", "theme_color": "#4A6B82"}`,
+	callEvaluate:  `{"progress_change": 20, "reached_next_node": false, "morality_change": 0, "reputation_change": 1, "flags": [], "reason": "演示模式：每回合固定推进剧情"}`,
+	callEnding:    "浓雾终于散去，灯塔重新亮起。你没有找到守夜人，却找到了他留下的日记——他选择留在雾里，守着这座城不愿被人提起的秘密。你合上日记，乘着清晨的第一班船离开了雾港。（演示模式结局）",
+	callQuick:     "你做出了选择，对方轻轻点了点头，气氛似乎缓和了一些。",
+	callAuto:      `{"choice": 1, "reason": "演示模式：总是选择第一个选项"}`,
+	callHint:      "老霍提着油灯从门口经过，意味深长地朝钟楼的方向看了一眼。",
+	callReport:    "这是一局演示模式的冒险：你在雾港旧城四处调查，与酒馆老板娘和钟楼看守周旋，最终揭开了灯塔的秘密。配置有效的 API Key 后即可体验由AI实时生成的完整故事。",
+}
+
+// demoContent 返回演示模式下某类调用的预置回复
+func demoContent(kind string) string {
+	switch kind {
+	case callParse:
+		return demoWorld
+	case callScene:
+		return demoScene
+	case callOptions:
+		return demoOptions
+	case callNarrate:
+		return demoNarratives[rand.Intn(len(demoNarratives))]
+	}
+	return demoTexts[kind]
+}
+
+// demoCompletion 构造演示模式的对话补全结果，不发起网络请求
+func demoCompletion(kind string, req openai.ChatCompletionRequest) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		Model: req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: demoContent(kind),
+			},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	}
+}
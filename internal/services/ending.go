@@ -0,0 +1,136 @@
+package services
+
+import (
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// DefaultEndingID 没有条件结局匹配时使用的默认结局ID
+const DefaultEndingID = "default"
+
+// validEndingConditionTypes 支持的结局条件类型
+var validEndingConditionTypes = map[string]bool{
+	"morality":   true,
+	"reputation": true,
+	"relation":   true,
+	"hp":         true,
+	"san":        true,
+	"alive":      true,
+	"flag":       true,
+	"status":     true,
+	"trait":      true,
+}
+
+// endingContext 判定结局条件所需的数据
+type endingContext struct {
+	world     *models.World
+	character *models.Character
+	charState *models.CharacterState
+	story     *models.StoryState
+}
+
+// selectEnding 按条件匹配结局，多个同时满足时取优先级最高者（同优先级按定义顺序），无匹配返回nil
+func selectEnding(ec endingContext) *models.EndingDef {
+	var selected *models.EndingDef
+	for i := range ec.world.Endings {
+		ending := &ec.world.Endings[i]
+		if !endingMatches(ending, ec) {
+			continue
+		}
+		if selected == nil || ending.Priority > selected.Priority {
+			selected = ending
+		}
+	}
+	return selected
+}
+
+// endingMatches 判断结局的所有条件是否满足
+func endingMatches(ending *models.EndingDef, ec endingContext) bool {
+	for _, cond := range ending.Conditions {
+		if !endingConditionMet(cond, ec) {
+			return false
+		}
+	}
+	return true
+}
+
+// endingConditionMet 判断单个结局条件
+func endingConditionMet(cond models.EndingCondition, ec endingContext) bool {
+	switch cond.Type {
+	case "morality":
+		return compareInt(ec.charState.Morality, cond.Op, cond.Value)
+	case "reputation":
+		return compareInt(ec.charState.Reputation, cond.Op, cond.Value)
+	case "relation":
+		npcID := resolveNPCID(ec.world, cond.Target)
+		return compareInt(ec.charState.Relations[npcID], cond.Op, cond.Value)
+	case "hp":
+		return compareInt(ec.charState.HP, cond.Op, cond.Value)
+	case "san":
+		return compareInt(ec.charState.SAN, cond.Op, cond.Value)
+	case "alive":
+		return applyNegation(ec.charState.HP > 0 && ec.charState.SAN > 0, cond.Op)
+	case "flag":
+		return applyNegation(containsString(ec.story.Flags, cond.Target), cond.Op)
+	case "status":
+		return applyNegation(containsString(ec.charState.Status, cond.Target), cond.Op)
+	case "trait":
+		return applyNegation(containsString(ec.character.Traits, cond.Target), cond.Op)
+	}
+	return false
+}
+
+// compareInt 按运算符比较数值，默认为 >=
+func compareInt(actual int, op string, value int) bool {
+	switch op {
+	case "<=":
+		return actual <= value
+	case ">":
+		return actual > value
+	case "<":
+		return actual < value
+	case "==":
+		return actual == value
+	default:
+		return actual >= value
+	}
+}
+
+// applyNegation 布尔条件的 op 为 not 时取反
+func applyNegation(result bool, op string) bool {
+	if op == "not" {
+		return !result
+	}
+	return result
+}
+
+// resolveNPCID 将NPC名字解析为ID，找不到时原样返回
+func resolveNPCID(world *models.World, target string) string {
+	for _, npc := range world.NPCs {
+		if npc.Name == target {
+			return npc.ID
+		}
+	}
+	return target
+}
+
+// endingFlagNames 收集结局条件里引用的旗标，供剧情评估时判定
+func endingFlagNames(world *models.World) []string {
+	var flags []string
+	for _, ending := range world.Endings {
+		for _, cond := range ending.Conditions {
+			if cond.Type == "flag" && cond.Target != "" && !containsString(flags, cond.Target) {
+				flags = append(flags, cond.Target)
+			}
+		}
+	}
+	return flags
+}
+
+func containsString(list []string, target string) bool {
+	for _, s := range list {
+		if s == target {
+			return true
+		}
+	}
+	return false
+}
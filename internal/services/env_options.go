@@ -0,0 +1,66 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// maxEnvironmentOptions 每回合最多补充的环境选项数
+const maxEnvironmentOptions = 4
+
+// environmentOptions 根据场景的可互动物件和出口生成确定性的探索选项（检查X、前往Y），前往出口无需检定
+func environmentOptions(scene *models.Scene) []models.Option {
+	var options []models.Option
+	for i, target := range scene.Interactables {
+		options = append(options, models.Option{
+			ID:          fmt.Sprintf("env_inspect_%d", i+1),
+			Label:       "检查" + target,
+			Description: "仔细检查" + target + "，看看有没有线索",
+			ActionType:  "investigate",
+			Difficulty:  10,
+			Risk:        "low",
+		})
+	}
+	for i, exit := range scene.Exits {
+		options = append(options, models.Option{
+			ID:          fmt.Sprintf("env_exit_%d", i+1),
+			Label:       "前往" + exit,
+			Description: "离开这里，前往" + exit,
+			ActionType:  "move",
+			Difficulty:  8,
+			Risk:        "low",
+			Trivial:     true,
+		})
+	}
+	return options
+}
+
+// injectEnvironmentOptions 在AI生成的选项后补上环境选项，保证AI漏掉关键交互点时玩家也能探索。
+// AI选项已经提到该物件或出口时不再重复，最多补充 maxEnvironmentOptions 个
+func injectEnvironmentOptions(scene *models.Scene, options []models.Option) []models.Option {
+	targets := append(append([]string{}, scene.Interactables...), scene.Exits...)
+	added := 0
+	for i, option := range environmentOptions(scene) {
+		if added >= maxEnvironmentOptions {
+			break
+		}
+		if optionMentions(options, targets[i]) {
+			continue
+		}
+		options = append(options, option)
+		added++
+	}
+	return options
+}
+
+// optionMentions 判断是否已有选项提到了该物件或出口
+func optionMentions(options []models.Option, target string) bool {
+	for _, option := range options {
+		if strings.Contains(option.Label, target) || strings.Contains(option.Description, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// 装备槽
+const (
+	slotWeapon    = "weapon"
+	slotArmor     = "armor"
+	slotAccessory = "accessory"
+)
+
+// equipmentSlots 所有装备槽（道具类型与槽位同名即可装备，也可以在 Properties["slot"] 中指定）
+var equipmentSlots = []string{slotWeapon, slotArmor, slotAccessory}
+
+// defenseProperty 防具属性：减少战斗失败时受到的伤害
+const defenseProperty = "defense"
+
+// itemSlot 返回道具可装备的槽位，不可装备时返回空
+func itemSlot(item models.Item) string {
+	if slot := item.Properties["slot"]; containsString(equipmentSlots, slot) {
+		return slot
+	}
+	if containsString(equipmentSlots, item.Type) {
+		return item.Type
+	}
+	return ""
+}
+
+// propertyBonus 解析道具属性中的数值加成（如 "+2"、"-1"），不是数字时返回0
+func propertyBonus(value string) int {
+	bonus, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(value), "+"))
+	if err != nil {
+		return 0
+	}
+	return bonus
+}
+
+// equippedItems 返回角色当前装备着的道具（已不在背包中的忽略）
+func equippedItems(character *models.Character) []models.Item {
+	if character == nil {
+		return nil
+	}
+	var items []models.Item
+	for _, slot := range equipmentSlots {
+		itemID := character.Equipment[slot]
+		if itemID == "" {
+			continue
+		}
+		for _, item := range character.Inventory {
+			if item.ID == itemID {
+				items = append(items, item)
+				break
+			}
+		}
+	}
+	return items
+}
+
+// equipmentBonus 汇总装备对某个属性或行动类型的加成（道具 Properties 中以属性名或行动类型为键）
+func equipmentBonus(character *models.Character, key string) int {
+	bonus := 0
+	for _, item := range equippedItems(character) {
+		bonus += propertyBonus(item.Properties[key])
+	}
+	return bonus
+}
+
+// equippedAttributes 返回叠加了装备属性加成的属性值（不修改原属性）
+func equippedAttributes(attributes map[string]int, character *models.Character) map[string]int {
+	if len(equippedItems(character)) == 0 {
+		return attributes
+	}
+	result := make(map[string]int, len(attributes))
+	for attr, value := range attributes {
+		result[attr] = value + equipmentBonus(character, attr)
+	}
+	return result
+}
+
+// reduceDamage 按装备的防御值减少受到的伤害，至少保留1点
+func reduceDamage(damage int, character *models.Character) int {
+	if damage <= 0 {
+		return damage
+	}
+	return max(damage-equipmentBonus(character, defenseProperty), 1)
+}
+
+// pruneEquipment 卸下已经不在背包里的道具（道具被消耗或丢失时）
+func pruneEquipment(character *models.Character) {
+	for slot, itemID := range character.Equipment {
+		found := false
+		for _, item := range character.Inventory {
+			if item.ID == itemID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			delete(character.Equipment, slot)
+		}
+	}
+}
+
+// EquipItem 把背包中的道具装备到对应槽位，槽位上原有的装备自动换下（仍留在背包）。
+// 装备属于角色本身，和背包一样跨世界保留
+func (ms *MetaService) EquipItem(characterID, itemID string) (*models.Character, error) {
+	char, err := ms.storage.GetCharacter(characterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+	if err := equipItem(char, itemID); err != nil {
+		return nil, err
+	}
+	if err := ms.storage.UpdateCharacter(char); err != nil {
+		return nil, fmt.Errorf("保存角色失败: %w", err)
+	}
+	return char, nil
+}
+
+// equipItem 在内存中把背包里的道具装备到对应槽位（不保存）
+func equipItem(char *models.Character, itemID string) error {
+	var slot, name string
+	for _, item := range char.Inventory {
+		if item.ID == itemID {
+			slot, name = itemSlot(item), item.Name
+			if slot == "" {
+				return fmt.Errorf("%w: 「%s」无法装备", ErrInvalidInput, item.Name)
+			}
+			break
+		}
+	}
+	if slot == "" {
+		return fmt.Errorf("%w: 背包中没有这件道具", ErrNotFound)
+	}
+
+	if char.Equipment == nil {
+		char.Equipment = make(map[string]string)
+	}
+	char.Equipment[slot] = itemID
+	char.UpdatedAt = time.Now()
+
+	log.Printf("🗡️ [装备] %s 装备了「%s」（%s）\n", char.Name, name, slot)
+	return nil
+}
+
+// UnequipItem 卸下槽位上的装备，道具留在背包中
+func (ms *MetaService) UnequipItem(characterID, slot string) (*models.Character, error) {
+	if !containsString(equipmentSlots, slot) {
+		return nil, fmt.Errorf("%w: 未知装备槽「%s」", ErrInvalidInput, slot)
+	}
+
+	char, err := ms.storage.GetCharacter(characterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+	if char.Equipment[slot] == "" {
+		return char, nil
+	}
+
+	delete(char.Equipment, slot)
+	char.UpdatedAt = time.Now()
+	if err := ms.storage.UpdateCharacter(char); err != nil {
+		return nil, fmt.Errorf("保存角色失败: %w", err)
+	}
+
+	log.Printf("🗡️ [装备] %s 卸下了%s槽的装备\n", char.Name, slot)
+	return char, nil
+}
@@ -0,0 +1,29 @@
+package services
+
+import "errors"
+
+// 服务层的哨兵错误，供API层区分错误类别
+var (
+	// ErrLLMUnavailable LLM接口调用失败（网络、鉴权、限流等）
+	ErrLLMUnavailable = errors.New("LLM调用失败")
+	// ErrLLMTimeout 单次LLM请求超过配置的超时时间
+	ErrLLMTimeout = errors.New("LLM请求超时")
+	// ErrLLMInvalidResponse LLM返回的内容无法解析
+	ErrLLMInvalidResponse = errors.New("LLM返回内容无法解析")
+	// ErrStoryEnded 故事已结束，不能继续行动
+	ErrStoryEnded = errors.New("故事已结束")
+	// ErrInvalidInput 请求内容未通过业务校验
+	ErrInvalidInput = errors.New("参数不合法")
+	// ErrNotFound 请求的资源不存在（非数据库记录，如章节序号越界）
+	ErrNotFound = errors.New("资源不存在")
+	// ErrForbidden 无权访问该资源（如访问他人的故事）
+	ErrForbidden = errors.New("无权访问")
+	// ErrNotEnoughXP 经验值不足以支付消耗
+	ErrNotEnoughXP = errors.New("经验值不足")
+	// ErrUndoUnavailable 无法回退（没有历史记录，或回退次数已用完且不允许付费回退）
+	ErrUndoUnavailable = errors.New("无法回退")
+	// ErrConfirmRequired 重大不可逆行动需要玩家确认后再执行
+	ErrConfirmRequired = errors.New("需要确认")
+	// ErrStateInconsistent 故事快照与当前状态不一致（开发模式下才会返回）
+	ErrStateInconsistent = errors.New("故事状态不一致")
+)
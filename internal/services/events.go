@@ -0,0 +1,187 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// 规则事件类型（前端据此播放特效）
+const (
+	eventCriticalSuccess   = "critical_success"
+	eventCriticalFailure   = "critical_failure"
+	eventLevelUp           = "level_up"
+	eventItemGained        = "item_gained"
+	eventItemLost          = "item_lost"
+	eventTraitGained       = "trait_gained"
+	eventStatusAdded       = "status_added"
+	eventStatusRemoved     = "status_removed"
+	eventRelationMilestone = "relation_milestone"
+	eventObjectiveDone     = "objective_done"
+	eventThreatTriggered   = "threat_triggered"
+	eventThreatWeakened    = "threat_weakened"
+	eventRuleViolated      = "rule_violated"
+	eventChapterStarted    = "chapter_started"
+	eventTimeAdvanced      = "time_advanced"
+	eventBaseAttribute     = "base_attribute_changed"
+)
+
+// relationMilestone 好感度里程碑：跨过时触发 relation_milestone 事件
+type relationMilestone struct {
+	Value int
+	Label string
+}
+
+var relationMilestones = []relationMilestone{
+	{80, "倾心"},
+	{50, "亲密"},
+	{20, "友好"},
+	{-20, "反感"},
+	{-50, "敌视"},
+}
+
+// eventContext 一回合结算前后的状态，用于对比出实际发生的事件
+type eventContext struct {
+	world      *models.World
+	diceRoll   *models.DiceRoll
+	changes    models.StateChanges
+	before     models.StateSnapshot // 结算前的快照（含角色世界状态、章节、时间）
+	story      *models.StoryState   // 结算后的故事
+	charState  *models.CharacterState
+	charBefore *models.Character
+	charAfter  *models.Character
+}
+
+// collectGameEvents 按本回合实际发生的变化生成类型化事件列表
+func collectGameEvents(ec eventContext) []models.GameEvent {
+	events := []models.GameEvent{}
+	add := func(eventType, message string, data map[string]interface{}) {
+		events = append(events, models.GameEvent{Type: eventType, Message: message, Data: data})
+	}
+
+	if ec.diceRoll != nil && ec.diceRoll.Critical {
+		if ec.diceRoll.Success {
+			add(eventCriticalSuccess, "大成功！", map[string]interface{}{"roll": ec.diceRoll.Result})
+		} else {
+			add(eventCriticalFailure, "大失败！", map[string]interface{}{"roll": ec.diceRoll.Result})
+		}
+	}
+
+	if ec.charBefore != nil && ec.charAfter != nil {
+		if ec.charAfter.Level > ec.charBefore.Level {
+			add(eventLevelUp, fmt.Sprintf("升到了%d级", ec.charAfter.Level),
+				map[string]interface{}{"from": ec.charBefore.Level, "to": ec.charAfter.Level})
+		}
+		for _, trait := range ec.charAfter.Traits {
+			if !containsString(ec.charBefore.Traits, trait) {
+				info := describeTrait(trait)
+				add(eventTraitGained, fmt.Sprintf("获得特质「%s」", trait),
+					map[string]interface{}{"trait": trait, "negative": info.Negative})
+			}
+		}
+	}
+
+	for _, item := range ec.changes.ItemsGained {
+		add(eventItemGained, fmt.Sprintf("获得「%s」", item.Name),
+			map[string]interface{}{"item_id": item.ID, "name": item.Name, "quantity": item.Count()})
+	}
+	for _, itemID := range ec.changes.ItemsLost {
+		data := map[string]interface{}{"item_id": itemID}
+		message := "失去了一件道具"
+		if ec.charBefore != nil {
+			for _, item := range ec.charBefore.Inventory {
+				if item.ID == itemID {
+					data["name"] = item.Name
+					message = fmt.Sprintf("失去「%s」", item.Name)
+					break
+				}
+			}
+		}
+		add(eventItemLost, message, data)
+	}
+
+	for _, status := range ec.changes.StatusAdded {
+		add(eventStatusAdded, fmt.Sprintf("陷入「%s」状态", status), map[string]interface{}{"status": status})
+	}
+	for _, status := range ec.changes.StatusRemoved {
+		add(eventStatusRemoved, fmt.Sprintf("「%s」状态解除", status), map[string]interface{}{"status": status})
+	}
+
+	if ec.charState != nil && ec.world != nil {
+		for _, npc := range ec.world.NPCs {
+			after, ok := ec.charState.Relations[npc.ID]
+			if !ok {
+				continue
+			}
+			before, met := ec.before.CharState.Relations[npc.ID]
+			if !met {
+				before = after - ec.changes.RelationChange[npc.ID]
+			}
+			milestone, crossed := crossedRelationMilestone(before, after)
+			if !crossed {
+				continue
+			}
+			add(eventRelationMilestone, fmt.Sprintf("与%s的关系变为「%s」", npc.Name, milestone.Label),
+				map[string]interface{}{"npc_id": npc.ID, "npc_name": npc.Name, "value": after, "milestone": milestone.Value})
+		}
+	}
+
+	for _, objective := range ec.changes.ObjectivesDone {
+		add(eventObjectiveDone, fmt.Sprintf("达成目标「%s」", objective), map[string]interface{}{"objective": objective})
+	}
+	if ec.changes.ThreatTriggered != "" {
+		add(eventThreatTriggered, fmt.Sprintf("威胁爆发：%s", ec.changes.ThreatTriggered),
+			map[string]interface{}{"threat": ec.changes.ThreatTriggered})
+	}
+	if ec.changes.ThreatWeakened != "" {
+		add(eventThreatWeakened, fmt.Sprintf("反击削弱了威胁：%s", ec.changes.ThreatWeakened),
+			map[string]interface{}{"threat": ec.changes.ThreatWeakened})
+	}
+	if len(ec.changes.BaseAttributeChange) > 0 {
+		add(eventBaseAttribute, "永久改变："+describeBaseAttributeChange(ec.changes.BaseAttributeChange),
+			map[string]interface{}{"changes": ec.changes.BaseAttributeChange})
+	}
+	for _, rule := range ec.changes.RulesViolated {
+		add(eventRuleViolated, fmt.Sprintf("违反规则「%s」", rule), map[string]interface{}{"rule": rule})
+	}
+
+	if ec.story != nil {
+		if len(ec.story.Chapters) > len(ec.before.Chapters) {
+			chapter := ec.story.Chapters[len(ec.story.Chapters)-1]
+			add(eventChapterStarted, fmt.Sprintf("第%d章 %s", chapter.Index, chapter.Title),
+				map[string]interface{}{"index": chapter.Index, "title": chapter.Title})
+		}
+		if ec.story.Day != ec.before.Day || ec.story.Period != ec.before.Period {
+			add(eventTimeAdvanced, "时间流逝，现在是"+describeGameTime(ec.story.Day, ec.story.Period),
+				map[string]interface{}{"day": ec.story.Day, "period": ec.story.Period})
+		}
+	}
+
+	return events
+}
+
+// recordTurnEvents 把本回合的事件记到回合结果的叙事条目上（随叙事一起回退和分叉，供战报统计）
+func recordTurnEvents(story *models.StoryState, events []models.GameEvent) {
+	if len(events) == 0 {
+		return
+	}
+	for i := len(story.Narrative) - 1; i >= 0 && story.Narrative[i].Turn == story.Turn; i-- {
+		if story.Narrative[i].Type == "result" {
+			story.Narrative[i].Events = events
+			return
+		}
+	}
+}
+
+// crossedRelationMilestone 判断好感度是否朝远离0的方向跨过了某个里程碑
+func crossedRelationMilestone(before, after int) (relationMilestone, bool) {
+	for _, milestone := range relationMilestones {
+		if milestone.Value > 0 && before < milestone.Value && after >= milestone.Value {
+			return milestone, true
+		}
+		if milestone.Value < 0 && before > milestone.Value && after <= milestone.Value {
+			return milestone, true
+		}
+	}
+	return relationMilestone{}, false
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// maxFallbackNPCOptions 备用选项中最多针对几个在场NPC
+const maxFallbackNPCOptions = 2
+
+// sceneFallbackOptions 各场景类型的基础备用选项（未列出的场景类型使用探索类的默认选项）
+var sceneFallbackOptions = map[string][]models.Option{
+	"combat": {
+		{Label: "发起攻击", Description: "抓住机会主动出手", ActionType: "attack", Difficulty: 12, Risk: "high"},
+		{Label: "寻找掩护", Description: "躲到安全的位置，避开正面交锋", ActionType: "move", Difficulty: 10, Risk: "medium"},
+		{Label: "观察破绽", Description: "冷静观察对手的动作，寻找可乘之机", ActionType: "observe", Difficulty: 11, Risk: "low"},
+	},
+	"social": {
+		{Label: "上前搭话", Description: "找在场的人聊一聊，打听消息", ActionType: "talk", Difficulty: 10, Risk: "low"},
+		{Label: "观察众人", Description: "留意在场每个人的神情和举动", ActionType: "observe", Difficulty: 8, Risk: "low"},
+		{Label: "悄悄离开", Description: "找个机会离开这里", ActionType: "move", Difficulty: 8, Risk: "low"},
+	},
+	"puzzle": {
+		{Label: "研究线索", Description: "把已知的线索串起来推敲", ActionType: "investigate", Difficulty: 12, Risk: "low"},
+		{Label: "仔细观察", Description: "不放过任何细节", ActionType: "observe", Difficulty: 10, Risk: "low"},
+		{Label: "大胆尝试", Description: "凭直觉试一试可能的解法", ActionType: "custom", Difficulty: 13, Risk: "medium"},
+	},
+	"date": {
+		{Label: "聊聊近况", Description: "轻松地聊些彼此感兴趣的话题", ActionType: "talk", Difficulty: 8, Risk: "low"},
+		{Label: "说句情话", Description: "试着让气氛暧昧一些", ActionType: "flirt", Difficulty: 12, Risk: "medium"},
+		{Label: "四处走走", Description: "换个地方继续约会", ActionType: "move", Difficulty: 8, Risk: "low"},
+	},
+	"romance": {
+		{Label: "聊聊近况", Description: "轻松地聊些彼此感兴趣的话题", ActionType: "talk", Difficulty: 8, Risk: "low"},
+		{Label: "说句情话", Description: "试着让气氛暧昧一些", ActionType: "flirt", Difficulty: 12, Risk: "medium"},
+		{Label: "留意对方", Description: "注意对方的情绪和反应", ActionType: "observe", Difficulty: 8, Risk: "low"},
+	},
+	"temptation": {
+		{Label: "试探对方", Description: "不动声色地探探对方的意图", ActionType: "talk", Difficulty: 10, Risk: "medium"},
+		{Label: "保持清醒", Description: "冷静观察，看清眼前的局面", ActionType: "observe", Difficulty: 12, Risk: "low"},
+		{Label: "转身离开", Description: "拒绝诱惑，离开这里", ActionType: "move", Difficulty: 10, Risk: "low"},
+	},
+	"work": {
+		{Label: "埋头工作", Description: "认真完成手头的工作", ActionType: "work", Difficulty: 10, Risk: "low"},
+		{Label: "和同事聊聊", Description: "跟身边的人交流一下", ActionType: "talk", Difficulty: 8, Risk: "low"},
+		{Label: "观察四周", Description: "留意周围发生的事", ActionType: "observe", Difficulty: 8, Risk: "low"},
+	},
+	"school": {
+		{Label: "认真学习", Description: "专心钻研课业", ActionType: "study", Difficulty: 10, Risk: "low"},
+		{Label: "找同学聊天", Description: "和身边的同学聊一聊", ActionType: "talk", Difficulty: 8, Risk: "low"},
+		{Label: "四处逛逛", Description: "在校园里走走看看", ActionType: "move", Difficulty: 8, Risk: "low"},
+	},
+}
+
+// presentNPCs 返回当前场景中在场的NPC：此时段会出现、且名字出现在场景描述或最近叙事中
+func presentNPCs(world *models.World, scene *models.Scene, story *models.StoryState) []*models.NPC {
+	if world == nil {
+		return nil
+	}
+	narrative, _ := lastResult(story, scene)
+	var present []*models.NPC
+	for i := range world.NPCs {
+		npc := &world.NPCs[i]
+		if npc.Name == "" || !availableInPeriod(npc.Periods, story.Period) {
+			continue
+		}
+		if strings.Contains(scene.Description, npc.Name) || strings.Contains(narrative, npc.Name) {
+			present = append(present, npc)
+		}
+	}
+	return present
+}
+
+// npcFallbackOption 针对一个在场NPC的备用选项：战斗中对敌人出手，其他情况上前交谈
+func npcFallbackOption(scene *models.Scene, npc *models.NPC, index int) models.Option {
+	if scene.Type == "combat" && (npc.Role == "enemy" || npc.Role == "boss") {
+		return models.Option{
+			ID:          fmt.Sprintf("fallback_npc_%d", index+1),
+			Label:       "攻击" + npc.Name,
+			Description: "集中力量对付" + npc.Name,
+			ActionType:  "attack",
+			Difficulty:  13,
+			Risk:        "high",
+		}
+	}
+	return models.Option{
+		ID:          fmt.Sprintf("fallback_npc_%d", index+1),
+		Label:       "与" + npc.Name + "交谈",
+		Description: "和" + npc.Name + "聊一聊，看看对方怎么说",
+		ActionType:  "talk",
+		Difficulty:  10,
+		Risk:        "low",
+	}
+}
+
+// fallbackOptions AI生成选项失败时按本地规则拼出备用选项：场景类型的基础行动，加上针对在场NPC的选项。
+// 可互动物件和出口由 injectEnvironmentOptions 补充，保证AI不可用时游戏仍然可玩
+func (ss *StoryService) fallbackOptions(world *models.World, scene *models.Scene, story *models.StoryState) []models.Option {
+	options := ss.getDefaultOptions()
+	if base, ok := sceneFallbackOptions[scene.Type]; ok {
+		options = make([]models.Option, 0, len(base)+maxFallbackNPCOptions)
+		for i, opt := range base {
+			opt.ID = fmt.Sprintf("fallback_%d", i+1)
+			options = append(options, opt)
+		}
+	}
+	for i, npc := range presentNPCs(world, scene, story) {
+		if i >= maxFallbackNPCOptions {
+			break
+		}
+		options = append(options, npcFallbackOption(scene, npc, i))
+	}
+	return options
+}
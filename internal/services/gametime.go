@@ -0,0 +1,138 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// gamePeriods 一天中的时段（按先后顺序）
+var gamePeriods = []string{"morning", "afternoon", "evening", "night"}
+
+// plotHoldProgress 下一剧情节点不在当前时段时，推进度最多停留在此值
+const plotHoldProgress = 0.9
+
+var periodNames = map[string]string{
+	"morning":   "早上",
+	"afternoon": "下午",
+	"evening":   "傍晚",
+	"night":     "深夜",
+}
+
+// defaultTimeConfig 未配置时间流逝时使用的默认速度
+func defaultTimeConfig() models.TimeConfig {
+	return models.TimeConfig{
+		ActionsPerPeriod: 3,
+		ActionPeriods: map[string]int{
+			"move":  1,
+			"work":  2,
+			"study": 2,
+			"date":  1,
+		},
+	}
+}
+
+// timeSettings 返回生效的时间配置，两项都未配置时使用默认值
+func timeSettings(cfg models.TimeConfig) models.TimeConfig {
+	if cfg.ActionsPerPeriod == 0 && len(cfg.ActionPeriods) == 0 {
+		return defaultTimeConfig()
+	}
+	return cfg
+}
+
+// startGameTime 设置故事开始时的时间（第1天早上）
+func startGameTime(story *models.StoryState) {
+	story.Day = 1
+	story.Period = gamePeriods[0]
+	story.PeriodActions = 0
+}
+
+// periodIndex 返回时段序号，未知时段按早上处理
+func periodIndex(period string) int {
+	for i, p := range gamePeriods {
+		if p == period {
+			return i
+		}
+	}
+	return 0
+}
+
+// advanceGameTime 按行动类型推进游戏时间，返回推进的时段数。
+// 配置了时段数的行动直接推进，其他行动累计到 ActionsPerPeriod 次推进一个时段
+func advanceGameTime(story *models.StoryState, cfg models.TimeConfig, actionTypes ...string) int {
+	if story.Day == 0 {
+		startGameTime(story)
+	}
+
+	periods := 0
+	for _, actionType := range actionTypes {
+		if n, ok := cfg.ActionPeriods[actionType]; ok {
+			periods += n
+			continue
+		}
+		if cfg.ActionsPerPeriod <= 0 {
+			continue
+		}
+		story.PeriodActions++
+		if story.PeriodActions >= cfg.ActionsPerPeriod {
+			periods++
+		}
+	}
+	if periods == 0 {
+		return 0
+	}
+
+	index := periodIndex(story.Period) + periods
+	story.Day += index / len(gamePeriods)
+	story.Period = gamePeriods[index%len(gamePeriods)]
+	story.PeriodActions = 0
+	return periods
+}
+
+// describeGameTime 返回"第N天 时段"形式的时间描述
+func describeGameTime(day int, period string) string {
+	if day == 0 {
+		day = 1
+	}
+	name, ok := periodNames[period]
+	if !ok {
+		name = periodNames[gamePeriods[0]]
+	}
+	return fmt.Sprintf("第%d天 %s", day, name)
+}
+
+// availableInPeriod 时段限制为空或包含当前时段
+func availableInPeriod(periods []string, period string) bool {
+	return len(periods) == 0 || containsString(periods, period)
+}
+
+// describeTimeContext 生成给LLM参考的时间说明，包括当前时段在场的NPC
+func describeTimeContext(world *models.World, day int, period string) string {
+	var present, absent []string
+	for _, npc := range world.NPCs {
+		if availableInPeriod(npc.Periods, period) {
+			present = append(present, npc.Name)
+		} else {
+			absent = append(absent, npc.Name)
+		}
+	}
+
+	text := describeGameTime(day, period)
+	if len(present) > 0 {
+		text += "；此时段在场的角色：" + strings.Join(present, "、")
+	}
+	if len(absent) > 0 {
+		text += "；此时段不会出现：" + strings.Join(absent, "、")
+	}
+	return text
+}
+
+// gameTimeInfo 返回故事当前的游戏时间
+func gameTimeInfo(story *models.StoryState) *models.GameTime {
+	return &models.GameTime{
+		Day:    story.Day,
+		Period: story.Period,
+		Label:  describeGameTime(story.Day, story.Period),
+	}
+}
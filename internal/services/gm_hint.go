@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// defaultGMHintConfig 未配置GM提示时的默认阈值：连续4回合进度增幅都不到5%
+func defaultGMHintConfig() models.GMHintConfig {
+	return models.GMHintConfig{StallTurns: 4, MinProgress: 0.05}
+}
+
+// gmHintSettings 返回生效的GM提示配置，未配置的项使用默认值
+func gmHintSettings(cfg models.GMHintConfig) models.GMHintConfig {
+	defaults := defaultGMHintConfig()
+	if cfg.StallTurns == 0 {
+		cfg.StallTurns = defaults.StallTurns
+	}
+	if cfg.MinProgress <= 0 {
+		cfg.MinProgress = defaults.MinProgress
+	}
+	return cfg
+}
+
+// recentNarrativeLimit GM提示参考的最近叙事条数
+const recentNarrativeLimit = 6
+
+// trackPlotStall 记录剧情进度停滞的回合数，连续停滞达到阈值时插入一条GM旁白提示方向并重新计数。
+// 提示只作引导，不改变进度；推进到新节点或进度明显增长时清零
+func (ss *StoryService) trackPlotStall(ctx context.Context, story *models.StoryState, world *models.World,
+	currentNode, nextNode *models.PlotNode, gained float64, reached bool) {
+
+	cfg := gmHintSettings(ss.meta.GameConfig().GMHint)
+	if cfg.StallTurns < 0 || reached || gained >= cfg.MinProgress {
+		story.StalledTurns = 0
+		return
+	}
+
+	story.StalledTurns++
+	if story.StalledTurns < cfg.StallTurns {
+		return
+	}
+	story.StalledTurns = 0
+
+	recent := story.Narrative
+	if len(recent) > recentNarrativeLimit {
+		recent = recent[len(recent)-recentNarrativeLimit:]
+	}
+	hint, err := ss.llm.GenerateGMHint(ctx, world, currentNode, nextNode, recent)
+	if err != nil || hint == "" {
+		log.Printf("⚠️ 生成GM提示失败，使用默认提示: %v\n", err)
+		hint = fallbackGMHint(nextNode)
+	}
+
+	log.Printf("🧭 [GM提示] 剧情已停滞%d回合：%s\n", cfg.StallTurns, hint)
+	story.Narrative = append(story.Narrative, models.NarrativeLog{
+		Turn:      story.Turn,
+		Type:      "system",
+		Content:   "🧭 GM提示：" + hint,
+		Timestamp: time.Now(),
+	})
+}
+
+// fallbackGMHint AI不可用时，按下一剧情节点的地点和人物给出提示
+func fallbackGMHint(nextNode *models.PlotNode) string {
+	switch {
+	case nextNode.Location != "" && len(nextNode.KeyNPCs) > 0:
+		return fmt.Sprintf("也许该去%s看看，%s或许知道些什么。", nextNode.Location, strings.Join(nextNode.KeyNPCs, "、"))
+	case nextNode.Location != "":
+		return fmt.Sprintf("也许该去%s看看。", nextNode.Location)
+	case len(nextNode.KeyNPCs) > 0:
+		return fmt.Sprintf("%s或许知道些什么。", strings.Join(nextNode.KeyNPCs, "、"))
+	default:
+		return "四处转转吧，线索也许就在不远处。"
+	}
+}
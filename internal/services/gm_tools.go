@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// SetPlot GM工具：直接把故事跳到指定剧情节点和推进度，便于测试后期剧情。
+// generateScene 为 true 时切换节点后生成承接当前场景的新场景（生成失败时留在原场景）
+func (ss *StoryService) SetPlot(ctx context.Context, storyID, nodeID string, progress float64,
+	generateScene bool) (*models.LoadedStory, error) {
+
+	if progress < 0 || progress > 1 {
+		return nil, fmt.Errorf("%w: 推进度必须在0到1之间", ErrInvalidInput)
+	}
+
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	world, err := ss.storyWorld(story)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+	node := findPlotNode(world, nodeID)
+	if node == nil {
+		return nil, fmt.Errorf("%w: 世界中没有剧情节点「%s」", ErrNotFound, nodeID)
+	}
+	scene, err := ss.storage.GetScene(story.SceneID)
+	if err != nil {
+		return nil, fmt.Errorf("获取场景失败: %w", err)
+	}
+
+	log.Printf("🛠️ [GM] 故事 %s 剧情跳转到「%s」，推进度 %.0f%%\n", story.ID, node.Name, progress*100)
+
+	if story.CurrentPlotNodeID != node.ID {
+		story.CurrentPlotNodeID = node.ID
+		openChapter(story, node.Name, node.ID, story.Turn+1)
+	}
+	story.PlotProgress = progress
+	story.StalledTurns = 0
+	story.Narrative = append(story.Narrative, models.NarrativeLog{
+		Turn:      story.Turn,
+		Type:      "system",
+		Content:   fmt.Sprintf("🛠️ 【GM】剧情跳转到「%s」\n\n%s", node.Name, node.Description),
+		Timestamp: time.Now(),
+	})
+
+	if generateScene {
+		character, err := ss.storage.GetCharacter(story.CharacterID)
+		if err != nil {
+			return nil, fmt.Errorf("获取角色失败: %w", err)
+		}
+		scene = ss.continueScene(ctx, story, world, character, scene)
+	}
+
+	story.UpdatedAt = time.Now()
+	if err := ss.storage.UpdateStoryState(story); err != nil {
+		return nil, fmt.Errorf("更新故事状态失败: %w", err)
+	}
+
+	return &models.LoadedStory{Story: story, Scene: scene, CharState: story.CharState}, nil
+}
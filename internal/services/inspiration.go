@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// inspirationParameter 行动参数中表示愿意为灵感迸发消耗的经验值的键
+const inspirationParameter = "spend_xp_for_bonus"
+
+// defaultInspirationConfig 未配置灵感迸发时的默认值：每10点经验值换1点加值，最多+5，每个场景1次
+func defaultInspirationConfig() models.InspirationConfig {
+	return models.InspirationConfig{XPPerPoint: 10, MaxBonus: 5, PerScene: 1}
+}
+
+// inspirationSettings 返回生效的灵感迸发配置，未配置的项使用默认值
+func inspirationSettings(cfg models.InspirationConfig) models.InspirationConfig {
+	defaults := defaultInspirationConfig()
+	if cfg.XPPerPoint <= 0 {
+		cfg.XPPerPoint = defaults.XPPerPoint
+	}
+	if cfg.MaxBonus <= 0 {
+		cfg.MaxBonus = defaults.MaxBonus
+	}
+	if cfg.PerScene == 0 {
+		cfg.PerScene = defaults.PerScene
+	}
+	return cfg
+}
+
+// inspirationBonus 把愿意消耗的经验值换算成检定加值和实际消耗（多出的零头不扣）
+func inspirationBonus(offered int, cfg models.InspirationConfig) (bonus, xp int) {
+	bonus = min(offered/cfg.XPPerPoint, cfg.MaxBonus)
+	return bonus, bonus * cfg.XPPerPoint
+}
+
+// spendInspiration 检定前结算灵感迸发：校验本场景的使用次数并在内存中扣除 char 的经验值（随回合一起保存），
+// 返回本次行动的检定加值。校验不通过或经验值不足时返回错误，不做任何修改
+func (ss *StoryService) spendInspiration(story *models.StoryState, char *models.Character, action models.Action) (int, error) {
+	raw := strings.TrimSpace(action.Parameters[inspirationParameter])
+	if raw == "" {
+		return 0, nil
+	}
+	offered, err := strconv.Atoi(raw)
+	if err != nil || offered <= 0 {
+		return 0, fmt.Errorf("%w: %s 必须是正整数", ErrInvalidInput, inspirationParameter)
+	}
+
+	cfg := inspirationSettings(ss.meta.GameConfig().Inspiration)
+	bonus, xp := inspirationBonus(offered, cfg)
+	switch {
+	case cfg.PerScene < 0:
+		return 0, fmt.Errorf("%w: 灵感迸发未开放", ErrForbidden)
+	case bonus == 0:
+		return 0, fmt.Errorf("%w: 灵感迸发至少需要消耗 %d 点经验值", ErrInvalidInput, cfg.XPPerPoint)
+	case story.InspirationUses[story.SceneID] >= cfg.PerScene:
+		return 0, fmt.Errorf("%w: 本场景的 %d 次灵感迸发已经用完", ErrInvalidInput, cfg.PerScene)
+	}
+
+	if err := spendXP(char, xp); err != nil {
+		return 0, fmt.Errorf("灵感迸发需要消耗经验值: %w", err)
+	}
+	if story.InspirationUses == nil {
+		story.InspirationUses = make(map[string]int)
+	}
+	story.InspirationUses[story.SceneID]++
+
+	log.Printf("💡 [灵感迸发] 消耗 %d 点经验值，本次检定 +%d（剩余经验值 %d）\n", xp, bonus, char.XP)
+	return bonus, nil
+}
+
+// applyInspiration 把灵感迸发的加值计入检定并记录来源（大成功/大失败由骰面决定，不受加值影响）
+func applyInspiration(diceRoll *models.DiceRoll, bonus int) {
+	if bonus == 0 {
+		return
+	}
+	diceRoll.Modifier += bonus
+	diceRoll.Bonus += bonus
+	diceRoll.BonusSource = fmt.Sprintf("灵感迸发 +%d", bonus)
+	if !diceRoll.Critical {
+		diceRoll.Success = diceRoll.Result+diceRoll.Modifier >= diceRoll.Target
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// 可使用的道具类型
+const (
+	itemConsumable = "consumable" // 消耗品：恢复HP/理智，用后减少一个
+	itemKeyItem    = "key_item"   // 关键道具：触发剧情旗标，不会消耗
+)
+
+// 道具属性：消耗品恢复的HP/理智（如 "+20"），关键道具触发的剧情旗标
+const (
+	hpProperty   = "hp"
+	sanProperty  = "san"
+	flagProperty = "flag"
+)
+
+// consumableRecoveryRatio 消耗品没有写明恢复量时，恢复HP上限的比例
+const consumableRecoveryRatio = 0.25
+
+// UseItem 使用背包中的道具：消耗品恢复HP/理智并减少一个，关键道具设置剧情旗标，可装备的道具直接装备。
+// 使用结果写入角色最近进行中的故事；消耗品和关键道具作用于故事所在的世界，没有进行中的故事时不能使用。
+// 角色、角色状态和故事在一个事务里保存，故事在此期间被其他请求改动时返回版本冲突且不做任何修改
+func (ms *MetaService) UseItem(characterID, itemID, target string) (*models.ItemUseResult, error) {
+	char, err := ms.storage.GetCharacter(characterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+	var item *models.Item
+	for i := range char.Inventory {
+		if char.Inventory[i].ID == itemID {
+			item = &char.Inventory[i]
+			break
+		}
+	}
+	if item == nil {
+		return nil, fmt.Errorf("%w: 背包中没有这件道具", ErrNotFound)
+	}
+	used := *item
+	slot := itemSlot(used)
+	if slot == "" && used.Type != itemConsumable && used.Type != itemKeyItem {
+		return nil, fmt.Errorf("%w: 「%s」无法使用", ErrInvalidInput, used.Name)
+	}
+
+	story, err := ms.latestActiveStory(characterID)
+	if err != nil {
+		return nil, err
+	}
+	if story == nil && slot == "" {
+		return nil, fmt.Errorf("%w: 角色没有进行中的故事，无法使用「%s」", ErrNotFound, used.Name)
+	}
+
+	result := &models.ItemUseResult{Item: used}
+	var state *models.CharacterState
+	if slot != "" {
+		if err := equipItem(char, itemID); err != nil {
+			return nil, err
+		}
+		result.Message = fmt.Sprintf("🗡️ 你装备了「%s」", used.Name)
+	} else {
+		// 在故事线记录的状态上结算（旧数据没有记录时使用共享状态）
+		if story.CharState != nil && story.CharState.CharacterID == characterID && story.CharState.WorldID == story.WorldID {
+			state = cloneCharacterState(story.CharState)
+		} else if state, err = ms.storage.GetCharacterState(characterID, story.WorldID); err != nil {
+			return nil, fmt.Errorf("获取角色状态失败: %w", err)
+		}
+
+		changes, message := itemUseChanges(used, state, target)
+		ms.ApplyChanges(char, state, changes)
+		// 恢复后可能脱离危机阶段
+		if crisis := crisisStatusChanges(state, ms.ruleEngine.CrisisThreshold()); len(crisis.StatusAdded)+len(crisis.StatusRemoved) > 0 {
+			ms.ApplyChanges(char, state, crisis)
+			changes.StatusAdded = append(changes.StatusAdded, crisis.StatusAdded...)
+			changes.StatusRemoved = append(changes.StatusRemoved, crisis.StatusRemoved...)
+			if len(crisis.StatusRemoved) > 0 {
+				message += fmt.Sprintf("，「%s」状态解除", strings.Join(crisis.StatusRemoved, "、"))
+			}
+		}
+
+		for _, flag := range changes.FlagsSet {
+			if !containsString(story.Flags, flag) {
+				story.Flags = append(story.Flags, flag)
+			}
+		}
+		story.CharState = state
+		result.Changes = changes
+		result.Message = message
+		result.CharState = state
+	}
+	result.Character = char
+
+	if story == nil {
+		if err := ms.storage.UpdateCharacter(char); err != nil {
+			return nil, fmt.Errorf("保存角色失败: %w", err)
+		}
+	} else {
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   result.Message,
+			Timestamp: time.Now(),
+		})
+		story.UpdatedAt = time.Now()
+		if err := ms.storage.CommitStory(story, char, state); err != nil {
+			return nil, fmt.Errorf("更新故事状态失败: %w", err)
+		}
+		result.StoryID = story.ID
+	}
+
+	log.Printf("🎒 [道具] %s 使用了「%s」：%s\n", char.Name, used.Name, result.Message)
+	return result, nil
+}
+
+// latestActiveStory 返回角色最近进行中的故事，没有时返回 nil
+func (ms *MetaService) latestActiveStory(characterID string) (*models.StoryState, error) {
+	stories, err := ms.storage.ListActiveStoriesByCharacter(characterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取进行中的故事失败: %w", err)
+	}
+	if len(stories) == 0 {
+		return nil, nil
+	}
+	story, err := ms.storage.GetStoryState(stories[0].StoryID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	return story, nil
+}
+
+// itemUseChanges 消耗品和关键道具产生的状态变化及使用说明
+func itemUseChanges(item models.Item, state *models.CharacterState, target string) (models.StateChanges, string) {
+	var changes models.StateChanges
+	action := fmt.Sprintf("你使用了「%s」", item.Name)
+	if target != "" {
+		action = fmt.Sprintf("你对「%s」使用了「%s」", target, item.Name)
+	}
+
+	if item.Type == itemKeyItem {
+		flag := item.Properties[flagProperty]
+		if flag == "" {
+			flag = "used_" + item.ID
+		}
+		changes.FlagsSet = []string{flag}
+		return changes, "🗝️ " + action
+	}
+
+	changes.ItemsLost = []string{item.ID}
+	changes.HPChange = propertyBonus(item.Properties[hpProperty])
+	changes.SANChange = propertyBonus(item.Properties[sanProperty])
+	if changes.HPChange == 0 && changes.SANChange == 0 {
+		changes.HPChange = int(math.Ceil(float64(state.MaxHP) * consumableRecoveryRatio))
+	}
+
+	// 说明里写实际变化量（HP/理智不会超出上限或低于0）
+	var effects []string
+	if changes.HPChange != 0 {
+		effects = append(effects, fmt.Sprintf("HP %+d", max(0, min(state.HP+changes.HPChange, state.MaxHP))-state.HP))
+	}
+	if changes.SANChange != 0 {
+		effects = append(effects, fmt.Sprintf("理智 %+d", max(0, min(state.SAN+changes.SANChange, state.MaxSAN))-state.SAN))
+	}
+	return changes, fmt.Sprintf("🧪 %s，%s", action, strings.Join(effects, "、"))
+}
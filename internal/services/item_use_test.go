@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+func TestUseItemIsRevertedByUndo(t *testing.T) {
+	env := newTestStoryEnv(t, 12)
+
+	char, err := env.store.GetCharacter(env.char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	char.Inventory = []models.Item{{ID: "potion", Name: "草药", Type: itemConsumable,
+		Properties: map[string]string{hpProperty: "+5"}, Quantity: 2}}
+	if err := env.store.UpdateCharacter(char); err != nil {
+		t.Fatalf("保存角色失败: %v", err)
+	}
+
+	env.act(t, "在码头边打听消息")
+	before, err := env.store.GetStoryState(env.state.ID)
+	if err != nil {
+		t.Fatalf("获取故事失败: %v", err)
+	}
+
+	result, err := env.meta.UseItem(char.ID, "potion", "")
+	if err != nil {
+		t.Fatalf("使用道具失败: %v", err)
+	}
+	if result.StoryID != env.state.ID {
+		t.Fatalf("使用结果应写入故事 %s，实际 %s", env.state.ID, result.StoryID)
+	}
+	story, err := env.store.GetStoryState(env.state.ID)
+	if err != nil {
+		t.Fatalf("获取故事失败: %v", err)
+	}
+	if story.Version != before.Version+1 {
+		t.Errorf("使用道具应让故事版本加一：%d → %d", before.Version, story.Version)
+	}
+	if got := inventoryCount(t, env, "potion"); got != 1 {
+		t.Fatalf("使用后应剩 1 个草药，实际 %d", got)
+	}
+
+	if _, err := env.story.UndoTurn(env.state.ID); err != nil {
+		t.Fatalf("回退失败: %v", err)
+	}
+	if got := inventoryCount(t, env, "potion"); got != 2 {
+		t.Errorf("回退后背包应回到回合开始前的 2 个草药，实际 %d", got)
+	}
+}
+
+// inventoryCount 角色背包中某道具的数量
+func inventoryCount(t *testing.T, env *testStoryEnv, itemID string) int {
+	t.Helper()
+	char, err := env.store.GetCharacter(env.char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	for _, item := range char.Inventory {
+		if item.ID == itemID {
+			return item.Count()
+		}
+	}
+	return 0
+}
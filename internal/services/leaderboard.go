@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/google/uuid"
+)
+
+// maxedRelation 视为满好感的好感度（最高一档里程碑）
+var maxedRelation = relationMilestones[0].Value
+
+// recordWorldClear 故事通关时写入通关记录，供世界排行榜使用；记录失败只打日志，不影响本回合
+func (ss *StoryService) recordWorldClear(story *models.StoryState, world *models.World, character *models.Character,
+	charState *models.CharacterState) {
+
+	maxed := 0
+	for _, npc := range world.NPCs {
+		if charState.Relations[npc.ID] >= maxedRelation {
+			maxed++
+		}
+	}
+
+	clear := &models.WorldClear{
+		ID:                uuid.New().String(),
+		WorldID:           world.ID,
+		StoryID:           story.ID,
+		CharacterID:       character.ID,
+		CharacterName:     character.Name,
+		Turns:             story.Turn,
+		Days:              story.Day,
+		EndingID:          story.EndingID,
+		MaxedRelations:    maxed,
+		AllRelationsMaxed: len(world.NPCs) > 0 && maxed == len(world.NPCs),
+		CreatedAt:         time.Now(),
+	}
+	if err := ss.storage.CreateWorldClear(clear); err != nil {
+		log.Printf("⚠️ 记录通关失败: %v\n", err)
+		return
+	}
+	log.Printf("🏆 [通关] %s 用 %d 回合通关「%s」（满好感 %d/%d）\n", character.Name, story.Turn, world.Name, maxed, len(world.NPCs))
+}
+
+// WorldLeaderboard 分页获取世界的通关排行榜及记录计数，补充角色当前等级
+func (ss *StoryService) WorldLeaderboard(worldID string, page models.Page) ([]models.WorldClear, models.ListCount, error) {
+	if _, err := ss.storage.GetWorld(worldID); err != nil {
+		return nil, models.ListCount{}, fmt.Errorf("获取世界失败: %w", err)
+	}
+	clears, count, err := ss.storage.GetWorldLeaderboard(worldID, page)
+	if err != nil {
+		return nil, count, err
+	}
+
+	// 一次批量取回上榜的角色（已删除的角色保留通关时记录的名字）
+	characterIDs := make([]string, 0, len(clears))
+	for _, clear := range clears {
+		characterIDs = append(characterIDs, clear.CharacterID)
+	}
+	characters, err := ss.storage.GetCharactersByIDs(characterIDs)
+	if err != nil {
+		return nil, count, fmt.Errorf("获取角色失败: %w", err)
+	}
+	for i := range clears {
+		if char, ok := characters[clears[i].CharacterID]; ok {
+			clears[i].CharacterLevel = char.Level
+		}
+	}
+
+	return clears, count, nil
+}
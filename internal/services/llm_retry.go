@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 重试默认值
+const (
+	defaultMaxRetries     = 3                // 默认最多重试次数
+	maxRetriesLimit       = 5                // 配置的重试次数上限，避免一次请求等待过久
+	defaultRetryBackoffMs = 500              // 默认首次退避时间（毫秒）
+	retryBackoffFactor    = 2                // 每次重试退避时间的倍数
+	maxRetryBackoff       = 10 * time.Second // 单次退避时间上限
+	defaultTimeoutSeconds = 120              // 默认单次请求超时（秒）
+)
+
+// requestTimeout 按配置计算单次请求的超时时间：0 使用默认值，负数不限制
+func requestTimeout(config models.LLMConfig) time.Duration {
+	switch {
+	case config.TimeoutSeconds < 0:
+		return 0
+	case config.TimeoutSeconds == 0:
+		return defaultTimeoutSeconds * time.Second
+	}
+	return time.Duration(config.TimeoutSeconds) * time.Second
+}
+
+// retrySettings 按配置计算重试次数和首次退避时间：0 表示使用默认值，重试次数为负数时不重试
+func retrySettings(config models.LLMConfig) (int, time.Duration) {
+	retries := config.MaxRetries
+	switch {
+	case retries < 0:
+		retries = 0
+	case retries == 0:
+		retries = defaultMaxRetries
+	case retries > maxRetriesLimit:
+		retries = maxRetriesLimit
+	}
+	backoff := config.RetryBackoffMs
+	if backoff <= 0 {
+		backoff = defaultRetryBackoffMs
+	}
+	return retries, time.Duration(backoff) * time.Millisecond
+}
+
+// retryableLLMError 判断LLM调用错误是否值得重试：429限流和5xx临时错误重试，
+// 其他HTTP错误（密钥无效、请求格式错误等）重试也没用；超时和取消不重试，网络错误重试
+func retryableLLMError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		status = reqErr.HTTPStatusCode
+	default:
+		return true
+	}
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// createWithTimeout 发起一次对话补全请求，每次请求单独计时；
+// 超过配置的超时时间时返回 ErrLLMTimeout（调用方自己取消或到期的 ctx 原样返回）
+func (settings llmSettings) createWithTimeout(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if settings.timeout <= 0 {
+		return settings.client.CreateChatCompletion(ctx, req)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, settings.timeout)
+	defer cancel()
+	resp, err := settings.client.CreateChatCompletion(attemptCtx, req)
+	if err != nil {
+		return resp, settings.timeoutError(ctx, attemptCtx, req, err)
+	}
+	return resp, nil
+}
+
+// timeoutError 请求因超过配置的超时时间失败时包装为 ErrLLMTimeout，其他错误原样返回
+func (settings llmSettings) timeoutError(ctx, attemptCtx context.Context, req openai.ChatCompletionRequest, err error) error {
+	if ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		log.Printf("⏱️ [LLM超时] 超过%v未响应，Model: %s\n", settings.timeout, req.Model)
+		return fmt.Errorf("%w: %w", ErrLLMTimeout, attemptCtx.Err())
+	}
+	return err
+}
+
+// callWithRetry 发起对话补全请求，遇到限流或临时错误时按指数退避重试（超时不重试）
+func callWithRetry(ctx context.Context, settings llmSettings, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return withRetry(ctx, settings, req.Model, func() (openai.ChatCompletionResponse, error) {
+		return settings.createWithTimeout(ctx, req)
+	})
+}
+
+// withRetry 按配置的重试次数和指数退避反复调用 call，直到成功或遇到不值得重试的错误
+func withRetry[T any](ctx context.Context, settings llmSettings, model string, call func() (T, error)) (T, error) {
+	backoff := settings.retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := call()
+		if err == nil || attempt >= settings.maxRetries || !retryableLLMError(err) {
+			return resp, err
+		}
+
+		log.Printf("🔁 [LLM重试] 第%d/%d次重试（%v 后），Model: %s，错误: %v\n",
+			attempt+1, settings.maxRetries, backoff, model, err)
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*retryBackoffFactor, maxRetryBackoff)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 演示模式模拟流式输出：每次发送的字数和间隔
+const (
+	demoStreamChunkRunes = 6
+	demoStreamInterval   = 40 * time.Millisecond
+)
+
+// openStreamWithTimeout 建立一次流式对话补全请求，超时计时覆盖整个流的读取过程；
+// 返回的 cancel 必须在读完流后调用
+func (settings llmSettings) openStreamWithTimeout(ctx context.Context, req openai.ChatCompletionRequest) (*openai.ChatCompletionStream, context.Context, context.CancelFunc, error) {
+	streamCtx, cancel := ctx, context.CancelFunc(func() {})
+	if settings.timeout > 0 {
+		streamCtx, cancel = context.WithTimeout(ctx, settings.timeout)
+	}
+	stream, err := settings.client.CreateChatCompletionStream(streamCtx, req)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, settings.timeoutError(ctx, streamCtx, req, err)
+	}
+	return stream, streamCtx, cancel, nil
+}
+
+// chatStream 以流式方式发起对话补全请求，每收到一段文本就发送到 out（不会关闭 out），返回完整文本。
+// 只有建立连接失败时才重试：已经发送给调用方的片段无法撤回。
+// 流式响应不带token用量（当前SDK版本不支持 stream_options），因此不记录用量
+func (llm *LLMService) chatStream(ctx context.Context, settings llmSettings, kind string, req openai.ChatCompletionRequest, out chan<- string) (string, error) {
+	req = settings.capMaxTokens(req)
+
+	if settings.demo {
+		return demoStream(ctx, demoContent(kind), out)
+	}
+
+	type openedStream struct {
+		stream    *openai.ChatCompletionStream
+		streamCtx context.Context
+		cancel    context.CancelFunc
+	}
+	opened, err := withRetry(ctx, settings, req.Model, func() (openedStream, error) {
+		stream, streamCtx, cancel, err := settings.openStreamWithTimeout(ctx, req)
+		return openedStream{stream, streamCtx, cancel}, err
+	})
+	if err != nil {
+		return "", err
+	}
+	defer opened.cancel()
+	defer opened.stream.Close()
+
+	var content strings.Builder
+	for {
+		resp, err := opened.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return content.String(), nil
+		}
+		if err != nil {
+			return content.String(), settings.timeoutError(ctx, opened.streamCtx, req, err)
+		}
+		if len(resp.Choices) == 0 || resp.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := resp.Choices[0].Delta.Content
+		content.WriteString(delta)
+		select {
+		case out <- delta:
+		case <-ctx.Done():
+			return content.String(), ctx.Err()
+		}
+	}
+}
+
+// demoStream 演示模式下把预置文本切成小段逐段发送，模拟流式输出
+func demoStream(ctx context.Context, content string, out chan<- string) (string, error) {
+	runes := []rune(content)
+	for start := 0; start < len(runes); start += demoStreamChunkRunes {
+		chunk := string(runes[start:min(start+demoStreamChunkRunes, len(runes))])
+		select {
+		case out <- chunk:
+		case <-ctx.Done():
+			return string(runes[:start]), ctx.Err()
+		}
+		time.Sleep(demoStreamInterval)
+	}
+	return content, nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// headerTransport 给每个请求补上配置的默认请求头（不覆盖客户端自己设置的，如 Authorization）
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		if req.Header.Get(key) == "" {
+			req.Header.Set(key, value)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newLLMHTTPClient 按配置构造访问LLM接口的HTTP客户端：可走HTTP代理、附加默认请求头。
+// 两者都没配置时返回 nil，使用 go-openai 的默认客户端；代理地址无效时忽略代理并记录告警
+func newLLMHTTPClient(config models.LLMConfig) *http.Client {
+	if config.ProxyURL == "" && len(config.Headers) == 0 {
+		return nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			// 无法解析的地址可能原样带着账号密码，不打印
+			log.Printf("⚠️ LLM代理地址无效（应为 http://host:port 形式），已忽略\n")
+		} else {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if len(config.Headers) > 0 {
+		roundTripper = &headerTransport{base: transport, headers: config.Headers}
+	}
+	return &http.Client{Transport: roundTripper}
+}
+
+// redactProxyURL 隐藏代理地址中的密码，用于打印日志；无效的地址整体隐藏
+func redactProxyURL(proxy string) string {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || proxyURL.Host == "" {
+		return "（无效地址）"
+	}
+	return proxyURL.Redacted()
+}
@@ -2,6 +2,9 @@ package services
 
 import (
 	"database/sql"
+	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/aiwuxian/project-abyss/internal/models"
@@ -9,36 +12,100 @@ import (
 	"github.com/google/uuid"
 )
 
+// generatedRequestTTL AI角色生成请求的幂等记录保留时长（客户端重试都发生在这段时间内）
+const generatedRequestTTL = 30 * time.Minute
+
+// generatedRequest 已完成的AI角色生成请求
+type generatedRequest struct {
+	characterID string
+	createdAt   time.Time
+}
+
 type MetaService struct {
-	storage *storage.Storage
-	config  models.GameConfig
+	storage    *storage.Storage
+	ruleEngine *RuleEngine
+	mu         sync.RWMutex
+	config     models.GameConfig
+
+	// 已完成的AI角色生成请求（request_id -> 角色ID），用于重试时保持幂等，
+	// 仅保存在内存中，超过 generatedRequestTTL 的记录会被清理
+	generatedMu sync.Mutex
+	generated   map[string]generatedRequest
 }
 
-func NewMetaService(storage *storage.Storage, config models.GameConfig) *MetaService {
+func NewMetaService(storage *storage.Storage, ruleEngine *RuleEngine, config models.GameConfig) *MetaService {
 	return &MetaService{
-		storage: storage,
-		config:  config,
+		storage:    storage,
+		ruleEngine: ruleEngine,
+		config:     config,
+		generated:  make(map[string]generatedRequest),
+	}
+}
+
+// GameConfig 返回当前的游戏配置
+func (ms *MetaService) GameConfig() models.GameConfig {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.config
+}
+
+// SetGameConfig 热更新游戏配置
+func (ms *MetaService) SetGameConfig(config models.GameConfig) {
+	ms.mu.Lock()
+	ms.config = config
+	ms.mu.Unlock()
+}
+
+// GeneratedCharacter 查找同一 request_id 之前生成的角色
+func (ms *MetaService) GeneratedCharacter(requestID string) (*models.Character, bool) {
+	if requestID == "" {
+		return nil, false
+	}
+	ms.generatedMu.Lock()
+	generated, ok := ms.generated[requestID]
+	ms.generatedMu.Unlock()
+	if !ok || time.Since(generated.createdAt) > generatedRequestTTL {
+		return nil, false
+	}
+
+	char, err := ms.storage.GetCharacter(generated.characterID)
+	if err != nil {
+		return nil, false
+	}
+	return char, true
+}
+
+// RememberGeneratedCharacter 记录 request_id 对应生成的角色，同时清理过期的记录
+func (ms *MetaService) RememberGeneratedCharacter(requestID, characterID string) {
+	if requestID == "" {
+		return
+	}
+	ms.generatedMu.Lock()
+	defer ms.generatedMu.Unlock()
+	now := time.Now()
+	for id, generated := range ms.generated {
+		if now.Sub(generated.createdAt) > generatedRequestTTL {
+			delete(ms.generated, id)
+		}
 	}
+	ms.generated[requestID] = generatedRequest{characterID: characterID, createdAt: now}
 }
 
 // CreateCharacter 创建新角色（手动创建）
 func (ms *MetaService) CreateCharacter(char *models.Character) (*models.Character, error) {
-	// 如果没有基础属性，使用默认值
-	if char.BaseAttributes == nil || len(char.BaseAttributes) == 0 {
-		char.BaseAttributes = map[string]int{
-			"strength":     10,
-			"dexterity":    10,
-			"intelligence": 10,
-			"charisma":     10,
-			"perception":   10,
-		}
+	// 如果没有基础属性，使用配置的默认值；每项属性限制在上下限内
+	settings := ms.AttributeSettings()
+	if len(char.BaseAttributes) == 0 {
+		char.BaseAttributes = defaultBaseAttributes(settings)
 	}
+	char.BaseAttributes = clampAttributes(char.BaseAttributes, settings)
 
 	char.ID = uuid.New().String()
 	char.Level = 1
 	char.XP = 0
 	char.Traits = []string{}
 	char.Inventory = []models.Item{}
+	char.Equipment = map[string]string{}
 	char.CreatedAt = time.Now()
 	char.UpdatedAt = time.Now()
 
@@ -54,9 +121,9 @@ func (ms *MetaService) GetCharacter(id string) (*models.Character, error) {
 	return ms.storage.GetCharacter(id)
 }
 
-// GetAllCharacters 获取所有角色
-func (ms *MetaService) GetAllCharacters() ([]models.Character, error) {
-	return ms.storage.GetAllCharacters()
+// GetAllCharacters 分页获取角色列表及记录计数
+func (ms *MetaService) GetAllCharacters(page models.Page) ([]models.Character, models.ListCount, error) {
+	return ms.storage.GetAllCharacters(page)
 }
 
 // InitCharacterInWorld 初始化角色在新世界的状态
@@ -71,23 +138,38 @@ func (ms *MetaService) InitCharacterInWorld(characterID, worldID string, world *
 		return nil, err
 	}
 
-	// 获取角色信息
+	return ms.newCharacterState(characterID, worldID, world)
+}
+
+// ResetCharacterInWorld 重置角色在世界中的状态（周目+重新开始时使用），
+// 等级、特质和背包属于角色本身，不受影响
+func (ms *MetaService) ResetCharacterInWorld(characterID, worldID string, world *models.World) (*models.CharacterState, error) {
+	return ms.newCharacterState(characterID, worldID, world)
+}
+
+// newCharacterState 按角色属性和世界生成初始状态并保存（已有状态会被覆盖）：高难世界压低HP/SAN上限，
+// 世界归属宇宙时继承同一宇宙其他世界的声望和NPC好感
+func (ms *MetaService) newCharacterState(characterID, worldID string, world *models.World) (*models.CharacterState, error) {
 	char, err := ms.storage.GetCharacter(characterID)
 	if err != nil {
 		return nil, err
 	}
 
-	// 创建新状态
-	state = &models.CharacterState{
+	config := ms.GameConfig()
+	maxHP, maxSAN := dangerousVitals(config, world.Difficulty, char.Level)
+	state := &models.CharacterState{
 		CharacterID: characterID,
 		WorldID:     worldID,
-		HP:          ms.config.DefaultHP,
-		MaxHP:       ms.config.DefaultHP,
-		SAN:         ms.config.DefaultSAN,
-		MaxSAN:      ms.config.DefaultSAN,
+		HP:          maxHP,
+		MaxHP:       maxHP,
+		SAN:         maxSAN,
+		MaxSAN:      maxSAN,
 		Attributes:  ms.calculateAttributes(char, world),
 		Status:      []string{},
-		Relations:   ms.initRelations(world),
+		Relations:   ms.initRelations(world, 0),
+	}
+	if err := ms.inheritUniverse(state, world); err != nil {
+		return nil, err
 	}
 
 	if err := ms.storage.SaveCharacterState(state); err != nil {
@@ -106,14 +188,8 @@ func (ms *MetaService) calculateAttributes(char *models.Character, world *models
 			attrs[k] = v
 		}
 	} else {
-		// 如果没有基础属性，使用默认值
-		attrs = map[string]int{
-			"strength":     10,
-			"dexterity":    10,
-			"intelligence": 10,
-			"charisma":     10,
-			"perception":   10,
-		}
+		// 如果没有基础属性，使用配置的默认值
+		attrs = defaultBaseAttributes(ms.AttributeSettings())
 	}
 
 	// 根据等级加成
@@ -122,75 +198,132 @@ func (ms *MetaService) calculateAttributes(char *models.Character, world *models
 		attrs[k] += levelBonus
 	}
 
-	// 根据世界类型调整
-	switch world.Genre {
-	case "horror":
-		attrs["perception"] += 2
-		attrs["strength"] -= 1
-	case "fantasy":
-		attrs["strength"] += 1
-		attrs["charisma"] += 1
-	case "urban":
-		attrs["dexterity"] += 1
-		attrs["intelligence"] += 1
-	case "scifi":
-		attrs["intelligence"] += 2
-	case "romance", "school", "workplace":
-		attrs["charisma"] += 2
+	// 根据世界类型（或世界自定义）调整
+	for attr, mod := range ms.attributeModifiers(world) {
+		attrs[attr] += mod
 	}
 
 	return attrs
 }
 
-// initRelations 初始化与NPC的关系
-func (ms *MetaService) initRelations(world *models.World) map[string]int {
+// attributeNames 角色的全部属性
+var attributeNames = []string{"strength", "dexterity", "intelligence", "charisma", "perception"}
+
+// defaultGenreAttributes 未配置时各世界类型的内置属性加成
+var defaultGenreAttributes = map[string]map[string]int{
+	"horror":    {"perception": 2, "strength": -1},
+	"fantasy":   {"strength": 1, "charisma": 1},
+	"urban":     {"dexterity": 1, "intelligence": 1},
+	"scifi":     {"intelligence": 2},
+	"romance":   {"charisma": 2},
+	"school":    {"charisma": 2},
+	"workplace": {"charisma": 2},
+}
+
+// attributeModifiers 返回世界的属性加成：世界自定义加成优先，其次是配置中的类型加成，最后是内置默认值
+func (ms *MetaService) attributeModifiers(world *models.World) map[string]int {
+	if len(world.AttributeModifiers) > 0 {
+		return world.AttributeModifiers
+	}
+	if mods, ok := ms.GameConfig().GenreAttributes[world.Genre]; ok {
+		return mods
+	}
+	return defaultGenreAttributes[world.Genre]
+}
+
+// initRelations 初始化与NPC的关系，声望会影响NPC的初始态度
+func (ms *MetaService) initRelations(world *models.World, reputation int) map[string]int {
 	relations := make(map[string]int)
 	for _, npc := range world.NPCs {
-		relations[npc.ID] = npc.Relationship
+		relations[npc.ID] = npc.Relationship + reputationAttitude(reputation)
 	}
 	return relations
 }
 
-// ApplyChanges 应用状态变化
-func (ms *MetaService) ApplyChanges(characterID, worldID string, changes models.StateChanges) error {
-	// 更新角色元信息
-	char, err := ms.storage.GetCharacter(characterID)
-	if err != nil {
-		return err
+// reputationAttitude 声望对陌生NPC初始好感的修正（每5点声望±1好感）
+func reputationAttitude(reputation int) int {
+	return reputation / 5
+}
+
+// ReputationTitle 根据声望返回称号
+func ReputationTitle(reputation int) string {
+	switch {
+	case reputation >= 60:
+		return "声名远扬"
+	case reputation >= 20:
+		return "小有善名"
+	case reputation <= -60:
+		return "臭名昭著"
+	case reputation <= -20:
+		return "恶名在外"
+	default:
+		return "默默无闻"
 	}
+}
 
-	char.XP += changes.XPGain
+// describeLevelUp 升级时写进叙事日志的系统消息
+func describeLevelUp(levelUp *models.LevelUp) string {
+	message := fmt.Sprintf("⬆️ 升级！你从 %d 级升到了 %d 级", levelUp.From, levelUp.To)
+	if len(levelUp.AttributeGain) > 0 {
+		message += "，" + describeBaseAttributeChange(levelUp.AttributeGain)
+	}
+	return message
+}
 
-	// 处理道具
-	for _, item := range changes.ItemsGained {
-		char.Inventory = append(char.Inventory, item)
+// ApplyChanges 在内存中把状态变化应用到角色和角色世界状态上（不保存，由调用方和故事一起提交）；
+// 经验值足够时结算升级（可连升数级），返回升级结果（没有升级时为 nil）
+func (ms *MetaService) ApplyChanges(char *models.Character, state *models.CharacterState, changes models.StateChanges) *models.LevelUp {
+	// 更新角色元信息
+	char.XP += changes.XPGain
+	fromLevel := char.Level
+	for ms.ruleEngine.CheckLevelUp(char.XP, char.Level) {
+		char.XP -= ms.ruleEngine.XPToNextLevel(char.Level)
+		char.Level++
 	}
 
-	// 移除道具
+	// 处理道具（可堆叠道具合并数量）
+	char.Inventory = models.StackItems(char.Inventory, changes.ItemsGained...)
+
+	// 移除道具：每次消耗一个，数量减到0才移出背包
 	for _, itemID := range changes.ItemsLost {
 		for i, item := range char.Inventory {
 			if item.ID == itemID {
-				char.Inventory = append(char.Inventory[:i], char.Inventory[i+1:]...)
+				if item.Count() > 1 {
+					char.Inventory[i].Quantity = item.Count() - 1
+				} else {
+					char.Inventory = append(char.Inventory[:i], char.Inventory[i+1:]...)
+				}
 				break
 			}
 		}
 	}
 
-	// 添加特质
-	char.Traits = append(char.Traits, changes.TraitsGained...)
+	// 用完或失去的道具从装备槽卸下
+	pruneEquipment(char)
 
-	char.UpdatedAt = time.Now()
+	// 添加特质（已有的不重复添加）
+	char.Traits = appendTraits(char.Traits, changes.TraitsGained...)
 
-	if err := ms.storage.UpdateCharacter(char); err != nil {
-		return err
+	// 升级：当前世界的各项属性每级 +1（与进入新世界时按等级计算的加成一致，基础属性不变）
+	var levelUp *models.LevelUp
+	if gained := char.Level - fromLevel; gained > 0 {
+		levelUp = &models.LevelUp{From: fromLevel, To: char.Level, AttributeGain: make(map[string]int, len(state.Attributes))}
+		for attr := range state.Attributes {
+			state.Attributes[attr] += gained
+			levelUp.AttributeGain[attr] = gained
+		}
+		log.Printf("⬆️ [升级] %s 从 %d 级升到 %d 级，剩余经验值 %d\n", char.Name, fromLevel, char.Level, char.XP)
 	}
 
-	// 更新世界状态
-	state, err := ms.storage.GetCharacterState(characterID, worldID)
-	if err != nil {
-		return err
+	// 重大剧情永久改变基础属性（当前世界同步生效）
+	if len(changes.BaseAttributeChange) > 0 {
+		applyBaseAttributeChange(char, state, changes.BaseAttributeChange, ms.AttributeSettings())
+		log.Printf("🌟 [永久改变] %s 的基础属性：%s\n", char.Name, describeBaseAttributeChange(changes.BaseAttributeChange))
 	}
 
+	char.UpdatedAt = time.Now()
+
+	// 更新世界状态
 	state.HP += changes.HPChange
 	if state.HP > state.MaxHP {
 		state.HP = state.MaxHP
@@ -221,11 +354,73 @@ func (ms *MetaService) ApplyChanges(characterID, worldID string, changes models.
 	}
 
 	// 更新关系
+	if state.Relations == nil && len(changes.RelationChange) > 0 {
+		state.Relations = make(map[string]int)
+	}
 	for npcID, change := range changes.RelationChange {
+		if _, met := state.Relations[npcID]; !met {
+			// 第一次打交道的NPC按声望决定初始态度
+			state.Relations[npcID] = reputationAttitude(state.Reputation)
+		}
 		state.Relations[npcID] += change
 	}
 
-	return ms.storage.SaveCharacterState(state)
+	// 更新道德值
+	state.Morality += changes.MoralityChange
+	if state.Morality > 100 {
+		state.Morality = 100
+	}
+	if state.Morality < -100 {
+		state.Morality = -100
+	}
+
+	// 堕落路线：道德值跌破阈值时留下负面特质
+	if state.Morality <= corruptionThreshold && !containsString(char.Traits, corruptionTrait) {
+		char.Traits = append(char.Traits, corruptionTrait)
+		log.Printf("🩸 [特质] %s 道德值跌至%d，获得负面特质「%s」\n", char.Name, state.Morality, corruptionTrait)
+	}
+
+	// 更新声望
+	state.Reputation += changes.ReputationChange
+	if state.Reputation > 100 {
+		state.Reputation = 100
+	}
+	if state.Reputation < -100 {
+		state.Reputation = -100
+	}
+
+	return levelUp
+}
+
+// cloneCharacter 深拷贝角色，结算在副本上进行，原角色保留作为结算前的状态
+func cloneCharacter(char *models.Character) *models.Character {
+	clone := *char
+	clone.BaseAttributes = make(map[string]int, len(char.BaseAttributes))
+	for attr, value := range char.BaseAttributes {
+		clone.BaseAttributes[attr] = value
+	}
+	clone.Traits = append([]string{}, char.Traits...)
+	clone.Inventory = append([]models.Item{}, char.Inventory...)
+	clone.Equipment = make(map[string]string, len(char.Equipment))
+	for slot, itemID := range char.Equipment {
+		clone.Equipment[slot] = itemID
+	}
+	return &clone
+}
+
+// cloneCharacterState 深拷贝角色世界状态，避免结算时改动快照或故事线记录里共用的属性、状态和好感度
+func cloneCharacterState(state *models.CharacterState) *models.CharacterState {
+	clone := *state
+	clone.Attributes = make(map[string]int, len(state.Attributes))
+	for attr, value := range state.Attributes {
+		clone.Attributes[attr] = value
+	}
+	clone.Status = append([]string{}, state.Status...)
+	clone.Relations = make(map[string]int, len(state.Relations))
+	for npcID, value := range state.Relations {
+		clone.Relations[npcID] = value
+	}
+	return &clone
 }
 
 // GetCharacterState 获取角色在世界中的状态
@@ -237,3 +432,16 @@ func (ms *MetaService) GetCharacterState(characterID, worldID string) (*models.C
 func (ms *MetaService) RestoreCharacterState(characterID, worldID string, snapshot *models.CharacterState) error {
 	return ms.storage.SaveCharacterState(snapshot)
 }
+
+// spendXP 在内存中扣除角色的经验值，不足时返回 ErrNotEnoughXP 且不做任何修改
+func spendXP(char *models.Character, amount int) error {
+	if amount <= 0 {
+		return nil
+	}
+	if char.XP < amount {
+		return fmt.Errorf("%w: 需要 %d 点，当前只有 %d 点", ErrNotEnoughXP, amount, char.XP)
+	}
+	char.XP -= amount
+	char.UpdatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+)
+
+func TestGeneratedCharacterExpires(t *testing.T) {
+	store, err := storage.New(storage.MemoryPath)
+	if err != nil {
+		t.Fatalf("创建内存数据库失败: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	ms := NewMetaService(store, NewRuleEngine(), models.GameConfig{})
+
+	char, err := ms.CreateCharacter(&models.Character{Name: "测试角色"})
+	if err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	ms.RememberGeneratedCharacter("old", char.ID)
+	ms.RememberGeneratedCharacter("recent", char.ID)
+	if got, ok := ms.GeneratedCharacter("recent"); !ok || got.ID != char.ID {
+		t.Fatalf("同一 request_id 应返回之前生成的角色，实际 %v", got)
+	}
+
+	// 把 old 的记录时间拨回到保留时长之前
+	ms.generated["old"] = generatedRequest{characterID: char.ID, createdAt: time.Now().Add(-generatedRequestTTL - time.Minute)}
+	if _, ok := ms.GeneratedCharacter("old"); ok {
+		t.Error("过期的 request_id 不应再返回角色")
+	}
+	ms.RememberGeneratedCharacter("new", char.ID)
+	if _, ok := ms.generated["old"]; ok {
+		t.Error("记录新请求时应清理过期的记录")
+	}
+	if _, ok := ms.generated["recent"]; !ok {
+		t.Error("未过期的记录不应被清理")
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import "github.com/aiwuxian/project-abyss/internal/models"
+
+// momentumDifficultyShift 大成功/大失败后下一轮选项难度的调整幅度
+const momentumDifficultyShift = 2
+
+// riskLevels 风险等级从低到高
+var riskLevels = []string{"low", "medium", "high"}
+
+// rollMomentum 根据上一回合检定判断局势：1 顺风（大成功），-1 逆风（大失败），0 平稳
+func rollMomentum(roll *models.DiceRoll) int {
+	if roll == nil || !roll.Critical {
+		return 0
+	}
+	if roll.Success {
+		return 1
+	}
+	return -1
+}
+
+// describeMomentum 生成给LLM参考的局势说明
+func describeMomentum(roll *models.DiceRoll) string {
+	switch rollMomentum(roll) {
+	case 1:
+		return "顺风局：上一回合大成功，角色占据主动。请多给出激进、进取的选项（乘胜追击、冒险争取更大收益），风险可以标得更高"
+	case -1:
+		return "逆风局：上一回合大失败，角色处境不利。请多给出保守、补救的选项（撤退、求助、弥补失误、稳住局面），激进选项的风险应标为high"
+	}
+	if roll != nil && !roll.Success {
+		return "上一回合检定失败，局势略有不利，可以给出补救性的选项"
+	}
+	return "局势平稳"
+}
+
+// shiftRisk 将风险等级上调或下调 delta 级
+func shiftRisk(risk string, delta int) string {
+	index := 1
+	for i, level := range riskLevels {
+		if level == risk {
+			index = i
+			break
+		}
+	}
+	index += delta
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(riskLevels) {
+		index = len(riskLevels) - 1
+	}
+	return riskLevels[index]
+}
+
+// adjustOptionsForMomentum 按上一回合的检定结果重算选项的风险与难度：
+// 逆风局风险升一级、难度上调，顺风局难度下调
+func adjustOptionsForMomentum(options []models.Option, lastRoll *models.DiceRoll) {
+	momentum := rollMomentum(lastRoll)
+	if momentum == 0 {
+		return
+	}
+	for i := range options {
+		if momentum < 0 {
+			options[i].Risk = shiftRisk(options[i].Risk, 1)
+		}
+		if options[i].Difficulty > 0 {
+			options[i].Difficulty -= momentum * momentumDifficultyShift
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// narrativeCleanRule 叙事清洗规则：Line 为 true 时删除匹配的整行，否则只删除匹配的片段
+type narrativeCleanRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Line    bool
+}
+
+// narrativeCleanRules 叙事返回前的本地清洗规则，去掉模型违背提示词留下的元话语和游戏术语。
+// 规则只针对明显的泄漏，宁可漏掉也不要误删正文；新规则直接加在这里
+var narrativeCleanRules = []narrativeCleanRule{
+	// 元话语
+	{Name: "AI自述", Line: true, Pattern: regexp.MustCompile(`作为(一个|一名)?(AI|ＡＩ|人工智能|语言模型|AI助手)`)},
+	{Name: "开场白", Line: true, Pattern: regexp.MustCompile(`^\s*(好的[，,！!。]?\s*)?(以下是|下面是|这是)[^。！？]{0,20}(叙事|叙述|JSON|json|内容|文本|故事|回复)\s*[:：]?\s*$`)},
+	{Name: "结束语", Line: true, Pattern: regexp.MustCompile(`^\s*(希望(这段|以上|这个|这些)|如果(你|您)(需要|想要|希望)|如需(调整|修改|继续))`)},
+	{Name: "代码块", Line: true, Pattern: regexp.MustCompile("^\\s*```")},
+	// 泄漏的游戏术语（删除所在的句子）
+	{Name: "检定说明", Pattern: sentenceContaining(`检定(结果|成功|失败|通过|未通过)|掷骰|骰子?(结果|点数)|\b[dD]20\b|难度(值|等级)\s*[:：]?\s*\d+`)},
+	{Name: "数值变化", Pattern: sentenceContaining(`(好感度?|HP|SAN|理智值?|生命值|经验值?|XP)\s*[+＋\-－]\s*\d+`)},
+	{Name: "术语括注", Pattern: regexp.MustCompile(`[（(【\[]\s*(检定|掷骰|骰子|DC|难度|好感|HP|SAN|理智值)[^）)】\]\n]{0,30}[）)】\]]`)},
+}
+
+// sentenceContaining 匹配包含 pattern 的整个句子（到句末标点或行尾为止）
+func sentenceContaining(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`[^。！？!?\n]*(` + pattern + `)[^。！？!?\n]*[。！？!?]?`)
+}
+
+// cleanNarrative 按 narrativeCleanRules 清洗叙事文本，记录每次清洗以便观察模型行为。
+// 清洗后没有剩下任何内容时保留原文
+func cleanNarrative(narrative string) string {
+	var kept []string
+	for _, line := range strings.Split(narrative, "\n") {
+		if rule, ok := matchLineRule(line); ok {
+			log.Printf("🧹 [叙事清洗] %s，删除整行: %s\n", rule.Name, excerptText(line, npcMemoryExcerpt))
+			continue
+		}
+		for _, rule := range narrativeCleanRules {
+			if rule.Line {
+				continue
+			}
+			for _, match := range rule.Pattern.FindAllString(line, -1) {
+				log.Printf("🧹 [叙事清洗] %s，删除片段: %s\n", rule.Name, match)
+			}
+			line = rule.Pattern.ReplaceAllString(line, "")
+		}
+		kept = append(kept, line)
+	}
+
+	cleaned := strings.TrimSpace(collapseBlankLines(strings.Join(kept, "\n")))
+	if cleaned == "" {
+		log.Println("⚠️ [叙事清洗] 清洗后没有剩余内容，保留原文")
+		return narrative
+	}
+	return cleaned
+}
+
+// matchLineRule 返回命中的第一条整行规则
+func matchLineRule(line string) (narrativeCleanRule, bool) {
+	for _, rule := range narrativeCleanRules {
+		if rule.Line && rule.Pattern.MatchString(line) {
+			return rule, true
+		}
+	}
+	return narrativeCleanRule{}, false
+}
+
+// blankLinesPattern 连续的空行
+var blankLinesPattern = regexp.MustCompile(`\n\s*\n(\s*\n)+`)
+
+// collapseBlankLines 把删除整行后留下的多个连续空行合并为一个
+func collapseBlankLines(text string) string {
+	return blankLinesPattern.ReplaceAllString(text, "\n\n")
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// continuityTailRunes 作为续写约束的上一段叙事结尾字数
+const continuityTailRunes = 150
+
+// 连续性检查用到的词：人物离场、重新登场、到达某地
+var (
+	departureWords = []string{"离开", "离去", "走远", "转身走", "消失在", "告辞", "先走"}
+	returnWords    = []string{"回来", "折返", "又出现", "再次出现", "去而复返", "赶了回来", "追上"}
+	arrivalWords   = []string{"来到", "走进", "到了", "抵达", "进入"}
+	negationRunes  = "没不别未"
+
+	sentenceSplitter = regexp.MustCompile(`[。！？!?\n]+`)
+)
+
+// previousProse 返回上一段叙事（最近一次行动结果或快速选择续写），还没有行动时返回场景描述
+func previousProse(story *models.StoryState, scene *models.Scene) string {
+	for i := len(story.Narrative) - 1; i >= 0; i-- {
+		if entry := story.Narrative[i]; entry.Type == "result" || entry.Type == "quick_choice" {
+			return entry.Content
+		}
+	}
+	return scene.Description
+}
+
+// tailText 返回文本结尾的 n 个字
+func tailText(text string, n int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return "……" + string(runes[len(runes)-n:])
+}
+
+// negationWindow 往前检查否定词的字数（"没离开""没有离开"都算否定）
+const negationWindow = 2
+
+// containsAffirmed 判断句子中是否出现某个词，且前面没有紧跟否定（"没有离开"不算离开）
+func containsAffirmed(sentence string, words []string) bool {
+	for _, word := range words {
+		rest := sentence
+		for {
+			idx := strings.Index(rest, word)
+			if idx < 0 {
+				break
+			}
+			before := []rune(rest[:idx])
+			if !strings.ContainsAny(string(before[max(len(before)-negationWindow, 0):]), negationRunes) {
+				return true
+			}
+			rest = rest[idx+len(word):]
+		}
+	}
+	return false
+}
+
+// departedNPCs 返回在这段叙事中离场的NPC名字
+func departedNPCs(world *models.World, text string) []string {
+	var names []string
+	for _, sentence := range sentenceSplitter.Split(text, -1) {
+		if !containsAffirmed(sentence, departureWords) {
+			continue
+		}
+		for _, npc := range world.NPCs {
+			if npc.Name != "" && strings.Contains(sentence, npc.Name) && !containsString(names, npc.Name) {
+				names = append(names, npc.Name)
+			}
+		}
+	}
+	return names
+}
+
+// continuityIssues 检测新叙事与上一段之间明显的连续性矛盾：已经离场的人物没有交代就重新在场，
+// 或者玩家没有移动却突然到了别的地方。返回矛盾说明，没有问题时为空
+func continuityIssues(world *models.World, scene *models.Scene, action models.Action, previous, narrative string) []string {
+	var issues []string
+	if !containsAffirmed(narrative, returnWords) {
+		for _, name := range departedNPCs(world, previous) {
+			if strings.Contains(narrative, name) && !strings.Contains(action.Content, name) {
+				issues = append(issues, fmt.Sprintf("「%s」在上一段已经离开，这一段却没有交代就又出现在场", name))
+			}
+		}
+	}
+
+	if actionTypeOf(action) != "move" {
+		for _, sentence := range sentenceSplitter.Split(narrative, -1) {
+			if !containsAffirmed(sentence, arrivalWords) {
+				continue
+			}
+			for _, exit := range scene.Exits {
+				issue := fmt.Sprintf("玩家没有移动，叙事却突然到了「%s」", exit)
+				if strings.Contains(sentence, exit) && !strings.Contains(action.Content, exit) && !containsString(issues, issue) {
+					issues = append(issues, issue)
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// describeNarrativeContinuity 给叙事prompt提供上一段的结尾作为续写的强约束；
+// issues 为上一次生成中检测到的连续性矛盾，重试时要求避免
+func describeNarrativeContinuity(previous string, issues []string) string {
+	text := fmt.Sprintf(`
+**续写约束（必须遵守）：**上一段叙事的结尾是：
+「%s」
+这一段必须从上文结束时的状态自然续写：地点、在场人物、人物的姿态和情绪都要接得上。已经离开的人物不能无故出现，除非先交代其回来；玩家没有移动时不要换地点。
+`, tailText(previous, continuityTailRunes))
+	if len(issues) > 0 {
+		text += fmt.Sprintf("**上一次生成的叙事与上文矛盾，请修正：**%s\n", strings.Join(issues, "；"))
+	}
+	return text
+}
+
+// narrateWithContinuity 以上一段结尾为约束生成叙事（角色处于濒死/恐慌时一并要求突出危机感）；
+// 检测到明显的连续性矛盾时带着矛盾说明重试一次，重试失败时沿用第一次的叙事。
+// out 不为空时第一次叙事流式发给玩家，重试改为一次性生成；revised 表示已发出的流式叙事被重试结果取代
+func (ss *StoryService) narrateWithContinuity(ctx context.Context, story *models.StoryState, world *models.World,
+	character *models.Character, charState *models.CharacterState, scene *models.Scene, action models.Action,
+	diceRoll *models.DiceRoll, conflict string, wordRange [2]int, out chan<- string) (narrative string, revised bool, err error) {
+
+	previous := previousProse(story, scene)
+	crisis := describeCrisis(charState)
+	if out != nil {
+		narrative, err = ss.llm.NarrateResultStream(ctx, world, character, scene, action, diceRoll,
+			story.Narrative, conflict, wordRange, story.NPCMemories, describeNarrativeContinuity(previous, nil)+crisis, out)
+	} else {
+		narrative, err = ss.llm.NarrateResult(ctx, world, character, scene, action, diceRoll,
+			story.Narrative, conflict, wordRange, story.NPCMemories, describeNarrativeContinuity(previous, nil)+crisis)
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	issues := continuityIssues(world, scene, action, previous, narrative)
+	if len(issues) == 0 {
+		return narrative, false, nil
+	}
+	log.Printf("🔗 [叙事连贯] 检测到与上文矛盾，重试一次: %s\n", strings.Join(issues, "；"))
+	retried, err := ss.llm.NarrateResult(ctx, world, character, scene, action, diceRoll,
+		story.Narrative, conflict, wordRange, story.NPCMemories, describeNarrativeContinuity(previous, issues)+crisis)
+	if err != nil {
+		log.Printf("⚠️ 重试叙事失败，沿用第一次的叙事: %v\n", err)
+		return narrative, false, nil
+	}
+	return retried, out != nil, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// narrativeLengths 叙事长度偏好对应的字数范围
+var narrativeLengths = map[string][2]int{
+	"short":  {60, 100},
+	"medium": {120, 180},
+	"long":   {250, 350},
+}
+
+// defaultSceneNarrativeLength 未配置时各场景类型的默认叙事长度（未列出的场景使用 medium）
+var defaultSceneNarrativeLength = map[string]string{
+	"combat":     "short",
+	"romance":    "long",
+	"date":       "long",
+	"temptation": "long",
+}
+
+const (
+	minNarrativeWords = 50
+	maxNarrativeWords = 800
+)
+
+// narrativeWordRange 把长度偏好（short/medium/long 或目标字数）换算成字数范围，无法识别时返回 false
+func narrativeWordRange(preference string) ([2]int, bool) {
+	preference = strings.TrimSpace(preference)
+	if r, ok := narrativeLengths[preference]; ok {
+		return r, true
+	}
+	target, err := strconv.Atoi(preference)
+	if err != nil || target <= 0 {
+		return [2]int{}, false
+	}
+	target = max(minNarrativeWords, min(target, maxNarrativeWords))
+	return [2]int{target * 4 / 5, target * 6 / 5}, true
+}
+
+// resolveNarrativeLength 按 请求 > 配置的场景长度 > 内置场景默认 > 全局默认 的顺序确定叙事字数范围
+func resolveNarrativeLength(cfg models.GameConfig, sceneType, requested string) [2]int {
+	candidates := []string{requested, cfg.SceneNarrativeLength[sceneType], defaultSceneNarrativeLength[sceneType], cfg.NarrativeLength}
+	for _, preference := range candidates {
+		if r, ok := narrativeWordRange(preference); ok {
+			return r
+		}
+	}
+	return narrativeLengths["medium"]
+}
+
+// describeWordRange 返回prompt中使用的字数描述，如"120-180"
+func describeWordRange(r [2]int) string {
+	return fmt.Sprintf("%d-%d", r[0], r[1])
+}
+
+// narrativeMaxTokens 按字数上限估算叙事请求的 max_tokens（中文约每字2个token，另留快速选择的余量）
+func narrativeMaxTokens(r [2]int) int {
+	return r[1]*2 + 100
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxParagraphRunes 单段的字数上限，超过时在句末标点处继续切分，方便前端逐段呈现
+const maxParagraphRunes = 120
+
+// sentenceEnds 句末标点
+const sentenceEnds = "。！？!?…"
+
+// closingMarks 紧跟在句末标点后、应当留在同一句的后引号和括号
+const closingMarks = "」』”’\"'）)】"
+
+// splitParagraphs 把叙事切分成段落：先按换行分出自然段，过长的自然段再按句末标点切成几段。
+// 只在段落之间去掉空白，每段内的文字原样保留，各段依次拼接即为原文的全部内容
+func splitParagraphs(narrative string) []string {
+	var paragraphs []string
+	for _, line := range strings.Split(narrative, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		paragraphs = append(paragraphs, splitLongParagraph(line)...)
+	}
+	return paragraphs
+}
+
+// splitLongParagraph 把超过字数上限的自然段按句子切开，每段尽量凑满上限但不拆开句子
+func splitLongParagraph(paragraph string) []string {
+	if utf8.RuneCountInString(paragraph) <= maxParagraphRunes {
+		return []string{paragraph}
+	}
+
+	var parts []string
+	var current strings.Builder
+	for _, sentence := range splitSentences(paragraph) {
+		if current.Len() > 0 &&
+			utf8.RuneCountInString(current.String())+utf8.RuneCountInString(sentence) > maxParagraphRunes {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		current.WriteString(sentence)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// splitSentences 按句末标点切分句子，连续的句末标点（如"！？""……"）和随后的后引号留在同一句
+func splitSentences(text string) []string {
+	var sentences []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !strings.ContainsRune(sentenceEnds, runes[i]) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && strings.ContainsRune(sentenceEnds+closingMarks, runes[end]) {
+			end++
+		}
+		sentences = append(sentences, string(runes[start:end]))
+		start = end
+		i = end - 1
+	}
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
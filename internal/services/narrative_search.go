@@ -0,0 +1,26 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// SearchNarrative 在故事的叙事日志中搜索关键词，按出现顺序分页返回命中的条目及其回合
+func (ss *StoryService) SearchNarrative(storyID, query string, page models.Page) ([]models.NarrativeMatch, models.ListCount, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, models.ListCount{}, fmt.Errorf("%w: 搜索关键词不能为空", ErrInvalidInput)
+	}
+
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, models.ListCount{}, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	matches, count, err := ss.storage.SearchNarrative(story, query, page)
+	if err != nil {
+		return nil, count, fmt.Errorf("搜索叙事失败: %w", err)
+	}
+	return matches, count, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// maxWorldDifficulty 世界难度上限
+const maxWorldDifficulty = 10
+
+// defaultNewGamePlusConfig 周目+的默认配置
+func defaultNewGamePlusConfig() models.NewGamePlusConfig {
+	return models.NewGamePlusConfig{DifficultyStep: 1, RelationDrop: 5}
+}
+
+// newGamePlusSettings 返回生效的周目+配置，未配置的项使用默认值，负数表示该项不变化
+func newGamePlusSettings(cfg models.NewGamePlusConfig) models.NewGamePlusConfig {
+	defaults := defaultNewGamePlusConfig()
+	if cfg.DifficultyStep == 0 {
+		cfg.DifficultyStep = defaults.DifficultyStep
+	}
+	if cfg.RelationDrop == 0 {
+		cfg.RelationDrop = defaults.RelationDrop
+	}
+	return cfg
+}
+
+// storyCycle 返回故事的周目数（旧数据没有记录时按第一周目）
+func storyCycle(story *models.StoryState) int {
+	return max(story.Cycle, 1)
+}
+
+// applyCycle 按周目调整内存中的世界（不写回数据库）：每多一周目难度提升、NPC初始好感降低
+func applyCycle(world *models.World, cycle int, cfg models.NewGamePlusConfig) {
+	extra := cycle - 1
+	if extra <= 0 {
+		return
+	}
+	cfg = newGamePlusSettings(cfg)
+	if cfg.DifficultyStep > 0 {
+		world.Difficulty = min(world.Difficulty+cfg.DifficultyStep*extra, maxWorldDifficulty)
+	}
+	if cfg.RelationDrop > 0 {
+		for i := range world.NPCs {
+			world.NPCs[i].Relationship -= cfg.RelationDrop * extra
+		}
+	}
+}
+
+// describeCycle 周目+开场时给场景生成的说明（第一周目返回空）
+func describeCycle(cycle int) string {
+	if cycle <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("；这是玩家第%d周目进入这个世界：世界已重置，人物不记得玩家，但开场的情境和人物的反应要与以往略有不同", cycle)
+}
+
+// nextCycle 返回角色在该世界开启周目+时的周目数，没有通关过该世界时返回 ErrInvalidInput
+func (ss *StoryService) nextCycle(characterID, worldID string) (int, error) {
+	cleared, err := ss.storage.MaxClearedCycle(characterID, worldID)
+	if err != nil {
+		return 0, fmt.Errorf("获取通关记录失败: %w", err)
+	}
+	if cleared == 0 {
+		return 0, fmt.Errorf("%w: 还没有通关这个世界，无法开启周目+", ErrInvalidInput)
+	}
+	return cleared + 1, nil
+}
+
+// storyWorld 读取故事所在的世界，并按故事的周目调整难度和NPC初始好感
+func (ss *StoryService) storyWorld(story *models.StoryState) (*models.World, error) {
+	world, err := ss.storage.GetWorld(story.WorldID)
+	if err != nil {
+		return nil, err
+	}
+	applyCycle(world, storyCycle(story), ss.meta.GameConfig().NewGamePlus)
+	return world, nil
+}
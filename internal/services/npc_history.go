@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// mentionsNPC 判断叙事条目是否涉及该NPC：有标注时按标注的NPC ID，
+// 没有标注的条目（旧存档、系统提示）按内容是否提到NPC名字
+func mentionsNPC(entry models.NarrativeLog, npc *models.NPC) bool {
+	if len(entry.NPCIDs) > 0 {
+		return containsString(entry.NPCIDs, npc.ID)
+	}
+	return npc.Name != "" && strings.Contains(entry.Content, npc.Name)
+}
+
+// NPCHistory 返回玩家在故事中与某个NPC的全部互动，以及当前好感度和攻略阶段（人物关系档案）
+func (ss *StoryService) NPCHistory(storyID, npcID string) (*models.NPCHistory, error) {
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	world, err := ss.storage.GetWorld(story.WorldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+	npc := findNPC(world, npcID)
+	if npc == nil {
+		return nil, fmt.Errorf("%w: 世界中没有这个NPC", ErrNotFound)
+	}
+
+	// 只读取本故事线的状态，不覆盖角色当前的世界状态
+	charState := story.CharState
+	if charState == nil {
+		charState, err = ss.meta.GetCharacterState(story.CharacterID, story.WorldID)
+		if err != nil {
+			return nil, fmt.Errorf("获取角色状态失败: %w", err)
+		}
+	}
+
+	history := &models.NPCHistory{
+		NPCID:    npc.ID,
+		NPCName:  npc.Name,
+		Memories: story.NPCMemories[npc.ID],
+		Entries:  []models.NarrativeLog{},
+	}
+	if relation, met := charState.Relations[npc.ID]; met {
+		history.Relationship = relation
+	} else {
+		history.Relationship = npc.Relationship
+	}
+	if romanceable(npc) {
+		stage := romanceStages[romanceStageIndex(story, npc.ID)]
+		history.Stage, history.StageName = stage.Key, stage.Name
+	}
+	if history.Memories == nil {
+		history.Memories = []models.NPCMemory{}
+	}
+	for _, entry := range story.Narrative {
+		if mentionsNPC(entry, npc) {
+			history.Entries = append(history.Entries, entry)
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+const (
+	npcMemoryLimit   = 6   // 每个NPC滚动保留的互动条数
+	npcMemoryExcerpt = 120 // 每条互动保留的叙事字数
+)
+
+// involvedNPCs 返回行动涉及的NPC：行动目标，以及名字出现在给定文本中的NPC（按世界中的顺序，不重复）
+func involvedNPCs(world *models.World, action models.Action, texts ...string) []*models.NPC {
+	if world == nil {
+		return nil
+	}
+	target := findNPC(world, action.Target)
+	var involved []*models.NPC
+	for i := range world.NPCs {
+		npc := &world.NPCs[i]
+		if npc == target {
+			involved = append(involved, npc)
+			continue
+		}
+		if npc.Name == "" {
+			continue
+		}
+		for _, text := range texts {
+			if strings.Contains(text, npc.Name) {
+				involved = append(involved, npc)
+				break
+			}
+		}
+	}
+	return involved
+}
+
+// involvedNPCIDs 返回行动涉及的NPC的ID，用于标注叙事条目
+func involvedNPCIDs(world *models.World, action models.Action, texts ...string) []string {
+	var ids []string
+	for _, npc := range involvedNPCs(world, action, texts...) {
+		ids = append(ids, npc.ID)
+	}
+	return ids
+}
+
+// excerptText 截取文本前 limit 个字，超出时加省略号
+func excerptText(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
+
+// cloneNPCMemories 深拷贝NPC互动历史（快照与故事各持一份，回退时互不影响）
+func cloneNPCMemories(memories map[string][]models.NPCMemory) map[string][]models.NPCMemory {
+	if memories == nil {
+		return nil
+	}
+	cloned := make(map[string][]models.NPCMemory, len(memories))
+	for npcID, entries := range memories {
+		cloned[npcID] = append([]models.NPCMemory{}, entries...)
+	}
+	return cloned
+}
+
+// recordNPCMemories 把本回合的互动记入涉及的每个NPC的历史，只保留最近 npcMemoryLimit 条
+func recordNPCMemories(story *models.StoryState, world *models.World, action models.Action, narrative string) {
+	npcs := involvedNPCs(world, action, action.Content, narrative)
+	if len(npcs) == 0 {
+		return
+	}
+	if story.NPCMemories == nil {
+		story.NPCMemories = make(map[string][]models.NPCMemory)
+	}
+	for _, npc := range npcs {
+		entries := append(story.NPCMemories[npc.ID], models.NPCMemory{
+			Turn:    story.Turn,
+			Action:  excerptText(action.Content, npcMemoryExcerpt),
+			Outcome: excerptText(narrative, npcMemoryExcerpt),
+		})
+		if len(entries) > npcMemoryLimit {
+			entries = entries[len(entries)-npcMemoryLimit:]
+		}
+		story.NPCMemories[npc.ID] = entries
+	}
+}
+
+// describeNPCMemories 列出行动涉及的NPC与玩家的过往互动，供叙事保持称呼、承诺一致（没有历史时返回空）
+func describeNPCMemories(world *models.World, action models.Action, memories map[string][]models.NPCMemory) string {
+	var blocks []string
+	for _, npc := range involvedNPCs(world, action, action.Content) {
+		entries := memories[npc.ID]
+		if len(entries) == 0 {
+			continue
+		}
+		lines := []string{fmt.Sprintf("与%s：", npc.Name)}
+		for _, entry := range entries {
+			lines = append(lines, fmt.Sprintf("- 第%d回合：%s → %s", entry.Turn, entry.Action, entry.Outcome))
+		}
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+	if len(blocks) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+**过往互动（NPC要记得之前聊过的内容、许下的承诺和对玩家的称呼）：**
+%s
+`, strings.Join(blocks, "\n"))
+}
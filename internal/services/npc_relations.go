@@ -0,0 +1,181 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// npcRelationRipple NPC之间的关系类型 -> 连带好感变化的百分比（讨好A时，A的盟友跟着升、情敌和仇敌跟着降）
+var npcRelationRipple = map[string]int{
+	"ally":  50,
+	"rival": -50,
+	"enemy": -50,
+}
+
+// npcRelationNames 关系类型的中文名（用于叙事提示）
+var npcRelationNames = map[string]string{
+	"ally":  "盟友",
+	"rival": "情敌",
+	"enemy": "仇敌",
+}
+
+// socialRelationActions 会直接影响目标NPC好感度的行动类型
+var socialRelationActions = []string{"talk", "help", "persuade", "flirt", "seduce", "date", "touch"}
+
+// relationActionGain 对NPC的社交行动成功时增加的好感度（大成功翻倍，大失败扣除）
+const relationActionGain = 5
+
+// findNPC 按ID或名字查找世界中的NPC
+func findNPC(world *models.World, ref string) *models.NPC {
+	if world == nil || ref == "" {
+		return nil
+	}
+	for i := range world.NPCs {
+		if world.NPCs[i].ID == ref || world.NPCs[i].Name == ref {
+			return &world.NPCs[i]
+		}
+	}
+	return nil
+}
+
+// relatedNPCs 返回与该NPC有关系的其他NPC（NPC ID -> 关系类型），
+// 关系视为双向：任一方声明即可，双方都声明时以该NPC自己的声明为准
+func relatedNPCs(world *models.World, npc *models.NPC) map[string]string {
+	related := make(map[string]string)
+	for _, rel := range npc.Relations {
+		if other := findNPC(world, rel.Target); other != nil && other.ID != npc.ID {
+			related[other.ID] = rel.Type
+		}
+	}
+	for _, other := range world.NPCs {
+		if other.ID == npc.ID {
+			continue
+		}
+		if _, ok := related[other.ID]; ok {
+			continue
+		}
+		for _, rel := range other.Relations {
+			if rel.Target == npc.ID || rel.Target == npc.Name {
+				related[other.ID] = rel.Type
+				break
+			}
+		}
+	}
+	return related
+}
+
+// npcRelationChanges 计算行动带来的好感度变化：对目标NPC的社交行动按检定结果直接改变好感，
+// 再按NPC之间的关系连带影响关联NPC（只传导一层，不会连锁）
+func npcRelationChanges(world *models.World, action models.Action, diceRoll *models.DiceRoll) map[string]int {
+	target := findNPC(world, action.Target)
+	if target == nil || diceRoll == nil || !containsString(socialRelationActions, actionTypeOf(action)) {
+		return nil
+	}
+
+	delta := 0
+	switch {
+	case diceRoll.Critical && diceRoll.Success:
+		delta = relationActionGain * 2
+	case diceRoll.Success:
+		delta = relationActionGain
+	case diceRoll.Critical:
+		delta = -relationActionGain
+	}
+	if delta == 0 {
+		return nil
+	}
+
+	changes := map[string]int{target.ID: delta}
+	for npcID, relType := range relatedNPCs(world, target) {
+		ripple := delta * npcRelationRipple[relType] / 100
+		if ripple == 0 {
+			continue
+		}
+		changes[npcID] += ripple
+		if other := findNPC(world, npcID); other != nil {
+			log.Printf("💞 [连带关系] %s 是 %s 的%s，好感 %+d\n", other.Name, target.Name, npcRelationName(relType), ripple)
+		}
+	}
+	return changes
+}
+
+// npcRelationName 返回关系类型的中文名，未知类型原样返回
+func npcRelationName(relType string) string {
+	if name, ok := npcRelationNames[relType]; ok {
+		return name
+	}
+	return relType
+}
+
+// describeNPCRelations 生成行动目标NPC的人际关系说明，供叙事体现三角关系（无关系返回空）
+func describeNPCRelations(world *models.World, targetRef string) string {
+	target := findNPC(world, targetRef)
+	if target == nil {
+		return ""
+	}
+	related := relatedNPCs(world, target)
+	if len(related) == 0 {
+		return ""
+	}
+
+	var parts []string
+	for _, other := range world.NPCs {
+		if relType, ok := related[other.ID]; ok {
+			parts = append(parts, fmt.Sprintf("%s是%s的%s", other.Name, target.Name, npcRelationName(relType)))
+		}
+	}
+	return fmt.Sprintf("\n**人物关系：**%s。玩家与%s的互动会牵动这些人的态度，请在叙事中适当体现这种微妙的关系。\n",
+		strings.Join(parts, "；"), target.Name)
+}
+
+// maxGroupRelationChange 群体行动对单个NPC好感的最大影响
+const maxGroupRelationChange = 10
+
+// npcNames 返回世界中所有NPC的名字
+func npcNames(world *models.World) []string {
+	names := make([]string, 0, len(world.NPCs))
+	for _, npc := range world.NPCs {
+		names = append(names, npc.Name)
+	}
+	return names
+}
+
+// groupRelationChanges 把剧情评估给出的群体好感变化（NPC名字或ID -> 变化值）换成 NPC ID，
+// 只保留行动目标或在行动、叙事中出场的NPC，每人限制在 ±maxGroupRelationChange。
+// 社交行动的目标已经按检定结果改变过好感，这里不再重复计算
+func groupRelationChanges(world *models.World, action models.Action, narrative string, evaluated map[string]int) map[string]int {
+	if len(evaluated) == 0 {
+		return nil
+	}
+	present := make(map[string]bool)
+	for _, npc := range involvedNPCs(world, action, action.Content, narrative) {
+		present[npc.ID] = true
+	}
+	var direct string
+	if target := findNPC(world, action.Target); target != nil && containsString(socialRelationActions, actionTypeOf(action)) {
+		direct = target.ID
+	}
+
+	changes := make(map[string]int)
+	var parts []string
+	for ref, delta := range evaluated {
+		npc := findNPC(world, ref)
+		if npc == nil || !present[npc.ID] || npc.ID == direct {
+			continue
+		}
+		delta = max(-maxGroupRelationChange, min(delta, maxGroupRelationChange))
+		if delta == 0 {
+			continue
+		}
+		changes[npc.ID] += delta
+		parts = append(parts, fmt.Sprintf("%s %+d", npc.Name, delta))
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	log.Printf("👥 [群体影响] %s\n", strings.Join(parts, "，"))
+	return changes
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// defaultOpeningTemplate 未配置开场旁白模板时使用的格式
+const defaultOpeningTemplate = "你进入了【{scene}】\n\n{scene_description}"
+
+// renderOpening 按模板生成开场旁白（故事的第一条系统叙事），模板为空时使用默认格式。
+// 支持的占位：{world} {genre} {character} {scene} {scene_description} {chapter} {time}
+func renderOpening(template string, world *models.World, character *models.Character, scene *models.Scene,
+	story *models.StoryState, chapter string) string {
+
+	if strings.TrimSpace(template) == "" {
+		template = defaultOpeningTemplate
+	}
+	return strings.NewReplacer(
+		"{world}", world.Name,
+		"{genre}", world.Genre,
+		"{character}", character.Name,
+		"{scene}", scene.Name,
+		"{scene_description}", scene.Description,
+		"{chapter}", chapter,
+		"{time}", describeGameTime(story.Day, story.Period),
+	).Replace(template)
+}
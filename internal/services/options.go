@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// storyScene 故事当前局面：所在世界、场景、角色及本故事线的角色状态
+type storyScene struct {
+	world     *models.World
+	scene     *models.Scene
+	character *models.Character
+	charState *models.CharacterState
+}
+
+// loadStoryScene 加载故事当前局面（同时恢复本故事线的角色状态）
+func (ss *StoryService) loadStoryScene(story *models.StoryState) (*storyScene, error) {
+	world, err := ss.storyWorld(story)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+	scene, err := ss.storage.GetScene(story.SceneID)
+	if err != nil {
+		return nil, fmt.Errorf("获取场景失败: %w", err)
+	}
+	character, err := ss.storage.GetCharacter(story.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+	charState, err := ss.activateCharState(story)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色状态失败: %w", err)
+	}
+	return &storyScene{world: world, scene: scene, character: character, charState: charState}, nil
+}
+
+// generateOptions 基于当前场景和最近一次行动结果生成可选行动，AI不可用时使用本地备用选项；
+// 补充场景的环境选项、过滤不合场景类型的选项，危机阶段换上自救选项，并标注性格冲突、是否需要二次确认、是否无需检定和后果预览
+func (ss *StoryService) generateOptions(ctx context.Context, story *models.StoryState, current *storyScene) []models.Option {
+	narrative, lastRoll := lastResult(story, current.scene)
+	options, err := ss.llm.GenerateOptions(ctx, current.world, current.character, current.scene, narrative, story.Narrative,
+		current.charState, lastRoll, describeTimeContext(current.world, story.Day, story.Period),
+		allowedSceneActions(ss.meta.GameConfig(), current.scene.Type))
+	if err != nil || len(options) == 0 {
+		options = ss.fallbackOptions(current.world, current.scene, story)
+	}
+	options = ss.fitSceneOptions(current.scene, injectEnvironmentOptions(current.scene, options))
+	options = applyCrisisOptions(current.charState, options)
+	markPersonalityConflicts(current.character, options)
+	markIrreversibleOptions(options)
+	ss.markTrivialOptions(current.world, current.scene, current.character, options)
+	ss.previewConsequences(current.world, current.scene, current.character, current.charState, options, story.AttributeMap)
+	return options
+}
+
+// CurrentOptions 重新生成故事当前可选的行动（开局或读档后还没有上一回合的选项时使用）
+func (ss *StoryService) CurrentOptions(ctx context.Context, storyID string) ([]models.Option, error) {
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	if story.Status != "active" {
+		return nil, ErrStoryEnded
+	}
+	current, err := ss.loadStoryScene(story)
+	if err != nil {
+		return nil, err
+	}
+	return ss.generateOptions(ctx, story, current), nil
+}
+
+// lastResult 返回最近一次行动结果的叙事和检定（还没有行动时返回场景描述）
+func lastResult(story *models.StoryState, scene *models.Scene) (string, *models.DiceRoll) {
+	for i := len(story.Narrative) - 1; i >= 0; i-- {
+		if entry := story.Narrative[i]; entry.Type == "result" {
+			return entry.Content, entry.DiceRoll
+		}
+	}
+	return scene.Description, nil
+}
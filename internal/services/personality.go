@@ -0,0 +1,134 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// personalityConflictPenalty 违背本性的行动额外增加的检定难度
+const personalityConflictPenalty = 4
+
+// personalityRule 性格关键词到行动倾向的映射
+type personalityRule struct {
+	Name     string   // 倾向名称（用于提示和叙事）
+	Keywords []string // 性格描述包含任一关键词即视为具有该倾向
+	Averse   []string // 与本性冲突的行动类型
+	Favored  []string // 符合本性的行动类型
+}
+
+var personalityRules = []personalityRule{
+	{
+		Name:     "胆小",
+		Keywords: []string{"胆小", "懦弱", "怯懦", "胆怯", "怕事"},
+		Averse:   []string{"attack"},
+		Favored:  []string{"observe", "sneak", "move"},
+	},
+	{
+		Name:     "冲动",
+		Keywords: []string{"冲动", "鲁莽", "暴躁", "急躁", "好斗"},
+		Averse:   []string{"sneak", "observe"},
+		Favored:  []string{"attack", "move"},
+	},
+	{
+		Name:     "害羞",
+		Keywords: []string{"害羞", "腼腆", "羞涩", "社恐"},
+		Averse:   []string{"flirt", "seduce", "persuade"},
+		Favored:  []string{"observe", "study"},
+	},
+	{
+		Name:     "善良",
+		Keywords: []string{"善良", "仁慈", "心软", "正直"},
+		Averse:   []string{"seduce"},
+		Favored:  []string{"help", "talk"},
+	},
+	{
+		Name:     "冷漠",
+		Keywords: []string{"冷漠", "孤僻", "高冷", "冷淡"},
+		Averse:   []string{"help", "flirt"},
+		Favored:  []string{"observe", "investigate"},
+	},
+	{
+		Name:     "谨慎",
+		Keywords: []string{"谨慎", "小心", "稳重"},
+		Averse:   []string{"attack"},
+		Favored:  []string{"investigate", "observe"},
+	},
+}
+
+// customActionKeywords 自定义行动按内容关键词推断行动类型（按顺序匹配），用于判定是否违背本性
+var customActionKeywords = []struct {
+	ActionType string
+	Keywords   []string
+}{
+	{"attack", []string{"攻击", "硬刚", "动手", "冲上去", "打倒", "砍", "杀"}},
+	{"sneak", []string{"潜行", "偷偷", "悄悄", "躲"}},
+	{"seduce", []string{"勾引", "诱惑"}},
+	{"flirt", []string{"搭讪", "调情", "撩"}},
+	{"persuade", []string{"说服", "劝"}},
+	{"help", []string{"帮助", "帮忙", "救"}},
+	{"observe", []string{"观察", "看看", "等待"}},
+}
+
+// personalityTendencies 返回角色性格命中的倾向规则
+func personalityTendencies(character *models.Character) []personalityRule {
+	if character == nil || character.Personality == "" {
+		return nil
+	}
+	var matched []personalityRule
+	for _, rule := range personalityRules {
+		for _, kw := range rule.Keywords {
+			if strings.Contains(character.Personality, kw) {
+				matched = append(matched, rule)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// actionTypeOf 返回行动的实际类型，自定义行动按内容推断
+func actionTypeOf(action models.Action) string {
+	if action.Type != "custom" && action.Type != "" {
+		return action.Type
+	}
+	for _, entry := range customActionKeywords {
+		for _, kw := range entry.Keywords {
+			if strings.Contains(action.Content, kw) {
+				return entry.ActionType
+			}
+		}
+	}
+	return action.Type
+}
+
+// personalityConflict 判断行动是否违背角色本性，返回冲突的倾向名称（无冲突返回空）
+func personalityConflict(character *models.Character, actionType string) string {
+	for _, rule := range personalityTendencies(character) {
+		if containsString(rule.Averse, actionType) {
+			return rule.Name
+		}
+	}
+	return ""
+}
+
+// describePersonalityTendency 生成给LLM参考的性格倾向说明
+func describePersonalityTendency(character *models.Character) string {
+	rules := personalityTendencies(character)
+	if len(rules) == 0 {
+		return "无明显倾向"
+	}
+	var parts []string
+	for _, rule := range rules {
+		parts = append(parts, "「"+rule.Name+"」倾向"+strings.Join(rule.Favored, "/")+
+			"，抗拒"+strings.Join(rule.Averse, "/"))
+	}
+	return strings.Join(parts, "；")
+}
+
+// markPersonalityConflicts 标记与角色本性冲突的选项，供前端额外确认
+func markPersonalityConflicts(character *models.Character, options []models.Option) {
+	for i := range options {
+		options[i].PersonalityConflict = personalityConflict(character, options[i].ActionType)
+	}
+}
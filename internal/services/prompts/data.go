@@ -0,0 +1,96 @@
+package prompts
+
+// 各类提示词模板可用的数据。同一类调用的系统提示词和用户提示词使用同一份数据，
+// 字段已经由服务层整理成可以直接写进提示词的文本
+
+// CharacterData 角色生成（character_system / character_user）
+type CharacterData struct {
+	Scale  string // 属性分制说明（如"3-18分制"）
+	Budget string // 总属性点范围
+	Name   string
+	Gender string // 男/女
+	Age    int
+	Prompt string // 玩家的补充描述
+}
+
+// ParseData 小说段落解析（parse_system / parse_user）
+type ParseData struct {
+	SegmentText    string // 小说段落原文
+	SourceLanguage string // 原文语言说明（中文原文时为空）
+}
+
+// SceneData 场景生成（scene_system / scene_user）
+type SceneData struct {
+	Task             string // 本次任务：开场场景或承接上一场景
+	OriginalText     string // 原小说片段或摘要
+	WorldName        string
+	WorldDescription string
+	Genre            string
+	NPCs             string // 世界中的关键角色
+	CharacterName    string
+	CharacterLevel   int
+	TimeContext      string // 当前游戏内时间
+	WorldRules       string // 世界禁忌规则说明（可为空）
+	Continuity       string // 承接上一场景的上下文（开场场景为空）
+}
+
+// OptionsData 行动选项生成（options_system / options_user）
+type OptionsData struct {
+	OriginalText        string
+	SceneName           string
+	SceneType           string
+	SceneDescription    string
+	History             string // 最近的历史对话
+	Narrative           string // 当前情况（最近一段叙事）
+	HP                  int
+	MaxHP               int
+	SAN                 int
+	MaxSAN              int
+	Personality         string
+	PersonalityTendency string // 性格倾向说明
+	Momentum            string // 当前局势（顺风/逆风）
+	TimeContext         string
+	AllowedActions      string // 场景允许的行动类型说明（可为空）
+}
+
+// NarrateData 行动叙事（narrate_system / narrate_user）
+type NarrateData struct {
+	History           string // 最近的历史对话
+	OriginalText      string
+	CharacterName     string
+	Gender            string
+	Age               int
+	Appearance        string
+	Personality       string
+	SceneName         string
+	SceneType         string
+	SceneDescription  string
+	ActionContent     string
+	ActionType        string
+	Outcome           string // 成功/失败/大成功/大失败
+	Roll              string // 检定数值说明
+	Extra             string // 违背本性、人物关系、语气、NPC记忆、续写约束等附加要求
+	WordRange         string // 字数要求
+	QuickChoiceMarker string // 快速选择的标记
+	Objectives        string // 场景目标说明
+	RuleCheck         string // 世界规则检查说明
+}
+
+// EvaluateData 剧情推进评估（evaluate_system / evaluate_user）
+type EvaluateData struct {
+	CurrentName        string
+	CurrentDescription string
+	CurrentLocation    string
+	NextName           string
+	NextDescription    string
+	NextLocation       string
+	NextKeyNPCs        []string
+	Progress           float64 // 当前推进度（百分比）
+	ActionContent      string
+	Outcome            string // 检定结果：成功/失败/大成功/大失败
+	Narrative          string // 行动结果
+	Flags              string // 可触发的剧情旗标
+	Rules              string // 世界规则
+	ViolatedRules      string // 本回合违反的规则
+	NPCs               string // 世界中的NPC
+}
@@ -0,0 +1,177 @@
+// Package prompts 管理LLM调用的提示词模板。
+//
+// 内置模板在 defaults 目录下（编译进程序），每个文件是一个 Go text/template，文件名即模板名。
+// 配置了模板目录时，目录中同名的 .tmpl 文件覆盖内置模板，缺失的模板使用内置默认值；
+// 模板在加载时解析并用空数据试渲染一次，字段名写错等问题在启动时就会报错。
+package prompts
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// templateExt 模板文件扩展名
+const templateExt = ".tmpl"
+
+// 模板名（同时也是模板文件名，不含扩展名）
+const (
+	CharacterSystem = "character_system" // 角色生成：系统提示词
+	CharacterUser   = "character_user"   // 角色生成：用户提示词
+	ParseSystem     = "parse_system"     // 小说段落解析：系统提示词
+	ParseUser       = "parse_user"       // 小说段落解析：用户提示词
+	SceneSystem     = "scene_system"     // 场景生成：系统提示词
+	SceneUser       = "scene_user"       // 场景生成：用户提示词
+	OptionsSystem   = "options_system"   // 行动选项：系统提示词
+	OptionsUser     = "options_user"     // 行动选项：用户提示词
+	NarrateSystem   = "narrate_system"   // 行动叙事：系统提示词
+	NarrateUser     = "narrate_user"     // 行动叙事：用户提示词
+	EvaluateSystem  = "evaluate_system"  // 剧情推进评估：系统提示词
+	EvaluateUser    = "evaluate_user"    // 剧情推进评估：用户提示词
+)
+
+// templateData 每个模板渲染时使用的数据类型（零值用于加载时的试渲染）
+var templateData = map[string]interface{}{
+	CharacterSystem: CharacterData{},
+	CharacterUser:   CharacterData{},
+	ParseSystem:     ParseData{},
+	ParseUser:       ParseData{},
+	SceneSystem:     SceneData{},
+	SceneUser:       SceneData{},
+	OptionsSystem:   OptionsData{},
+	OptionsUser:     OptionsData{},
+	NarrateSystem:   NarrateData{},
+	NarrateUser:     NarrateData{},
+	EvaluateSystem:  EvaluateData{},
+	EvaluateUser:    EvaluateData{},
+}
+
+//go:embed defaults/*.tmpl
+var defaultFiles embed.FS
+
+// builtin 内置模板，程序启动时解析一次
+var builtin = mustParseDefaults()
+
+// Store 已加载的提示词模板，加载后只读，可并发使用
+type Store struct {
+	templates map[string]*template.Template
+	custom    map[string]bool // 来自模板目录的模板，渲染失败时回退到内置模板
+}
+
+// Default 返回只包含内置模板的 Store
+func Default() *Store {
+	return &Store{templates: builtin, custom: map[string]bool{}}
+}
+
+// Load 从目录加载提示词模板：dir 为空时只使用内置模板；目录不存在时记录告警并使用内置模板；
+// 目录中的模板无法解析或试渲染失败时返回错误
+func Load(dir string) (*Store, error) {
+	store := Default()
+	if dir == "" {
+		return store, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("⚠️ 提示词模板目录 %s 不存在，使用内置模板\n", dir)
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取提示词模板目录失败: %w", err)
+	}
+
+	templates := make(map[string]*template.Template, len(builtin))
+	for name, tmpl := range builtin {
+		templates[name] = tmpl
+	}
+	var loaded []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != templateExt {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), templateExt)
+		if _, known := templateData[name]; !known {
+			log.Printf("⚠️ 未知的提示词模板 %s，已忽略\n", entry.Name())
+			continue
+		}
+		text, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取提示词模板 %s 失败: %w", entry.Name(), err)
+		}
+		tmpl, err := parse(name, string(text))
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = tmpl
+		store.custom[name] = true
+		loaded = append(loaded, name)
+	}
+	store.templates = templates
+
+	sort.Strings(loaded)
+	log.Printf("📝 从 %s 加载了 %d 个自定义提示词模板 %v，其余使用内置模板\n", dir, len(loaded), loaded)
+	return store, nil
+}
+
+// Render 渲染提示词模板。自定义模板渲染失败时记录告警并回退到内置模板
+func (s *Store) Render(name string, data interface{}) (string, error) {
+	tmpl, ok := s.templates[name]
+	if !ok {
+		return "", fmt.Errorf("提示词模板 %s 不存在", name)
+	}
+	text, err := execute(tmpl, data)
+	if err != nil && s.custom[name] {
+		log.Printf("⚠️ 自定义提示词模板 %s 渲染失败，使用内置模板: %v\n", name, err)
+		text, err = execute(builtin[name], data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("渲染提示词模板 %s 失败: %w", name, err)
+	}
+	return text, nil
+}
+
+// parse 解析模板并用对应数据类型的零值试渲染，提前发现语法错误和不存在的字段
+func parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("解析提示词模板 %s 失败: %w", name, err)
+	}
+	if err := tmpl.Execute(io.Discard, templateData[name]); err != nil {
+		return nil, fmt.Errorf("提示词模板 %s 试渲染失败: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// execute 渲染模板，去掉文件末尾的换行（编辑器保存时自动添加，不算提示词内容）
+func execute(tmpl *template.Template, data interface{}) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// mustParseDefaults 解析全部内置模板，内置模板缺失或有误属于程序错误
+func mustParseDefaults() map[string]*template.Template {
+	templates := make(map[string]*template.Template, len(templateData))
+	for name := range templateData {
+		text, err := defaultFiles.ReadFile("defaults/" + name + templateExt)
+		if err != nil {
+			panic(fmt.Sprintf("缺少内置提示词模板 %s: %v", name, err))
+		}
+		tmpl, err := parse(name, string(text))
+		if err != nil {
+			panic(err)
+		}
+		templates[name] = tmpl
+	}
+	return templates
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/google/uuid"
+)
+
+// quickChoiceMarker 叙事末尾的快速选择标记，格式：【快速选择】问题｜选项1｜选项2
+const quickChoiceMarker = "【快速选择】"
+
+const maxQuickChoiceOptions = 3
+
+// extractQuickChoice 从叙事中取出末尾的快速选择，返回去掉标记后的叙事
+func extractQuickChoice(narrative string) (string, *models.QuickChoice) {
+	index := strings.LastIndex(narrative, quickChoiceMarker)
+	if index < 0 {
+		return narrative, nil
+	}
+
+	text := strings.TrimSpace(narrative[:index])
+	line := strings.TrimSpace(narrative[index+len(quickChoiceMarker):])
+	if newline := strings.Index(line, "\n"); newline >= 0 {
+		line = strings.TrimSpace(line[:newline])
+	}
+
+	// 格式不完整时丢弃标记，只保留叙事
+	parts := strings.FieldsFunc(line, func(r rune) bool { return r == '｜' || r == '|' })
+	if len(parts) < 3 {
+		return text, nil
+	}
+	var options []string
+	for _, part := range parts[1:] {
+		if part = strings.TrimSpace(part); part != "" {
+			options = append(options, part)
+		}
+	}
+	if len(options) < 2 {
+		return text, nil
+	}
+	if len(options) > maxQuickChoiceOptions {
+		options = options[:maxQuickChoiceOptions]
+	}
+
+	return text, &models.QuickChoice{
+		ID:      uuid.New().String(),
+		Prompt:  strings.TrimSpace(parts[0]),
+		Options: options,
+	}
+}
+
+// ResolveQuickChoice 处理叙事中的快速选择：只做一次轻量续写，不投骰、不推进回合
+func (ss *StoryService) ResolveQuickChoice(ctx context.Context, storyID, choiceID string, option int) (*models.StoryState, error) {
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	if story.Status != "active" {
+		return nil, ErrStoryEnded
+	}
+
+	choice := story.PendingChoice
+	if choice == nil || choice.ID != choiceID {
+		return nil, fmt.Errorf("%w: 快速选择已失效", ErrInvalidInput)
+	}
+	if option < 0 || option >= len(choice.Options) {
+		return nil, fmt.Errorf("%w: 选项不存在", ErrInvalidInput)
+	}
+	selected := choice.Options[option]
+
+	world, err := ss.storage.GetWorld(story.WorldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+	character, err := ss.storage.GetCharacter(story.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+	scene, err := ss.storage.GetScene(story.SceneID)
+	if err != nil {
+		return nil, fmt.Errorf("获取场景失败: %w", err)
+	}
+
+	continuation, err := ss.llm.ContinueQuickChoice(ctx, world, character, scene, story.Narrative, choice, selected,
+		story.NPCMemories)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("⚡ [快速选择] %s → %s\n", choice.Prompt, selected)
+	action := models.Action{Content: choice.Prompt + " " + selected}
+	story.Narrative = append(story.Narrative, models.NarrativeLog{
+		Turn:      story.Turn,
+		Type:      "quick_choice",
+		Content:   fmt.Sprintf("你选择了「%s」。\n\n%s", selected, continuation),
+		Timestamp: time.Now(),
+		NPCIDs:    involvedNPCIDs(world, action, action.Content, continuation),
+	})
+	recordNPCMemories(story, world, action, continuation)
+	story.PendingChoice = nil
+	story.UpdatedAt = time.Now()
+
+	if err := ss.storage.UpdateStoryState(story); err != nil {
+		return nil, fmt.Errorf("更新故事状态失败: %w", err)
+	}
+
+	return story, nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// reportHistoryLimit 撰写战报时最多带入的叙事行数（超出时保留最近的）
+const reportHistoryLimit = 120
+
+// GenerateReport 生成故事战报：统计整局数据，并让AI撰写回顾。AI不可用时只返回统计，回顾为空
+func (ss *StoryService) GenerateReport(ctx context.Context, storyID string) (*models.StoryReport, error) {
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	world, err := ss.storage.GetWorld(story.WorldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+	character, err := ss.storage.GetCharacter(story.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+
+	// 只读取本故事线的状态，不覆盖角色当前的世界状态
+	charState := story.CharState
+	if charState == nil {
+		charState, err = ss.meta.GetCharacterState(story.CharacterID, story.WorldID)
+		if err != nil {
+			return nil, fmt.Errorf("获取角色状态失败: %w", err)
+		}
+	}
+
+	report := &models.StoryReport{
+		StoryID:     story.ID,
+		WorldName:   world.Name,
+		Character:   character.Name,
+		Status:      story.Status,
+		EndingName:  endingName(world, story.EndingID),
+		Stats:       reportStats(story, world, charState),
+		GeneratedAt: time.Now(),
+	}
+
+	review, err := ss.llm.GenerateReport(ctx, world, character, story, report.Stats, report.EndingName)
+	if err != nil {
+		log.Printf("⚠️ 生成战报回顾失败，仅返回统计: %v\n", err)
+	} else {
+		report.Review = review
+	}
+
+	return report, nil
+}
+
+// endingName 返回结局名称，没有达成结局时返回空
+func endingName(world *models.World, endingID string) string {
+	if endingID == "" {
+		return ""
+	}
+	for _, ending := range world.Endings {
+		if ending.ID == endingID {
+			return ending.Name
+		}
+	}
+	return "默认结局"
+}
+
+// reportStats 从叙事日志（检定、回合事件）和最终状态中统计战报数据
+func reportStats(story *models.StoryState, world *models.World, charState *models.CharacterState) models.ReportStats {
+	stats := models.ReportStats{
+		Turns:        story.Turn,
+		Days:         story.Day,
+		TraitsGained: []string{},
+		ItemsGained:  []string{},
+		Relations:    []models.RelationRank{},
+		HP:           charState.HP,
+		MaxHP:        charState.MaxHP,
+		SAN:          charState.SAN,
+		MaxSAN:       charState.MaxSAN,
+		Morality:     charState.Morality,
+		Reputation:   charState.Reputation,
+	}
+
+	for _, entry := range story.Narrative {
+		if roll := entry.DiceRoll; roll != nil {
+			stats.Rolls++
+			if roll.Success {
+				stats.Successes++
+			}
+			if roll.Critical && roll.Success {
+				stats.CriticalSuccesses++
+			}
+			if roll.Critical && !roll.Success {
+				stats.CriticalFailures++
+			}
+		}
+		for _, event := range entry.Events {
+			switch event.Type {
+			case eventTraitGained:
+				stats.TraitsGained = appendUnique(stats.TraitsGained, eventString(event, "trait"))
+			case eventItemGained:
+				stats.ItemsGained = appendUnique(stats.ItemsGained, eventString(event, "name"))
+			case eventRuleViolated:
+				stats.RulesViolated = appendUnique(stats.RulesViolated, eventString(event, "rule"))
+			}
+		}
+	}
+	if stats.Rolls > 0 {
+		stats.SuccessRate = float64(stats.Successes) / float64(stats.Rolls)
+	}
+
+	for _, npc := range world.NPCs {
+		relationship, ok := charState.Relations[npc.ID]
+		if !ok {
+			continue
+		}
+		stats.Relations = append(stats.Relations, models.RelationRank{NPCID: npc.ID, Name: npc.Name, Relationship: relationship})
+	}
+	sort.SliceStable(stats.Relations, func(i, j int) bool {
+		return stats.Relations[i].Relationship > stats.Relations[j].Relationship
+	})
+
+	return stats
+}
+
+// eventString 取事件数据中的字符串字段
+func eventString(event models.GameEvent, key string) string {
+	value, _ := event.Data[key].(string)
+	return value
+}
+
+// appendUnique 追加非空且不重复的值
+func appendUnique(list []string, value string) []string {
+	if value == "" || containsString(list, value) {
+		return list
+	}
+	return append(list, value)
+}
+
+// RenderReportMarkdown 把战报导出为 Markdown 文本
+func RenderReportMarkdown(report *models.StoryReport) string {
+	statusNames := map[string]string{"active": "进行中", "completed": "通关", "failed": "失败"}
+	stats := report.Stats
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# 战报：%s · %s\n\n", report.WorldName, report.Character)
+	fmt.Fprintf(&b, "- 结果：%s", statusNames[report.Status])
+	if report.EndingName != "" {
+		fmt.Fprintf(&b, "（%s）", report.EndingName)
+	}
+	fmt.Fprintf(&b, "\n- 生成时间：%s\n\n", report.GeneratedAt.Format("2006-01-02 15:04"))
+
+	if report.Review != "" {
+		fmt.Fprintf(&b, "## 回顾\n\n%s\n\n", report.Review)
+	}
+
+	b.WriteString("## 统计\n\n")
+	fmt.Fprintf(&b, "- 总回合：%d（第%d天）\n", stats.Turns, stats.Days)
+	fmt.Fprintf(&b, "- 检定：%d次，成功%d次（%.0f%%），大成功%d次，大失败%d次\n",
+		stats.Rolls, stats.Successes, stats.SuccessRate*100, stats.CriticalSuccesses, stats.CriticalFailures)
+	fmt.Fprintf(&b, "- 最终状态：HP %d/%d，理智 %d/%d，道德 %d，声望 %d\n",
+		stats.HP, stats.MaxHP, stats.SAN, stats.MaxSAN, stats.Morality, stats.Reputation)
+	fmt.Fprintf(&b, "- 获得特质：%s\n", joinOrNone(stats.TraitsGained))
+	fmt.Fprintf(&b, "- 获得道具：%s\n", joinOrNone(stats.ItemsGained))
+	if len(stats.RulesViolated) > 0 {
+		fmt.Fprintf(&b, "- 违反规则：%s\n", strings.Join(stats.RulesViolated, "、"))
+	}
+
+	if len(stats.Relations) > 0 {
+		b.WriteString("\n## 好感度排行\n\n")
+		for i, rank := range stats.Relations {
+			fmt.Fprintf(&b, "%d. %s（%+d）\n", i+1, rank.Name, rank.Relationship)
+		}
+	}
+
+	return b.String()
+}
+
+// joinOrNone 用顿号连接，空列表返回"无"
+func joinOrNone(list []string) string {
+	if len(list) == 0 {
+		return "无"
+	}
+	return strings.Join(list, "、")
+}
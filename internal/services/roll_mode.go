@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// 掷骰模式
+const (
+	RollNormal       = "normal"       // 普通：掷一次
+	RollAdvantage    = "advantage"    // 优势：掷两次取高
+	RollDisadvantage = "disadvantage" // 劣势：掷两次取低
+)
+
+// advantageStatuses 带来优势的角色状态
+var advantageStatuses = []string{"鼓舞", "专注", "祝福", "隐匿"}
+
+// disadvantageStatuses 带来劣势的角色状态（危机阶段的濒死/恐慌另有行动限制，不再叠加劣势）
+var disadvantageStatuses = []string{"受伤", "中毒", "疲惫", "虚弱", "恐惧", "失明"}
+
+// pickRoll 按模式从两次掷骰中取值：优势取高、劣势取低
+func pickRoll(rolls []int, mode string) int {
+	if mode == RollDisadvantage {
+		return min(rolls[0], rolls[1])
+	}
+	return max(rolls[0], rolls[1])
+}
+
+// rollModeFor 按角色状态选择掷骰模式，返回模式和带来它的状态；
+// 同时有优势和劣势时互相抵消，按普通检定处理
+func rollModeFor(charState *models.CharacterState) (mode string, source string) {
+	var advantages, disadvantages []string
+	for _, status := range charState.Status {
+		switch {
+		case containsString(advantageStatuses, status):
+			advantages = append(advantages, status)
+		case containsString(disadvantageStatuses, status):
+			disadvantages = append(disadvantages, status)
+		}
+	}
+	sort.Strings(advantages)
+	sort.Strings(disadvantages)
+
+	switch {
+	case len(advantages) > 0 && len(disadvantages) == 0:
+		return RollAdvantage, strings.Join(advantages, "、")
+	case len(disadvantages) > 0 && len(advantages) == 0:
+		return RollDisadvantage, strings.Join(disadvantages, "、")
+	default:
+		return RollNormal, ""
+	}
+}
+
+// describeRollMode 叙事prompt中的掷骰模式说明（普通检定为空）
+func describeRollMode(diceRoll *models.DiceRoll) string {
+	if len(diceRoll.Rolls) != 2 {
+		return ""
+	}
+	switch diceRoll.Mode {
+	case RollAdvantage:
+		return fmt.Sprintf("，因「%s」获得优势，掷出%d和%d取高", diceRoll.ModeSource, diceRoll.Rolls[0], diceRoll.Rolls[1])
+	case RollDisadvantage:
+		return fmt.Sprintf("，因「%s」陷入劣势，掷出%d和%d取低", diceRoll.ModeSource, diceRoll.Rolls[0], diceRoll.Rolls[1])
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// eventRomanceStage 与NPC的攻略阶段推进
+const eventRomanceStage = "romance_stage"
+
+// romanceStage 攻略阶段：好感度达到门槛时推进（只进不退），并解锁对应的互动
+type romanceStage struct {
+	Key       string
+	Name      string
+	Threshold int      // 进入该阶段所需的好感度
+	Unlocks   []string // 进入该阶段后才能对该NPC使用的行动类型
+	Milestone string   // 进入该阶段时的里程碑叙事（%s 为NPC名字）
+}
+
+// romanceStages 按顺序排列的攻略阶段
+var romanceStages = []romanceStage{
+	{Key: "stranger", Name: "陌生"},
+	{Key: "friend", Name: "好友", Threshold: 20, Unlocks: []string{"flirt"},
+		Milestone: "%s对你放下了戒备，你们成了可以说说心里话的朋友。"},
+	{Key: "ambiguous", Name: "暧昧", Threshold: 50, Unlocks: []string{"date", "touch"},
+		Milestone: "你和%s之间多了些说不清道不明的东西，目光相接时总有人先移开视线。"},
+	{Key: "lover", Name: "恋人", Threshold: 80, Unlocks: []string{"seduce"},
+		Milestone: "%s终于回应了你的心意，你们正式成为了恋人。"},
+	{Key: "harem", Name: "后宫", Threshold: 100,
+		Milestone: "%s已经离不开你，甘愿成为你身边的人之一。"},
+}
+
+// romanceable 判断NPC是否可攻略（敌人和首领不行）
+func romanceable(npc *models.NPC) bool {
+	return npc != nil && npc.Role != "enemy" && npc.Role != "boss"
+}
+
+// romanceStageIndex 返回故事中与该NPC所处的攻略阶段序号（未记录时为陌生）
+func romanceStageIndex(story *models.StoryState, npcID string) int {
+	key := story.RomanceStages[npcID]
+	for i, stage := range romanceStages {
+		if stage.Key == key {
+			return i
+		}
+	}
+	return 0
+}
+
+// requiredRomanceStage 返回解锁该行动类型所需的攻略阶段序号，不受阶段限制时返回 0
+func requiredRomanceStage(actionType string) int {
+	for i, stage := range romanceStages {
+		if containsString(stage.Unlocks, actionType) {
+			return i
+		}
+	}
+	return 0
+}
+
+// romanceLockReason 检查行动（含组合行动的每一步）对目标NPC是否已解锁，返回不允许的原因（允许时为空）
+func romanceLockReason(story *models.StoryState, world *models.World, action models.Action) string {
+	npc := findNPC(world, action.Target)
+	if !romanceable(npc) {
+		return ""
+	}
+	current := romanceStageIndex(story, npc.ID)
+	types := []string{actionTypeOf(action)}
+	for _, sub := range action.SubActions {
+		types = append(types, actionTypeOf(models.Action{Type: sub.Type, Content: sub.Content}))
+	}
+	for _, actionType := range types {
+		if required := requiredRomanceStage(actionType); required > current {
+			name := actionTypeNames[actionType]
+			if name == "" {
+				name = actionType
+			}
+			return fmt.Sprintf("你和%s还处于「%s」阶段，要到「%s」阶段才能%s",
+				npc.Name, romanceStages[current].Name, romanceStages[required].Name, name)
+		}
+	}
+	return ""
+}
+
+// advanceRomanceStages 好感度达到门槛时推进攻略阶段（可一次跨多个阶段），
+// 写入里程碑叙事并返回阶段推进事件
+func advanceRomanceStages(story *models.StoryState, world *models.World, charState *models.CharacterState) []models.GameEvent {
+	var events []models.GameEvent
+	for i := range world.NPCs {
+		npc := &world.NPCs[i]
+		relation, met := charState.Relations[npc.ID]
+		if !met || !romanceable(npc) {
+			continue
+		}
+		current := romanceStageIndex(story, npc.ID)
+		reached := current
+		for j := current + 1; j < len(romanceStages) && relation >= romanceStages[j].Threshold; j++ {
+			reached = j
+		}
+		if reached == current {
+			continue
+		}
+
+		stage := romanceStages[reached]
+		if story.RomanceStages == nil {
+			story.RomanceStages = make(map[string]string)
+		}
+		story.RomanceStages[npc.ID] = stage.Key
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   "💞 " + fmt.Sprintf(stage.Milestone, npc.Name),
+			Timestamp: time.Now(),
+		})
+		events = append(events, models.GameEvent{
+			Type:    eventRomanceStage,
+			Message: fmt.Sprintf("与%s的关系进入「%s」阶段", npc.Name, stage.Name),
+			Data:    map[string]interface{}{"npc_id": npc.ID, "npc_name": npc.Name, "stage": stage.Key, "value": relation},
+		})
+		log.Printf("💞 [攻略] %s 进入「%s」阶段（好感 %d）\n", npc.Name, stage.Name, relation)
+	}
+	return events
+}
+
+// cloneRomanceStages 复制攻略阶段（快照与故事各持一份）
+func cloneRomanceStages(stages map[string]string) map[string]string {
+	return maps.Clone(stages)
+}
+
+// RomanceStatus 返回故事中每个可攻略NPC的当前阶段、好感度和下一阶段门槛
+func (ss *StoryService) RomanceStatus(storyID string) ([]models.RomanceStatus, error) {
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
+	world, err := ss.storage.GetWorld(story.WorldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	// 只读取本故事线的状态，不覆盖角色当前的世界状态
+	charState := story.CharState
+	if charState == nil {
+		charState, err = ss.meta.GetCharacterState(story.CharacterID, story.WorldID)
+		if err != nil {
+			return nil, fmt.Errorf("获取角色状态失败: %w", err)
+		}
+	}
+
+	statuses := []models.RomanceStatus{}
+	for i := range world.NPCs {
+		npc := &world.NPCs[i]
+		if !romanceable(npc) {
+			continue
+		}
+		index := romanceStageIndex(story, npc.ID)
+		relation, met := charState.Relations[npc.ID]
+		if !met {
+			relation = npc.Relationship
+		}
+		status := models.RomanceStatus{
+			NPCID:        npc.ID,
+			NPCName:      npc.Name,
+			Stage:        romanceStages[index].Key,
+			StageName:    romanceStages[index].Name,
+			Relationship: relation,
+		}
+		for _, stage := range romanceStages[:index+1] {
+			status.Unlocked = append(status.Unlocked, stage.Unlocks...)
+		}
+		if index+1 < len(romanceStages) {
+			next := romanceStages[index+1]
+			status.NextStage, status.NextStageName, status.NextThreshold = next.Key, next.Name, next.Threshold
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -1,35 +1,212 @@
 package services
 
 import (
+	"math"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/aiwuxian/project-abyss/internal/models"
 )
 
+const (
+	critAttributeThreshold = 18 // 检定属性达到该值时大成功阈值扩大1
+	minCritSuccess         = 15 // 大成功阈值最多扩大到15-20
+	maxCritFailure         = 5  // 大失败阈值最多扩大到1-5
+)
+
+// CritRange 大成功/大失败的触发阈值：掷出不低于 Success 为大成功，不高于 Failure 为大失败
+type CritRange struct {
+	Success int
+	Failure int
+}
+
+// RandomSource 规则引擎的随机源（*rand.Rand 即满足），测试或回放时可替换成确定性的实现
+type RandomSource interface {
+	// Intn 返回 [0, n) 内的整数
+	Intn(n int) int
+}
+
+// FixedRolls 按顺序循环给出预设骰面的确定性随机源，每个值是骰面（1起），超过骰子面数时取最大面
+type FixedRolls struct {
+	faces []int
+	next  int
+}
+
+// NewFixedRolls 用给定的骰面序列构造确定性随机源
+func NewFixedRolls(faces ...int) *FixedRolls {
+	return &FixedRolls{faces: faces}
+}
+
+func (f *FixedRolls) Intn(n int) int {
+	if len(f.faces) == 0 {
+		return 0
+	}
+	face := f.faces[f.next%len(f.faces)]
+	f.next++
+	return max(1, min(face, n)) - 1
+}
+
 type RuleEngine struct {
-	rng *rand.Rand
+	mu    sync.Mutex
+	rng   RandomSource
+	rules models.RulesConfig
 }
 
 func NewRuleEngine() *RuleEngine {
+	return NewRuleEngineWithSource(rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// NewRuleEngineWithSource 使用指定随机源构造规则引擎（如 NewFixedRolls 注入固定骰值）
+func NewRuleEngineWithSource(source RandomSource) *RuleEngine {
 	return &RuleEngine{
-		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+		rng:   source,
+		rules: defaultRules(),
 	}
 }
 
+// SetRandomSource 替换随机源，之后的所有投骰（检定、伤害、理智损失）都从它取值
+func (re *RuleEngine) SetRandomSource(source RandomSource) {
+	re.mu.Lock()
+	re.rng = source
+	re.mu.Unlock()
+}
+
+// defaultRules 默认的难度规则
+func defaultRules() models.RulesConfig {
+	return models.RulesConfig{
+		BaseDifficulty: 10,
+		SceneDifficulty: map[string]int{
+			"combat":      15,
+			"social":      12,
+			"exploration": 10,
+			"puzzle":      14,
+		},
+		ActionModifiers: map[string]int{
+			"attack":   2,
+			"sneak":    3,
+			"persuade": 1,
+		},
+		CriticalSuccess:   20,
+		CriticalFailure:   1,
+		TrivialDifficulty: 6,
+		CrisisThreshold:   0.2,
+		LevelScaling:      models.LevelScalingConfig{Factor: 1, MaxAdjust: 5},
+		Outcome: models.OutcomeConfig{
+			DamageBase:       5,
+			SANDice:          6,
+			DegreeFactor:     0.5,
+			DifficultyFactor: 0.25,
+			CounterSeverity:  1,
+		},
+	}
+}
+
+// SetRules 热更新难度规则，未配置的项沿用默认值
+func (re *RuleEngine) SetRules(rules models.RulesConfig) {
+	defaults := defaultRules()
+	if rules.BaseDifficulty <= 0 {
+		rules.BaseDifficulty = defaults.BaseDifficulty
+	}
+	if rules.SceneDifficulty == nil {
+		rules.SceneDifficulty = defaults.SceneDifficulty
+	}
+	if rules.ActionModifiers == nil {
+		rules.ActionModifiers = defaults.ActionModifiers
+	}
+	if rules.CriticalSuccess <= 0 {
+		rules.CriticalSuccess = defaults.CriticalSuccess
+	}
+	if rules.CriticalFailure <= 0 {
+		rules.CriticalFailure = defaults.CriticalFailure
+	}
+	if rules.TrivialDifficulty == 0 {
+		rules.TrivialDifficulty = defaults.TrivialDifficulty
+	}
+	if rules.CrisisThreshold == 0 {
+		rules.CrisisThreshold = defaults.CrisisThreshold
+	}
+	if rules.LevelScaling.Factor <= 0 {
+		rules.LevelScaling.Factor = defaults.LevelScaling.Factor
+	}
+	if rules.LevelScaling.MaxAdjust <= 0 {
+		rules.LevelScaling.MaxAdjust = defaults.LevelScaling.MaxAdjust
+	}
+	if rules.Outcome.DamageBase <= 0 {
+		rules.Outcome.DamageBase = defaults.Outcome.DamageBase
+	}
+	if rules.Outcome.SANDice <= 0 {
+		rules.Outcome.SANDice = defaults.Outcome.SANDice
+	}
+	if rules.Outcome.DegreeFactor == 0 {
+		rules.Outcome.DegreeFactor = defaults.Outcome.DegreeFactor
+	}
+	if rules.Outcome.DifficultyFactor == 0 {
+		rules.Outcome.DifficultyFactor = defaults.Outcome.DifficultyFactor
+	}
+	if rules.Outcome.CounterSeverity == 0 {
+		rules.Outcome.CounterSeverity = defaults.Outcome.CounterSeverity
+	}
+
+	re.mu.Lock()
+	re.rules = rules
+	re.mu.Unlock()
+}
+
 // RollD20 投D20骰子
 func (re *RuleEngine) RollD20() int {
-	return re.rng.Intn(20) + 1
+	return re.RollDice(20)
 }
 
 // RollDice 投任意骰子
 func (re *RuleEngine) RollDice(sides int) int {
+	re.mu.Lock()
+	defer re.mu.Unlock()
 	return re.rng.Intn(sides) + 1
 }
 
-// Check 执行检定
-func (re *RuleEngine) Check(attribute int, difficulty int) *models.DiceRoll {
+// CriticalRange 计算本次检定的大成功/大失败阈值：以规则配置为基础，
+// 检定属性足够高时大成功阈值扩大1，再加上角色特质带来的扩大量
+func (re *RuleEngine) CriticalRange(attribute int, character *models.Character) CritRange {
+	successBonus, failureBonus := traitCritBonus(character)
+	crit := re.baseCritRange()
+	if attribute >= critAttributeThreshold {
+		successBonus++
+	}
+	crit.Success = max(minCritSuccess, min(20, crit.Success-successBonus))
+	crit.Failure = max(1, min(maxCritFailure, crit.Failure+failureBonus))
+	return crit
+}
+
+// baseCritRange 规则配置的大成功/大失败阈值（不含属性和特质的扩大）
+func (re *RuleEngine) baseCritRange() CritRange {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	return CritRange{Success: re.rules.CriticalSuccess, Failure: re.rules.CriticalFailure}
+}
+
+// Check 执行检定，按 crit 判定大成功/大失败
+func (re *RuleEngine) Check(attribute int, difficulty int, crit CritRange) *models.DiceRoll {
+	return re.check(attribute, difficulty, crit, RollNormal)
+}
+
+// CheckWithMode 按掷骰模式执行检定：优势掷两次D20取高，劣势取低，其余按普通检定掷一次；
+// 大成功/大失败按采用的那一次、以规则配置的阈值判定
+func (re *RuleEngine) CheckWithMode(attribute, difficulty int, mode string) *models.DiceRoll {
+	return re.check(attribute, difficulty, re.baseCritRange(), mode)
+}
+
+// check 按掷骰模式执行检定，按 crit 判定大成功/大失败（角色检定时阈值受属性和特质影响）
+func (re *RuleEngine) check(attribute, difficulty int, crit CritRange, mode string) *models.DiceRoll {
 	roll := re.RollD20()
+	var rolls []int
+	switch mode {
+	case RollAdvantage, RollDisadvantage:
+		rolls = []int{roll, re.RollD20()}
+		roll = pickRoll(rolls, mode)
+	default:
+		mode = RollNormal
+	}
 	total := roll + attribute
 
 	result := &models.DiceRoll{
@@ -38,48 +215,64 @@ func (re *RuleEngine) Check(attribute int, difficulty int) *models.DiceRoll {
 		Modifier: attribute,
 		Target:   difficulty,
 		Success:  total >= difficulty,
-		Critical: roll == 20 || roll == 1,
+		Critical: roll >= crit.Success || roll <= crit.Failure,
+		Mode:     mode,
+		Rolls:    rolls,
 	}
 
 	// 大成功
-	if roll == 20 {
+	if roll >= crit.Success {
 		result.Success = true
 	}
 	// 大失败
-	if roll == 1 {
+	if roll <= crit.Failure {
 		result.Success = false
 	}
 
 	return result
 }
 
-// CalculateDifficulty 根据场景和行动计算难度
-func (re *RuleEngine) CalculateDifficulty(sceneType string, actionType string) int {
-	baseDifficulty := 10
+// CalculateDifficulty 根据场景和行动计算难度；开启等级缩放时再按角色等级与世界难度的差值动态平衡
+func (re *RuleEngine) CalculateDifficulty(sceneType string, actionType string, level, worldDifficulty int) int {
+	re.mu.Lock()
+	defer re.mu.Unlock()
 
 	// 根据场景类型调整
-	switch sceneType {
-	case "combat":
-		baseDifficulty = 15
-	case "social":
-		baseDifficulty = 12
-	case "exploration":
-		baseDifficulty = 10
-	case "puzzle":
-		baseDifficulty = 14
+	difficulty, ok := re.rules.SceneDifficulty[sceneType]
+	if !ok {
+		difficulty = re.rules.BaseDifficulty
 	}
 
 	// 根据行动类型微调
-	switch actionType {
-	case "attack":
-		baseDifficulty += 2
-	case "sneak":
-		baseDifficulty += 3
-	case "persuade":
-		baseDifficulty += 1
-	}
+	difficulty += re.rules.ActionModifiers[actionType]
+
+	// 等级碾压世界时升难度保留挑战，等级不够时降难度避免必败
+	return difficulty + levelScalingAdjust(re.rules.LevelScaling, level, worldDifficulty)
+}
+
+// IsTrivial 检定难度是否低到无需检定（直接成功）
+func (re *RuleEngine) IsTrivial(difficulty int) bool {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	return re.rules.TrivialDifficulty > 0 && difficulty <= re.rules.TrivialDifficulty
+}
+
+// CrisisThreshold 进入濒死/恐慌阶段的HP/SAN比例，关闭时返回0
+func (re *RuleEngine) CrisisThreshold() float64 {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	return max(re.rules.CrisisThreshold, 0)
+}
 
-	return baseDifficulty
+// levelScalingAdjust 按角色等级与世界难度（1-10）的差值计算难度调整，未开启或世界难度未知时为0
+func levelScalingAdjust(scaling models.LevelScalingConfig, level, worldDifficulty int) int {
+	if !scaling.Enabled || worldDifficulty <= 0 || level <= 0 {
+		return 0
+	}
+	adjust := int(math.Round(float64(level-worldDifficulty) * scaling.Factor))
+	return max(-scaling.MaxAdjust, min(adjust, scaling.MaxAdjust))
 }
 
 // CalculateXPGain 计算经验值获得
@@ -91,10 +284,118 @@ func (re *RuleEngine) CalculateXPGain(difficulty int, success bool) int {
 	return baseXP / 2 // 失败也有一半经验
 }
 
+// XPToNextLevel 从当前等级升到下一级需要的经验值
+func (re *RuleEngine) XPToNextLevel(currentLevel int) int {
+	return currentLevel * 100
+}
+
+// XPBetween 从 fromLevel 级升到 toLevel 级需要的经验值（toLevel 低于 fromLevel 时为负）
+func (re *RuleEngine) XPBetween(fromLevel, toLevel int) int {
+	xp := 0
+	for level := fromLevel; level < toLevel; level++ {
+		xp += re.XPToNextLevel(level)
+	}
+	for level := toLevel; level < fromLevel; level++ {
+		xp -= re.XPToNextLevel(level)
+	}
+	return xp
+}
+
 // CheckLevelUp 检查是否升级
 func (re *RuleEngine) CheckLevelUp(currentXP int, currentLevel int) bool {
-	requiredXP := currentLevel * 100
-	return currentXP >= requiredXP
+	return currentXP >= re.XPToNextLevel(currentLevel)
+}
+
+// SuccessChance 计算检定成功的概率（与CheckWithMode的判定规则一致，优势/劣势按两次掷骰的全部组合计算）
+func (re *RuleEngine) SuccessChance(attribute int, difficulty int, crit CritRange, mode string) float64 {
+	succeeds := func(roll int) bool {
+		return roll >= crit.Success || (roll > crit.Failure && roll+attribute >= difficulty)
+	}
+	if mode != RollAdvantage && mode != RollDisadvantage {
+		successes := 0
+		for roll := 1; roll <= 20; roll++ {
+			if succeeds(roll) {
+				successes++
+			}
+		}
+		return float64(successes) / 20
+	}
+
+	successes := 0
+	for first := 1; first <= 20; first++ {
+		for second := 1; second <= 20; second++ {
+			if succeeds(pickRoll([]int{first, second}, mode)) {
+				successes++
+			}
+		}
+	}
+	return float64(successes) / 400
+}
+
+// outcomeRules 返回当前的损益规则和基础难度
+func (re *RuleEngine) outcomeRules() (models.OutcomeConfig, int) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+	return re.rules.Outcome, re.rules.BaseDifficulty
+}
+
+// lossBonus 按失败的差距和目标难度计算额外损失（系数为负时该项不计）
+func lossBonus(outcome models.OutcomeConfig, baseDifficulty, shortfall, target int) int {
+	bonus := 0.0
+	if outcome.DegreeFactor > 0 {
+		bonus += float64(max(shortfall, 0)) * outcome.DegreeFactor
+	}
+	if outcome.DifficultyFactor > 0 {
+		bonus += float64(max(target-baseDifficulty, 0)) * outcome.DifficultyFactor
+	}
+	return int(math.Round(bonus))
+}
+
+// shortfall 检定总值距离目标还差多少（达到目标时为0）
+func shortfall(roll *models.DiceRoll) int {
+	return max(roll.Target-roll.Result-roll.Modifier, 0)
+}
+
+// FailureDamage 计算战斗中检定失败受到的伤害：惨败比险败伤得更重，难度越高伤得越重，大失败时基础伤害翻倍
+func (re *RuleEngine) FailureDamage(roll *models.DiceRoll) int {
+	outcome, baseDifficulty := re.outcomeRules()
+	return re.CalculateDamage(outcome.DamageBase, roll.Critical) +
+		lossBonus(outcome, baseDifficulty, shortfall(roll), roll.Target)
+}
+
+// FailureSANLoss 计算检定失败时的理智损失（不含威胁加成），同样随差距和难度增加
+func (re *RuleEngine) FailureSANLoss(roll *models.DiceRoll) int {
+	outcome, baseDifficulty := re.outcomeRules()
+	return re.RollDice(outcome.SANDice) + lossBonus(outcome, baseDifficulty, shortfall(roll), roll.Target)
+}
+
+// lossShortfallRange 失败时差距的可能范围：最好是险败差1点（属性足够高时只有大失败会失败，差距可能为0），
+// 最坏是掷出1
+func lossShortfallRange(attribute, difficulty int) (int, int) {
+	worst := max(difficulty-1-attribute, 0)
+	return min(1, worst), worst
+}
+
+// DamageRange 返回 FailureDamage 可能的伤害范围（最坏情况按大失败翻倍）
+func (re *RuleEngine) DamageRange(attribute, difficulty int) (int, int) {
+	outcome, baseDifficulty := re.outcomeRules()
+	best, worst := lossShortfallRange(attribute, difficulty)
+	return 1 + outcome.DamageBase + lossBonus(outcome, baseDifficulty, best, difficulty),
+		(6+outcome.DamageBase)*2 + lossBonus(outcome, baseDifficulty, worst, difficulty)
+}
+
+// SANLossRange 返回 FailureSANLoss 可能的理智损失范围（不含威胁加成）
+func (re *RuleEngine) SANLossRange(attribute, difficulty int) (int, int) {
+	outcome, baseDifficulty := re.outcomeRules()
+	best, worst := lossShortfallRange(attribute, difficulty)
+	return 1 + lossBonus(outcome, baseDifficulty, best, difficulty),
+		outcome.SANDice + lossBonus(outcome, baseDifficulty, worst, difficulty)
+}
+
+// CounterSeverity 战斗中大成功时削弱最严重威胁的等级，0表示不反击
+func (re *RuleEngine) CounterSeverity() int {
+	outcome, _ := re.outcomeRules()
+	return max(outcome.CounterSeverity, 0)
 }
 
 // CalculateDamage 计算伤害
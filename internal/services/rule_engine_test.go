@@ -0,0 +1,171 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+func TestCriticalSuccessDoublesXP(t *testing.T) {
+	ss := NewStoryService(nil, nil, NewRuleEngineWithSource(NewFixedRolls(4)), nil)
+	scene := &models.Scene{Type: "exploration"}
+	char := &models.Character{Name: "测试角色"}
+
+	normal := ss.calculateChanges(scene, char, nil, &models.DiceRoll{Result: 15, Target: 12, Success: true})
+	critical := ss.calculateChanges(scene, char, nil, &models.DiceRoll{Result: 20, Target: 12, Success: true, Critical: true})
+	if normal.XPGain != 120 {
+		t.Errorf("普通成功的经验值应为难度×10=120，实际 %d", normal.XPGain)
+	}
+	if critical.XPGain != 2*normal.XPGain {
+		t.Errorf("大成功的经验值应翻倍为 %d，实际 %d", 2*normal.XPGain, critical.XPGain)
+	}
+}
+
+func TestFailureDamage(t *testing.T) {
+	// 默认规则：基础伤害5，差距系数0.5，难度系数0.25，基础难度10
+	tests := []struct {
+		name string
+		roll models.DiceRoll
+		want int
+	}{
+		// D6掷出4：4+5，差距 15-5-2=8 → +4，难度高出5 → +1.25，四舍五入共 +5
+		{"险败", models.DiceRoll{Result: 5, Modifier: 2, Target: 15}, 14},
+		// 大失败基础伤害翻倍：(4+5)×2，差距12 → +6，难度 → +1.25，共 +7
+		{"大失败", models.DiceRoll{Result: 1, Modifier: 2, Target: 15, Critical: true}, 25},
+		// 达到基础难度且只差1点：4+5，+0.5 四舍五入为 +1
+		{"差一点", models.DiceRoll{Result: 7, Modifier: 2, Target: 10}, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re := NewRuleEngineWithSource(NewFixedRolls(4))
+			if got := re.FailureDamage(&tt.roll); got != tt.want {
+				t.Errorf("伤害应为 %d，实际 %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFailureSANLoss(t *testing.T) {
+	re := NewRuleEngineWithSource(NewFixedRolls(3))
+	// D6掷出3，差距8 → +4，难度高出5 → +1.25，四舍五入共 3+5
+	if got := re.FailureSANLoss(&models.DiceRoll{Result: 5, Modifier: 2, Target: 15}); got != 8 {
+		t.Errorf("理智损失应为 8，实际 %d", got)
+	}
+
+	// 恐怖场景的威胁额外增加理智损失
+	ss := NewStoryService(nil, nil, NewRuleEngineWithSource(NewFixedRolls(3)), nil)
+	scene := &models.Scene{Type: "horror", Threats: []models.Threat{{Text: "低语", Severity: 3}}}
+	changes := ss.calculateChanges(scene, &models.Character{}, nil, &models.DiceRoll{Result: 5, Modifier: 2, Target: 15})
+	if want := -(8 + threatSANBonus(scene)); changes.SANChange != want {
+		t.Errorf("恐怖场景失败的理智变化应为 %d，实际 %d", want, changes.SANChange)
+	}
+	if changes.HPChange != 0 {
+		t.Errorf("非战斗场景失败不应损失HP，实际 %d", changes.HPChange)
+	}
+}
+
+func TestCheckWithMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		faces    []int
+		mode     string
+		want     int
+		rolls    int
+		success  bool
+		critical bool
+	}{
+		{"普通检定只掷一次", []int{8, 17}, RollNormal, 8, 0, false, false},
+		{"未知模式按普通检定", []int{8, 17}, "lucky", 8, 0, false, false},
+		{"优势取高", []int{8, 17}, RollAdvantage, 17, 2, true, false},
+		{"劣势取低", []int{8, 17}, RollDisadvantage, 8, 2, false, false},
+		{"优势掷出大成功", []int{3, 20}, RollAdvantage, 20, 2, true, true},
+		{"劣势掷出大失败", []int{20, 1}, RollDisadvantage, 1, 2, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re := NewRuleEngineWithSource(NewFixedRolls(tt.faces...))
+			roll := re.CheckWithMode(2, 15, tt.mode)
+			if roll.Result != tt.want || len(roll.Rolls) != tt.rolls {
+				t.Errorf("应采用 %d（记录 %d 次掷骰），实际 %d，掷骰 %v", tt.want, tt.rolls, roll.Result, roll.Rolls)
+			}
+			if roll.Success != tt.success || roll.Critical != tt.critical {
+				t.Errorf("成功/大成败应为 %v/%v，实际 %v/%v", tt.success, tt.critical, roll.Success, roll.Critical)
+			}
+			if tt.rolls == 0 && roll.Mode != RollNormal {
+				t.Errorf("普通检定的模式应记为 %s，实际 %s", RollNormal, roll.Mode)
+			}
+		})
+	}
+}
+
+func TestRollModeFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		status []string
+		mode   string
+		source string
+	}{
+		{"没有状态", nil, RollNormal, ""},
+		{"增益带来优势", []string{"鼓舞", "专注"}, RollAdvantage, "专注、鼓舞"},
+		{"受伤带来劣势", []string{"受伤"}, RollDisadvantage, "受伤"},
+		{"优势和劣势互相抵消", []string{"鼓舞", "受伤"}, RollNormal, ""},
+		{"无关状态不影响", []string{"饥饿"}, RollNormal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, source := rollModeFor(&models.CharacterState{Status: tt.status})
+			if mode != tt.mode || source != tt.source {
+				t.Errorf("应为 %s（%s），实际 %s（%s）", tt.mode, tt.source, mode, source)
+			}
+		})
+	}
+}
+
+func TestCritRangeChangesSuccessChance(t *testing.T) {
+	re := NewRuleEngineWithSource(NewFixedRolls(10))
+	base := re.CriticalRange(10, &models.Character{})
+	if base != (CritRange{Success: 20, Failure: 1}) {
+		t.Fatalf("默认阈值应为 20/1，实际 %+v", base)
+	}
+	wide := re.CriticalRange(10, &models.Character{Traits: []string{"天选之人"}})
+	if wide != (CritRange{Success: 19, Failure: 1}) {
+		t.Fatalf("天选之人的阈值应为 19/1，实际 %+v", wide)
+	}
+
+	tests := []struct {
+		name       string
+		difficulty int
+		mode       string
+		base, wide float64
+	}{
+		// 难度远超属性时只有大成功能通过：1/20 → 2/20
+		{"只能靠大成功", 40, RollNormal, 0.05, 0.10},
+		// 优势下两次都不是大成功才失败：1-(19/20)² → 1-(18/20)²
+		{"优势只能靠大成功", 40, RollAdvantage, 1 - 0.95*0.95, 1 - 0.9*0.9},
+		// 本来就能通过的难度不受大成功阈值影响
+		{"普通难度", 12, RollNormal, 0.95, 0.95},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotWide := re.SuccessChance(10, tt.difficulty, base, tt.mode), re.SuccessChance(10, tt.difficulty, wide, tt.mode)
+			if !approxEqual(got, tt.base) || !approxEqual(gotWide, tt.wide) {
+				t.Errorf("成功率应为 %.4f → %.4f，实际 %.4f → %.4f", tt.base, tt.wide, got, gotWide)
+			}
+		})
+	}
+
+	// 掷出19时按扩大后的阈值判定为大成功
+	re.SetRandomSource(NewFixedRolls(19))
+	if roll := re.Check(10, 40, wide); !roll.Success || !roll.Critical {
+		t.Errorf("19-20 阈值下掷出19应为大成功，实际 %+v", roll)
+	}
+	if roll := re.Check(10, 40, base); roll.Success || roll.Critical {
+		t.Errorf("默认阈值下掷出19不应通过难度40，实际 %+v", roll)
+	}
+}
+
+// approxEqual 比较两个概率是否在浮点误差内相等
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
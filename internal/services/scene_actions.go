@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// defaultSceneActions 未配置时各场景类型允许的行动类型（未列出的场景类型不限制，custom 始终允许）
+var defaultSceneActions = map[string][]string{
+	"combat":     {"attack", "move", "sneak", "observe", "investigate", "help", "talk", "persuade", "touch"},
+	"date":       {"talk", "flirt", "seduce", "date", "help", "touch", "observe", "move"},
+	"romance":    {"talk", "flirt", "seduce", "date", "help", "touch", "observe", "move"},
+	"temptation": {"talk", "flirt", "seduce", "touch", "persuade", "observe", "move"},
+	"work":       {"work", "talk", "help", "persuade", "study", "observe", "investigate", "move"},
+	"school":     {"study", "talk", "help", "persuade", "flirt", "date", "observe", "move", "work"},
+	"social":     {"talk", "help", "persuade", "flirt", "date", "touch", "observe", "move"},
+}
+
+// sceneTypeNames 场景类型的中文名（用于提示）
+var sceneTypeNames = map[string]string{
+	"combat":     "战斗",
+	"date":       "约会",
+	"romance":    "恋爱",
+	"temptation": "诱惑",
+	"work":       "工作",
+	"school":     "校园",
+	"social":     "社交",
+}
+
+// allowedSceneActions 返回场景类型允许的行动类型：配置优先于内置默认，返回 nil 表示不限制
+func allowedSceneActions(cfg models.GameConfig, sceneType string) []string {
+	if actions, ok := cfg.SceneActions[sceneType]; ok {
+		return actions
+	}
+	return defaultSceneActions[sceneType]
+}
+
+// sceneAllows 判断行动类型是否契合场景（不限制的场景、custom、危机自救和未标注类型的行动总是允许）
+func sceneAllows(allowed []string, actionType string) bool {
+	return len(allowed) == 0 || actionType == "" || actionType == "custom" || isCrisisAction(actionType) ||
+		containsString(allowed, actionType)
+}
+
+// describeAllowedActions 生成约束选项类型的prompt说明（不限制时返回空）
+func describeAllowedActions(allowed []string) string {
+	if len(allowed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n**本场景的 action_type 只能从以下类型中选择：%s（或 custom）**\n", strings.Join(allowed, "/"))
+}
+
+// fitSceneOptions 过滤掉不合场景类型的选项；全部被过滤时改用契合场景的默认选项
+func (ss *StoryService) fitSceneOptions(scene *models.Scene, options []models.Option) []models.Option {
+	allowed := allowedSceneActions(ss.meta.GameConfig(), scene.Type)
+	if len(allowed) == 0 {
+		return options
+	}
+
+	fitted := make([]models.Option, 0, len(options))
+	for _, opt := range options {
+		if sceneAllows(allowed, opt.ActionType) {
+			fitted = append(fitted, opt)
+		}
+	}
+	if dropped := len(options) - len(fitted); dropped > 0 {
+		log.Printf("🧭 [场景行动] %s场景过滤掉 %d 个不合场景的选项\n", scene.Type, dropped)
+	}
+	if len(fitted) > 0 {
+		return fitted
+	}
+	for _, opt := range ss.getDefaultOptions() {
+		if sceneAllows(allowed, opt.ActionType) {
+			fitted = append(fitted, opt)
+		}
+	}
+	return fitted
+}
+
+// offSceneEvent 玩家自定义的行动不合场景类型时给出提示事件（不阻止行动）
+func offSceneEvent(cfg models.GameConfig, scene *models.Scene, action models.Action) *models.GameEvent {
+	actionType := actionTypeOf(action)
+	if sceneAllows(allowedSceneActions(cfg, scene.Type), actionType) {
+		return nil
+	}
+	sceneName := sceneTypeNames[scene.Type]
+	if sceneName == "" {
+		sceneName = scene.Type
+	}
+	actionName := actionTypeNames[actionType]
+	if actionName == "" {
+		actionName = actionType
+	}
+	return &models.GameEvent{
+		Type:    "off_scene_action",
+		Message: fmt.Sprintf("当前是%s场景，「%s」不太合时宜", sceneName, actionName),
+		Data:    map[string]interface{}{"scene_type": scene.Type, "action_type": actionType},
+	}
+}
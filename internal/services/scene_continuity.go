@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/google/uuid"
+)
+
+// sceneSummaryExcerpt 上一场景描述保留的字数
+const sceneSummaryExcerpt = 200
+
+// describeSceneContinuity 给新场景的prompt提供上一场景的摘要、最近的叙事和要进入的剧情节点，
+// 让场景过渡自然（"离开教室后，你来到了…"）
+func describeSceneContinuity(previous *models.Scene, recent []models.NarrativeLog, node *models.PlotNode) string {
+	var lines []string
+	for _, entry := range recent {
+		if entry.Type == "system" {
+			continue
+		}
+		lines = append(lines, "- "+excerptText(entry.Content, sceneSummaryExcerpt))
+	}
+	history := strings.Join(lines, "\n")
+	if history == "" {
+		history = "（无）"
+	}
+
+	nodeText := ""
+	if node != nil {
+		nodeText = fmt.Sprintf("\n即将展开的剧情：%s —— %s", node.Name, node.Description)
+		if node.Location != "" {
+			nodeText += "（地点：" + node.Location + "）"
+		}
+	}
+
+	return fmt.Sprintf(`
+**承接上一场景（这不是开场，玩家已经在这个世界里经历了前面的故事）：**
+上一场景：%s —— %s
+最近发生的事：
+%s%s
+新场景要从上一场景自然过渡过来（如"离开教室后，你来到了…"），description 开头交代玩家是怎么从上一场景来到这里的；
+忽略下面"玩家是新进入者""开场场景"的要求，已经出场的人物和发生过的事要前后一致。
+`, previous.Name, excerptText(previous.Description, sceneSummaryExcerpt), history, nodeText)
+}
+
+// continueScene 剧情推进到新节点时生成承接上一场景的新场景，并把故事切换过去。
+// 生成失败时留在原场景，不影响本回合
+func (ss *StoryService) continueScene(ctx context.Context, story *models.StoryState, world *models.World,
+	character *models.Character, previous *models.Scene) *models.Scene {
+
+	recent := story.Narrative
+	if len(recent) > recentNarrativeLimit {
+		recent = recent[len(recent)-recentNarrativeLimit:]
+	}
+	continuity := describeSceneContinuity(previous, recent, findPlotNode(world, story.CurrentPlotNodeID))
+
+	scene, err := ss.llm.GenerateScene(ctx, world, character, describeTimeContext(world, story.Day, story.Period), continuity)
+	if err != nil {
+		log.Printf("⚠️ 生成新场景失败，留在当前场景: %v\n", err)
+		return previous
+	}
+	scene.ID = uuid.New().String()
+	if err := ss.storage.CreateScene(scene); err != nil {
+		log.Printf("⚠️ 保存新场景失败，留在当前场景: %v\n", err)
+		return previous
+	}
+
+	story.SceneID = scene.ID
+	story.Narrative = append(story.Narrative, models.NarrativeLog{
+		Turn:      story.Turn,
+		Type:      "system",
+		Content:   fmt.Sprintf("📍 【场景切换】%s\n\n%s", scene.Name, scene.Description),
+		Timestamp: time.Now(),
+	})
+	log.Printf("📍 [场景切换] %s → %s\n", previous.Name, scene.Name)
+	return scene
+}
+
+// findPlotNode 按ID查找世界中的剧情节点，找不到时返回 nil
+func findPlotNode(world *models.World, nodeID string) *models.PlotNode {
+	for i := range world.PlotLines {
+		if world.PlotLines[i].ID == nodeID {
+			return &world.PlotLines[i]
+		}
+	}
+	return nil
+}
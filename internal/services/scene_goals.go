@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// objectiveMarker 叙事中的目标达成标记，格式：【目标达成】编号
+const objectiveMarker = "【目标达成】"
+
+const (
+	defaultObjectiveReward = 30 // 未指定奖励的目标完成时获得的经验值
+	defaultThreatSeverity  = 2  // 未指定严重程度的威胁
+	maxThreatSeverity      = 5
+	threatTriggerSeverity  = 3 // 大失败时，严重程度达到该值的威胁会爆发
+)
+
+// normalizeSceneGoals 整理场景的目标和威胁：去掉空项，补上默认奖励和严重程度
+func normalizeSceneGoals(scene *models.Scene) {
+	objectives := []models.Objective{}
+	for _, objective := range scene.Objectives {
+		objective.Text = strings.TrimSpace(objective.Text)
+		if objective.Text == "" {
+			continue
+		}
+		if objective.Reward <= 0 {
+			objective.Reward = defaultObjectiveReward
+		}
+		objectives = append(objectives, objective)
+	}
+	scene.Objectives = objectives
+
+	threats := []models.Threat{}
+	for _, threat := range scene.Threats {
+		threat.Text = strings.TrimSpace(threat.Text)
+		if threat.Text == "" {
+			continue
+		}
+		if threat.Severity <= 0 {
+			threat.Severity = defaultThreatSeverity
+		}
+		threat.Severity = min(threat.Severity, maxThreatSeverity)
+		threats = append(threats, threat)
+	}
+	scene.Threats = threats
+	scene.Interactables = compactStrings(scene.Interactables)
+	scene.Exits = compactStrings(scene.Exits)
+}
+
+// compactStrings 去掉空白项和重复项
+func compactStrings(values []string) []string {
+	var result []string
+	for _, value := range values {
+		result = appendUnique(result, strings.TrimSpace(value))
+	}
+	return result
+}
+
+// worstThreat 返回场景中最严重的威胁（没有威胁返回 nil）
+func worstThreat(scene *models.Scene) *models.Threat {
+	var worst *models.Threat
+	for i := range scene.Threats {
+		if worst == nil || scene.Threats[i].Severity > worst.Severity {
+			worst = &scene.Threats[i]
+		}
+	}
+	return worst
+}
+
+// weakenThreat 把场景中的威胁降低 amount 级，降到0时威胁被击退、从场景中移除。
+// 返回威胁剩余的等级（找不到该威胁时返回-1）
+func weakenThreat(scene *models.Scene, text string, amount int) int {
+	for i, threat := range scene.Threats {
+		if threat.Text != text {
+			continue
+		}
+		remaining := max(threat.Severity-amount, 0)
+		if remaining == 0 {
+			scene.Threats = append(scene.Threats[:i], scene.Threats[i+1:]...)
+		} else {
+			scene.Threats[i].Severity = remaining
+		}
+		return remaining
+	}
+	return -1
+}
+
+// threatSANBonus 威胁带来的额外理智损失（严重程度每2级+1）
+func threatSANBonus(scene *models.Scene) int {
+	if threat := worstThreat(scene); threat != nil {
+		return threat.Severity / 2
+	}
+	return 0
+}
+
+// describeObjectives 列出未完成的场景目标，并说明达成标记的用法（没有未完成目标时返回空）
+func describeObjectives(scene *models.Scene) string {
+	var lines []string
+	for i, objective := range scene.Objectives {
+		if !objective.Done {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, objective.Text))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`
+**场景目标（未完成）：**
+%s
+如果这次行动确实达成了其中某个目标，在叙事最后单独一行加上：%s编号（如 %s1）。没有达成就不要加。
+`, strings.Join(lines, "\n"), objectiveMarker, objectiveMarker)
+}
+
+// extractCompletedObjectives 从叙事中取出目标达成标记，返回去掉标记后的叙事和达成的目标编号（从1开始）
+func extractCompletedObjectives(narrative string) (string, []int) {
+	return extractMarkerIndexes(narrative, objectiveMarker)
+}
+
+// extractMarkerIndexes 取出叙事中"标记+编号"格式的行，返回去掉这些行后的叙事和其中的编号
+func extractMarkerIndexes(narrative, marker string) (string, []int) {
+	if !strings.Contains(narrative, marker) {
+		return narrative, nil
+	}
+
+	var kept []string
+	var indexes []int
+	for _, line := range strings.Split(narrative, "\n") {
+		index := strings.Index(line, marker)
+		if index < 0 {
+			kept = append(kept, line)
+			continue
+		}
+		for _, field := range strings.FieldsFunc(line[index+len(marker):], func(r rune) bool {
+			return r == ',' || r == '，' || r == '、' || r == ' '
+		}) {
+			if n, err := strconv.Atoi(strings.TrimSpace(field)); err == nil {
+				indexes = append(indexes, n)
+			}
+		}
+		if before := strings.TrimSpace(line[:index]); before != "" {
+			kept = append(kept, before)
+		}
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n")), indexes
+}
+
+// completeObjectives 把达成的目标标记为完成并返回它们，已完成或编号无效的忽略
+func completeObjectives(scene *models.Scene, indexes []int) []models.Objective {
+	var completed []models.Objective
+	for _, n := range indexes {
+		if n < 1 || n > len(scene.Objectives) || scene.Objectives[n-1].Done {
+			continue
+		}
+		scene.Objectives[n-1].Done = true
+		completed = append(completed, scene.Objectives[n-1])
+	}
+	return completed
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/google/uuid"
+)
+
+// ListScenes 分页列出世界中已生成的场景，templatesOnly 为 true 时只列出场景库中的场景
+func (ws *WorldService) ListScenes(worldID string, templatesOnly bool, page models.Page) ([]models.Scene, models.ListCount, error) {
+	if _, err := ws.storage.GetWorld(worldID); err != nil {
+		return nil, models.ListCount{}, fmt.Errorf("获取世界失败: %w", err)
+	}
+	return ws.storage.GetWorldScenes(worldID, templatesOnly, page)
+}
+
+// SetSceneTemplate 把场景收入或移出所属世界的场景库
+func (ws *WorldService) SetSceneTemplate(sceneID string, isTemplate bool) (*models.Scene, error) {
+	if err := ws.storage.SetSceneTemplate(sceneID, isTemplate); err != nil {
+		return nil, fmt.Errorf("更新场景失败: %w", err)
+	}
+	return ws.storage.GetScene(sceneID)
+}
+
+// reuseTemplateScene 从世界场景库复制一个场景作为新故事的开场：复制出独立的场景，
+// 目标的完成状态清空，不影响场景库中的原场景
+func (ss *StoryService) reuseTemplateScene(world *models.World, sceneID string) (*models.Scene, error) {
+	template, err := ss.storage.GetScene(sceneID)
+	if err != nil {
+		return nil, fmt.Errorf("获取场景失败: %w", err)
+	}
+	if template.WorldID != world.ID {
+		return nil, fmt.Errorf("%w: 场景不属于这个世界", ErrInvalidInput)
+	}
+	if !template.IsTemplate {
+		return nil, fmt.Errorf("%w: 场景「%s」没有收入场景库", ErrInvalidInput, template.Name)
+	}
+
+	scene := *template
+	scene.ID = uuid.New().String()
+	scene.IsTemplate = false
+	scene.Objectives = make([]models.Objective, len(template.Objectives))
+	for i, objective := range template.Objectives {
+		objective.Done = false
+		scene.Objectives[i] = objective
+	}
+	log.Printf("♻️ [场景库] 复用场景「%s」开局，跳过场景生成\n", template.Name)
+	return &scene, nil
+}
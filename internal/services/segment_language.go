@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 小说段落的语言（按文字系统粗略区分）
+const (
+	langChinese  = "zh"
+	langJapanese = "ja"
+	langKorean   = "ko"
+	langEnglish  = "en" // 英文等拉丁字母语言
+	langRussian  = "ru"
+)
+
+var languageNames = map[string]string{
+	langChinese:  "中文",
+	langJapanese: "日文",
+	langKorean:   "韩文",
+	langEnglish:  "英文",
+	langRussian:  "俄文",
+}
+
+// normalizeSegmentText 清理粘贴进来的段落：去掉BOM和非法UTF-8字节，统一换行符
+func normalizeSegmentText(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.TrimPrefix(text, "\uFEFF")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return strings.TrimSpace(text)
+}
+
+// detectLanguage 按各文字系统的字符数判断段落语言：出现一定比例的假名即为日文（日文中也有大量汉字），
+// 其余取字符最多的文字系统，无法判断时按中文处理
+func detectLanguage(text string) string {
+	var han, kana, hangul, latin, cyrillic int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	total := han + kana + hangul + latin + cyrillic
+	if total == 0 {
+		return langChinese
+	}
+	if kana*10 >= total {
+		return langJapanese
+	}
+
+	lang, most := langChinese, han
+	for _, candidate := range []struct {
+		lang  string
+		count int
+	}{{langKorean, hangul}, {langEnglish, latin}, {langRussian, cyrillic}} {
+		if candidate.count > most {
+			lang, most = candidate.lang, candidate.count
+		}
+	}
+	return lang
+}
+
+// describeSourceLanguage 原文不是中文时，要求AI理解原文但统一用简体中文输出（中文原文返回空）
+func describeSourceLanguage(lang string) string {
+	if lang == langChinese {
+		return ""
+	}
+	return fmt.Sprintf(`
+**原文语言：**原文是%s。请先完整理解原文，再统一用简体中文填写所有字段的内容（JSON的键名和枚举值保持英文不变）。
+人名、地名使用通行的中文译名，NPC的 description 中可在括号里附上原文写法；同一人物在所有字段中必须使用同一个中文名。
+`, languageNames[lang])
+}
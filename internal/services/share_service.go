@@ -0,0 +1,136 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+	"github.com/google/uuid"
+)
+
+// 可分享的资源类型
+const (
+	shareCharacter = "character"
+	shareWorld     = "world"
+)
+
+// sharePermissionRead 只读权限（分享链接目前只支持只读）
+const sharePermissionRead = "read"
+
+// ShareService 角色和世界的只读分享链接
+type ShareService struct {
+	storage *storage.Storage
+}
+
+func NewShareService(storage *storage.Storage) *ShareService {
+	return &ShareService{storage: storage}
+}
+
+// CreateShare 为角色或世界生成只读分享令牌，expiresIn 为0表示永不过期
+func (ss *ShareService) CreateShare(resourceType, resourceID string, expiresIn time.Duration) (*models.ShareToken, error) {
+	if expiresIn < 0 {
+		return nil, fmt.Errorf("%w: 过期时间不能为负数", ErrInvalidInput)
+	}
+
+	var name string
+	switch resourceType {
+	case shareCharacter:
+		char, err := ss.storage.GetCharacter(resourceID)
+		if err != nil {
+			return nil, fmt.Errorf("获取角色失败: %w", err)
+		}
+		name = char.Name
+	case shareWorld:
+		world, err := ss.storage.GetWorld(resourceID)
+		if err != nil {
+			return nil, fmt.Errorf("获取世界失败: %w", err)
+		}
+		name = world.Name
+	default:
+		return nil, fmt.Errorf("%w: 不支持分享的资源类型「%s」", ErrInvalidInput, resourceType)
+	}
+
+	now := time.Now()
+	share := &models.ShareToken{
+		Token:        uuid.New().String(),
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Permission:   sharePermissionRead,
+		CreatedAt:    now,
+	}
+	if expiresIn > 0 {
+		expiresAt := now.Add(expiresIn)
+		share.ExpiresAt = &expiresAt
+	}
+	if err := ss.storage.CreateShareToken(share); err != nil {
+		return nil, fmt.Errorf("保存分享令牌失败: %w", err)
+	}
+
+	log.Printf("🔗 [分享] 生成了%s「%s」的只读分享链接\n", resourceType, name)
+	return share, nil
+}
+
+// GetShared 通过分享令牌读取资源。令牌不存在、已撤销或已过期都视为不存在；返回的内容去掉了资源ID
+func (ss *ShareService) GetShared(token string) (*models.SharedResource, error) {
+	share, err := ss.storage.GetShareToken(token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: 分享链接无效", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取分享令牌失败: %w", err)
+	}
+	if share.Revoked || share.Permission != sharePermissionRead {
+		return nil, fmt.Errorf("%w: 分享链接已失效", ErrNotFound)
+	}
+	if share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt) {
+		return nil, fmt.Errorf("%w: 分享链接已过期", ErrNotFound)
+	}
+
+	shared := &models.SharedResource{ResourceType: share.ResourceType, ExpiresAt: share.ExpiresAt}
+	switch share.ResourceType {
+	case shareCharacter:
+		char, err := ss.storage.GetCharacter(share.ResourceID)
+		if err != nil {
+			return nil, fmt.Errorf("获取角色失败: %w", err)
+		}
+		char.ID = ""
+		shared.Character = char
+	case shareWorld:
+		world, err := ss.storage.GetWorld(share.ResourceID)
+		if err != nil {
+			return nil, fmt.Errorf("获取世界失败: %w", err)
+		}
+		world.ID = ""
+		shared.World = world
+	default:
+		return nil, fmt.Errorf("%w: 分享链接无效", ErrNotFound)
+	}
+	return shared, nil
+}
+
+// RevokeShare 撤销分享令牌。需要提供被分享资源的ID以证明是资源的拥有者（访问者拿不到资源ID）
+func (ss *ShareService) RevokeShare(token, resourceID string) error {
+	share, err := ss.storage.GetShareToken(token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: 分享链接不存在", ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("获取分享令牌失败: %w", err)
+	}
+	if share.ResourceID != resourceID {
+		return fmt.Errorf("%w: 只有资源的拥有者才能撤销分享", ErrForbidden)
+	}
+	if share.Revoked {
+		return nil
+	}
+
+	if err := ss.storage.RevokeShareToken(token); err != nil {
+		return fmt.Errorf("撤销分享失败: %w", err)
+	}
+	log.Printf("🔗 [分享] 撤销了%s的分享链接\n", share.ResourceType)
+	return nil
+}
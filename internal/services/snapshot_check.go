@@ -0,0 +1,50 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// checkSnapshots 校验回合快照与故事状态是否一致：
+// 快照回合严格递增且都早于当前回合，最后一个快照恰好是上一回合，
+// 快照中的叙事长度单调不减且不超过当前叙事
+func checkSnapshots(story *models.StoryState) error {
+	prevTurn, prevLen := -1, 0
+	for i, snap := range story.Snapshots {
+		if snap.Turn <= prevTurn {
+			return fmt.Errorf("%w: 第%d个快照回合%d不大于前一个快照回合%d", ErrStateInconsistent, i+1, snap.Turn, prevTurn)
+		}
+		if snap.Turn >= story.Turn {
+			return fmt.Errorf("%w: 第%d个快照回合%d不早于当前回合%d", ErrStateInconsistent, i+1, snap.Turn, story.Turn)
+		}
+		if len(snap.Narrative) < prevLen {
+			return fmt.Errorf("%w: 第%d个快照叙事长度%d小于前一个快照的%d", ErrStateInconsistent, i+1, len(snap.Narrative), prevLen)
+		}
+		if len(snap.Narrative) > len(story.Narrative) {
+			return fmt.Errorf("%w: 第%d个快照叙事长度%d超过当前叙事长度%d", ErrStateInconsistent, i+1, len(snap.Narrative), len(story.Narrative))
+		}
+		prevTurn, prevLen = snap.Turn, len(snap.Narrative)
+	}
+
+	if n := len(story.Snapshots); n > 0 && story.Snapshots[n-1].Turn != story.Turn-1 {
+		return fmt.Errorf("%w: 最后一个快照回合%d与当前回合%d不衔接", ErrStateInconsistent, story.Snapshots[n-1].Turn, story.Turn)
+	}
+
+	return nil
+}
+
+// assertSnapshots 在保存故事前做快照一致性断言。开发模式下直接返回错误暴露问题，
+// 生产模式下只记录告警，不影响玩家继续游戏
+func (ss *StoryService) assertSnapshots(story *models.StoryState, stage string) error {
+	err := checkSnapshots(story)
+	if err == nil {
+		return nil
+	}
+	if ss.meta.GameConfig().DevMode {
+		return fmt.Errorf("%s后快照校验失败: %w", stage, err)
+	}
+	log.Printf("⚠️ [快照校验] 故事 %s %s后状态不一致: %v\n", story.ID, stage, err)
+	return nil
+}
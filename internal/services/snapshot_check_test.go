@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestSnapshotsStayConsistentAcrossUndo(t *testing.T) {
+	env := newTestStoryEnv(t, 12)
+
+	// assert 从数据库重新读取故事，校验快照并返回当前回合
+	assert := func(stage string) int {
+		t.Helper()
+		story, err := env.store.GetStoryState(env.state.ID)
+		if err != nil {
+			t.Fatalf("获取故事失败: %v", err)
+		}
+		if err := checkSnapshots(story); err != nil {
+			t.Fatalf("%s后快照不一致: %v", stage, err)
+		}
+		return story.Turn
+	}
+
+	start := assert("开局")
+	env.act(t, "调查灯塔下的脚印")
+	if turn := assert("行动"); turn != start+1 {
+		t.Fatalf("行动后应为第%d回合，实际 %d", start+1, turn)
+	}
+	if _, err := env.story.UndoTurn(env.state.ID); err != nil {
+		t.Fatalf("回退失败: %v", err)
+	}
+	if turn := assert("回退"); turn != start {
+		t.Fatalf("回退后应回到第%d回合，实际 %d", start, turn)
+	}
+	env.act(t, "沿着海岸寻找守夜人")
+	if turn := assert("回退后再次行动"); turn != start+1 {
+		t.Fatalf("再次行动后应为第%d回合，实际 %d", start+1, turn)
+	}
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+)
+
+// StatsService 运营统计
+type StatsService struct {
+	storage *storage.Storage
+}
+
+func NewStatsService(storage *storage.Storage) *StatsService {
+	return &StatsService{storage: storage}
+}
+
+// AdminStats 汇总故事状态、世界类型分布和今日LLM用量
+func (ss *StatsService) AdminStats() (*models.AdminStats, error) {
+	stories, err := ss.storage.GetStoryStats()
+	if err != nil {
+		return nil, fmt.Errorf("统计故事失败: %w", err)
+	}
+
+	genres, err := ss.storage.GetGenreDistribution()
+	if err != nil {
+		return nil, fmt.Errorf("统计世界类型失败: %w", err)
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	usage, err := ss.storage.GetLLMUsageSince(today)
+	if err != nil {
+		return nil, fmt.Errorf("统计LLM用量失败: %w", err)
+	}
+
+	return &models.AdminStats{
+		Stories:           stories,
+		GenreDistribution: genres,
+		LLMToday:          usage,
+	}, nil
+}
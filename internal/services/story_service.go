@@ -4,13 +4,21 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aiwuxian/project-abyss/internal/models"
 	"github.com/aiwuxian/project-abyss/internal/storage"
 	"github.com/google/uuid"
 )
 
+const (
+	maxSubActions = 5    // 组合行动一回合内最多的子行动数
+	maxNotesRunes = 5000 // 玩家备注的最大字数
+)
+
 type StoryService struct {
 	storage    *storage.Storage
 	llm        *LLMService
@@ -33,8 +41,11 @@ func (ss *StoryService) GetDependencies() (*storage.Storage, *RuleEngine, *MetaS
 	return ss.storage, ss.ruleEngine, ss.meta
 }
 
-// StartStory 开始新的故事
-func (ss *StoryService) StartStory(ctx context.Context, characterID, worldID string) (*models.StoryState, *models.Scene, error) {
+// StartStory 开始新的故事。
+// newGamePlus 为 true 时对已通关的世界开启周目+：难度提升、NPC初始好感变化，角色在该世界的状态重置；
+// templateSceneID 不为空时从世界场景库中的该场景起步，不再生成开场场景
+func (ss *StoryService) StartStory(ctx context.Context, characterID, worldID string, newGamePlus bool,
+	templateSceneID string) (*models.StoryState, *models.Scene, error) {
 	// 获取世界信息
 	world, err := ss.storage.GetWorld(worldID)
 	if err != nil {
@@ -47,17 +58,39 @@ func (ss *StoryService) StartStory(ctx context.Context, characterID, worldID str
 		return nil, nil, fmt.Errorf("获取角色失败: %w", err)
 	}
 
-	// 初始化角色状态
-	if _, err := ss.meta.InitCharacterInWorld(characterID, worldID, world); err != nil {
-		return nil, nil, fmt.Errorf("初始化角色状态失败: %w", err)
+	cycle := 1
+	if newGamePlus {
+		if cycle, err = ss.nextCycle(characterID, worldID); err != nil {
+			return nil, nil, err
+		}
+		applyCycle(world, cycle, ss.meta.GameConfig().NewGamePlus)
 	}
 
-	// 生成开场场景
-	scene, err := ss.llm.GenerateScene(ctx, world, char)
+	// 初始化角色状态（周目+重置该世界的状态，等级、特质和背包随角色保留）
+	var charState *models.CharacterState
+	if cycle > 1 {
+		charState, err = ss.meta.ResetCharacterInWorld(characterID, worldID, world)
+	} else {
+		charState, err = ss.meta.InitCharacterInWorld(characterID, worldID, world)
+	}
 	if err != nil {
-		return nil, nil, fmt.Errorf("生成场景失败: %w", err)
+		return nil, nil, fmt.Errorf("初始化角色状态失败: %w", err)
+	}
+
+	// 生成开场场景（故事从第1天早上开始），指定了场景库中的场景时直接复用
+	var scene *models.Scene
+	if templateSceneID != "" {
+		scene, err = ss.reuseTemplateScene(world, templateSceneID)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		scene, err = ss.llm.GenerateScene(ctx, world, char, describeTimeContext(world, 1, gamePeriods[0])+describeCycle(cycle), "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("生成场景失败: %w", err)
+		}
+		scene.ID = uuid.New().String()
 	}
-	scene.ID = uuid.New().String()
 
 	if err := ss.storage.CreateScene(scene); err != nil {
 		return nil, nil, fmt.Errorf("保存场景失败: %w", err)
@@ -89,18 +122,48 @@ func (ss *StoryService) StartStory(ctx context.Context, characterID, worldID str
 		PlotProgress:      0.0,
 		Turn:              0,
 		Narrative:         []models.NarrativeLog{},
+		CharState:         charState,
+		Cycle:             cycle,
 		Status:            "active",
 		CreatedAt:         time.Now(),
 		UpdatedAt:         time.Now(),
 	}
+	startGameTime(story)
+
+	// 第一章以起始剧情节点命名，没有剧情节点时用场景名
+	chapterTitle := scene.Name
+	for _, node := range world.PlotLines {
+		if node.ID == startPlotNodeID {
+			chapterTitle = node.Name
+			break
+		}
+	}
+	openChapter(story, chapterTitle, startPlotNodeID, 0)
 
 	// 添加开场叙事
 	story.Narrative = append(story.Narrative, models.NarrativeLog{
 		Turn:      0,
 		Type:      "system",
-		Content:   fmt.Sprintf("你进入了【%s】\n\n%s", scene.Name, scene.Description),
+		Content:   renderOpening(ss.meta.GameConfig().OpeningTemplate, world, char, scene, story, chapterTitle),
 		Timestamp: time.Now(),
 	})
+	if danger := describeWorldDanger(ss.meta.GameConfig(), world, charState); danger != "" {
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      0,
+			Type:      "system",
+			Content:   danger,
+			Timestamp: time.Now(),
+		})
+	}
+	if cycle > 1 {
+		log.Printf("🔁 [周目+] %s 开启 %s 的第%d周目（难度 %d）\n", char.Name, world.Name, cycle, world.Difficulty)
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      0,
+			Type:      "system",
+			Content:   fmt.Sprintf("🔁 第%d周目：世界已重置，难度提升至 %d", cycle, world.Difficulty),
+			Timestamp: time.Now(),
+		})
+	}
 
 	if err := ss.storage.CreateStoryState(story); err != nil {
 		return nil, nil, fmt.Errorf("保存故事状态失败: %w", err)
@@ -110,19 +173,51 @@ func (ss *StoryService) StartStory(ctx context.Context, characterID, worldID str
 }
 
 // ProcessAction 处理玩家行动
-func (ss *StoryService) ProcessAction(ctx context.Context, storyID string, action models.Action) (*models.ActionResult, error) {
+// expectedVersion 为客户端已知的故事版本（必填），与当前版本不一致时直接拒绝，避免用过期状态覆盖
+func (ss *StoryService) ProcessAction(ctx context.Context, storyID string, action models.Action, expectedVersion int) (*models.ActionResult, error) {
+	return ss.processAction(ctx, storyID, action, expectedVersion, nil)
+}
+
+// ProcessActionStream 与 ProcessAction 相同，但叙事以流式生成：生成过程中的文本片段发送到 out，
+// 处理结束后关闭 out。片段是未经清洗的原始文本，最终叙事以返回结果为准
+func (ss *StoryService) ProcessActionStream(ctx context.Context, storyID string, action models.Action, expectedVersion int,
+	out chan<- string) (*models.ActionResult, error) {
+	defer close(out)
+	return ss.processAction(ctx, storyID, action, expectedVersion, out)
+}
+
+// processAction 处理玩家行动，out 不为空时流式生成叙事
+func (ss *StoryService) processAction(ctx context.Context, storyID string, action models.Action, expectedVersion int,
+	out chan<- string) (*models.ActionResult, error) {
 	// 获取故事状态
 	story, err := ss.storage.GetStoryState(storyID)
 	if err != nil {
 		return nil, fmt.Errorf("获取故事状态失败: %w", err)
 	}
 
+	// 必须带上客户端看到的版本号，避免基于过期状态重复提交
+	if expectedVersion <= 0 {
+		return nil, fmt.Errorf("%w: 缺少故事版本号", ErrInvalidInput)
+	}
+	if story.Version != expectedVersion {
+		return nil, fmt.Errorf("%w（当前版本%d，请求版本%d）", storage.ErrVersionConflict, story.Version, expectedVersion)
+	}
+
 	if story.Status != "active" {
-		return nil, fmt.Errorf("故事已结束")
+		return nil, ErrStoryEnded
 	}
 
-	// 获取世界信息
-	world, err := ss.storage.GetWorld(story.WorldID)
+	if len(action.SubActions) > maxSubActions {
+		return nil, fmt.Errorf("%w: 组合行动最多%d步", ErrInvalidInput, maxSubActions)
+	}
+
+	// 重大不可逆行动需要玩家确认，避免误点
+	if reason := confirmationReason(action); reason != "" {
+		return nil, fmt.Errorf("%w: %s", ErrConfirmRequired, reason)
+	}
+
+	// 获取世界信息（按周目调整）
+	world, err := ss.storyWorld(story)
 	if err != nil {
 		return nil, fmt.Errorf("获取世界失败: %w", err)
 	}
@@ -139,73 +234,151 @@ func (ss *StoryService) ProcessAction(ctx context.Context, storyID string, actio
 		return nil, fmt.Errorf("获取角色失败: %w", err)
 	}
 
-	// 获取角色状态
-	charState, err := ss.meta.GetCharacterState(story.CharacterID, story.WorldID)
+	// 获取角色状态（切换到本故事线的状态）
+	charState, err := ss.activateCharState(story)
 	if err != nil {
 		return nil, fmt.Errorf("获取角色状态失败: %w", err)
 	}
 
-	// 计算检定难度
-	difficulty := ss.ruleEngine.CalculateDifficulty(scene.Type, action.Type)
+	// 当前状态不允许该行动时跳过检定
+	if reason, fatal := actionBlockReason(charState, action); reason != "" {
+		return ss.blockAction(ctx, story, world, scene, character, charState, action, reason, fatal)
+	}
 
-	// 选择合适的属性
-	attribute := ss.selectAttribute(action.Type, charState.Attributes)
+	// 攻略阶段还没解锁的互动不能对该NPC使用
+	if reason := romanceLockReason(story, world, action); reason != "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInput, reason)
+	}
 
-	// 执行检定
-	diceRoll := ss.ruleEngine.Check(attribute, difficulty)
+	// 本回合的结算都在角色和角色状态的副本上进行，最后和故事一起提交；
+	// 版本冲突时什么都不会写入，character 保留结算前的状态
+	charAfter := cloneCharacter(character)
+	charState = cloneCharacterState(charState)
+	var sceneChanged bool
 
-	log.Println("🎲 ========================================")
-	log.Printf("🎲 [检定] 行动: %s\n", action.Content)
-	log.Printf("🎲 属性加成: +%d | 目标难度: %d\n", attribute, difficulty)
-	log.Printf("🎲 投掷结果: %d + %d = %d\n", diceRoll.Result, diceRoll.Modifier, diceRoll.Result+diceRoll.Modifier)
-	if diceRoll.Critical {
-		if diceRoll.Success {
-			log.Println("🎲 ⭐⭐⭐ 大成功！⭐⭐⭐")
-		} else {
-			log.Println("🎲 💀💀💀 大失败！💀💀💀")
-		}
-	} else if diceRoll.Success {
-		log.Println("🎲 ✅ 成功！")
-	} else {
-		log.Println("🎲 ❌ 失败...")
+	// 消耗经验值触发灵感迸发（行动参数 spend_xp_for_bonus）
+	bonus, err := ss.spendInspiration(story, charAfter, action)
+	if err != nil {
+		return nil, err
 	}
-	log.Println("🎲 ========================================")
-	log.Println()
+
+	// 执行检定（组合行动逐步检定，关键步骤大失败时中断后续）
+	action.AttributeMap = mergeAttributeMaps(story.AttributeMap, action.AttributeMap)
+	steps, diceRoll, conflict := ss.rollAction(world, scene, character, charState, action, bonus)
 
 	// 生成叙事
-	narrative, err := ss.llm.NarrateResult(ctx, world, character, scene, action, diceRoll, story.Narrative)
+	wordRange := resolveNarrativeLength(ss.meta.GameConfig(), scene.Type, action.NarrativeLength)
+	narrative, revised, err := ss.narrateWithContinuity(ctx, story, world, character, charState, scene,
+		comboNarrationAction(action, steps), diceRoll, conflict, wordRange, out)
 	if err != nil {
 		narrative = fmt.Sprintf("你尝试了%s，结果%s", action.Content,
 			map[bool]string{true: "成功", false: "失败"}[diceRoll.Success])
 	}
+	narrative, objectiveIndexes := extractCompletedObjectives(narrative)
+	narrative, ruleIndexes := extractRuleViolations(narrative)
+	narrative, quickChoice := extractQuickChoice(narrative)
 
 	// 保存当前状态快照（用于回退）
-	snapshot := models.StateSnapshot{
-		Turn:      story.Turn,
-		Narrative: append([]models.NarrativeLog{}, story.Narrative...),
-		CharState: *charState,
-		Timestamp: time.Now(),
-	}
+	snapshot := takeSnapshot(story, character, charState, scene)
 	story.Snapshots = append(story.Snapshots, snapshot)
 
-	// 记录日志
+	// 记录日志（新回合的快速选择替换掉上一回合未回答的）
+	story.PendingChoice = quickChoice
 	story.Turn++
+	npcIDs := involvedNPCIDs(world, action, action.Content, narrative)
 	story.Narrative = append(story.Narrative, models.NarrativeLog{
 		Turn:      story.Turn,
 		Type:      "action",
-		Content:   action.Content,
+		Content:   actionLogContent(action),
 		Timestamp: time.Now(),
+		NPCIDs:    npcIDs,
 	})
 	story.Narrative = append(story.Narrative, models.NarrativeLog{
 		Turn:      story.Turn,
 		Type:      "result",
 		Content:   narrative,
-		DiceRoll:  diceRoll,
+		DiceRoll:  visibleRoll(diceRoll),
 		Timestamp: time.Now(),
+		NPCIDs:    npcIDs,
 	})
+	recordNPCMemories(story, world, action, narrative)
+
+	// 推进游戏内时间（组合行动按每个未跳过的步骤计算）
+	timeActions := []string{actionTypeOf(action)}
+	if len(steps) > 0 {
+		timeActions = timeActions[:0]
+		for _, step := range steps {
+			if !step.Skipped {
+				timeActions = append(timeActions, actionTypeOf(models.Action{Type: step.Type, Content: step.Content}))
+			}
+		}
+	}
+	if advanceGameTime(story, timeSettings(ss.meta.GameConfig().Time), timeActions...) > 0 {
+		log.Printf("🕐 [时间] 推进到%s\n", describeGameTime(story.Day, story.Period))
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   "🕐 时间流逝，现在是" + describeGameTime(story.Day, story.Period),
+			Timestamp: time.Now(),
+		})
+	}
+
+	// 计算状态变化（组合行动累计每一步的HP/SAN损失，奖励按整体结果结算一次）
+	changes := ss.calculateChanges(scene, character, steps, diceRoll)
 
-	// 计算状态变化
-	changes := ss.calculateChanges(scene, action, diceRoll)
+	// 危机阶段的自救行动成功时回复HP/SAN
+	mergeChanges(&changes, crisisRecovery(charState, action, diceRoll))
+
+	// 对NPC的社交行动改变好感度，并按NPC之间的关系连带影响其他人
+	mergeChanges(&changes, models.StateChanges{RelationChange: npcRelationChanges(world, action, diceRoll)})
+
+	// 叙事判定达成的场景目标发放奖励
+	if completed := completeObjectives(scene, objectiveIndexes); len(completed) > 0 {
+		for _, objective := range completed {
+			changes.XPGain += objective.Reward
+			changes.ObjectivesDone = append(changes.ObjectivesDone, objective.Text)
+			story.Narrative = append(story.Narrative, models.NarrativeLog{
+				Turn:      story.Turn,
+				Type:      "system",
+				Content:   fmt.Sprintf("🎯 达成目标「%s」，经验值 +%d", objective.Text, objective.Reward),
+				Timestamp: time.Now(),
+			})
+		}
+		sceneChanged = true
+	}
+	// 大成功的反击削弱场景威胁
+	if changes.ThreatWeakened != "" {
+		content := fmt.Sprintf("⚔️ 你的反击重创了「%s」", changes.ThreatWeakened)
+		if weakenThreat(scene, changes.ThreatWeakened, ss.ruleEngine.CounterSeverity()) == 0 {
+			content = fmt.Sprintf("⚔️ 你的反击击退了「%s」", changes.ThreatWeakened)
+		}
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   content,
+			Timestamp: time.Now(),
+		})
+		sceneChanged = true
+	}
+	// 违反世界规则招致反噬
+	ruleChanges := ruleViolationChanges(world, ruleIndexes, diceRoll, charState)
+	for _, rule := range ruleChanges.RulesViolated {
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   fmt.Sprintf("☠️ 违反规则「%s」", rule),
+			Timestamp: time.Now(),
+		})
+	}
+	mergeChanges(&changes, ruleChanges)
+	if changes.ThreatTriggered != "" {
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   fmt.Sprintf("⚠️ 威胁爆发：%s", changes.ThreatTriggered),
+			Timestamp: time.Now(),
+		})
+	}
 
 	log.Println("💫 [状态变化]")
 	if changes.HPChange != 0 {
@@ -223,68 +396,492 @@ func (ss *StoryService) ProcessAction(ctx context.Context, storyID string, actio
 	if len(changes.TraitsGained) > 0 {
 		log.Printf("   获得特质: %v\n", changes.TraitsGained)
 	}
-	log.Println()
-
-	// 应用变化
-	if err := ss.meta.ApplyChanges(story.CharacterID, story.WorldID, changes); err != nil {
-		return nil, fmt.Errorf("应用状态变化失败: %w", err)
+	if len(changes.ObjectivesDone) > 0 {
+		log.Printf("   达成目标: %v\n", changes.ObjectivesDone)
+	}
+	if changes.ThreatTriggered != "" {
+		log.Printf("   威胁爆发: %s\n", changes.ThreatTriggered)
 	}
+	if len(changes.RulesViolated) > 0 {
+		log.Printf("   违反规则: %v\n", changes.RulesViolated)
+	}
+	log.Println()
 
-	// 评估剧情推进
+	// 评估剧情推进（可能带来道德值、剧情旗标、群体好感和永久属性的变化）
 	if story.CurrentPlotNodeID != "" {
-		if err := ss.evaluatePlotProgress(ctx, story, action, narrative); err != nil {
+		plotChanges, err := ss.evaluatePlotProgress(ctx, story, world, action, narrative, diceRoll, changes.RulesViolated)
+		if err != nil {
 			log.Printf("⚠️ 评估剧情推进失败: %v\n", err)
 			// 不影响主流程，继续执行
+		} else {
+			mergeChanges(&changes, plotChanges)
+		}
+	}
+
+	// 应用变化（经验值足够时随之升级）
+	if levelUp := ss.meta.ApplyChanges(charAfter, charState, changes); levelUp != nil {
+		changes.LevelUp = levelUp
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   describeLevelUp(levelUp),
+			Timestamp: time.Now(),
+		})
+	}
+	for _, flag := range changes.FlagsSet {
+		if !containsString(story.Flags, flag) {
+			story.Flags = append(story.Flags, flag)
 		}
 	}
 
-	// 检查场景是否结束
-	sceneEnd := ss.checkSceneEnd(scene, story, charState, changes)
+	// HP/SAN跌破危机阈值时进入濒死/恐慌，回升后解除
+	mergeChanges(&changes, ss.syncCrisis(story, charAfter, charState))
+	story.CharState = charState
+
+	// 对比结算前后的状态，生成本回合的规则事件
+	events := collectGameEvents(eventContext{
+		world:      world,
+		diceRoll:   diceRoll,
+		changes:    changes,
+		before:     snapshot,
+		story:      story,
+		charState:  charState,
+		charBefore: character,
+		charAfter:  charAfter,
+	})
+	events = append(events, advanceRomanceStages(story, world, charState)...)
+	if event := offSceneEvent(ss.meta.GameConfig(), scene, action); event != nil {
+		events = append(events, *event)
+	}
+	recordTurnEvents(story, events)
+
+	// 检查场景是否结束，结束时按条件判定结局（切换场景前记下本回合结算的场景）
+	settledScene := scene
+	var ending string
+	sceneEnd := ss.checkSceneEnd(world, story, charState, changes)
 	if sceneEnd {
-		story.Status = "completed"
+		story.Status = ss.resolveOutcome(story, charState)
+		ending = ss.resolveEnding(ctx, world, character, charState, story)
+	} else if story.CurrentPlotNodeID != snapshot.PlotNodeID {
+		// 剧情推进到新节点时切换到承接上一场景的新场景
+		scene = ss.continueScene(ctx, story, world, character, scene)
+	}
+
+	if err := ss.assertSnapshots(story, "行动"); err != nil {
+		return nil, err
 	}
 
+	// 故事、角色、角色状态和场景在一个事务里提交，版本不匹配时整回合都不写入
+	var dirtyScenes []*models.Scene
+	if sceneChanged {
+		dirtyScenes = append(dirtyScenes, settledScene)
+	}
+	ss.settleSnapshot(story, charAfter)
 	story.UpdatedAt = time.Now()
-	if err := ss.storage.UpdateStoryState(story); err != nil {
+	if err := ss.storage.CommitStory(story, charAfter, charState, dirtyScenes...); err != nil {
 		return nil, fmt.Errorf("更新故事状态失败: %w", err)
 	}
-
-	// 重新获取角色状态以获取最新数据
-	charState, _ = ss.meta.GetCharacterState(story.CharacterID, story.WorldID)
+	ss.recordChangeLog(story, action, changes)
+	ss.recordStatePoint(story, charState)
+	if story.Status == "completed" {
+		ss.recordWorldClear(story, world, charAfter, charState)
+	}
 
 	// 生成下一步选项
 	var nextOptions []models.Option
 	if !sceneEnd {
-		nextOptions, err = ss.llm.GenerateOptions(ctx, world, scene, narrative, story.Narrative, charState)
-		if err != nil {
-			// 如果生成失败，提供默认选项
-			nextOptions = ss.getDefaultOptions()
+		nextOptions, err = ss.llm.GenerateOptions(ctx, world, character, scene, narrative, story.Narrative, charState, diceRoll,
+			describeTimeContext(world, story.Day, story.Period), allowedSceneActions(ss.meta.GameConfig(), scene.Type))
+		if err != nil || len(nextOptions) == 0 {
+			// 生成失败时按场景在本地拼出备用选项
+			log.Printf("⚠️ 生成选项失败，使用本地备用选项: %v\n", err)
+			nextOptions = ss.fallbackOptions(world, scene, story)
 		}
+		nextOptions = ss.fitSceneOptions(scene, injectEnvironmentOptions(scene, nextOptions))
+		nextOptions = applyCrisisOptions(charState, nextOptions)
+		adjustOptionsForMomentum(nextOptions, diceRoll)
+		markPersonalityConflicts(character, nextOptions)
+		markIrreversibleOptions(nextOptions)
+		ss.markTrivialOptions(world, scene, character, nextOptions)
+		ss.previewConsequences(world, scene, character, charState, nextOptions, action.AttributeMap)
+	}
+	hideAutomaticRolls(steps)
+
+	var newScene *models.Scene
+	if scene.ID != snapshot.SceneID {
+		newScene = scene
 	}
 
 	return &models.ActionResult{
-		Success:     diceRoll.Success,
-		Narrative:   narrative,
-		DiceRoll:    diceRoll,
-		Changes:     changes,
-		NextOptions: nextOptions,
-		SceneEnd:    sceneEnd,
+		Success:      diceRoll.Success,
+		Narrative:    narrative,
+		Paragraphs:   splitParagraphs(narrative),
+		Revised:      revised,
+		DiceRoll:     visibleRoll(diceRoll),
+		AutoSuccess:  diceRoll.Automatic,
+		Changes:      changes,
+		NextOptions:  nextOptions,
+		SceneEnd:     sceneEnd,
+		Ending:       ending,
+		PlotProgress: ss.plotProgressInfo(world, story),
+
+		PersonalityConflict: conflict,
+		Steps:               steps,
+		GameTime:            gameTimeInfo(story),
+		QuickChoice:         quickChoice,
+		Events:              events,
+		NewScene:            newScene,
 	}, nil
 }
 
-// selectAttribute 根据行动类型选择属性
-func (ss *StoryService) selectAttribute(actionType string, attributes map[string]int) int {
-	attrMap := map[string]string{
-		"attack":      "strength",
-		"move":        "dexterity",
-		"sneak":       "dexterity",
-		"talk":        "charisma",
-		"persuade":    "charisma",
-		"investigate": "perception",
-		"use_item":    "intelligence",
+// rollAction 执行行动检定。普通行动只检定一次；组合行动依次检定每一步，
+// 关键步骤大失败时跳过后续步骤，整体成功取决于最后一步是否成功且未被中断。
+// bonus 为灵感迸发的加值，组合行动的每一步都享受
+func (ss *StoryService) rollAction(world *models.World, scene *models.Scene, character *models.Character,
+	charState *models.CharacterState, action models.Action, bonus int) ([]models.ComboStep, *models.DiceRoll, string) {
+
+	if len(action.SubActions) == 0 {
+		diceRoll, conflict := ss.rollStep(world, scene, character, charState, action)
+		applyInspiration(diceRoll, bonus)
+		return nil, diceRoll, conflict
+	}
+
+	keyMarked := false
+	for _, sub := range action.SubActions {
+		if sub.Key {
+			keyMarked = true
+			break
+		}
+	}
+
+	var steps []models.ComboStep
+	var last *models.DiceRoll
+	var conflict string
+	interrupted := false
+	for _, sub := range action.SubActions {
+		step := models.ComboStep{Type: sub.Type, Content: sub.Content}
+		if interrupted {
+			step.Skipped = true
+			steps = append(steps, step)
+			continue
+		}
+
+		diceRoll, stepConflict := ss.rollStep(world, scene, character, charState, models.Action{
+			Type: sub.Type, Content: sub.Content, Target: action.Target,
+			Parameters: action.Parameters, AttributeMap: action.AttributeMap,
+		})
+		applyInspiration(diceRoll, bonus)
+		if conflict == "" {
+			conflict = stepConflict
+		}
+		step.DiceRoll = diceRoll
+		steps = append(steps, step)
+		last = diceRoll
+
+		if diceRoll.Critical && !diceRoll.Success && (sub.Key || !keyMarked) {
+			interrupted = true
+			log.Printf("💥 [组合行动] 「%s」大失败，后续动作中断\n", sub.Content)
+		}
+	}
+
+	overall := *last
+	overall.Success = last.Success && !interrupted
+	return steps, &overall, conflict
+}
+
+// rollStep 对单个行动计算难度并检定，返回检定结果和违背的性格倾向
+func (ss *StoryService) rollStep(world *models.World, scene *models.Scene, character *models.Character,
+	charState *models.CharacterState, action models.Action) (*models.DiceRoll, string) {
+
+	// 计算检定难度
+	difficulty := ss.ruleEngine.CalculateDifficulty(scene.Type, action.Type, character.Level, world.Difficulty)
+
+	// 违背本性的行动检定更难
+	conflict := personalityConflict(character, actionTypeOf(action))
+	if conflict != "" {
+		difficulty += personalityConflictPenalty
+		log.Printf("😣 行动违背角色本性「%s」，难度 +%d\n", conflict, personalityConflictPenalty)
+	}
+	if ss.skipsCheck(scene, action, difficulty, conflict) {
+		log.Printf("🎲 [免检定] 行动: %s（难度 %d），直接成功\n", action.Content, difficulty)
+		return autoSuccessRoll(difficulty), conflict
+	}
+
+	// 选择合适的属性（指定了语气时改用语气对应的属性，行动类型已显式映射时除外），特质和装备带来正负修正
+	attributes := equippedAttributes(charState.Attributes, character)
+	attribute := ss.selectAttribute(action.Type, attributes, action.AttributeMap)
+	tone, hasTone := lookupTone(action)
+	if _, mapped := action.AttributeMap[action.Type]; hasTone && !mapped && tone.Attribute != "" {
+		attribute = attributes[tone.Attribute]
+	}
+	if mod := traitModifier(character, actionTypeOf(action)); mod != 0 {
+		attribute += mod
+		log.Printf("🏷️ 特质修正: %+d\n", mod)
+	}
+	if mod := equipmentBonus(character, actionTypeOf(action)); mod != 0 {
+		attribute += mod
+		log.Printf("🗡️ 装备修正: %+d\n", mod)
+	}
+
+	// 目标NPC的性格决定吃不吃这种语气
+	if hasTone {
+		if reaction := toneReaction(tone, findNPC(world, action.Target)); reaction != 0 {
+			attribute += reaction * toneReactionModifier
+			log.Printf("🗣️ 语气「%s」修正: %+d\n", tone.Name, reaction*toneReactionModifier)
+		}
+	}
+
+	// 执行检定（大成功/大失败阈值受属性和特质影响，受伤、鼓舞等状态带来劣势/优势）
+	crit := ss.ruleEngine.CriticalRange(attribute, character)
+	mode, modeSource := rollModeFor(charState)
+	diceRoll := ss.ruleEngine.check(attribute, difficulty, crit, mode)
+	diceRoll.ModeSource = modeSource
+
+	log.Println("🎲 ========================================")
+	log.Printf("🎲 [检定] 行动: %s\n", action.Content)
+	log.Printf("🎲 属性加成: +%d | 目标难度: %d\n", attribute, difficulty)
+	if len(diceRoll.Rolls) == 2 {
+		log.Printf("🎲 %s（%s）: 掷出 %d 和 %d，取 %d\n", diceRoll.Mode, modeSource, diceRoll.Rolls[0], diceRoll.Rolls[1], diceRoll.Result)
+	}
+	log.Printf("🎲 投掷结果: %d + %d = %d\n", diceRoll.Result, diceRoll.Modifier, diceRoll.Result+diceRoll.Modifier)
+	if diceRoll.Critical {
+		if diceRoll.Success {
+			log.Println("🎲 ⭐⭐⭐ 大成功！⭐⭐⭐")
+		} else {
+			log.Println("🎲 💀💀💀 大失败！💀💀💀")
+		}
+	} else if diceRoll.Success {
+		log.Println("🎲 ✅ 成功！")
+	} else {
+		log.Println("🎲 ❌ 失败...")
+	}
+	log.Println("🎲 ========================================")
+	log.Println()
+
+	return diceRoll, conflict
+}
+
+// comboNarrationAction 组合行动叙事时把每一步的结果写进行动描述，让LLM生成连贯叙事
+func comboNarrationAction(action models.Action, steps []models.ComboStep) models.Action {
+	if len(steps) == 0 {
+		return action
+	}
+
+	var parts []string
+	for _, step := range steps {
+		switch {
+		case step.Skipped:
+			parts = append(parts, fmt.Sprintf("%s（未能执行）", step.Content))
+		case step.DiceRoll.Critical && step.DiceRoll.Success:
+			parts = append(parts, fmt.Sprintf("%s（大成功）", step.Content))
+		case step.DiceRoll.Critical:
+			parts = append(parts, fmt.Sprintf("%s（大失败，动作被打断）", step.Content))
+		case step.DiceRoll.Success:
+			parts = append(parts, fmt.Sprintf("%s（成功）", step.Content))
+		default:
+			parts = append(parts, fmt.Sprintf("%s（失败）", step.Content))
+		}
+	}
+
+	narrated := action
+	narrated.Content = fmt.Sprintf("一连串动作：%s。请按顺序连贯地描写整个过程", strings.Join(parts, " → "))
+	return narrated
+}
+
+// actionLogContent 叙事日志中的行动内容，组合行动按步骤拼接
+func actionLogContent(action models.Action) string {
+	if len(action.SubActions) == 0 {
+		return action.Content
+	}
+	var contents []string
+	for _, sub := range action.SubActions {
+		contents = append(contents, sub.Content)
+	}
+	if action.Content != "" {
+		return fmt.Sprintf("%s（%s）", action.Content, strings.Join(contents, " → "))
+	}
+	return strings.Join(contents, " → ")
+}
+
+// takeSnapshot 记录回合开始前的状态，用于回退
+func takeSnapshot(story *models.StoryState, character *models.Character, charState *models.CharacterState,
+	scene *models.Scene) models.StateSnapshot {
+	return models.StateSnapshot{
+		Turn:           story.Turn,
+		Narrative:      append([]models.NarrativeLog{}, story.Narrative...),
+		CharState:      *cloneCharacterState(charState),
+		Flags:          append([]string{}, story.Flags...),
+		Level:          character.Level,
+		XP:             character.XP,
+		Inventory:      append([]models.Item{}, character.Inventory...),
+		Traits:         append([]string{}, character.Traits...),
+		BaseAttributes: maps.Clone(character.BaseAttributes),
+		PlotNodeID:     story.CurrentPlotNodeID,
+		PlotProgress:   story.PlotProgress,
+		StalledTurns:   story.StalledTurns,
+		Chapters:       append([]models.Chapter{}, story.Chapters...),
+		Day:            story.Day,
+		Period:         story.Period,
+		PeriodActions:  story.PeriodActions,
+		SceneID:        story.SceneID,
+		Objectives:     append([]models.Objective{}, scene.Objectives...),
+		Threats:        append([]models.Threat{}, scene.Threats...),
+		NPCMemories:    cloneNPCMemories(story.NPCMemories),
+		RomanceStages:  cloneRomanceStages(story.RomanceStages),
+		Timestamp:      time.Now(),
+	}
+}
+
+// settleSnapshot 提交回合前在最后一个快照上记下本回合对角色进度的净改变，回退时据此撤销
+func (ss *StoryService) settleSnapshot(story *models.StoryState, charAfter *models.Character) {
+	snapshot := &story.Snapshots[len(story.Snapshots)-1]
+	progress := &models.TurnProgress{
+		XP: ss.ruleEngine.XPBetween(snapshot.Level, charAfter.Level) + charAfter.XP - snapshot.XP,
+	}
+	for _, trait := range charAfter.Traits {
+		if !containsString(snapshot.Traits, trait) {
+			progress.TraitsGained = append(progress.TraitsGained, trait)
+		}
+	}
+	for attr, value := range charAfter.BaseAttributes {
+		before, ok := snapshot.BaseAttributes[attr]
+		if !ok {
+			before = ss.meta.AttributeSettings().Default
+		}
+		if value != before {
+			if progress.BaseAttributeChange == nil {
+				progress.BaseAttributeChange = make(map[string]int)
+			}
+			progress.BaseAttributeChange[attr] = value - before
+		}
+	}
+	snapshot.Progress = progress
+}
+
+// mergeChanges 把一步的状态变化合并到整回合的变化中
+func mergeChanges(dst *models.StateChanges, src models.StateChanges) {
+	dst.HPChange += src.HPChange
+	dst.SANChange += src.SANChange
+	dst.XPGain += src.XPGain
+	dst.MoralityChange += src.MoralityChange
+	dst.ReputationChange += src.ReputationChange
+	dst.ItemsGained = append(dst.ItemsGained, src.ItemsGained...)
+	dst.ItemsLost = append(dst.ItemsLost, src.ItemsLost...)
+	dst.TraitsGained = append(dst.TraitsGained, src.TraitsGained...)
+	dst.StatusAdded = append(dst.StatusAdded, src.StatusAdded...)
+	dst.StatusRemoved = append(dst.StatusRemoved, src.StatusRemoved...)
+	dst.FlagsSet = append(dst.FlagsSet, src.FlagsSet...)
+	dst.ObjectivesDone = append(dst.ObjectivesDone, src.ObjectivesDone...)
+	dst.RulesViolated = append(dst.RulesViolated, src.RulesViolated...)
+	if dst.ThreatTriggered == "" {
+		dst.ThreatTriggered = src.ThreatTriggered
+	}
+	if dst.ThreatWeakened == "" {
+		dst.ThreatWeakened = src.ThreatWeakened
+	}
+	for npcID, delta := range src.RelationChange {
+		if dst.RelationChange == nil {
+			dst.RelationChange = make(map[string]int)
+		}
+		dst.RelationChange[npcID] += delta
+	}
+	for attr, delta := range src.BaseAttributeChange {
+		if dst.BaseAttributeChange == nil {
+			dst.BaseAttributeChange = make(map[string]int)
+		}
+		dst.BaseAttributeChange[attr] += delta
+	}
+}
+
+// plotProgressInfo 汇总当前剧情节点与推进度，世界没有剧情节点时返回nil
+func (ss *StoryService) plotProgressInfo(world *models.World, story *models.StoryState) *models.PlotProgressInfo {
+	for i, node := range world.PlotLines {
+		if node.ID != story.CurrentPlotNodeID {
+			continue
+		}
+		info := &models.PlotProgressInfo{
+			CurrentNodeID:   node.ID,
+			CurrentNodeName: node.Name,
+			Progress:        story.PlotProgress,
+			NodeIndex:       i + 1,
+			TotalNodes:      len(world.PlotLines),
+		}
+		if i < len(world.PlotLines)-1 {
+			info.NextNodeName = world.PlotLines[i+1].Name
+		}
+		return info
+	}
+	return nil
+}
+
+// resolveOutcome 场景结束时判定故事状态：角色死亡、理智归零或超时为失败，否则为完成
+func (ss *StoryService) resolveOutcome(story *models.StoryState, charState *models.CharacterState) string {
+	if charState.HP <= 0 || charState.SAN <= 0 || story.Turn >= 100 {
+		return "failed"
+	}
+	return "completed"
+}
+
+// resolveEnding 按世界定义的条件选出结局，交给LLM细化后写入叙事日志
+func (ss *StoryService) resolveEnding(ctx context.Context, world *models.World, character *models.Character,
+	charState *models.CharacterState, story *models.StoryState) string {
+
+	ending := selectEnding(endingContext{
+		world:     world,
+		character: character,
+		charState: charState,
+		story:     story,
+	})
+
+	story.EndingID = DefaultEndingID
+	endingName := "结局"
+	if ending != nil {
+		story.EndingID = ending.ID
+		endingName = ending.Name
+		log.Printf("🏁 [结局] 达成条件结局「%s」\n", ending.Name)
+	} else {
+		log.Println("🏁 [结局] 无条件结局匹配，使用默认结局")
+	}
+
+	content, err := ss.llm.GenerateEnding(ctx, world, character, ending, story.Status, story.Narrative)
+	if err != nil {
+		log.Printf("⚠️ 生成结局失败: %v\n", err)
+		content = "你的旅程在这里画上了句号。"
+		if ending != nil && ending.Hint != "" {
+			content = ending.Hint
+		}
+	}
+
+	story.Narrative = append(story.Narrative, models.NarrativeLog{
+		Turn:      story.Turn,
+		Type:      "system",
+		Content:   fmt.Sprintf("🏁 【%s】\n\n%s", endingName, content),
+		Timestamp: time.Now(),
+	})
+
+	return content
+}
+
+// defaultAttributeMap 行动类型默认使用的检定属性，未列出的行动使用智力
+var defaultAttributeMap = map[string]string{
+	"attack":      "strength",
+	"move":        "dexterity",
+	"sneak":       "dexterity",
+	"talk":        "charisma",
+	"persuade":    "charisma",
+	"investigate": "perception",
+	"use_item":    "intelligence",
+	"struggle":    "strength",
+	"call_help":   "charisma",
+}
+
+// selectAttribute 根据行动类型选择属性，overrides 中的合法映射优先，非法属性名忽略并回退默认
+func (ss *StoryService) selectAttribute(actionType string, attributes map[string]int, overrides map[string]string) int {
+	if attrName, ok := overrides[actionType]; ok && containsString(attributeNames, attrName) {
+		return attributes[attrName]
 	}
 
-	attrName, ok := attrMap[actionType]
+	attrName, ok := defaultAttributeMap[actionType]
 	if !ok {
 		attrName = "intelligence"
 	}
@@ -292,38 +889,154 @@ func (ss *StoryService) selectAttribute(actionType string, attributes map[string
 	return attributes[attrName]
 }
 
-// calculateChanges 计算状态变化
-func (ss *StoryService) calculateChanges(scene *models.Scene, _ models.Action, diceRoll *models.DiceRoll) models.StateChanges {
-	changes := models.StateChanges{}
+// mergeAttributeMaps 合并故事级与请求级的属性映射，请求级优先
+func mergeAttributeMaps(storyMap, requestMap map[string]string) map[string]string {
+	if len(requestMap) == 0 {
+		return storyMap
+	}
+	merged := make(map[string]string, len(storyMap)+len(requestMap))
+	for k, v := range storyMap {
+		merged[k] = v
+	}
+	for k, v := range requestMap {
+		merged[k] = v
+	}
+	return merged
+}
 
-	// 计算经验值
-	changes.XPGain = ss.ruleEngine.CalculateXPGain(diceRoll.Target, diceRoll.Success)
+// SetAttributeMap 设置故事的自定义检定属性映射，非法属性名直接忽略
+func (ss *StoryService) SetAttributeMap(storyID string, attrMap map[string]string) (*models.StoryState, error) {
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
+	}
 
-	// 根据场景类型和结果计算HP/SAN变化
-	if scene.Type == "combat" {
-		if !diceRoll.Success {
-			damage := ss.ruleEngine.CalculateDamage(5, diceRoll.Critical)
-			changes.HPChange = -damage
+	story.AttributeMap = make(map[string]string)
+	for actionType, attrName := range attrMap {
+		if !containsString(attributeNames, attrName) {
+			log.Printf("⚠️ 忽略非法的检定属性映射: %s -> %s\n", actionType, attrName)
+			continue
 		}
+		story.AttributeMap[actionType] = attrName
 	}
+	story.UpdatedAt = time.Now()
 
-	if scene.Type == "horror" || len(scene.Threats) > 0 {
-		if !diceRoll.Success {
-			changes.SANChange = -ss.ruleEngine.RollDice(6)
+	if err := ss.storage.UpdateStoryState(story); err != nil {
+		return nil, fmt.Errorf("更新故事状态失败: %w", err)
+	}
+
+	return story, nil
+}
+
+// previewConsequences 为高风险选项按calculateChanges的规则推算后果范围，帮助玩家做知情决策
+func (ss *StoryService) previewConsequences(world *models.World, scene *models.Scene, character *models.Character,
+	charState *models.CharacterState, options []models.Option, attrMap map[string]string) {
+
+	for i := range options {
+		if options[i].Risk != "high" {
+			continue
+		}
+
+		difficulty := ss.ruleEngine.CalculateDifficulty(scene.Type, options[i].ActionType, character.Level, world.Difficulty)
+		if options[i].PersonalityConflict != "" {
+			difficulty += personalityConflictPenalty
 		}
+		attribute := ss.selectAttribute(options[i].ActionType, equippedAttributes(charState.Attributes, character), attrMap) +
+			equipmentBonus(character, options[i].ActionType)
+		crit := ss.ruleEngine.CriticalRange(attribute, character)
+		mode, _ := rollModeFor(charState)
+
+		preview := &models.ConsequencePreview{
+			SuccessChance: ss.ruleEngine.SuccessChance(attribute, difficulty, crit, mode),
+		}
+		if scene.Type == "combat" {
+			preview.HPLossMin, preview.HPLossMax = ss.ruleEngine.DamageRange(attribute, difficulty)
+			preview.HPLossMin = reduceDamage(preview.HPLossMin, character)
+			preview.HPLossMax = reduceDamage(preview.HPLossMax, character)
+		}
+		if scene.Type == "horror" || len(scene.Threats) > 0 {
+			bonus := threatSANBonus(scene)
+			preview.SANLossMin, preview.SANLossMax = ss.ruleEngine.SANLossRange(attribute, difficulty)
+			preview.SANLossMin += bonus
+			preview.SANLossMax += bonus
+		}
+		options[i].Consequence = preview
 	}
+}
+
+// calculateChanges 计算行动的状态变化：HP/SAN损失按每一步检定累计（普通行动只有一步，组合行动跳过的步骤不算），
+// 经验值、大成功的奖励和大失败留下的特质按整体结果 diceRoll 只结算一次
+func (ss *StoryService) calculateChanges(scene *models.Scene, character *models.Character, steps []models.ComboStep,
+	diceRoll *models.DiceRoll) models.StateChanges {
+	var changes models.StateChanges
+	if len(steps) == 0 {
+		changes = ss.stepDamage(scene, character, diceRoll)
+	}
+	for _, step := range steps {
+		if !step.Skipped {
+			mergeChanges(&changes, ss.stepDamage(scene, character, step.DiceRoll))
+		}
+	}
+
+	// 计算经验值
+	changes.XPGain = ss.ruleEngine.CalculateXPGain(diceRoll.Target, diceRoll.Success)
 
 	// 大成功可能获得额外奖励
 	if diceRoll.Critical && diceRoll.Success {
 		changes.XPGain *= 2
-		// 可能获得道具或特质
+		// 战斗中顺势反击，削弱最严重的威胁
+		if scene.Type == "combat" && ss.ruleEngine.CounterSeverity() > 0 {
+			if threat := worstThreat(scene); threat != nil {
+				changes.ThreatWeakened = threat.Text
+			}
+		}
+	}
+
+	// 大失败可能留下负面特质
+	if diceRoll.Critical && !diceRoll.Success {
+		if trait, ok := criticalFailureTraits[scene.Type]; ok && !containsString(character.Traits, trait) {
+			changes.TraitsGained = append(changes.TraitsGained, trait)
+		}
 	}
 
 	return changes
 }
 
-// checkSceneEnd 检查场景是否结束
-func (ss *StoryService) checkSceneEnd(_ *models.Scene, story *models.StoryState,
+// stepDamage 计算一步检定失败造成的HP/SAN损失：失败得越惨、难度越高，损失越大；
+// 大失败时诅咒缠身额外损失理智，足够严重的威胁随之爆发
+func (ss *StoryService) stepDamage(scene *models.Scene, character *models.Character, diceRoll *models.DiceRoll) models.StateChanges {
+	var changes models.StateChanges
+	if diceRoll.Success {
+		return changes
+	}
+
+	if scene.Type == "combat" {
+		damage := ss.ruleEngine.FailureDamage(diceRoll)
+		changes.HPChange = -reduceDamage(damage, character)
+	}
+
+	// 威胁越严重，失败时理智损失越多
+	if scene.Type == "horror" || len(scene.Threats) > 0 {
+		changes.SANChange = -ss.ruleEngine.FailureSANLoss(diceRoll) - threatSANBonus(scene)
+	}
+
+	if diceRoll.Critical {
+		if containsString(character.Traits, cursedTrait) {
+			outcome, _ := ss.ruleEngine.outcomeRules()
+			changes.SANChange -= ss.ruleEngine.RollDice(outcome.SANDice)
+		}
+		// 足够严重的威胁在大失败时爆发，造成额外伤害
+		if threat := worstThreat(scene); threat != nil && threat.Severity >= threatTriggerSeverity {
+			changes.HPChange -= threat.Severity * 2
+			changes.ThreatTriggered = threat.Text
+		}
+	}
+
+	return changes
+}
+
+// checkSceneEnd 检查场景是否结束。world 为本回合按周目调整后的世界，剧情节点与判定时保持一致
+func (ss *StoryService) checkSceneEnd(world *models.World, story *models.StoryState,
 	charState *models.CharacterState, _ models.StateChanges) bool {
 
 	// 角色死亡
@@ -343,8 +1056,7 @@ func (ss *StoryService) checkSceneEnd(_ *models.Scene, story *models.StoryState,
 	}
 
 	// 评估剧情进度判断是否完成
-	world, err := ss.storage.GetWorld(story.WorldID)
-	if err == nil && len(world.PlotLines) > 0 {
+	if len(world.PlotLines) > 0 {
 		// 找到当前节点
 		var currentNode *models.PlotNode
 		var currentNodeIndex int
@@ -419,30 +1131,155 @@ func (ss *StoryService) UndoTurn(storyID string) (*models.StoryState, error) {
 		return nil, fmt.Errorf("获取故事状态失败: %w", err)
 	}
 
+	// 已结束的故事不能回退：结局和通关记录已经生效，回退只会留下一个无法继续的故事
+	if story.Status != "active" {
+		return nil, ErrStoryEnded
+	}
+
 	if len(story.Snapshots) == 0 {
-		return nil, fmt.Errorf("无法回退：没有历史记录")
+		return nil, fmt.Errorf("%w：没有历史记录", ErrUndoUnavailable)
+	}
+
+	// 超出免费次数的回退需要付出代价（和恢复的状态一起保存）
+	cost, err := ss.undoCost(story)
+	if err != nil {
+		return nil, err
+	}
+	char, err := ss.storage.GetCharacter(story.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
 	}
 
 	// 获取最后一个快照
 	snapshot := story.Snapshots[len(story.Snapshots)-1]
 
+	// 撤销本回合的升级、特质、基础属性和道具变化：按本回合的净改变扣回经验值（必要时降级）、
+	// 去掉获得的特质、还原基础属性的改变，背包回到回合开始前，
+	// 回退成本在撤销之后扣除。快照里的世界属性记录于回合开始前，升级加的属性随之撤销
+	// （旧快照没有记录时保持当前的等级、经验值和背包）
+	restoredState := cloneCharacterState(&snapshot.CharState)
+	if snapshot.Progress != nil {
+		if err := ss.revertProgress(char, snapshot.Progress); err != nil {
+			return nil, err
+		}
+	}
+	if snapshot.Level > 0 {
+		char.Inventory = append([]models.Item{}, snapshot.Inventory...)
+		pruneEquipment(char)
+	}
+	if err := payUndoCost(char, cost); err != nil {
+		return nil, err
+	}
+	story.UndoCount++
+
 	// 恢复状态
 	story.Turn = snapshot.Turn
 	story.Narrative = snapshot.Narrative
+	story.Flags = snapshot.Flags
+	story.CurrentPlotNodeID = snapshot.PlotNodeID
+	story.PlotProgress = snapshot.PlotProgress
+	story.StalledTurns = snapshot.StalledTurns
+	story.Chapters = snapshot.Chapters
+	story.Day = snapshot.Day
+	story.Period = snapshot.Period
+	story.PeriodActions = snapshot.PeriodActions
+	story.NPCMemories = snapshot.NPCMemories
+	story.RomanceStages = snapshot.RomanceStages
+	story.PendingChoice = nil
+	story.CharState = restoredState
 	story.Snapshots = story.Snapshots[:len(story.Snapshots)-1]
+
+	// 回到快照所在的场景，并恢复场景目标的完成状态（旧快照没有记录时保持不变）
+	if snapshot.SceneID != "" {
+		story.SceneID = snapshot.SceneID
+	}
+	var restoredScenes []*models.Scene
+	if snapshot.Objectives != nil || snapshot.Threats != nil {
+		if scene, err := ss.storage.GetScene(story.SceneID); err == nil {
+			if snapshot.Objectives != nil {
+				scene.Objectives = snapshot.Objectives
+			}
+			if snapshot.Threats != nil {
+				scene.Threats = snapshot.Threats
+			}
+			restoredScenes = append(restoredScenes, scene)
+		}
+	}
 	story.UpdatedAt = time.Now()
+	if err := ss.assertSnapshots(story, "回退"); err != nil {
+		return nil, err
+	}
+
+	// 故事、角色（回退成本）、角色状态和场景在一个事务里保存，任何一步失败都不会只扣掉经验值
+	if err := ss.storage.CommitStory(story, char, restoredState, restoredScenes...); err != nil {
+		return nil, fmt.Errorf("更新故事状态失败: %w", err)
+	}
+	if err := ss.storage.MarkStateChangesUndone(story.ID, story.Turn); err != nil {
+		log.Printf("⚠️ 标记变更日志失败: %v\n", err)
+	}
+	if err := ss.storage.MarkStatePointsUndone(story.ID, story.Turn); err != nil {
+		log.Printf("⚠️ 标记状态轨迹失败: %v\n", err)
+	}
+
+	log.Printf("⏪ [回退] 已回退到回合 %d（本局第 %d 次回退）\n", story.Turn, story.UndoCount)
+
+	return story, nil
+}
+
+// revertProgress 在内存中撤销一回合对角色进度的净改变：扣回本回合获得的经验值（不够扣时逐级降级），
+// 退还回合内花掉的经验值，去掉本回合获得的特质，还原本回合对基础属性的改变。
+// 回合之后训练等花掉的经验值不会退还，训练出的属性也保留；
+// 本回合获得的经验值已经花掉、扣回后不足0时返回 ErrNotEnoughXP，不做任何修改
+func (ss *StoryService) revertProgress(char *models.Character, progress *models.TurnProgress) error {
+	level, xp := char.Level, char.XP-progress.XP
+	for xp < 0 && level > 1 {
+		level--
+		xp += ss.ruleEngine.XPToNextLevel(level)
+	}
+	if xp < 0 {
+		return fmt.Errorf("%w: 本回合获得的 %d 点经验值已经花掉，无法回退", ErrNotEnoughXP, progress.XP)
+	}
+	char.Level, char.XP = level, xp
+
+	if len(progress.TraitsGained) > 0 {
+		traits := make([]string, 0, len(char.Traits))
+		for _, trait := range char.Traits {
+			if !containsString(progress.TraitsGained, trait) {
+				traits = append(traits, trait)
+			}
+		}
+		char.Traits = traits
+	}
 
-	// 恢复角色状态
-	if err := ss.meta.RestoreCharacterState(story.CharacterID, story.WorldID, &snapshot.CharState); err != nil {
-		return nil, fmt.Errorf("恢复角色状态失败: %w", err)
+	if len(progress.BaseAttributeChange) > 0 {
+		cfg := ss.meta.AttributeSettings()
+		if char.BaseAttributes == nil {
+			char.BaseAttributes = defaultBaseAttributes(cfg)
+		}
+		for attr, delta := range progress.BaseAttributeChange {
+			char.BaseAttributes[attr] = max(cfg.Min, min(char.BaseAttributes[attr]-delta, cfg.Max))
+		}
+	}
+	return nil
+}
+
+// SetNotes 保存玩家在故事上的私人备注（攻略计划、喜欢的NPC等），不参与任何游戏逻辑
+func (ss *StoryService) SetNotes(storyID, notes string) (*models.StoryState, error) {
+	if utf8.RuneCountInString(notes) > maxNotesRunes {
+		return nil, fmt.Errorf("%w: 备注最多%d字", ErrInvalidInput, maxNotesRunes)
+	}
+
+	story, err := ss.storage.GetStoryState(storyID)
+	if err != nil {
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
 	}
 
+	story.Notes = notes
+	story.UpdatedAt = time.Now()
 	if err := ss.storage.UpdateStoryState(story); err != nil {
 		return nil, fmt.Errorf("更新故事状态失败: %w", err)
 	}
 
-	log.Println("⏪ [回退] 已回退到回合", story.Turn)
-
 	return story, nil
 }
 
@@ -479,43 +1316,64 @@ func (ss *StoryService) CreateSaveGame(storyID, name, description string) (*mode
 	return save, nil
 }
 
-// ListSaveGames 列出角色的所有存档
-func (ss *StoryService) ListSaveGames(characterID string) ([]models.SaveGame, error) {
-	return ss.storage.GetSaveGamesByCharacter(characterID)
+// ListSaveGames 分页列出角色的存档及记录计数
+func (ss *StoryService) ListSaveGames(characterID string, page models.Page) ([]models.SaveGame, models.ListCount, error) {
+	saves, count, err := ss.storage.GetSaveGamesByCharacter(characterID, page)
+	if err != nil {
+		return nil, count, err
+	}
+
+	// 一次批量取回存档涉及的世界，补充世界名称
+	worldIDs := make([]string, 0, len(saves))
+	for _, save := range saves {
+		worldIDs = append(worldIDs, save.WorldID)
+	}
+	worlds, err := ss.storage.GetWorldsByIDs(worldIDs)
+	if err != nil {
+		return nil, count, fmt.Errorf("获取世界失败: %w", err)
+	}
+	for i := range saves {
+		if world, ok := worlds[saves[i].WorldID]; ok {
+			saves[i].WorldName = world.Name
+		}
+	}
+
+	return saves, count, nil
 }
 
-// LoadStory 读取故事
-func (ss *StoryService) LoadStory(ctx context.Context, storyID string) (*models.StoryState, *models.Scene, *models.CharacterState, error) {
+// LoadStory 读取故事，并为进行中的故事重新生成当前可选的行动（存档里不保存选项）
+func (ss *StoryService) LoadStory(ctx context.Context, storyID string) (*models.LoadedStory, error) {
 	story, err := ss.storage.GetStoryState(storyID)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("获取故事状态失败: %w", err)
+		return nil, fmt.Errorf("获取故事状态失败: %w", err)
 	}
 
-	scene, err := ss.storage.GetScene(story.SceneID)
+	current, err := ss.loadStoryScene(story)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("获取场景失败: %w", err)
+		return nil, err
 	}
 
-	charState, err := ss.meta.GetCharacterState(story.CharacterID, story.WorldID)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("获取角色状态失败: %w", err)
+	loaded := &models.LoadedStory{Story: story, Scene: current.scene, CharState: current.charState}
+	if story.Status == "active" {
+		loaded.Options = ss.generateOptions(ctx, story, current)
 	}
 
-	log.Printf("📂 [读档] 已加载故事: %s (回合 %d)\n", story.ID, story.Turn)
+	log.Printf("📂 [读档] 已加载故事: %s (回合 %d，%d 个选项)\n", story.ID, story.Turn, len(loaded.Options))
 
-	return story, scene, charState, nil
+	return loaded, nil
 }
 
-// evaluatePlotProgress 评估并更新剧情推进
-func (ss *StoryService) evaluatePlotProgress(ctx context.Context, story *models.StoryState, action models.Action, narrative string) error {
-	// 获取世界信息
-	world, err := ss.storage.GetWorld(story.WorldID)
-	if err != nil {
-		return fmt.Errorf("获取世界失败: %w", err)
-	}
+// failForwardProgress 检定失败但没有偏离剧情时保底的推进度，运气差也不会永远卡在原地
+const failForwardProgress = 0.03
+
+// evaluatePlotProgress 评估并更新剧情推进，返回评估带来的道德值与旗标变化。
+// violatedRules 为本回合违反的世界规则，评估时会据此扣减推进；检定失败带来的剧情转折同样算推进
+func (ss *StoryService) evaluatePlotProgress(ctx context.Context, story *models.StoryState, world *models.World,
+	action models.Action, narrative string, diceRoll *models.DiceRoll, violatedRules []string) (models.StateChanges, error) {
+	var changes models.StateChanges
 
 	if len(world.PlotLines) == 0 {
-		return nil // 没有剧情节点，不需要评估
+		return changes, nil // 没有剧情节点，不需要评估
 	}
 
 	// 找到当前节点
@@ -530,7 +1388,7 @@ func (ss *StoryService) evaluatePlotProgress(ctx context.Context, story *models.
 	}
 
 	if currentNode == nil {
-		return fmt.Errorf("当前剧情节点不存在")
+		return changes, fmt.Errorf("当前剧情节点不存在")
 	}
 
 	// 找到下一个节点
@@ -551,21 +1409,57 @@ func (ss *StoryService) evaluatePlotProgress(ctx context.Context, story *models.
 	}
 
 	// 调用LLM评估剧情推进
-	newProgress, reached, err := ss.llm.EvaluatePlotProgress(ctx, currentNode, nextNode, action, narrative, story.PlotProgress)
+	eval, err := ss.llm.EvaluatePlotProgress(ctx, currentNode, nextNode, action, narrative, diceRoll, story.PlotProgress,
+		endingFlagNames(world), world.Rules, violatedRules, npcNames(world))
 	if err != nil {
-		return err
+		return changes, err
 	}
 
-	story.PlotProgress = newProgress
+	// 失败前进：检定失败但没有违反规则、也没有偏离剧情时，至少推进一点
+	if gain := eval.Progress - story.PlotProgress; !diceRoll.Success && len(violatedRules) == 0 &&
+		gain >= 0 && gain < failForwardProgress {
+		eval.Progress = min(story.PlotProgress+failForwardProgress, 1.0)
+		log.Printf("🎲 [失败前进] 检定失败也推动了故事，推进度保底 +%.0f%%\n", failForwardProgress*100)
+	}
 
-	// 追加一条系统消息显示当前进度与目标
-	progressMsg := fmt.Sprintf("剧情进度：%.0f%% / 100%%（当前：%s → 目标：%s）", story.PlotProgress*100, currentNode.Name, nextNode.Name)
-	story.Narrative = append(story.Narrative, models.NarrativeLog{
-		Turn:      story.Turn,
-		Type:      "system",
-		Content:   progressMsg,
-		Timestamp: time.Now(),
-	})
+	prevProgress := story.PlotProgress
+	story.PlotProgress = eval.Progress
+	reached := eval.Reached
+
+	// 下一节点限定了时段时，只有在对应时段才能触发
+	if reached && !isLastNode && !availableInPeriod(nextNode.Periods, story.Period) {
+		log.Printf("🕐 [剧情推进] 「%s」只在%v触发，当前为%s，暂缓推进\n", nextNode.Name, nextNode.Periods, story.Period)
+		reached = false
+		if story.PlotProgress > plotHoldProgress {
+			story.PlotProgress = plotHoldProgress
+		}
+	}
+	changes.MoralityChange = eval.MoralityChange
+	changes.ReputationChange = eval.ReputationChange
+	changes.FlagsSet = eval.Flags
+	changes.RelationChange = groupRelationChanges(world, action, narrative, eval.RelationChange)
+	changes.BaseAttributeChange = sanitizeBaseAttributeChange(eval.BaseAttributeChange)
+	if len(changes.BaseAttributeChange) > 0 {
+		log.Printf("🌟 [永久改变] 基础属性：%s\n", describeBaseAttributeChange(changes.BaseAttributeChange))
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   fmt.Sprintf("🌟 【命运的烙印】这段经历永久地改变了你（%s），无论去往哪个世界都将伴随你。", describeBaseAttributeChange(changes.BaseAttributeChange)),
+			Timestamp: time.Now(),
+		})
+	}
+	ss.trackPlotStall(ctx, story, world, currentNode, nextNode, story.PlotProgress-prevProgress, reached)
+
+	// 进度默认通过ActionResult.PlotProgress返回，仅在配置开启时写入叙事日志
+	if ss.meta.GameConfig().PlotProgressInNarrative {
+		progressMsg := fmt.Sprintf("剧情进度：%.0f%% / 100%%（当前：%s → 目标：%s）", story.PlotProgress*100, currentNode.Name, nextNode.Name)
+		story.Narrative = append(story.Narrative, models.NarrativeLog{
+			Turn:      story.Turn,
+			Type:      "system",
+			Content:   progressMsg,
+			Timestamp: time.Now(),
+		})
+	}
 
 	// 如果到达下一个节点
 	if reached {
@@ -580,6 +1474,7 @@ func (ss *StoryService) evaluatePlotProgress(ctx context.Context, story *models.
 			// 更新当前节点
 			story.CurrentPlotNodeID = nextNode.ID
 			story.PlotProgress = 0.0 // 重置推进度
+			openChapter(story, nextNode.Name, nextNode.ID, story.Turn+1)
 
 			// 添加剧情节点到达的系统消息
 			story.Narrative = append(story.Narrative, models.NarrativeLog{
@@ -596,5 +1491,5 @@ func (ss *StoryService) evaluatePlotProgress(ctx context.Context, story *models.
 		}
 	}
 
-	return nil
+	return changes, nil
 }
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+)
+
+// testStoryEnv 演示模式的LLM、内存数据库和固定骰值搭起来的一局故事
+type testStoryEnv struct {
+	store *storage.Storage
+	meta  *MetaService
+	story *StoryService
+	char  *models.Character
+	state *models.StoryState
+}
+
+// newTestStoryEnv 创建角色和世界并开始一局故事，之后的检定依次掷出 rolls
+func newTestStoryEnv(t *testing.T, rolls ...int) *testStoryEnv {
+	t.Helper()
+	cfg, err := LoadConfig("../../config.example.yml")
+	if err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	cfg.LLM.DemoMode = true
+
+	store, err := storage.New(storage.MemoryPath)
+	if err != nil {
+		t.Fatalf("创建内存数据库失败: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	ruleEngine := NewRuleEngineWithSource(NewFixedRolls(rolls...))
+	ruleEngine.SetRules(cfg.Rules)
+	meta := NewMetaService(store, ruleEngine, cfg.Game)
+	llm := NewLLMService(cfg.LLM)
+	worlds := NewWorldService(store, llm)
+	stories := NewStoryService(store, llm, ruleEngine, meta)
+
+	ctx := context.Background()
+	char, err := meta.CreateCharacter(&models.Character{Name: "测试角色"})
+	if err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	world, err := worlds.CreateWorldFromSegment(ctx, "海边小镇的灯塔守夜人失踪了，镇上的人都闭口不谈。")
+	if err != nil {
+		t.Fatalf("创建世界失败: %v", err)
+	}
+	story, _, err := stories.StartStory(ctx, char.ID, world.ID, false, "")
+	if err != nil {
+		t.Fatalf("开始故事失败: %v", err)
+	}
+	return &testStoryEnv{store: store, meta: meta, story: stories, char: char, state: story}
+}
+
+// act 以当前版本提交一次行动
+func (env *testStoryEnv) act(t *testing.T, content string) *models.ActionResult {
+	t.Helper()
+	story, err := env.store.GetStoryState(env.state.ID)
+	if err != nil {
+		t.Fatalf("获取故事失败: %v", err)
+	}
+	result, err := env.story.ProcessAction(context.Background(), story.ID,
+		models.Action{Type: "investigate", Content: content}, story.Version)
+	if err != nil {
+		t.Fatalf("行动失败: %v", err)
+	}
+	return result
+}
+
+// setXP 直接设置角色的经验值，返回保存后的角色
+func (env *testStoryEnv) setXP(t *testing.T, xp int) *models.Character {
+	t.Helper()
+	char, err := env.store.GetCharacter(env.char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	char.XP = xp
+	if err := env.store.UpdateCharacter(char); err != nil {
+		t.Fatalf("保存角色失败: %v", err)
+	}
+	return char
+}
+
+func TestUndoTurnRevertsLevelUp(t *testing.T) {
+	env := newTestStoryEnv(t, 18)
+
+	char := env.setXP(t, 90)
+	before, err := env.store.GetCharacterState(char.ID, env.state.WorldID)
+	if err != nil {
+		t.Fatalf("获取角色状态失败: %v", err)
+	}
+
+	result := env.act(t, "调查灯塔下的脚印")
+	if result.Changes.LevelUp == nil {
+		t.Fatalf("行动后应当升级，经验值变化 %+d", result.Changes.XPGain)
+	}
+
+	if _, err := env.story.UndoTurn(env.state.ID); err != nil {
+		t.Fatalf("回退失败: %v", err)
+	}
+	char, err = env.store.GetCharacter(char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	if char.Level != 1 || char.XP != 90 {
+		t.Errorf("回退后应为1级90经验值，实际 %d 级 %d 经验值", char.Level, char.XP)
+	}
+	after, err := env.store.GetCharacterState(char.ID, env.state.WorldID)
+	if err != nil {
+		t.Fatalf("获取角色状态失败: %v", err)
+	}
+	for attr, value := range before.Attributes {
+		if after.Attributes[attr] != value {
+			t.Errorf("回退后属性 %s 应为 %d，实际 %d", attr, value, after.Attributes[attr])
+		}
+	}
+}
+
+func TestUndoTurnRevertsTraits(t *testing.T) {
+	env := newTestStoryEnv(t, 1)
+	char, err := env.store.GetCharacter(env.char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	char.Traits = []string{"天选之人"}
+	if err := env.store.UpdateCharacter(char); err != nil {
+		t.Fatalf("保存角色失败: %v", err)
+	}
+
+	result := env.act(t, "调查灯塔下的脚印")
+	if len(result.Changes.TraitsGained) == 0 {
+		t.Fatalf("大失败应当留下特质，实际 %+v", result.Changes)
+	}
+	if _, err := env.story.UndoTurn(env.state.ID); err != nil {
+		t.Fatalf("回退失败: %v", err)
+	}
+	char, err = env.store.GetCharacter(char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	if len(char.Traits) != 1 || char.Traits[0] != "天选之人" {
+		t.Errorf("回退后应只保留回合开始前的特质，实际 %v", char.Traits)
+	}
+}
+
+func TestUndoTurnRevertsBaseAttributeChange(t *testing.T) {
+	env := newTestStoryEnv(t)
+	story, err := env.store.GetStoryState(env.state.ID)
+	if err != nil {
+		t.Fatalf("获取故事失败: %v", err)
+	}
+	char, err := env.store.GetCharacter(env.char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	state, err := env.store.GetCharacterState(char.ID, story.WorldID)
+	if err != nil {
+		t.Fatalf("获取角色状态失败: %v", err)
+	}
+	scene, err := env.store.GetScene(story.SceneID)
+	if err != nil {
+		t.Fatalf("获取场景失败: %v", err)
+	}
+	baseBefore, worldBefore := char.BaseAttributes["strength"], state.Attributes["strength"]
+
+	// 按行动的流程结算一个留下命运的烙印的回合
+	story.Snapshots = append(story.Snapshots, takeSnapshot(story, char, state, scene))
+	story.Turn++
+	charAfter, stateAfter := cloneCharacter(char), cloneCharacterState(state)
+	env.meta.ApplyChanges(charAfter, stateAfter, models.StateChanges{BaseAttributeChange: map[string]int{"strength": 2}})
+	story.CharState = stateAfter
+	env.story.settleSnapshot(story, charAfter)
+	if err := env.store.CommitStory(story, charAfter, stateAfter); err != nil {
+		t.Fatalf("提交回合失败: %v", err)
+	}
+
+	if _, err := env.story.UndoTurn(story.ID); err != nil {
+		t.Fatalf("回退失败: %v", err)
+	}
+	char, err = env.store.GetCharacter(char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	state, err = env.store.GetCharacterState(char.ID, story.WorldID)
+	if err != nil {
+		t.Fatalf("获取角色状态失败: %v", err)
+	}
+	if char.BaseAttributes["strength"] != baseBefore || state.Attributes["strength"] != worldBefore {
+		t.Errorf("回退后基础属性和世界属性都应回到 %d/%d，实际 %d/%d",
+			baseBefore, worldBefore, char.BaseAttributes["strength"], state.Attributes["strength"])
+	}
+}
+
+func TestUndoTurnKeepsLaterTraining(t *testing.T) {
+	env := newTestStoryEnv(t, 18)
+	char := env.setXP(t, 90)
+
+	result := env.act(t, "调查灯塔下的脚印")
+	training, err := env.meta.TrainAttribute(char.ID, "strength")
+	if err != nil {
+		t.Fatalf("训练失败: %v", err)
+	}
+	if _, err := env.story.UndoTurn(env.state.ID); err != nil {
+		t.Fatalf("回退失败: %v", err)
+	}
+
+	char, err = env.store.GetCharacter(char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	// 回退只扣回本回合获得的经验值，训练花掉的经验值和训练出的属性都保留
+	if want := 90 - training.XPCost; char.Level != 1 || char.XP != want {
+		t.Errorf("回退后应为1级 %d 经验值（本回合获得 %d，训练花掉 %d），实际 %d 级 %d 经验值",
+			want, result.Changes.XPGain, training.XPCost, char.Level, char.XP)
+	}
+	if char.BaseAttributes["strength"] != training.Value {
+		t.Errorf("回退不应撤销回合之后的训练，力量应为 %d，实际 %d", training.Value, char.BaseAttributes["strength"])
+	}
+}
+
+func TestUndoTurnRefusesSpentXP(t *testing.T) {
+	env := newTestStoryEnv(t, 18)
+	char := env.setXP(t, 0)
+
+	env.act(t, "调查灯塔下的脚印")
+	char, err := env.store.GetCharacter(char.ID)
+	if err != nil {
+		t.Fatalf("获取角色失败: %v", err)
+	}
+	// 把本回合获得的经验值全部花掉
+	char.XP = 0
+	if err := env.store.UpdateCharacter(char); err != nil {
+		t.Fatalf("保存角色失败: %v", err)
+	}
+
+	if _, err := env.story.UndoTurn(env.state.ID); !errors.Is(err, ErrNotEnoughXP) {
+		t.Fatalf("本回合获得的经验值已经花掉时回退应返回 ErrNotEnoughXP，实际 %v", err)
+	}
+	story, err := env.store.GetStoryState(env.state.ID)
+	if err != nil {
+		t.Fatalf("获取故事失败: %v", err)
+	}
+	if len(story.Snapshots) != 1 {
+		t.Errorf("回退失败时不应改动故事，实际剩 %d 个快照", len(story.Snapshots))
+	}
+}
+
+func TestUndoTurnRejectsEndedStory(t *testing.T) {
+	env := newTestStoryEnv(t, 12)
+	env.act(t, "调查灯塔下的脚印")
+
+	story, err := env.store.GetStoryState(env.state.ID)
+	if err != nil {
+		t.Fatalf("获取故事失败: %v", err)
+	}
+	story.Status = "completed"
+	if err := env.store.UpdateStoryState(story); err != nil {
+		t.Fatalf("保存故事失败: %v", err)
+	}
+	if env.story.UndoStatus(story).Allowed {
+		t.Error("已结束的故事不应显示可以回退")
+	}
+
+	if _, err := env.story.UndoTurn(story.ID); !errors.Is(err, ErrStoryEnded) {
+		t.Fatalf("已结束的故事回退应返回 ErrStoryEnded，实际 %v", err)
+	}
+	after, err := env.store.GetStoryState(story.ID)
+	if err != nil {
+		t.Fatalf("获取故事失败: %v", err)
+	}
+	if after.Turn != story.Turn || after.Status != "completed" {
+		t.Errorf("拒绝回退时不应改动故事，实际第%d回合、状态 %s", after.Turn, after.Status)
+	}
+}
+
+func TestComboRewardsOncePerAction(t *testing.T) {
+	env := newTestStoryEnv(t, 3)
+	scene := &models.Scene{Type: "combat"}
+	char := &models.Character{Name: "测试角色"}
+
+	failed := &models.DiceRoll{Result: 3, Target: 12, Success: false}
+	critical := &models.DiceRoll{Result: 20, Target: 12, Success: true, Critical: true}
+	steps := []models.ComboStep{
+		{Content: "冲上前", DiceRoll: failed},
+		{Content: "挥刀", DiceRoll: critical},
+		{Content: "撤退", Skipped: true},
+	}
+
+	changes := env.story.calculateChanges(scene, char, steps, critical)
+	if want := 12 * 10 * 2; changes.XPGain != want {
+		t.Errorf("组合行动的经验值应按整体结果结算一次（%d），实际 %d", want, changes.XPGain)
+	}
+	single := env.story.stepDamage(scene, char, failed)
+	if changes.HPChange != single.HPChange {
+		t.Errorf("HP损失应只累计失败的一步（%d），实际 %d", single.HPChange, changes.HPChange)
+	}
+	if len(changes.TraitsGained) != 0 {
+		t.Errorf("整体大成功不应留下大失败特质，实际 %v", changes.TraitsGained)
+	}
+
+	fumble := &models.DiceRoll{Result: 1, Target: 12, Success: false, Critical: true}
+	changes = env.story.calculateChanges(scene, char, []models.ComboStep{
+		{Content: "绊倒", DiceRoll: fumble},
+		{Content: "再绊倒", DiceRoll: fumble},
+	}, fumble)
+	if changes.XPGain != 12*10/2 {
+		t.Errorf("失败的组合行动只结算一次一半经验值，实际 %d", changes.XPGain)
+	}
+	if len(changes.TraitsGained) != 1 {
+		t.Errorf("大失败特质每次行动最多一个，实际 %v", changes.TraitsGained)
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/aiwuxian/project-abyss/internal/storage"
+	"github.com/google/uuid"
+)
+
+// 任务状态
+const (
+	TaskPending = "pending"
+	TaskRunning = "running"
+	TaskDone    = "done"
+	TaskFailed  = "failed"
+)
+
+const (
+	taskTimeout         = 5 * time.Minute  // 单个任务的最长执行时间
+	taskRetention       = 24 * time.Hour   // 已结束任务的保留时间
+	taskCleanupInterval = 30 * time.Minute // 过期任务的清理间隔
+)
+
+// taskTransitions 任务状态机允许的状态转换
+var taskTransitions = map[string][]string{
+	TaskPending: {TaskRunning, TaskFailed},
+	TaskRunning: {TaskDone, TaskFailed},
+}
+
+// TaskFunc 后台任务的执行函数，返回值会序列化为任务结果
+type TaskFunc func(ctx context.Context) (interface{}, error)
+
+// TaskService 管理后台异步任务
+type TaskService struct {
+	storage *storage.Storage
+}
+
+func NewTaskService(storage *storage.Storage) *TaskService {
+	return &TaskService{storage: storage}
+}
+
+// Start 处理上次运行遗留的未完成任务，并启动过期任务清理
+func (ts *TaskService) Start() {
+	if err := ts.storage.FailUnfinishedTasks("服务重启，任务已中断，请重新提交"); err != nil {
+		log.Printf("⚠️ 处理遗留任务失败: %v\n", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(taskCleanupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ts.cleanup()
+		}
+	}()
+}
+
+// Submit 创建任务并在后台执行
+func (ts *TaskService) Submit(taskType string, run TaskFunc) (*models.Task, error) {
+	task := &models.Task{
+		ID:        uuid.New().String(),
+		Type:      taskType,
+		Status:    TaskPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := ts.storage.CreateTask(task); err != nil {
+		return nil, fmt.Errorf("创建任务失败: %w", err)
+	}
+
+	go ts.execute(*task, run)
+
+	return task, nil
+}
+
+// GetTask 查询任务状态与结果
+func (ts *TaskService) GetTask(id string) (*models.Task, error) {
+	return ts.storage.GetTask(id)
+}
+
+// execute 执行任务并记录结果，任务函数panic时按失败处理
+func (ts *TaskService) execute(task models.Task, run TaskFunc) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("❌ 任务 %s panic: %v\n", task.ID, r)
+			ts.transition(&task, TaskFailed, nil, fmt.Sprintf("任务执行异常: %v", r))
+		}
+	}()
+
+	if !ts.transition(&task, TaskRunning, nil, "") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), taskTimeout)
+	defer cancel()
+
+	result, err := run(ctx)
+	if err != nil {
+		log.Printf("❌ 任务 %s 失败: %v\n", task.ID, err)
+		ts.transition(&task, TaskFailed, nil, err.Error())
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		ts.transition(&task, TaskFailed, nil, fmt.Sprintf("序列化任务结果失败: %v", err))
+		return
+	}
+	ts.transition(&task, TaskDone, data, "")
+}
+
+// transition 按状态机更新任务状态，不允许的转换会被忽略
+func (ts *TaskService) transition(task *models.Task, to string, result json.RawMessage, errMsg string) bool {
+	if !containsString(taskTransitions[task.Status], to) {
+		log.Printf("⚠️ 任务 %s 不允许从 %s 转为 %s\n", task.ID, task.Status, to)
+		return false
+	}
+
+	task.Status = to
+	task.Result = result
+	task.Error = errMsg
+	task.UpdatedAt = time.Now()
+	if err := ts.storage.UpdateTask(task); err != nil {
+		log.Printf("❌ 更新任务 %s 状态失败: %v\n", task.ID, err)
+		return false
+	}
+	return true
+}
+
+// cleanup 删除过期的已结束任务
+func (ts *TaskService) cleanup() {
+	n, err := ts.storage.DeleteFinishedTasksBefore(time.Now().Add(-taskRetention))
+	if err != nil {
+		log.Printf("⚠️ 清理过期任务失败: %v\n", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("🧹 已清理 %d 个过期任务\n", n)
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// toneParameter 行动参数中表示语气/态度的键
+const toneParameter = "tone"
+
+// toneReactionModifier 目标NPC性格喜欢/反感该语气时的检定修正
+const toneReactionModifier = 2
+
+// actionTone 行动的语气：决定检定用的属性，并按目标NPC的性格产生正负修正
+type actionTone struct {
+	Name      string   // 中文名（用于叙事和日志）
+	Attribute string   // 检定改用的属性（行动类型已被显式映射时不生效）
+	Liked     []string // NPC性格/特质含这些关键词时吃这一套
+	Disliked  []string // NPC性格/特质含这些关键词时反感
+}
+
+var actionTones = map[string]actionTone{
+	"aggressive": {
+		Name:      "强硬",
+		Attribute: "strength",
+		Liked:     []string{"胆小", "懦弱", "怯懦", "软弱", "顺从"},
+		Disliked:  []string{"高傲", "强势", "倔强", "暴躁", "傲娇"},
+	},
+	"gentle": {
+		Name:      "温柔",
+		Attribute: "charisma",
+		Liked:     []string{"害羞", "温柔", "善良", "敏感", "内向"},
+		Disliked:  []string{"强势", "冷酷", "好斗", "暴躁"},
+	},
+	"flirt": {
+		Name:      "挑逗",
+		Attribute: "charisma",
+		Liked:     []string{"妩媚", "风骚", "开放", "大胆", "热情"},
+		Disliked:  []string{"高冷", "保守", "正经", "矜持", "冷淡"},
+	},
+	"honest": {
+		Name:      "坦诚",
+		Attribute: "intelligence",
+		Liked:     []string{"正直", "善良", "单纯", "真诚"},
+		Disliked:  []string{"腹黑", "狡猾", "多疑", "心机"},
+	},
+}
+
+// lookupTone 返回行动参数中指定的语气，未指定或未知语气返回 false
+func lookupTone(action models.Action) (actionTone, bool) {
+	tone, ok := actionTones[strings.ToLower(strings.TrimSpace(action.Parameters[toneParameter]))]
+	return tone, ok
+}
+
+// toneReaction 判断目标NPC对该语气的反应：1 吃这一套，-1 反感，0 无明显反应
+func toneReaction(tone actionTone, npc *models.NPC) int {
+	if npc == nil {
+		return 0
+	}
+	profile := npc.Description + " " + strings.Join(npc.Traits, " ")
+	for _, kw := range tone.Disliked {
+		if strings.Contains(profile, kw) {
+			return -1
+		}
+	}
+	for _, kw := range tone.Liked {
+		if strings.Contains(profile, kw) {
+			return 1
+		}
+	}
+	return 0
+}
+
+// describeTone 生成给LLM的语气说明，要求叙事体现语气和目标NPC的反应（未指定语气返回空）
+func describeTone(world *models.World, action models.Action) string {
+	tone, ok := lookupTone(action)
+	if !ok {
+		return ""
+	}
+	text := fmt.Sprintf("\n**语气：**玩家以「%s」的态度行动，请在对白和动作中体现这种语气", tone.Name)
+	if npc := findNPC(world, action.Target); npc != nil {
+		switch toneReaction(tone, npc) {
+		case 1:
+			text += fmt.Sprintf("，%s的性格正吃这一套", npc.Name)
+		case -1:
+			text += fmt.Sprintf("，%s的性格对这种语气很反感", npc.Name)
+		}
+	}
+	return text + "。\n"
+}
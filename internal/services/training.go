@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// defaultTrainingConfig 未配置属性训练时的默认值：训练默认值属性的第一点消耗20经验值
+func defaultTrainingConfig() models.TrainingConfig {
+	return models.TrainingConfig{XPBase: 20}
+}
+
+// trainingSettings 返回生效的训练配置，未配置的项使用默认值
+func trainingSettings(cfg models.TrainingConfig) models.TrainingConfig {
+	if cfg.XPBase == 0 {
+		cfg.XPBase = defaultTrainingConfig().XPBase
+	}
+	return cfg
+}
+
+// trainingCost 把属性从 value 训练到 value+1 的经验值成本：高于默认值后每点越来越贵，防止无限堆单项属性
+func trainingCost(value int, attrs models.AttributeConfig, training models.TrainingConfig) int {
+	return training.XPBase * max(1, value-attrs.Default+1)
+}
+
+// trainingCosts 各属性下一次训练的成本，已达上限的属性不列出
+func trainingCosts(base map[string]int, attrs models.AttributeConfig, training models.TrainingConfig) map[string]int {
+	costs := make(map[string]int, len(attributeNames))
+	for _, attr := range attributeNames {
+		if value := base[attr]; value < attrs.Max {
+			costs[attr] = trainingCost(value, attrs, training)
+		}
+	}
+	return costs
+}
+
+// TrainAttribute 消耗经验值把角色的一项基础属性提升1点。基础属性跨世界继承，在之后进入的世界中生效
+func (ms *MetaService) TrainAttribute(characterID, attr string) (*models.TrainingResult, error) {
+	training := trainingSettings(ms.GameConfig().Training)
+	if training.XPBase < 0 {
+		return nil, fmt.Errorf("%w: 属性训练未开放", ErrForbidden)
+	}
+	if !containsString(attributeNames, attr) {
+		return nil, fmt.Errorf("%w: 未知属性「%s」", ErrInvalidInput, attr)
+	}
+
+	char, err := ms.storage.GetCharacter(characterID)
+	if err != nil {
+		return nil, fmt.Errorf("获取角色失败: %w", err)
+	}
+
+	attrs := ms.AttributeSettings()
+	char.BaseAttributes = clampAttributes(char.BaseAttributes, attrs)
+	value := char.BaseAttributes[attr]
+	if value >= attrs.Max {
+		return nil, fmt.Errorf("%w: %s已达上限 %d", ErrInvalidInput, attributeDisplayNames[attr], attrs.Max)
+	}
+	cost := trainingCost(value, attrs, training)
+	if char.XP < cost {
+		return nil, fmt.Errorf("%w: 训练%s需要 %d 点，当前只有 %d 点", ErrNotEnoughXP, attributeDisplayNames[attr], cost, char.XP)
+	}
+
+	char.XP -= cost
+	char.BaseAttributes[attr] = value + 1
+	char.UpdatedAt = time.Now()
+	if err := ms.storage.UpdateCharacter(char); err != nil {
+		return nil, fmt.Errorf("保存角色失败: %w", err)
+	}
+
+	log.Printf("🏋️ [训练] %s 的%s %d → %d（消耗 %d 经验值）\n", char.Name, attributeDisplayNames[attr], value, value+1, cost)
+	return &models.TrainingResult{
+		Character: char,
+		Attribute: attr,
+		Value:     value + 1,
+		XPCost:    cost,
+		NextCosts: trainingCosts(char.BaseAttributes, attrs, training),
+	}, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// traitEffect 特质对检定的影响
+type traitEffect struct {
+	Negative    bool
+	Modifier    int      // 检定修正（负面特质为负数）
+	ActionTypes []string // 生效的行动类型（为空表示所有行动）
+	CritSuccess int      // 大成功阈值扩大量（1 表示 19-20 即大成功）
+	CritFailure int      // 大失败阈值扩大量（1 表示 1-2 即大失败）
+	Description string
+}
+
+// traitCatalog 已知特质的效果，不在表中的特质只作为描述，不影响检定
+var traitCatalog = map[string]traitEffect{
+	"敏锐":   {Modifier: 2, ActionTypes: []string{"observe", "investigate"}, Description: "观察和调查检定+2"},
+	"强健":   {Modifier: 2, ActionTypes: []string{"attack", "move"}, Description: "攻击和移动检定+2"},
+	"能言善辩": {Modifier: 2, ActionTypes: []string{"talk", "persuade"}, Description: "交谈和说服检定+2"},
+	"魅惑":   {Modifier: 2, ActionTypes: []string{"flirt", "seduce", "date"}, Description: "搭讪、诱惑和约会检定+2"},
+	"天选之人": {CritSuccess: 1, Description: "掷出19-20即为大成功"},
+
+	"胆怯":   {Negative: true, Modifier: -2, ActionTypes: []string{"attack"}, Description: "攻击检定-2"},
+	"伤痕累累": {Negative: true, Modifier: -2, ActionTypes: []string{"attack", "move"}, Description: "攻击和移动检定-2"},
+	"心有余悸": {Negative: true, Modifier: -2, ActionTypes: []string{"observe", "investigate", "sneak"}, Description: "观察、调查和潜行检定-2"},
+	"声名狼藉": {Negative: true, Modifier: -2, ActionTypes: []string{"talk", "persuade", "help"}, Description: "交谈、说服和帮助检定-2"},
+	"诅咒缠身": {Negative: true, Modifier: -1, Description: "所有检定-1，大失败时额外损失理智"},
+	"堕落之印": {Negative: true, Modifier: -1, ActionTypes: []string{"help", "talk"}, Description: "善意的行动检定-1"},
+	"厄运缠身": {Negative: true, CritFailure: 1, Description: "掷出1-2即为大失败"},
+}
+
+// negativeTraitKeywords 不在表中的特质按名称关键词判定是否为负面特质
+var negativeTraitKeywords = []string{"诅咒", "恐惧", "怯", "伤", "病", "狼藉", "堕落", "厄运", "创伤"}
+
+// cursedTrait 大失败时额外损失理智的特质
+const cursedTrait = "诅咒缠身"
+
+// corruptionTrait 道德值跌破 corruptionThreshold 时获得的特质
+const (
+	corruptionTrait     = "堕落之印"
+	corruptionThreshold = -60
+)
+
+// criticalFailureTraits 大失败时按场景类型获得的负面特质
+var criticalFailureTraits = map[string]string{
+	"combat":     "伤痕累累",
+	"horror":     "心有余悸",
+	"mystery":    "心有余悸",
+	"social":     "声名狼藉",
+	"temptation": "声名狼藉",
+}
+
+// describeTrait 返回特质的正负和效果
+func describeTrait(name string) models.TraitInfo {
+	if effect, ok := traitCatalog[name]; ok {
+		return models.TraitInfo{
+			Name:        name,
+			Negative:    effect.Negative,
+			Modifier:    effect.Modifier,
+			Description: effect.Description,
+		}
+	}
+	for _, kw := range negativeTraitKeywords {
+		if strings.Contains(name, kw) {
+			return models.TraitInfo{Name: name, Negative: true}
+		}
+	}
+	return models.TraitInfo{Name: name}
+}
+
+// GroupTraits 把角色特质按正负分组
+func GroupTraits(traits []string) *models.TraitGroups {
+	groups := &models.TraitGroups{
+		Positive: []models.TraitInfo{},
+		Negative: []models.TraitInfo{},
+	}
+	for _, name := range traits {
+		info := describeTrait(name)
+		if info.Negative {
+			groups.Negative = append(groups.Negative, info)
+		} else {
+			groups.Positive = append(groups.Positive, info)
+		}
+	}
+	return groups
+}
+
+// traitModifier 汇总角色特质对该行动类型的检定修正（正面加、负面减）
+func traitModifier(character *models.Character, actionType string) int {
+	if character == nil {
+		return 0
+	}
+	total := 0
+	for _, name := range character.Traits {
+		effect, ok := traitCatalog[name]
+		if !ok {
+			continue
+		}
+		if len(effect.ActionTypes) == 0 || containsString(effect.ActionTypes, actionType) {
+			total += effect.Modifier
+		}
+	}
+	return total
+}
+
+// traitCritBonus 汇总角色特质对大成功/大失败阈值的扩大量
+func traitCritBonus(character *models.Character) (success, failure int) {
+	if character == nil {
+		return 0, 0
+	}
+	for _, name := range character.Traits {
+		effect := traitCatalog[name]
+		success += effect.CritSuccess
+		failure += effect.CritFailure
+	}
+	return success, failure
+}
+
+// appendTraits 添加尚未拥有的特质
+func appendTraits(traits []string, gained ...string) []string {
+	for _, name := range gained {
+		if name != "" && !containsString(traits, name) {
+			traits = append(traits, name)
+		}
+	}
+	return traits
+}
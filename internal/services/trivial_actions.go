@@ -0,0 +1,68 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// riskyActionTypes 有风险的行动类型，即使选项标记了无需检定也照常检定
+var riskyActionTypes = []string{"attack", "sneak", "seduce"}
+
+// trivialAllowed 选项或行动标记的"无需检定"是否成立：战斗场景、有风险的行动和违背本性的行动都必须检定，
+// 避免客户端随意标记来跳过检定
+func trivialAllowed(scene *models.Scene, actionType, conflict string) bool {
+	return scene.Type != "combat" && !containsString(riskyActionTypes, actionType) && conflict == ""
+}
+
+// skipsCheck 判断行动是否免检定直接成功：难度不高于配置的阈值，或来自标记为无需检定的选项。
+// 玩家为这次行动消耗经验值触发灵感迸发时照常检定
+func (ss *StoryService) skipsCheck(scene *models.Scene, action models.Action, difficulty int, conflict string) bool {
+	if strings.TrimSpace(action.Parameters[inspirationParameter]) != "" {
+		return false
+	}
+	if ss.ruleEngine.IsTrivial(difficulty) {
+		return true
+	}
+	return action.Trivial && trivialAllowed(scene, actionTypeOf(action), conflict)
+}
+
+// autoSuccessRoll 免检定行动的结算结果：视为普通成功参与后续结算，返回给前端时隐藏
+func autoSuccessRoll(difficulty int) *models.DiceRoll {
+	return &models.DiceRoll{Type: "auto", Target: difficulty, Success: true, Automatic: true}
+}
+
+// visibleRoll 返回给前端和写入叙事日志的检定结果，免检定的行动没有检定
+func visibleRoll(roll *models.DiceRoll) *models.DiceRoll {
+	if roll == nil || roll.Automatic {
+		return nil
+	}
+	return roll
+}
+
+// hideAutomaticRolls 去掉组合行动中免检定步骤的检定结果（结算完成后调用）
+func hideAutomaticRolls(steps []models.ComboStep) {
+	for i := range steps {
+		steps[i].DiceRoll = visibleRoll(steps[i].DiceRoll)
+	}
+}
+
+// markTrivialOptions 标注无需检定的选项：规则难度不高于阈值的直接标注；
+// AI标注的只在低风险且不属于必须检定的情况下保留
+func (ss *StoryService) markTrivialOptions(world *models.World, scene *models.Scene, character *models.Character,
+	options []models.Option) {
+
+	for i := range options {
+		opt := &options[i]
+		difficulty := ss.ruleEngine.CalculateDifficulty(scene.Type, opt.ActionType, character.Level, world.Difficulty)
+		if opt.PersonalityConflict != "" {
+			difficulty += personalityConflictPenalty
+		}
+		if ss.ruleEngine.IsTrivial(difficulty) {
+			opt.Trivial = true
+			continue
+		}
+		opt.Trivial = opt.Trivial && opt.Risk != "medium" && opt.Risk != "high" &&
+			trivialAllowed(scene, opt.ActionType, opt.PersonalityConflict)
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// defaultUndoConfig 未配置回退成本时的默认值：每局3次免费回退，之后每次消耗20点经验值
+func defaultUndoConfig() models.UndoConfig {
+	return models.UndoConfig{Free: 3, XPCost: 20}
+}
+
+// undoSettings 返回生效的回退配置，未配置的项使用默认值
+func undoSettings(cfg models.UndoConfig) models.UndoConfig {
+	defaults := defaultUndoConfig()
+	if cfg.Free == 0 {
+		cfg.Free = defaults.Free
+	}
+	if cfg.XPCost == 0 {
+		cfg.XPCost = defaults.XPCost
+	}
+	return cfg
+}
+
+// UndoStatus 计算故事当前的回退额度：剩余免费次数，以及免费次数用完后下一次回退的成本（已结束的故事不能回退）
+func (ss *StoryService) UndoStatus(story *models.StoryState) models.UndoStatus {
+	cfg := undoSettings(ss.meta.GameConfig().Undo)
+	status := models.UndoStatus{Used: story.UndoCount, Unlimited: cfg.Unlimited, Allowed: story.Status == "active"}
+	if cfg.Unlimited || !status.Allowed {
+		return status
+	}
+
+	status.FreeLeft = max(max(cfg.Free, 0)-story.UndoCount, 0)
+	if status.FreeLeft == 0 {
+		status.Allowed = cfg.XPCost > 0
+		status.XPCost = max(cfg.XPCost, 0)
+	}
+	return status
+}
+
+// undoCost 校验一次回退的成本：有免费次数时为0，否则为需要消耗的经验值；
+// 配置禁止付费回退时返回错误。只做校验，经验值由回退和恢复的状态一起扣除保存
+func (ss *StoryService) undoCost(story *models.StoryState) (int, error) {
+	status := ss.UndoStatus(story)
+	if !status.Allowed {
+		return 0, fmt.Errorf("%w: 本局的 %d 次回退机会已经用完", ErrUndoUnavailable, status.Used)
+	}
+	return status.XPCost, nil
+}
+
+// payUndoCost 在内存中从角色身上扣除回退的经验值成本，经验值不足时返回错误，不做任何修改
+func payUndoCost(char *models.Character, cost int) error {
+	if cost == 0 {
+		return nil
+	}
+	if err := spendXP(char, cost); err != nil {
+		return fmt.Errorf("回退需要消耗经验值: %w", err)
+	}
+	log.Printf("⏪ [回退] 免费次数已用完，消耗 %d 点经验值（剩余 %d）\n", cost, char.XP)
+	return nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateUniverse 创建世界宇宙，用来把同一部小说不同篇章的世界归为一组
+func (ws *WorldService) CreateUniverse(name, description string) (*models.Universe, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: 宇宙名称不能为空", ErrInvalidInput)
+	}
+
+	universe := &models.Universe{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		CreatedAt:   time.Now(),
+	}
+	if err := ws.storage.CreateUniverse(universe); err != nil {
+		return nil, fmt.Errorf("保存宇宙失败: %w", err)
+	}
+	return universe, nil
+}
+
+// GetUniverse 获取宇宙信息
+func (ws *WorldService) GetUniverse(universeID string) (*models.Universe, error) {
+	return ws.storage.GetUniverse(universeID)
+}
+
+// ListUniverses 分页获取宇宙列表及记录计数
+func (ws *WorldService) ListUniverses(page models.Page) ([]models.Universe, models.ListCount, error) {
+	return ws.storage.GetUniverses(page)
+}
+
+// DeleteUniverse 删除宇宙，归属的世界变回独立世界，世界和其中的故事不受影响
+func (ws *WorldService) DeleteUniverse(universeID string) error {
+	if err := ws.storage.DeleteUniverse(universeID); err != nil {
+		return fmt.Errorf("删除宇宙失败: %w", err)
+	}
+	return nil
+}
+
+// SetWorldUniverse 把世界归入宇宙，universeID 为空时移出所属宇宙
+func (ws *WorldService) SetWorldUniverse(worldID, universeID string) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+	if universeID != "" {
+		if _, err := ws.storage.GetUniverse(universeID); err != nil {
+			return nil, fmt.Errorf("获取宇宙失败: %w", err)
+		}
+	}
+
+	world.UniverseID = universeID
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+	return world, nil
+}
+
+// inheritUniverse 角色进入宇宙中的世界时，继承在同一宇宙其他世界积累的声望（取平均），
+// 并按名字沿用已结识NPC的好感；独立世界或角色还没去过同宇宙的其他世界时不做改动
+func (ms *MetaService) inheritUniverse(state *models.CharacterState, world *models.World) error {
+	if world.UniverseID == "" {
+		return nil
+	}
+	siblings, err := ms.storage.GetUniverseCharacterStates(state.CharacterID, world.UniverseID, world.ID)
+	if err != nil || len(siblings) == 0 {
+		return err
+	}
+
+	worldIDs := make([]string, len(siblings))
+	for i, sibling := range siblings {
+		worldIDs[i] = sibling.WorldID
+	}
+	worlds, err := ms.storage.GetWorldsByIDs(worldIDs)
+	if err != nil {
+		return err
+	}
+
+	// 同名NPC视为同一个人（不同世界的NPC ID互不相通）
+	reputation := 0
+	known := make(map[string][]int)
+	for _, sibling := range siblings {
+		reputation += sibling.Reputation
+		siblingWorld, ok := worlds[sibling.WorldID]
+		if !ok {
+			continue
+		}
+		for _, npc := range siblingWorld.NPCs {
+			if relation, ok := sibling.Relations[npc.ID]; ok {
+				known[npc.Name] = append(known[npc.Name], relation)
+			}
+		}
+	}
+	state.Reputation = reputation / len(siblings)
+	state.Relations = ms.initRelations(world, state.Reputation)
+
+	var recognized []string
+	for _, npc := range world.NPCs {
+		relations, ok := known[npc.Name]
+		if !ok {
+			continue
+		}
+		sum := 0
+		for _, relation := range relations {
+			sum += relation
+		}
+		state.Relations[npc.ID] = sum / len(relations)
+		recognized = append(recognized, npc.Name)
+	}
+
+	log.Printf("🌌 [世界宇宙] 角色带着 %d 个世界的经历进入「%s」：声望 %d，认出 %d 位旧识 %v\n",
+		len(siblings), world.Name, state.Reputation, len(recognized), recognized)
+	return nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// defaultWorldDangerConfig 世界难度影响初始HP/SAN的默认配置
+func defaultWorldDangerConfig() models.WorldDangerConfig {
+	return models.WorldDangerConfig{Baseline: 3, Step: 0.05, MaxReduction: 0.4}
+}
+
+// worldDangerSettings 返回生效的配置，未配置的项使用默认值
+func worldDangerSettings(cfg models.WorldDangerConfig) models.WorldDangerConfig {
+	defaults := defaultWorldDangerConfig()
+	if cfg.Baseline <= 0 {
+		cfg.Baseline = defaults.Baseline
+	}
+	if cfg.Step == 0 {
+		cfg.Step = defaults.Step
+	}
+	if cfg.MaxReduction <= 0 {
+		cfg.MaxReduction = defaults.MaxReduction
+	}
+	return cfg
+}
+
+// worldDangerReduction 角色进入世界时HP/SAN上限降低的比例（0表示不降低）
+func worldDangerReduction(cfg models.WorldDangerConfig, difficulty, level int) float64 {
+	cfg = worldDangerSettings(cfg)
+	if cfg.Step < 0 {
+		return 0
+	}
+	gap := difficulty - max(cfg.Baseline, level)
+	if gap <= 0 {
+		return 0
+	}
+	return min(float64(gap)*cfg.Step, cfg.MaxReduction)
+}
+
+// dangerousVitals 按世界难度和角色等级计算进入世界时的HP/SAN上限
+func dangerousVitals(cfg models.GameConfig, difficulty, level int) (maxHP, maxSAN int) {
+	keep := 1 - worldDangerReduction(cfg.WorldDanger, difficulty, level)
+	return int(math.Round(float64(cfg.DefaultHP) * keep)), int(math.Round(float64(cfg.DefaultSAN) * keep))
+}
+
+// describeWorldDanger 上限被世界难度压低时的开场提示（没有降低时为空）
+func describeWorldDanger(cfg models.GameConfig, world *models.World, charState *models.CharacterState) string {
+	if charState.MaxHP >= cfg.DefaultHP && charState.MaxSAN >= cfg.DefaultSAN {
+		return ""
+	}
+	return fmt.Sprintf("☠️ 这个世界很危险（难度 %d）：在这里你的HP上限只有 %d、理智上限只有 %d（平常为 %d/%d），每一次受伤都更加致命",
+		world.Difficulty, charState.MaxHP, charState.MaxSAN, cfg.DefaultHP, cfg.DefaultSAN)
+}
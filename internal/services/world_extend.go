@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+	"github.com/google/uuid"
+)
+
+// ExtendWorld 把小说的后续段落追加到已有世界：新NPC按名字去重合并，新剧情节点接到时间线末尾续编 order，
+// 并更新世界描述。已有NPC和剧情节点的ID保持不变，进行中的故事（当前节点、好感度、互动历史）不受影响，
+// 走到原时间线末尾的故事可以继续推进到新节点
+func (ws *WorldService) ExtendWorld(ctx context.Context, worldID, segmentText string) (*models.World, error) {
+	segmentText = normalizeSegmentText(segmentText)
+	if segmentText == "" {
+		return nil, fmt.Errorf("%w: 段落文本不能为空", ErrInvalidInput)
+	}
+
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	extension, err := ws.llm.ExtendWorld(ctx, world, segmentText)
+	if err != nil {
+		return nil, fmt.Errorf("解析后续段落失败: %w", err)
+	}
+
+	addedNPCs := mergeNPCs(world, extension.NPCs)
+	addedNodes := appendPlotNodes(world, extension.PlotLines)
+	if description := strings.TrimSpace(extension.Description); description != "" {
+		world.Description = description
+	}
+	if world.SegmentText == "" {
+		world.SegmentText = segmentText
+	} else {
+		world.SegmentText += "\n\n" + segmentText
+	}
+
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	log.Printf("📚 世界「%s」已追加后续内容：新增%d个NPC、%d个剧情节点\n", world.Name, addedNPCs, addedNodes)
+	return world, nil
+}
+
+// mergeNPCs 按名字把NPC合并进世界：已有NPC保留ID和原有设定，只补充新的特质、出现时段和关系；
+// 新NPC分配ID后追加。返回新增的NPC数
+func mergeNPCs(world *models.World, npcs []models.NPC) int {
+	added := 0
+	for _, npc := range npcs {
+		npc.Name = strings.TrimSpace(npc.Name)
+		if npc.Name == "" {
+			continue
+		}
+
+		existing := findNPC(world, npc.Name)
+		if existing == nil {
+			npc.ID = uuid.New().String()
+			world.NPCs = append(world.NPCs, npc)
+			added++
+			continue
+		}
+
+		if existing.Description == "" {
+			existing.Description = npc.Description
+		}
+		for _, trait := range npc.Traits {
+			if !containsString(existing.Traits, trait) {
+				existing.Traits = append(existing.Traits, trait)
+			}
+		}
+		// 原本全天都在的NPC不因新段落而受时段限制
+		if len(existing.Periods) > 0 {
+			for _, period := range npc.Periods {
+				if !containsString(existing.Periods, period) {
+					existing.Periods = append(existing.Periods, period)
+				}
+			}
+		}
+		for _, relation := range npc.Relations {
+			known := false
+			for _, r := range existing.Relations {
+				if r.Target == relation.Target {
+					known = true
+					break
+				}
+			}
+			if !known {
+				existing.Relations = append(existing.Relations, relation)
+			}
+		}
+	}
+	return added
+}
+
+// appendPlotNodes 把新剧情节点按 order 排序后接到时间线末尾，order 续编，ID 取 plot_<order>（与已有ID冲突时加后缀）。
+// 缺少名称的节点跳过，返回追加的节点数
+func appendPlotNodes(world *models.World, nodes []models.PlotNode) int {
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Order < nodes[j].Order })
+
+	ids := make(map[string]bool, len(world.PlotLines))
+	lastOrder := 0
+	for _, node := range world.PlotLines {
+		ids[node.ID] = true
+		lastOrder = max(lastOrder, node.Order)
+	}
+
+	added := 0
+	for _, node := range nodes {
+		if err := checkPlotNode(&node, world.NPCs); err != nil {
+			log.Printf("⚠️ 跳过不合法的剧情节点: %v\n", err)
+			continue
+		}
+		added++
+		node.Order = lastOrder + added
+		node.ID = fmt.Sprintf("plot_%d", node.Order)
+		for suffix := 2; ids[node.ID]; suffix++ {
+			node.ID = fmt.Sprintf("plot_%d_%d", node.Order, suffix)
+		}
+		ids[node.ID] = true
+		world.PlotLines = append(world.PlotLines, node)
+	}
+	return added
+}
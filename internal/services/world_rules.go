@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// ruleViolationMarker 叙事中的违反规则标记，格式：【违反规则】编号
+const ruleViolationMarker = "【违反规则】"
+
+const (
+	ruleViolationSANLoss = 20 // 违反世界规则必定损失的理智值
+	ruleViolationHPLoss  = 15 // 违反规则且检定失败时额外受到的伤害
+)
+
+// describeWorldRules 列出世界的禁忌规则，供生成场景时暗示给玩家（没有规则时返回空）
+func describeWorldRules(world *models.World) string {
+	if world == nil || len(world.Rules) == 0 {
+		return ""
+	}
+	var lines []string
+	for i, rule := range world.Rules {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, rule))
+	}
+	return fmt.Sprintf(`
+**世界规则（禁忌）：**
+%s
+这些规则在这个世界里真实有效。请在场景中通过告示、传闻、NPC的警告或诡异的细节暗示它们，但不要直接说明违反的后果。
+`, strings.Join(lines, "\n"))
+}
+
+// describeRuleCheck 列出世界规则，并说明违反标记的用法（没有规则时返回空）
+func describeRuleCheck(world *models.World) string {
+	if world == nil || len(world.Rules) == 0 {
+		return ""
+	}
+	var lines []string
+	for i, rule := range world.Rules {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, rule))
+	}
+	return fmt.Sprintf(`
+**世界规则（禁忌）：**
+%s
+如果玩家这次的行动违反了其中某条规则，叙事中要出现规则反噬的恐怖后果，并在叙事最后单独一行加上：%s编号（如 %s1）。没有违反就不要加。
+`, strings.Join(lines, "\n"), ruleViolationMarker, ruleViolationMarker)
+}
+
+// extractRuleViolations 从叙事中取出违反规则标记，返回去掉标记后的叙事和违反的规则编号（从1开始）
+func extractRuleViolations(narrative string) (string, []int) {
+	return extractMarkerIndexes(narrative, ruleViolationMarker)
+}
+
+// ruleViolationChanges 计算违反规则的后果：必定损失理智，检定失败时受伤，大失败时直接死亡。
+// 编号无效或重复的忽略
+func ruleViolationChanges(world *models.World, indexes []int, diceRoll *models.DiceRoll,
+	charState *models.CharacterState) models.StateChanges {
+	var changes models.StateChanges
+	for _, n := range indexes {
+		if n < 1 || n > len(world.Rules) || containsString(changes.RulesViolated, world.Rules[n-1]) {
+			continue
+		}
+		changes.RulesViolated = append(changes.RulesViolated, world.Rules[n-1])
+	}
+	if len(changes.RulesViolated) == 0 {
+		return changes
+	}
+
+	changes.SANChange = -ruleViolationSANLoss * len(changes.RulesViolated)
+	switch {
+	case diceRoll.Critical && !diceRoll.Success:
+		changes.HPChange = -charState.HP
+	case !diceRoll.Success:
+		changes.HPChange = -ruleViolationHPLoss
+	}
+	return changes
+}
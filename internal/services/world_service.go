@@ -4,6 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aiwuxian/project-abyss/internal/models"
@@ -11,6 +15,33 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	maxWorldTags      = 10 // 每个世界最多的标签数
+	maxWorldTagLength = 12 // 单个标签最多的字数
+
+	maxWorldRules      = 10  // 每个世界最多的规则数
+	maxWorldRuleLength = 100 // 单条规则最多的字数
+
+	maxAttributeModifier = 5 // 世界自定义属性加成的绝对值上限
+)
+
+// themeColorPattern 主题色格式：#RRGGBB
+var themeColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// genreTags 世界类型对应的自动标签
+var genreTags = map[string]string{
+	"fantasy":       "奇幻",
+	"urban":         "都市",
+	"scifi":         "科幻",
+	"romance":       "恋爱",
+	"slice_of_life": "日常",
+	"school":        "校园",
+	"workplace":     "职场",
+	"mystery":       "悬疑",
+	"adventure":     "冒险",
+	"horror":        "恐怖",
+}
+
 type WorldService struct {
 	storage *storage.Storage
 	llm     *LLMService
@@ -30,6 +61,14 @@ func (ws *WorldService) GetStorage() *storage.Storage {
 
 // CreateWorldFromSegment 从小说段落创建世界
 func (ws *WorldService) CreateWorldFromSegment(ctx context.Context, segmentText string) (*models.World, error) {
+	segmentText = normalizeSegmentText(segmentText)
+	if segmentText == "" {
+		return nil, fmt.Errorf("%w: 段落文本不能为空", ErrInvalidInput)
+	}
+	if lang := detectLanguage(segmentText); lang != langChinese {
+		log.Printf("🌐 检测到%s原文，将以中文生成世界信息\n", languageNames[lang])
+	}
+
 	// 使用LLM解析段落
 	world, err := ws.llm.ParseSegment(ctx, segmentText)
 	if err != nil {
@@ -47,6 +86,9 @@ func (ws *WorldService) CreateWorldFromSegment(ctx context.Context, segmentText
 		}
 	}
 
+	// 按类型补充自动标签
+	world.Tags = normalizeTags(append([]string{genreTag(world.Genre)}, world.Tags...))
+
 	// 生成ID和时间戳
 	world.ID = uuid.New().String()
 	world.CreatedAt = time.Now()
@@ -56,6 +98,19 @@ func (ws *WorldService) CreateWorldFromSegment(ctx context.Context, segmentText
 		world.NPCs[i].ID = uuid.New().String()
 	}
 
+	// 剧情线按 order 排序并生成 plot_<order> 形式的稳定ID；没有可用节点时先不保存剧情线，
+	// 世界照常创建，之后可以单独重新生成剧情线
+	if len(world.PlotLines) > 0 {
+		plotLines, err := normalizePlotLines(world.PlotLines, world.NPCs)
+		if err != nil {
+			log.Printf("⚠️ 解析出的剧情线不合法，已忽略（可稍后重新生成剧情线）: %v\n", err)
+		}
+		world.PlotLines = plotLines
+	}
+	if len(world.PlotLines) == 0 {
+		log.Printf("⚠️ 世界「%s」没有剧情线，剧情推进不会生效\n", world.Name)
+	}
+
 	// 保存到数据库
 	if err := ws.storage.CreateWorld(world); err != nil {
 		return nil, fmt.Errorf("保存世界失败: %w", err)
@@ -69,9 +124,256 @@ func (ws *WorldService) GetWorld(worldID string) (*models.World, error) {
 	return ws.storage.GetWorld(worldID)
 }
 
+// DeleteWorld 删除世界及其场景等附属数据；还有故事在这个世界中时拒绝删除
+func (ws *WorldService) DeleteWorld(worldID string) error {
+	if err := ws.storage.DeleteWorld(worldID); err != nil {
+		return fmt.Errorf("删除世界失败: %w", err)
+	}
+	log.Printf("🗑️ 删除了世界 %s\n", worldID)
+	return nil
+}
+
+// GetScene 获取场景
+func (ws *WorldService) GetScene(sceneID string) (*models.Scene, error) {
+	return ws.storage.GetScene(sceneID)
+}
+
+// ListWorlds 分页获取世界列表及记录计数，可按标签和收藏过滤
+func (ws *WorldService) ListWorlds(filter models.WorldFilter, page models.Page) ([]models.World, models.ListCount, error) {
+	return ws.storage.GetWorlds(filter, page)
+}
+
+// UpdateTags 替换世界的标签
+func (ws *WorldService) UpdateTags(worldID string, tags []string) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	tags = normalizeTags(tags)
+	if len(tags) > maxWorldTags {
+		return nil, fmt.Errorf("%w: 标签最多%d个", ErrInvalidInput, maxWorldTags)
+	}
+	for _, tag := range tags {
+		if len([]rune(tag)) > maxWorldTagLength {
+			return nil, fmt.Errorf("%w: 标签「%s」超过%d个字", ErrInvalidInput, tag, maxWorldTagLength)
+		}
+	}
+
+	world.Tags = tags
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	return world, nil
+}
+
+// UpdateRules 替换世界的禁忌规则，规则编号按顺序计算，进行中的故事下回合即生效
+func (ws *WorldService) UpdateRules(worldID string, rules []string) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	rules = normalizeTags(rules)
+	if len(rules) > maxWorldRules {
+		return nil, fmt.Errorf("%w: 规则最多%d条", ErrInvalidInput, maxWorldRules)
+	}
+	for _, rule := range rules {
+		if len([]rune(rule)) > maxWorldRuleLength {
+			return nil, fmt.Errorf("%w: 规则「%s」超过%d个字", ErrInvalidInput, rule, maxWorldRuleLength)
+		}
+	}
+
+	world.Rules = rules
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	return world, nil
+}
+
+// UpdateAttributeModifiers 设置世界自定义的属性加成，传空时恢复使用类型默认加成。
+// 只影响之后新进入该世界的角色
+func (ws *WorldService) UpdateAttributeModifiers(worldID string, modifiers map[string]int) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	for attr, mod := range modifiers {
+		if !containsString(attributeNames, attr) {
+			return nil, fmt.Errorf("%w: 未知属性「%s」", ErrInvalidInput, attr)
+		}
+		if mod > maxAttributeModifier || mod < -maxAttributeModifier {
+			return nil, fmt.Errorf("%w: 属性加成需在±%d以内", ErrInvalidInput, maxAttributeModifier)
+		}
+	}
+
+	world.AttributeModifiers = modifiers
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	return world, nil
+}
+
+// GenerateCoverPrompt 让AI根据世界描述生成封面绘图提示词和主题色并保存，
+// 实际出图交给外部服务，生成后通过 UpdateCover 回填地址
+func (ws *WorldService) GenerateCoverPrompt(ctx context.Context, worldID string) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	coverPrompt, themeColor, err := ws.llm.GenerateCoverPrompt(ctx, world)
+	if err != nil {
+		return nil, fmt.Errorf("生成封面提示词失败: %w", err)
+	}
+	if coverPrompt == "" {
+		return nil, fmt.Errorf("%w: 封面提示词为空", ErrLLMInvalidResponse)
+	}
+
+	world.CoverPrompt = coverPrompt
+	if themeColorPattern.MatchString(themeColor) {
+		world.ThemeColor = strings.ToUpper(themeColor)
+	} else {
+		log.Printf("⚠️ AI返回的主题色格式无效，已忽略: %s\n", themeColor)
+	}
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	log.Printf("🎨 世界「%s」的封面提示词已生成\n", world.Name)
+	return world, nil
+}
+
+// UpdateCover 回填外部生成的封面地址和主题色，传空字符串表示清除
+func (ws *WorldService) UpdateCover(worldID, coverURL, themeColor string) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	coverURL = strings.TrimSpace(coverURL)
+	if coverURL != "" {
+		parsed, err := url.Parse(coverURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: 封面地址必须是 http(s) 链接", ErrInvalidInput)
+		}
+	}
+	themeColor = strings.TrimSpace(themeColor)
+	if themeColor != "" && !themeColorPattern.MatchString(themeColor) {
+		return nil, fmt.Errorf("%w: 主题色格式应为 #RRGGBB", ErrInvalidInput)
+	}
+
+	world.CoverURL = coverURL
+	world.ThemeColor = strings.ToUpper(themeColor)
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	return world, nil
+}
+
+// RegeneratePlotLines 仅基于原始段落和现有NPC重新生成世界的剧情线并覆盖保存，其他信息不变。
+// 节点ID统一按顺序重排为 plot_1、plot_2...，进行中的故事会落到同序号的新节点上
+func (ws *WorldService) RegeneratePlotLines(ctx context.Context, worldID string) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+	if strings.TrimSpace(world.SegmentText) == "" {
+		return nil, fmt.Errorf("%w: 世界没有原始段落，无法重新生成剧情线", ErrInvalidInput)
+	}
+
+	plotLines, err := ws.llm.GeneratePlotLines(ctx, world)
+	if err != nil {
+		return nil, fmt.Errorf("生成剧情线失败: %w", err)
+	}
+	plotLines, err = normalizePlotLines(plotLines, world.NPCs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrLLMInvalidResponse, err)
+	}
+
+	world.PlotLines = plotLines
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	log.Printf("📜 世界「%s」的剧情线已重新生成，共%d个节点\n", world.Name, len(plotLines))
+	return world, nil
+}
+
+// normalizePlotLines 整理剧情节点：按 order 排序后从1连续重编 order 和 plot_<order> 形式的ID，
+// 难度限制在1-10，去掉未知时段和不存在的关键NPC。缺少名称的节点无法使用，单独跳过；
+// 一个可用节点都没有时返回错误
+func normalizePlotLines(plotLines []models.PlotNode, npcs []models.NPC) ([]models.PlotNode, error) {
+	sort.SliceStable(plotLines, func(i, j int) bool { return plotLines[i].Order < plotLines[j].Order })
+
+	normalized := make([]models.PlotNode, 0, len(plotLines))
+	for _, node := range plotLines {
+		if err := checkPlotNode(&node, npcs); err != nil {
+			log.Printf("⚠️ 跳过不合法的剧情节点: %v\n", err)
+			continue
+		}
+		node.Order = len(normalized) + 1
+		node.ID = fmt.Sprintf("plot_%d", node.Order)
+		normalized = append(normalized, node)
+	}
+
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("剧情线为空")
+	}
+	return normalized, nil
+}
+
+// checkPlotNode 校验并修正单个剧情节点：缺少名称时返回错误；难度限制在1-10，去掉未知时段和不存在的关键NPC
+func checkPlotNode(node *models.PlotNode, npcs []models.NPC) error {
+	if strings.TrimSpace(node.Name) == "" {
+		return fmt.Errorf("第%d个剧情节点缺少名称", node.Order)
+	}
+	node.Difficulty = max(1, min(node.Difficulty, 10))
+
+	periods := []string{}
+	for _, period := range node.Periods {
+		if containsString(gamePeriods, period) {
+			periods = append(periods, period)
+		}
+	}
+	node.Periods = periods
+
+	keyNPCs := []string{}
+	for _, name := range node.KeyNPCs {
+		for _, npc := range npcs {
+			if npc.Name == name {
+				keyNPCs = append(keyNPCs, name)
+				break
+			}
+		}
+	}
+	node.KeyNPCs = keyNPCs
+	return nil
+}
+
+// SetFavorite 收藏或取消收藏世界
+func (ws *WorldService) SetFavorite(worldID string, favorite bool) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	world.Favorite = favorite
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	return world, nil
+}
+
 // GenerateStartScene 为世界生成开场场景
 func (ws *WorldService) GenerateStartScene(ctx context.Context, world *models.World, character *models.Character) (*models.Scene, error) {
-	scene, err := ws.llm.GenerateScene(ctx, world, character)
+	scene, err := ws.llm.GenerateScene(ctx, world, character, describeTimeContext(world, 1, gamePeriods[0]), "")
 	if err != nil {
 		return nil, err
 	}
@@ -85,3 +387,50 @@ func (ws *WorldService) GenerateStartScene(ctx context.Context, world *models.Wo
 
 	return scene, nil
 }
+
+// UpdateEndings 设置世界的条件结局
+func (ws *WorldService) UpdateEndings(worldID string, endings []models.EndingDef) (*models.World, error) {
+	world, err := ws.storage.GetWorld(worldID)
+	if err != nil {
+		return nil, fmt.Errorf("获取世界失败: %w", err)
+	}
+
+	for i := range endings {
+		if endings[i].ID == "" {
+			endings[i].ID = uuid.New().String()
+		}
+		if endings[i].ID == DefaultEndingID {
+			return nil, fmt.Errorf("%w: 结局ID不能使用保留值: %s", ErrInvalidInput, DefaultEndingID)
+		}
+		for _, cond := range endings[i].Conditions {
+			if !validEndingConditionTypes[cond.Type] {
+				return nil, fmt.Errorf("%w: 结局「%s」包含未知的条件类型: %s", ErrInvalidInput, endings[i].Name, cond.Type)
+			}
+		}
+	}
+
+	world.Endings = endings
+	if err := ws.storage.UpdateWorld(world); err != nil {
+		return nil, fmt.Errorf("保存世界失败: %w", err)
+	}
+
+	return world, nil
+}
+
+// genreTag 返回世界类型对应的标签，未知类型返回空
+func genreTag(genre string) string {
+	return genreTags[genre]
+}
+
+// normalizeTags 去掉首尾空白、空标签和重复标签，保持原有顺序
+func normalizeTags(tags []string) []string {
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || containsString(result, tag) {
+			continue
+		}
+		result = append(result, tag)
+	}
+	return result
+}
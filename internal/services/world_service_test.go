@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+func TestNormalizePlotLines(t *testing.T) {
+	npcs := []models.NPC{{Name: "艾琳"}}
+	plotLines := []models.PlotNode{
+		{Order: 7, Name: "灯塔之夜", Difficulty: 15, Periods: []string{"night", "midnight"}},
+		{Order: 2, Name: "", Difficulty: 3},
+		{Order: 3, Name: "酒馆打听", Difficulty: 0, KeyNPCs: []string{"艾琳", "不存在的人"}},
+		{Order: 3, Name: "码头", Difficulty: 5},
+	}
+
+	normalized, err := normalizePlotLines(plotLines, npcs)
+	if err != nil {
+		t.Fatalf("整理剧情线失败: %v", err)
+	}
+
+	want := []struct {
+		id         string
+		name       string
+		difficulty int
+	}{
+		{"plot_1", "酒馆打听", 1},
+		{"plot_2", "码头", 5},
+		{"plot_3", "灯塔之夜", 10},
+	}
+	if len(normalized) != len(want) {
+		t.Fatalf("应保留 %d 个节点（跳过缺少名称的），实际 %d", len(want), len(normalized))
+	}
+	for i, w := range want {
+		node := normalized[i]
+		if node.ID != w.id || node.Order != i+1 || node.Name != w.name || node.Difficulty != w.difficulty {
+			t.Errorf("第%d个节点应为 %s/%d/%s/难度%d，实际 %s/%d/%s/难度%d",
+				i+1, w.id, i+1, w.name, w.difficulty, node.ID, node.Order, node.Name, node.Difficulty)
+		}
+	}
+	if got := normalized[0].KeyNPCs; len(got) != 1 || got[0] != "艾琳" {
+		t.Errorf("不存在的关键NPC应被去掉，实际 %v", got)
+	}
+	if got := normalized[2].Periods; len(got) != 1 || got[0] != "night" {
+		t.Errorf("未知时段应被去掉，实际 %v", got)
+	}
+}
+
+func TestNormalizePlotLinesWithoutUsableNodes(t *testing.T) {
+	if _, err := normalizePlotLines([]models.PlotNode{{Order: 1, Name: " "}}, nil); err == nil {
+		t.Error("没有可用节点时应返回错误")
+	}
+	if _, err := normalizePlotLines(nil, nil); err == nil {
+		t.Error("剧情线为空时应返回错误")
+	}
+}
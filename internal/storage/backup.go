@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Path 返回数据库文件路径（内存库为 MemoryPath）
+func (s *Storage) Path() string {
+	return s.path
+}
+
+// Backup 用 VACUUM INTO 把整个数据库写成一份一致性快照（目标文件必须不存在）。
+// 快照只占用一个读事务，WAL 模式下不阻塞其他请求的读写
+func (s *Storage) Backup(destPath string) error {
+	if _, err := s.db.Exec(`VACUUM INTO ?`, destPath); err != nil {
+		return fmt.Errorf("备份数据库失败: %w", err)
+	}
+	return nil
+}
+
+// TableCounts 统计每张表的记录数
+func (s *Storage) TableCounts() (map[string]int, error) {
+	tables, err := s.tables()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(tables))
+	for _, table := range tables {
+		var count int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM ` + quoteIdent(table)).Scan(&count); err != nil {
+			return nil, err
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+// CheckIntegrity 执行 SQLite 完整性检查，数据库损坏时返回错误
+func (s *Storage) CheckIntegrity() error {
+	var result string
+	if err := s.db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("数据库已损坏: %s", result)
+	}
+	return nil
+}
+
+// RestoreFrom 用备份文件中的数据替换当前数据库的全部数据，返回每张表恢复的记录数。
+// 整个替换在一个事务中完成，失败时原数据保持不变。备份文件会先升级到当前的表结构，
+// 旧版本的备份也能恢复（新增的列取默认值）
+func (s *Storage) RestoreFrom(backupPath string) (map[string]int, error) {
+	backup, err := New(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开备份失败: %w", err)
+	}
+	err = backup.CheckIntegrity()
+	backup.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := s.tables()
+	if err != nil {
+		return nil, err
+	}
+
+	// ATTACH 只对单个连接生效，恢复过程必须固定在同一个连接上
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS backup`, backupPath); err != nil {
+		return nil, fmt.Errorf("挂载备份失败: %w", err)
+	}
+	defer conn.ExecContext(ctx, `DETACH DATABASE backup`)
+
+	columns := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		if columns[table], err = sharedColumns(ctx, conn, table); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	restored := make(map[string]int, len(tables))
+	for _, table := range tables {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM main.`+quoteIdent(table)); err != nil {
+			return nil, fmt.Errorf("清空表 %s 失败: %w", table, err)
+		}
+		if len(columns[table]) == 0 {
+			continue // 备份里没有这张表
+		}
+		list := strings.Join(columns[table], ", ")
+		result, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO main.%s (%s) SELECT %s FROM backup.%s`,
+			quoteIdent(table), list, list, quoteIdent(table)))
+		if err != nil {
+			return nil, fmt.Errorf("恢复表 %s 失败: %w", table, err)
+		}
+		count, _ := result.RowsAffected()
+		restored[table] = int(count)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// tables 返回数据库中的所有数据表
+func (s *Storage) tables() ([]string, error) {
+	// 只取普通表：全文索引的虚拟表和影子表由触发器随原表重建，不能直接复制
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// sharedColumns 返回当前库和备份库中同一张表共有的列（已加引号），备份中没有这张表时返回空。
+// 按列名对应而不是按位置，迁移新增的列在两边的位置可能不同
+func sharedColumns(ctx context.Context, conn *sql.Conn, table string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT m.name FROM pragma_table_info(?, 'main') m
+		JOIN pragma_table_info(?, 'backup') b ON b.name = m.name
+		ORDER BY m.cid
+	`, table, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, quoteIdent(name))
+	}
+	return columns, rows.Err()
+}
+
+// quoteIdent 给表名、列名加上双引号
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
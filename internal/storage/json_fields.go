@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// jsonFields 依次解析一行记录中的JSON列并收集解析错误。
+// 损坏的列不能静默解析成零值：否则调用方会拿到空属性、空NPC，下次保存时还会把空值写回，真正丢失数据
+type jsonFields struct {
+	errs []string
+}
+
+// decode 解析一列JSON，空字符串视为未填写
+func (f *jsonFields) decode(column, data string, v interface{}) {
+	if data == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		f.errs = append(f.errs, fmt.Sprintf("%s（%v）", column, err))
+	}
+}
+
+// err 汇总解析错误，table 和 id 用于定位损坏的记录；没有错误时返回 nil
+func (f *jsonFields) err(table, id string) error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s 的字段 %s", ErrCorruptData, table, id, strings.Join(f.errs, "、"))
+}
+
+// corruptRows 列表查询中统计无法读取的记录（字段类型不符或JSON损坏）：坏记录跳过并记录日志，
+// 不让一条坏数据拖垮整个列表；按ID读取单条记录时仍然返回错误
+type corruptRows struct {
+	list  string
+	count int
+}
+
+// skip 跳过一条无法读取的记录
+func (c *corruptRows) skip(err error) {
+	c.count++
+	log.Printf("⚠️ [数据损坏] %s中有一条记录无法读取，已跳过: %v\n", c.list, err)
+}
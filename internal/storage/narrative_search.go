@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// minFTSQueryRunes trigram 全文索引能匹配的最短关键词，更短的关键词改为在本故事的条目中逐条查找
+const minFTSQueryRunes = 3
+
+// syncNarrativeIndex 让故事的叙事索引与叙事日志一致：通常只追加新条目；
+// 日志变短（回退）时删掉多出的条目，已索引的最后一条对不上（日志被改写）时整个故事重建
+func syncNarrativeIndex(tx *sql.Tx, storyID string, narrative []models.NarrativeLog) error {
+	var indexed int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM narrative_entries WHERE story_id = ?`, storyID).Scan(&indexed); err != nil {
+		return err
+	}
+
+	if indexed > len(narrative) {
+		if _, err := tx.Exec(`DELETE FROM narrative_entries WHERE story_id = ? AND seq >= ?`, storyID, len(narrative)); err != nil {
+			return err
+		}
+		indexed = len(narrative)
+	}
+	if indexed > 0 {
+		var last string
+		if err := tx.QueryRow(`SELECT content FROM narrative_entries WHERE story_id = ? AND seq = ?`,
+			storyID, indexed-1).Scan(&last); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if last != narrative[indexed-1].Content {
+			if _, err := tx.Exec(`DELETE FROM narrative_entries WHERE story_id = ?`, storyID); err != nil {
+				return err
+			}
+			indexed = 0
+		}
+	}
+
+	for seq := indexed; seq < len(narrative); seq++ {
+		entry := narrative[seq]
+		if _, err := tx.Exec(`
+			INSERT INTO narrative_entries (story_id, seq, turn, type, content) VALUES (?, ?, ?, ?, ?)
+		`, storyID, seq, entry.Turn, entry.Type, entry.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchNarrative 在故事的叙事日志中全文搜索关键词，按出现顺序分页返回匹配的条目。
+// 搜索前先补齐索引（兼容索引上线前的旧故事）。同时返回命中总数和本页跳过的损坏记录数
+func (s *Storage) SearchNarrative(story *models.StoryState, query string, page models.Page) ([]models.NarrativeMatch, models.ListCount, error) {
+	var count models.ListCount
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, count, err
+	}
+	defer tx.Rollback()
+	if err := syncNarrativeIndex(tx, story.ID, story.Narrative); err != nil {
+		return nil, count, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, count, err
+	}
+
+	from := `FROM narrative_entries e WHERE e.story_id = ? AND instr(e.content, ?) > 0`
+	args := []interface{}{story.ID, query}
+	if len([]rune(query)) >= minFTSQueryRunes {
+		from = `FROM narrative_fts f JOIN narrative_entries e ON e.id = f.rowid
+			WHERE narrative_fts MATCH ? AND e.story_id = ?`
+		args = []interface{}{`"` + strings.ReplaceAll(query, `"`, `""`) + `"`, story.ID}
+	}
+
+	if err := s.db.QueryRow(`SELECT COUNT(*) `+from, args...).Scan(&count.Total); err != nil {
+		return nil, count, err
+	}
+
+	page = NormalizePage(page)
+	rows, err := s.db.Query(`SELECT e.seq, e.turn, COALESCE(e.type, ''), e.content `+from+` ORDER BY e.seq LIMIT ? OFFSET ?`,
+		append(args, page.Limit, page.Offset)...)
+	if err != nil {
+		return nil, count, err
+	}
+	defer rows.Close()
+
+	matches := []models.NarrativeMatch{}
+	corrupt := corruptRows{list: "叙事搜索结果"}
+	for rows.Next() {
+		var match models.NarrativeMatch
+		if err := rows.Scan(&match.Index, &match.Turn, &match.Type, &match.Content); err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		matches = append(matches, match)
+	}
+	count.Corrupt = corrupt.count
+	return matches, count, rows.Err()
+}
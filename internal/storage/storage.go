@@ -3,35 +3,66 @@ package storage
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/aiwuxian/project-abyss/internal/models"
 	_ "modernc.org/sqlite"
 )
 
+// ErrVersionConflict 乐观锁校验失败：记录已被其他请求更新
+var ErrVersionConflict = errors.New("数据已被其他请求更新，请刷新后重试")
+
+// ErrCorruptData 记录中的JSON字段已损坏，无法解析
+var ErrCorruptData = errors.New("数据已损坏")
+
+// ErrInUse 记录仍被其他数据引用，不能删除
+var ErrInUse = errors.New("仍有关联数据，无法删除")
+
+// MemoryPath 使用SQLite内存数据库的特殊路径（不落盘，进程退出后数据丢失，用于测试和演示）
+const MemoryPath = ":memory:"
+
 type Storage struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
 }
 
 func New(dbPath string) (*Storage, error) {
-	// 确保目录存在
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, fmt.Errorf("创建数据目录失败: %w", err)
+	inMemory := dbPath == MemoryPath
+	if !inMemory {
+		// 确保目录存在
+		dir := filepath.Dir(dbPath)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建数据目录失败: %w", err)
+		}
 	}
 
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("打开数据库失败: %w", err)
 	}
+	if inMemory {
+		// 内存库的每个连接都是一个独立的空库，必须始终复用同一个连接
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+		db.SetConnMaxIdleTime(0)
+	} else if _, err := db.Exec(`PRAGMA journal_mode=WAL`); err != nil {
+		// WAL 模式下备份等长时间的读不会阻塞写入
+		return nil, fmt.Errorf("设置日志模式失败: %w", err)
+	}
 
-	s := &Storage{db: db}
+	s := &Storage{db: db, path: dbPath}
 	if err := s.initSchema(); err != nil {
 		return nil, fmt.Errorf("初始化数据库结构失败: %w", err)
 	}
+	if err := s.migrate(); err != nil {
+		return nil, fmt.Errorf("迁移数据库结构失败: %w", err)
+	}
 
 	return s, nil
 }
@@ -51,6 +82,8 @@ func (s *Storage) initSchema() error {
 		xp INTEGER DEFAULT 0,
 		traits TEXT, -- JSON array
 		inventory TEXT, -- JSON array
+		equipment TEXT DEFAULT '{}', -- JSON object
+		version INTEGER DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -66,6 +99,22 @@ func (s *Storage) initSchema() error {
 		goals TEXT, -- JSON array
 		npcs TEXT, -- JSON array
 		plot_lines TEXT, -- JSON array
+		endings TEXT DEFAULT '[]', -- JSON array
+		tags TEXT DEFAULT '[]', -- JSON array
+		favorite INTEGER DEFAULT 0,
+		attribute_modifiers TEXT DEFAULT '{}', -- JSON object
+		rules TEXT DEFAULT '[]', -- JSON array
+		cover_prompt TEXT DEFAULT '',
+		cover_url TEXT DEFAULT '',
+		theme_color TEXT DEFAULT '',
+		universe_id TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS universes (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -79,6 +128,8 @@ func (s *Storage) initSchema() error {
 		attributes TEXT, -- JSON object
 		status TEXT, -- JSON array
 		relations TEXT, -- JSON object
+		morality INTEGER DEFAULT 0,
+		reputation INTEGER DEFAULT 0,
 		PRIMARY KEY (character_id, world_id),
 		FOREIGN KEY (character_id) REFERENCES characters(id),
 		FOREIGN KEY (world_id) REFERENCES worlds(id)
@@ -92,6 +143,9 @@ func (s *Storage) initSchema() error {
 		type TEXT,
 		threats TEXT, -- JSON array
 		objectives TEXT, -- JSON array
+		interactables TEXT DEFAULT '[]', -- JSON array
+		exits TEXT DEFAULT '[]', -- JSON array
+		is_template INTEGER DEFAULT 0, -- 是否收入世界场景库，供之后开局复用
 		FOREIGN KEY (world_id) REFERENCES worlds(id)
 	);
 
@@ -100,10 +154,31 @@ func (s *Storage) initSchema() error {
 		character_id TEXT NOT NULL,
 		world_id TEXT NOT NULL,
 		scene_id TEXT,
+		current_plot_node_id TEXT DEFAULT '',
+		plot_progress REAL DEFAULT 0,
+		stalled_turns INTEGER DEFAULT 0,
+		undo_count INTEGER DEFAULT 0,
+		inspiration_uses TEXT DEFAULT '{}', -- JSON object
+		romance_stages TEXT DEFAULT '{}', -- JSON object
 		turn INTEGER DEFAULT 0,
+		day INTEGER DEFAULT 1,
+		period TEXT DEFAULT 'morning',
+		period_actions INTEGER DEFAULT 0,
 		narrative TEXT, -- JSON array
 		snapshots TEXT, -- JSON array
+		flags TEXT DEFAULT '[]', -- JSON array
+		chapters TEXT DEFAULT '[]', -- JSON array
+		pending_choice TEXT DEFAULT 'null', -- JSON object
+		attribute_map TEXT DEFAULT '{}', -- JSON object
+		char_state TEXT DEFAULT 'null', -- JSON object
+		branched_from TEXT DEFAULT '',
+		branch_turn INTEGER DEFAULT 0,
+		cycle INTEGER DEFAULT 1,
+		notes TEXT DEFAULT '',
+		npc_memories TEXT DEFAULT '{}', -- JSON object
 		status TEXT DEFAULT 'active',
+		ending_id TEXT DEFAULT '',
+		version INTEGER DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (character_id) REFERENCES characters(id),
@@ -125,6 +200,107 @@ func (s *Storage) initSchema() error {
 		FOREIGN KEY (world_id) REFERENCES worlds(id)
 	);
 
+	CREATE TABLE IF NOT EXISTS tasks (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		status TEXT NOT NULL,
+		result TEXT, -- JSON
+		error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS llm_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		call_type TEXT NOT NULL,
+		model TEXT,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		total_tokens INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS world_clears (
+		id TEXT PRIMARY KEY,
+		world_id TEXT NOT NULL,
+		story_id TEXT NOT NULL UNIQUE,
+		character_id TEXT NOT NULL,
+		character_name TEXT,
+		turns INTEGER NOT NULL,
+		days INTEGER DEFAULT 1,
+		ending_id TEXT,
+		maxed_relations INTEGER DEFAULT 0,
+		all_relations_maxed INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (world_id) REFERENCES worlds(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS state_change_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		story_id TEXT NOT NULL,
+		turn INTEGER NOT NULL,
+		action TEXT,
+		changes TEXT, -- JSON object
+		undone INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (story_id) REFERENCES story_states(id)
+	);
+
+	-- 每回合结算后的角色状态轨迹（只用于观测调平衡，不参与回退）
+	CREATE TABLE IF NOT EXISTS state_timeline (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		story_id TEXT NOT NULL,
+		turn INTEGER NOT NULL,
+		hp INTEGER,
+		max_hp INTEGER,
+		san INTEGER,
+		max_san INTEGER,
+		attributes TEXT, -- JSON object
+		relation_total INTEGER DEFAULT 0,
+		morality INTEGER DEFAULT 0,
+		undone INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (story_id) REFERENCES story_states(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_llm_usage_created ON llm_usage(created_at);
+	CREATE INDEX IF NOT EXISTS idx_state_change_log_story ON state_change_log(story_id, turn);
+	CREATE INDEX IF NOT EXISTS idx_state_timeline_story ON state_timeline(story_id, turn);
+	CREATE TABLE IF NOT EXISTS share_tokens (
+		token TEXT PRIMARY KEY,
+		resource_type TEXT NOT NULL,
+		resource_id TEXT NOT NULL,
+		permission TEXT NOT NULL DEFAULT 'read',
+		expires_at DATETIME,
+		revoked INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS narrative_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		story_id TEXT NOT NULL,
+		seq INTEGER NOT NULL, -- 在故事叙事日志中的下标
+		turn INTEGER NOT NULL,
+		type TEXT,
+		content TEXT NOT NULL,
+		UNIQUE (story_id, seq)
+	);
+
+	-- 叙事全文索引（trigram 分词支持中文子串搜索），由触发器随 narrative_entries 同步
+	CREATE VIRTUAL TABLE IF NOT EXISTS narrative_fts USING fts5(
+		content, content='narrative_entries', content_rowid='id', tokenize='trigram'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS narrative_entries_ai AFTER INSERT ON narrative_entries BEGIN
+		INSERT INTO narrative_fts(rowid, content) VALUES (new.id, new.content);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS narrative_entries_ad AFTER DELETE ON narrative_entries BEGIN
+		INSERT INTO narrative_fts(narrative_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	END;
+
+	CREATE INDEX IF NOT EXISTS idx_world_clears_rank ON world_clears(world_id, turns);
+	CREATE INDEX IF NOT EXISTS idx_share_tokens_resource ON share_tokens(resource_type, resource_id);
 	CREATE INDEX IF NOT EXISTS idx_story_character ON story_states(character_id);
 	CREATE INDEX IF NOT EXISTS idx_story_world ON story_states(world_id);
 	CREATE INDEX IF NOT EXISTS idx_story_status ON story_states(status);
@@ -134,6 +310,181 @@ func (s *Storage) initSchema() error {
 	return err
 }
 
+// migrate 为旧版本数据库补齐后续新增的列
+func (s *Storage) migrate() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"characters", "equipment", "TEXT DEFAULT '{}'"},
+		{"worlds", "endings", "TEXT DEFAULT '[]'"},
+		{"worlds", "tags", "TEXT DEFAULT '[]'"},
+		{"worlds", "favorite", "INTEGER DEFAULT 0"},
+		{"worlds", "attribute_modifiers", "TEXT DEFAULT '{}'"},
+		{"worlds", "rules", "TEXT DEFAULT '[]'"},
+		{"worlds", "cover_prompt", "TEXT DEFAULT ''"},
+		{"worlds", "cover_url", "TEXT DEFAULT ''"},
+		{"worlds", "theme_color", "TEXT DEFAULT ''"},
+		{"worlds", "universe_id", "TEXT DEFAULT ''"},
+		{"characters", "version", "INTEGER DEFAULT 1"},
+		{"character_states", "morality", "INTEGER DEFAULT 0"},
+		{"character_states", "reputation", "INTEGER DEFAULT 0"},
+		{"story_states", "flags", "TEXT DEFAULT '[]'"},
+		{"story_states", "ending_id", "TEXT DEFAULT ''"},
+		{"story_states", "version", "INTEGER DEFAULT 1"},
+		{"story_states", "current_plot_node_id", "TEXT DEFAULT ''"},
+		{"story_states", "plot_progress", "REAL DEFAULT 0"},
+		{"story_states", "chapters", "TEXT DEFAULT '[]'"},
+		{"story_states", "day", "INTEGER DEFAULT 1"},
+		{"story_states", "period", "TEXT DEFAULT 'morning'"},
+		{"story_states", "period_actions", "INTEGER DEFAULT 0"},
+		{"story_states", "pending_choice", "TEXT DEFAULT 'null'"},
+		{"story_states", "attribute_map", "TEXT DEFAULT '{}'"},
+		{"story_states", "char_state", "TEXT DEFAULT 'null'"},
+		{"story_states", "branched_from", "TEXT DEFAULT ''"},
+		{"story_states", "branch_turn", "INTEGER DEFAULT 0"},
+		{"story_states", "npc_memories", "TEXT DEFAULT '{}'"},
+		{"story_states", "stalled_turns", "INTEGER DEFAULT 0"},
+		{"story_states", "undo_count", "INTEGER DEFAULT 0"},
+		{"story_states", "inspiration_uses", "TEXT DEFAULT '{}'"},
+		{"story_states", "romance_stages", "TEXT DEFAULT '{}'"},
+		{"story_states", "cycle", "INTEGER DEFAULT 1"},
+		{"story_states", "notes", "TEXT DEFAULT ''"},
+		{"scenes", "interactables", "TEXT DEFAULT '[]'"},
+		{"scenes", "exits", "TEXT DEFAULT '[]'"},
+		{"scenes", "is_template", "INTEGER DEFAULT 0"},
+	}
+
+	for _, col := range columns {
+		if err := s.addColumnIfMissing(col.table, col.column, col.definition); err != nil {
+			return fmt.Errorf("为%s添加列%s失败: %w", col.table, col.column, err)
+		}
+	}
+
+	if err := s.stackInventories(); err != nil {
+		return fmt.Errorf("合并背包重复道具失败: %w", err)
+	}
+	if err := s.structureSceneGoals(); err != nil {
+		return fmt.Errorf("转换场景目标和威胁失败: %w", err)
+	}
+
+	return nil
+}
+
+// structureSceneGoals 把旧数据中纯字符串的场景目标和威胁改写为结构化格式
+func (s *Storage) structureSceneGoals() error {
+	rows, err := s.db.Query(`SELECT id, COALESCE(threats, '[]'), COALESCE(objectives, '[]') FROM scenes
+		WHERE threats LIKE '["%' OR objectives LIKE '["%'`)
+	if err != nil {
+		return err
+	}
+
+	type sceneGoals struct {
+		threats    []models.Threat
+		objectives []models.Objective
+	}
+	converted := make(map[string]sceneGoals)
+	for rows.Next() {
+		var id, threatsJSON, objectivesJSON string
+		if err := rows.Scan(&id, &threatsJSON, &objectivesJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		var goals sceneGoals
+		if json.Unmarshal([]byte(threatsJSON), &goals.threats) != nil ||
+			json.Unmarshal([]byte(objectivesJSON), &goals.objectives) != nil {
+			continue
+		}
+		converted[id] = goals
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, goals := range converted {
+		threatsJSON, _ := json.Marshal(goals.threats)
+		objectivesJSON, _ := json.Marshal(goals.objectives)
+		if _, err := s.db.Exec(`UPDATE scenes SET threats = ?, objectives = ? WHERE id = ?`,
+			threatsJSON, objectivesJSON, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stackInventories 把旧数据背包中重复的可堆叠道具合并为带数量的一条记录
+func (s *Storage) stackInventories() error {
+	rows, err := s.db.Query(`SELECT id, inventory FROM characters`)
+	if err != nil {
+		return err
+	}
+
+	stacked := make(map[string][]models.Item)
+	for rows.Next() {
+		var id, inventoryJSON string
+		if err := rows.Scan(&id, &inventoryJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		var inventory []models.Item
+		if json.Unmarshal([]byte(inventoryJSON), &inventory) != nil {
+			continue
+		}
+		merged := models.StackItems(nil, inventory...)
+		if len(merged) < len(inventory) {
+			stacked[id] = merged
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, inventory := range stacked {
+		inventoryJSON, _ := json.Marshal(inventory)
+		if _, err := s.db.Exec(`UPDATE characters SET inventory = ? WHERE id = ?`, inventoryJSON, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumnIfMissing 列不存在时执行 ALTER TABLE ADD COLUMN
+func (s *Storage) addColumnIfMissing(table, column, definition string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
 func (s *Storage) Close() error {
 	return s.db.Close()
 }
@@ -142,86 +493,173 @@ func (s *Storage) Close() error {
 func (s *Storage) CreateCharacter(char *models.Character) error {
 	traitsJSON, _ := json.Marshal(char.Traits)
 	inventoryJSON, _ := json.Marshal(char.Inventory)
+	equipmentJSON, _ := json.Marshal(char.Equipment)
 	baseAttrsJSON, _ := json.Marshal(char.BaseAttributes)
 
+	if char.Version == 0 {
+		char.Version = 1
+	}
+
 	_, err := s.db.Exec(`
-		INSERT INTO characters (id, name, gender, age, appearance, personality, background, base_attributes, level, xp, traits, inventory, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO characters (id, name, gender, age, appearance, personality, background, base_attributes, level, xp, traits, inventory, equipment, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, char.ID, char.Name, char.Gender, char.Age, char.Appearance, char.Personality, char.Background, baseAttrsJSON,
-		char.Level, char.XP, traitsJSON, inventoryJSON, char.CreatedAt, char.UpdatedAt)
+		char.Level, char.XP, traitsJSON, inventoryJSON, equipmentJSON, char.Version, char.CreatedAt, char.UpdatedAt)
 
 	return err
 }
 
-func (s *Storage) GetCharacter(id string) (*models.Character, error) {
-	var char models.Character
-	var traitsJSON, inventoryJSON, baseAttrsJSON string
+const characterColumns = `id, name, gender, age, appearance, personality, background, base_attributes, level, xp, traits, inventory, equipment, version, created_at, updated_at`
 
-	err := s.db.QueryRow(`
-		SELECT id, name, gender, age, appearance, personality, background, base_attributes, level, xp, traits, inventory, created_at, updated_at
-		FROM characters WHERE id = ?
-	`, id).Scan(&char.ID, &char.Name, &char.Gender, &char.Age, &char.Appearance, &char.Personality, &char.Background, &baseAttrsJSON,
-		&char.Level, &char.XP, &traitsJSON, &inventoryJSON, &char.CreatedAt, &char.UpdatedAt)
+// 列表查询的分页限制
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
 
+// NormalizePage 补全分页参数：未指定时取默认页大小，超过上限时截断
+func NormalizePage(page models.Page) models.Page {
+	if page.Limit <= 0 {
+		page.Limit = DefaultPageSize
+	}
+	if page.Limit > MaxPageSize {
+		page.Limit = MaxPageSize
+	}
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+	return page
+}
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer 兼容 *sql.DB 和 *sql.Tx，单独保存与事务内保存共用同一段写入逻辑
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// scanCharacter 从一行结果中解析角色（单条与批量查询共用）
+func scanCharacter(row rowScanner) (*models.Character, error) {
+	var char models.Character
+	var traitsJSON, inventoryJSON, equipmentJSON, baseAttrsJSON string
+
+	err := row.Scan(&char.ID, &char.Name, &char.Gender, &char.Age, &char.Appearance, &char.Personality, &char.Background, &baseAttrsJSON,
+		&char.Level, &char.XP, &traitsJSON, &inventoryJSON, &equipmentJSON, &char.Version, &char.CreatedAt, &char.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	json.Unmarshal([]byte(traitsJSON), &char.Traits)
-	json.Unmarshal([]byte(inventoryJSON), &char.Inventory)
-	json.Unmarshal([]byte(baseAttrsJSON), &char.BaseAttributes)
+	var fields jsonFields
+	fields.decode("traits", traitsJSON, &char.Traits)
+	fields.decode("inventory", inventoryJSON, &char.Inventory)
+	fields.decode("equipment", equipmentJSON, &char.Equipment)
+	fields.decode("base_attributes", baseAttrsJSON, &char.BaseAttributes)
+	if err := fields.err("角色", char.ID); err != nil {
+		return nil, err
+	}
 
 	return &char, nil
 }
 
+func (s *Storage) GetCharacter(id string) (*models.Character, error) {
+	return scanCharacter(s.db.QueryRow(`SELECT `+characterColumns+` FROM characters WHERE id = ?`, id))
+}
+
+// GetCharactersByIDs 批量获取角色，返回以ID为键的映射（不存在的ID不会出现在结果中）
+func (s *Storage) GetCharactersByIDs(ids []string) (map[string]*models.Character, error) {
+	result := make(map[string]*models.Character)
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	placeholders, args := inClause(ids)
+	rows, err := s.db.Query(`SELECT `+characterColumns+` FROM characters WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	corrupt := corruptRows{list: "角色"}
+	for rows.Next() {
+		char, err := scanCharacter(rows)
+		if err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		result[char.ID] = char
+	}
+
+	return result, rows.Err()
+}
+
+// UpdateCharacter 以乐观锁更新角色：角色在读取之后被其他请求保存过时返回 ErrVersionConflict 且不写入
 func (s *Storage) UpdateCharacter(char *models.Character) error {
+	if err := updateCharacter(s.db, char); err != nil {
+		return err
+	}
+	char.Version++
+	return nil
+}
+
+// updateCharacter 按 char.Version 校验并写入角色，成功后数据库中的版本加一（内存中的版本由调用方在提交后递增）
+func updateCharacter(db execer, char *models.Character) error {
 	traitsJSON, _ := json.Marshal(char.Traits)
 	inventoryJSON, _ := json.Marshal(char.Inventory)
+	equipmentJSON, _ := json.Marshal(char.Equipment)
 	baseAttrsJSON, _ := json.Marshal(char.BaseAttributes)
 
-	_, err := s.db.Exec(`
+	result, err := db.Exec(`
 		UPDATE characters 
-		SET name=?, gender=?, age=?, appearance=?, personality=?, background=?, base_attributes=?, level=?, xp=?, traits=?, inventory=?, updated_at=?
-		WHERE id=?
+		SET name=?, gender=?, age=?, appearance=?, personality=?, background=?, base_attributes=?, level=?, xp=?, traits=?, inventory=?, equipment=?, version=version+1, updated_at=?
+		WHERE id=? AND version=?
 	`, char.Name, char.Gender, char.Age, char.Appearance, char.Personality, char.Background, baseAttrsJSON,
-		char.Level, char.XP, traitsJSON, inventoryJSON, time.Now(), char.ID)
+		char.Level, char.XP, traitsJSON, inventoryJSON, equipmentJSON, time.Now(), char.ID, char.Version)
+	if err != nil {
+		return err
+	}
 
-	return err
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
 }
 
-// GetAllCharacters 获取所有角色列表
-func (s *Storage) GetAllCharacters() ([]models.Character, error) {
-	rows, err := s.db.Query(`
-		SELECT id, name, gender, age, appearance, personality, background, base_attributes, level, xp, traits, inventory, created_at, updated_at
-		FROM characters
-		ORDER BY created_at DESC
-	`)
+// GetAllCharacters 分页获取角色列表，同时返回角色总数和本页跳过的损坏记录数
+func (s *Storage) GetAllCharacters(page models.Page) ([]models.Character, models.ListCount, error) {
+	var count models.ListCount
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM characters`).Scan(&count.Total); err != nil {
+		return nil, count, err
+	}
 
+	page = NormalizePage(page)
+	rows, err := s.db.Query(`SELECT `+characterColumns+` FROM characters ORDER BY created_at DESC, id LIMIT ? OFFSET ?`,
+		page.Limit, page.Offset)
 	if err != nil {
-		return nil, err
+		return nil, count, err
 	}
 	defer rows.Close()
 
-	var characters []models.Character
+	characters := []models.Character{}
+	corrupt := corruptRows{list: "角色列表"}
 	for rows.Next() {
-		var char models.Character
-		var traitsJSON, inventoryJSON, baseAttrsJSON string
-
-		err := rows.Scan(&char.ID, &char.Name, &char.Gender, &char.Age, &char.Appearance, &char.Personality, &char.Background, &baseAttrsJSON,
-			&char.Level, &char.XP, &traitsJSON, &inventoryJSON, &char.CreatedAt, &char.UpdatedAt)
-
+		char, err := scanCharacter(rows)
 		if err != nil {
+			corrupt.skip(err)
 			continue
 		}
-
-		json.Unmarshal([]byte(traitsJSON), &char.Traits)
-		json.Unmarshal([]byte(inventoryJSON), &char.Inventory)
-		json.Unmarshal([]byte(baseAttrsJSON), &char.BaseAttributes)
-
-		characters = append(characters, char)
+		characters = append(characters, *char)
 	}
 
-	return characters, nil
+	count.Corrupt = corrupt.count
+	return characters, count, rows.Err()
 }
 
 // World operations
@@ -229,176 +667,941 @@ func (s *Storage) CreateWorld(world *models.World) error {
 	goalsJSON, _ := json.Marshal(world.Goals)
 	npcsJSON, _ := json.Marshal(world.NPCs)
 	plotLinesJSON, _ := json.Marshal(world.PlotLines)
+	endingsJSON, _ := json.Marshal(world.Endings)
+	tagsJSON, _ := json.Marshal(world.Tags)
+	modifiersJSON, _ := json.Marshal(world.AttributeModifiers)
+	rulesJSON, _ := json.Marshal(world.Rules)
 
 	_, err := s.db.Exec(`
-		INSERT INTO worlds (id, segment_text, original_summary, name, description, genre, difficulty, goals, npcs, plot_lines, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO worlds (id, segment_text, original_summary, name, description, genre, difficulty, goals, npcs, plot_lines, endings, tags, favorite, attribute_modifiers, rules, cover_prompt, cover_url, theme_color, universe_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, world.ID, world.SegmentText, world.OriginalSummary, world.Name, world.Description,
-		world.Genre, world.Difficulty, goalsJSON, npcsJSON, plotLinesJSON, world.CreatedAt)
+		world.Genre, world.Difficulty, goalsJSON, npcsJSON, plotLinesJSON, endingsJSON, tagsJSON, world.Favorite, modifiersJSON, rulesJSON,
+		world.CoverPrompt, world.CoverURL, world.ThemeColor, world.UniverseID, world.CreatedAt)
 
 	return err
 }
 
-func (s *Storage) GetWorld(id string) (*models.World, error) {
-	var world models.World
-	var goalsJSON, npcsJSON, plotLinesJSON string
+func (s *Storage) UpdateWorld(world *models.World) error {
+	goalsJSON, _ := json.Marshal(world.Goals)
+	npcsJSON, _ := json.Marshal(world.NPCs)
+	plotLinesJSON, _ := json.Marshal(world.PlotLines)
+	endingsJSON, _ := json.Marshal(world.Endings)
+	tagsJSON, _ := json.Marshal(world.Tags)
+	modifiersJSON, _ := json.Marshal(world.AttributeModifiers)
+	rulesJSON, _ := json.Marshal(world.Rules)
 
-	err := s.db.QueryRow(`
-		SELECT id, segment_text, original_summary, name, description, genre, difficulty, goals, npcs, plot_lines, created_at
-		FROM worlds WHERE id = ?
-	`, id).Scan(&world.ID, &world.SegmentText, &world.OriginalSummary, &world.Name, &world.Description,
-		&world.Genre, &world.Difficulty, &goalsJSON, &npcsJSON, &plotLinesJSON, &world.CreatedAt)
+	_, err := s.db.Exec(`
+		UPDATE worlds
+		SET segment_text=?, original_summary=?, name=?, description=?, genre=?, difficulty=?, goals=?, npcs=?, plot_lines=?, endings=?, tags=?, favorite=?, attribute_modifiers=?, rules=?, cover_prompt=?, cover_url=?, theme_color=?, universe_id=?
+		WHERE id=?
+	`, world.SegmentText, world.OriginalSummary, world.Name, world.Description, world.Genre, world.Difficulty,
+		goalsJSON, npcsJSON, plotLinesJSON, endingsJSON, tagsJSON, world.Favorite, modifiersJSON, rulesJSON,
+		world.CoverPrompt, world.CoverURL, world.ThemeColor, world.UniverseID, world.ID)
+
+	return err
+}
+
+const worldColumns = `id, segment_text, original_summary, name, description, genre, difficulty, goals, npcs, plot_lines, endings, tags, favorite, attribute_modifiers, rules, cover_prompt, cover_url, theme_color, COALESCE(universe_id, ''), created_at`
+
+// scanWorld 从一行结果中解析世界（单条与批量查询共用）
+func scanWorld(row rowScanner) (*models.World, error) {
+	var world models.World
+	var goalsJSON, npcsJSON, plotLinesJSON, endingsJSON, tagsJSON, modifiersJSON, rulesJSON string
 
+	err := row.Scan(&world.ID, &world.SegmentText, &world.OriginalSummary, &world.Name, &world.Description,
+		&world.Genre, &world.Difficulty, &goalsJSON, &npcsJSON, &plotLinesJSON, &endingsJSON, &tagsJSON,
+		&world.Favorite, &modifiersJSON, &rulesJSON,
+		&world.CoverPrompt, &world.CoverURL, &world.ThemeColor, &world.UniverseID, &world.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	json.Unmarshal([]byte(goalsJSON), &world.Goals)
-	json.Unmarshal([]byte(npcsJSON), &world.NPCs)
-	json.Unmarshal([]byte(plotLinesJSON), &world.PlotLines)
+	var fields jsonFields
+	fields.decode("goals", goalsJSON, &world.Goals)
+	fields.decode("npcs", npcsJSON, &world.NPCs)
+	fields.decode("plot_lines", plotLinesJSON, &world.PlotLines)
+	fields.decode("endings", endingsJSON, &world.Endings)
+	fields.decode("tags", tagsJSON, &world.Tags)
+	fields.decode("attribute_modifiers", modifiersJSON, &world.AttributeModifiers)
+	fields.decode("rules", rulesJSON, &world.Rules)
+	if err := fields.err("世界", world.ID); err != nil {
+		return nil, err
+	}
 
 	return &world, nil
 }
 
-// CharacterState operations
-func (s *Storage) SaveCharacterState(state *models.CharacterState) error {
-	attributesJSON, _ := json.Marshal(state.Attributes)
-	statusJSON, _ := json.Marshal(state.Status)
-	relationsJSON, _ := json.Marshal(state.Relations)
-
-	_, err := s.db.Exec(`
-		INSERT OR REPLACE INTO character_states 
-		(character_id, world_id, hp, max_hp, san, max_san, attributes, status, relations)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, state.CharacterID, state.WorldID, state.HP, state.MaxHP,
-		state.SAN, state.MaxSAN, attributesJSON, statusJSON, relationsJSON)
-
-	return err
+func (s *Storage) GetWorld(id string) (*models.World, error) {
+	return scanWorld(s.db.QueryRow(`SELECT `+worldColumns+` FROM worlds WHERE id = ?`, id))
 }
 
-func (s *Storage) GetCharacterState(characterID, worldID string) (*models.CharacterState, error) {
-	var state models.CharacterState
-	var attributesJSON, statusJSON, relationsJSON string
+// GetWorlds 分页获取世界列表（按创建时间倒序），可按标签、收藏和所属宇宙过滤，同时返回符合条件的总数和本页跳过的损坏记录数
+func (s *Storage) GetWorlds(filter models.WorldFilter, page models.Page) ([]models.World, models.ListCount, error) {
+	where := ` WHERE 1=1`
+	var args []interface{}
+	if filter.Tag != "" {
+		where += ` AND EXISTS (SELECT 1 FROM json_each(worlds.tags) WHERE json_each.value = ?)`
+		args = append(args, filter.Tag)
+	}
+	if filter.FavoriteOnly {
+		where += ` AND favorite = 1`
+	}
+	if filter.UniverseID != "" {
+		where += ` AND universe_id = ?`
+		args = append(args, filter.UniverseID)
+	}
 
-	err := s.db.QueryRow(`
-		SELECT character_id, world_id, hp, max_hp, san, max_san, attributes, status, relations
-		FROM character_states WHERE character_id = ? AND world_id = ?
-	`, characterID, worldID).Scan(&state.CharacterID, &state.WorldID,
-		&state.HP, &state.MaxHP, &state.SAN, &state.MaxSAN,
-		&attributesJSON, &statusJSON, &relationsJSON)
+	var count models.ListCount
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM worlds`+where, args...).Scan(&count.Total); err != nil {
+		return nil, count, err
+	}
 
+	page = NormalizePage(page)
+	rows, err := s.db.Query(`SELECT `+worldColumns+` FROM worlds`+where+` ORDER BY created_at DESC, id LIMIT ? OFFSET ?`,
+		append(args, page.Limit, page.Offset)...)
 	if err != nil {
-		return nil, err
+		return nil, count, err
 	}
+	defer rows.Close()
 
-	json.Unmarshal([]byte(attributesJSON), &state.Attributes)
-	json.Unmarshal([]byte(statusJSON), &state.Status)
-	json.Unmarshal([]byte(relationsJSON), &state.Relations)
+	worlds := []models.World{}
+	corrupt := corruptRows{list: "世界列表"}
+	for rows.Next() {
+		world, err := scanWorld(rows)
+		if err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		worlds = append(worlds, *world)
+	}
 
-	return &state, nil
+	count.Corrupt = corrupt.count
+	return worlds, count, rows.Err()
 }
 
-// Scene operations
-func (s *Storage) CreateScene(scene *models.Scene) error {
-	threatsJSON, _ := json.Marshal(scene.Threats)
-	objectivesJSON, _ := json.Marshal(scene.Objectives)
+// GetWorldsByIDs 批量获取世界，返回以ID为键的映射（不存在的ID不会出现在结果中）
+func (s *Storage) GetWorldsByIDs(ids []string) (map[string]*models.World, error) {
+	result := make(map[string]*models.World)
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return result, nil
+	}
 
-	_, err := s.db.Exec(`
-		INSERT INTO scenes (id, world_id, name, description, type, threats, objectives)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, scene.ID, scene.WorldID, scene.Name, scene.Description,
-		scene.Type, threatsJSON, objectivesJSON)
+	placeholders, args := inClause(ids)
+	rows, err := s.db.Query(`SELECT `+worldColumns+` FROM worlds WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return err
+	corrupt := corruptRows{list: "世界"}
+	for rows.Next() {
+		world, err := scanWorld(rows)
+		if err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		result[world.ID] = world
+	}
+
+	return result, rows.Err()
 }
 
-func (s *Storage) GetScene(id string) (*models.Scene, error) {
-	var scene models.Scene
-	var threatsJSON, objectivesJSON string
+// DeleteWorld 删除世界及其场景、角色在该世界的状态、通关记录和分享链接；
+// 世界还有故事（进行中或已结束）时返回 ErrInUse，世界不存在时返回 sql.ErrNoRows
+func (s *Storage) DeleteWorld(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	err := s.db.QueryRow(`
-		SELECT id, world_id, name, description, type, threats, objectives
-		FROM scenes WHERE id = ?
-	`, id).Scan(&scene.ID, &scene.WorldID, &scene.Name, &scene.Description,
-		&scene.Type, &threatsJSON, &objectivesJSON)
+	var stories int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM story_states WHERE world_id = ?`, id).Scan(&stories); err != nil {
+		return err
+	}
+	if stories > 0 {
+		return fmt.Errorf("%w：世界还有 %d 个故事", ErrInUse, stories)
+	}
 
+	for _, stmt := range []string{
+		`DELETE FROM scenes WHERE world_id = ?`,
+		`DELETE FROM character_states WHERE world_id = ?`,
+		`DELETE FROM world_clears WHERE world_id = ?`,
+		`DELETE FROM share_tokens WHERE resource_type = 'world' AND resource_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM worlds WHERE id = ?`, id)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
 
-	json.Unmarshal([]byte(threatsJSON), &scene.Threats)
-	json.Unmarshal([]byte(objectivesJSON), &scene.Objectives)
-
-	return &scene, nil
+// Universe operations
+func (s *Storage) CreateUniverse(universe *models.Universe) error {
+	_, err := s.db.Exec(`INSERT INTO universes (id, name, description, created_at) VALUES (?, ?, ?, ?)`,
+		universe.ID, universe.Name, universe.Description, universe.CreatedAt)
+	return err
 }
 
-// StoryState operations
-func (s *Storage) CreateStoryState(story *models.StoryState) error {
-	narrativeJSON, _ := json.Marshal(story.Narrative)
-	snapshotsJSON, _ := json.Marshal(story.Snapshots)
+// universeColumns 宇宙的列，world_count 为归属的世界数
+const universeColumns = `id, name, COALESCE(description, ''), created_at,
+	(SELECT COUNT(*) FROM worlds WHERE worlds.universe_id = universes.id)`
 
-	_, err := s.db.Exec(`
-		INSERT INTO story_states (id, character_id, world_id, scene_id, turn, narrative, snapshots, status, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, story.ID, story.CharacterID, story.WorldID, story.SceneID,
-		story.Turn, narrativeJSON, snapshotsJSON, story.Status, story.CreatedAt, story.UpdatedAt)
+func scanUniverse(row rowScanner) (*models.Universe, error) {
+	var universe models.Universe
+	if err := row.Scan(&universe.ID, &universe.Name, &universe.Description, &universe.CreatedAt,
+		&universe.WorldCount); err != nil {
+		return nil, err
+	}
+	return &universe, nil
+}
 
-	return err
+func (s *Storage) GetUniverse(id string) (*models.Universe, error) {
+	return scanUniverse(s.db.QueryRow(`SELECT `+universeColumns+` FROM universes WHERE id = ?`, id))
 }
 
-func (s *Storage) UpdateStoryState(story *models.StoryState) error {
-	narrativeJSON, _ := json.Marshal(story.Narrative)
-	snapshotsJSON, _ := json.Marshal(story.Snapshots)
+// GetUniverses 分页获取宇宙列表（按创建时间倒序），同时返回总数和本页跳过的损坏记录数
+func (s *Storage) GetUniverses(page models.Page) ([]models.Universe, models.ListCount, error) {
+	var count models.ListCount
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM universes`).Scan(&count.Total); err != nil {
+		return nil, count, err
+	}
 
-	_, err := s.db.Exec(`
-		UPDATE story_states 
-		SET scene_id=?, turn=?, narrative=?, snapshots=?, status=?, updated_at=?
-		WHERE id=?
-	`, story.SceneID, story.Turn, narrativeJSON, snapshotsJSON, story.Status,
-		time.Now(), story.ID)
+	page = NormalizePage(page)
+	rows, err := s.db.Query(`SELECT `+universeColumns+` FROM universes ORDER BY created_at DESC, id LIMIT ? OFFSET ?`,
+		page.Limit, page.Offset)
+	if err != nil {
+		return nil, count, err
+	}
+	defer rows.Close()
+
+	universes := []models.Universe{}
+	corrupt := corruptRows{list: "宇宙列表"}
+	for rows.Next() {
+		universe, err := scanUniverse(rows)
+		if err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		universes = append(universes, *universe)
+	}
+
+	count.Corrupt = corrupt.count
+	return universes, count, rows.Err()
+}
+
+// DeleteUniverse 删除宇宙，归属它的世界变回独立世界（世界本身保留）；宇宙不存在时返回 sql.ErrNoRows
+func (s *Storage) DeleteUniverse(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM universes WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`UPDATE worlds SET universe_id = '' WHERE universe_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// uniqueIDs 去掉空值和重复的ID
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	var unique []string
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// inClause 生成 IN (...) 的占位符和参数
+func inClause(ids []string) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// CharacterState operations
+func (s *Storage) SaveCharacterState(state *models.CharacterState) error {
+	return saveCharacterState(s.db, state)
+}
+
+func saveCharacterState(db execer, state *models.CharacterState) error {
+	attributesJSON, _ := json.Marshal(state.Attributes)
+	statusJSON, _ := json.Marshal(state.Status)
+	relationsJSON, _ := json.Marshal(state.Relations)
+
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO character_states 
+		(character_id, world_id, hp, max_hp, san, max_san, attributes, status, relations, morality, reputation)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, state.CharacterID, state.WorldID, state.HP, state.MaxHP,
+		state.SAN, state.MaxSAN, attributesJSON, statusJSON, relationsJSON, state.Morality, state.Reputation)
 
 	return err
 }
 
-func (s *Storage) GetStoryState(id string) (*models.StoryState, error) {
-	var story models.StoryState
-	var narrativeJSON, snapshotsJSON string
+const characterStateColumns = `character_id, world_id, hp, max_hp, san, max_san, attributes, status, relations, morality, reputation`
 
-	err := s.db.QueryRow(`
-		SELECT id, character_id, world_id, scene_id, turn, narrative, snapshots, status, created_at, updated_at
-		FROM story_states WHERE id = ?
-	`, id).Scan(&story.ID, &story.CharacterID, &story.WorldID, &story.SceneID,
-		&story.Turn, &narrativeJSON, &snapshotsJSON, &story.Status, &story.CreatedAt, &story.UpdatedAt)
+// scanCharacterState 从一行结果中解析角色状态（单条与批量查询共用）
+func scanCharacterState(row rowScanner) (*models.CharacterState, error) {
+	var state models.CharacterState
+	var attributesJSON, statusJSON, relationsJSON string
+
+	err := row.Scan(&state.CharacterID, &state.WorldID,
+		&state.HP, &state.MaxHP, &state.SAN, &state.MaxSAN,
+		&attributesJSON, &statusJSON, &relationsJSON, &state.Morality, &state.Reputation)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields jsonFields
+	fields.decode("attributes", attributesJSON, &state.Attributes)
+	fields.decode("status", statusJSON, &state.Status)
+	fields.decode("relations", relationsJSON, &state.Relations)
+	if err := fields.err("角色状态", state.CharacterID+"@"+state.WorldID); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (s *Storage) GetCharacterState(characterID, worldID string) (*models.CharacterState, error) {
+	return scanCharacterState(s.db.QueryRow(`SELECT `+characterStateColumns+`
+		FROM character_states WHERE character_id = ? AND world_id = ?`, characterID, worldID))
+}
 
+// GetUniverseCharacterStates 获取角色在同一宇宙其他世界中的状态（不含 excludeWorldID）
+func (s *Storage) GetUniverseCharacterStates(characterID, universeID, excludeWorldID string) ([]models.CharacterState, error) {
+	rows, err := s.db.Query(`SELECT `+characterStateColumns+` FROM character_states
+		WHERE character_id = ? AND world_id != ?
+		AND world_id IN (SELECT id FROM worlds WHERE universe_id = ?)
+		ORDER BY world_id`, characterID, excludeWorldID, universeID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	json.Unmarshal([]byte(narrativeJSON), &story.Narrative)
-	json.Unmarshal([]byte(snapshotsJSON), &story.Snapshots)
+	var states []models.CharacterState
+	corrupt := corruptRows{list: "宇宙中的角色状态"}
+	for rows.Next() {
+		state, err := scanCharacterState(rows)
+		if err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		states = append(states, *state)
+	}
+	return states, rows.Err()
+}
 
-	return &story, nil
+// Scene operations
+func (s *Storage) CreateScene(scene *models.Scene) error {
+	threatsJSON, _ := json.Marshal(scene.Threats)
+	objectivesJSON, _ := json.Marshal(scene.Objectives)
+	interactablesJSON, _ := json.Marshal(scene.Interactables)
+	exitsJSON, _ := json.Marshal(scene.Exits)
+
+	_, err := s.db.Exec(`
+		INSERT INTO scenes (id, world_id, name, description, type, threats, objectives, interactables, exits, is_template)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, scene.ID, scene.WorldID, scene.Name, scene.Description,
+		scene.Type, threatsJSON, objectivesJSON, interactablesJSON, exitsJSON, scene.IsTemplate)
+
+	return err
+}
+
+// UpdateScene 更新场景的目标和威胁（完成状态等）
+func (s *Storage) UpdateScene(scene *models.Scene) error {
+	return updateScene(s.db, scene)
+}
+
+func updateScene(db execer, scene *models.Scene) error {
+	threatsJSON, _ := json.Marshal(scene.Threats)
+	objectivesJSON, _ := json.Marshal(scene.Objectives)
+
+	_, err := db.Exec(`UPDATE scenes SET threats = ?, objectives = ? WHERE id = ?`,
+		threatsJSON, objectivesJSON, scene.ID)
+	return err
+}
+
+// SetSceneTemplate 设置场景是否收入世界场景库，场景不存在时返回 sql.ErrNoRows
+func (s *Storage) SetSceneTemplate(id string, isTemplate bool) error {
+	result, err := s.db.Exec(`UPDATE scenes SET is_template = ? WHERE id = ?`, isTemplate, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const sceneColumns = `id, world_id, name, description, type, threats, objectives,
+	COALESCE(interactables, '[]'), COALESCE(exits, '[]'), COALESCE(is_template, 0)`
+
+// scanScene 从一行结果中解析场景（单条与批量查询共用）
+func scanScene(row rowScanner) (*models.Scene, error) {
+	var scene models.Scene
+	var threatsJSON, objectivesJSON, interactablesJSON, exitsJSON string
+
+	err := row.Scan(&scene.ID, &scene.WorldID, &scene.Name, &scene.Description,
+		&scene.Type, &threatsJSON, &objectivesJSON, &interactablesJSON, &exitsJSON, &scene.IsTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields jsonFields
+	fields.decode("threats", threatsJSON, &scene.Threats)
+	fields.decode("objectives", objectivesJSON, &scene.Objectives)
+	fields.decode("interactables", interactablesJSON, &scene.Interactables)
+	fields.decode("exits", exitsJSON, &scene.Exits)
+	if err := fields.err("场景", scene.ID); err != nil {
+		return nil, err
+	}
+
+	return &scene, nil
+}
+
+func (s *Storage) GetScene(id string) (*models.Scene, error) {
+	return scanScene(s.db.QueryRow(`SELECT `+sceneColumns+` FROM scenes WHERE id = ?`, id))
+}
+
+// GetWorldScenes 分页获取世界中已生成的场景（按生成先后），templatesOnly 为 true 时只返回场景库中的场景，
+// 同时返回符合条件的总数和本页跳过的损坏记录数
+func (s *Storage) GetWorldScenes(worldID string, templatesOnly bool, page models.Page) ([]models.Scene, models.ListCount, error) {
+	where := ` WHERE world_id = ?`
+	if templatesOnly {
+		where += ` AND is_template = 1`
+	}
+
+	var count models.ListCount
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM scenes`+where, worldID).Scan(&count.Total); err != nil {
+		return nil, count, err
+	}
+
+	page = NormalizePage(page)
+	rows, err := s.db.Query(`SELECT `+sceneColumns+` FROM scenes`+where+` ORDER BY rowid LIMIT ? OFFSET ?`,
+		worldID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, count, err
+	}
+	defer rows.Close()
+
+	scenes := []models.Scene{}
+	corrupt := corruptRows{list: "场景列表"}
+	for rows.Next() {
+		scene, err := scanScene(rows)
+		if err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		scenes = append(scenes, *scene)
+	}
+
+	count.Corrupt = corrupt.count
+	return scenes, count, rows.Err()
+}
+
+// StoryState operations
+func (s *Storage) CreateStoryState(story *models.StoryState) error {
+	narrativeJSON, _ := json.Marshal(story.Narrative)
+	snapshotsJSON, _ := json.Marshal(story.Snapshots)
+	flagsJSON, _ := json.Marshal(story.Flags)
+	chaptersJSON, _ := json.Marshal(story.Chapters)
+	choiceJSON, _ := json.Marshal(story.PendingChoice)
+	attrMapJSON, _ := json.Marshal(story.AttributeMap)
+	charStateJSON, _ := json.Marshal(story.CharState)
+	memoriesJSON, _ := json.Marshal(story.NPCMemories)
+	inspirationJSON, _ := json.Marshal(story.InspirationUses)
+	romanceJSON, _ := json.Marshal(story.RomanceStages)
+
+	if story.Version == 0 {
+		story.Version = 1
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO story_states (id, character_id, world_id, scene_id, current_plot_node_id, plot_progress, stalled_turns, undo_count, inspiration_uses, romance_stages, turn, day, period, period_actions, narrative, snapshots, flags, chapters, pending_choice, attribute_map, char_state, npc_memories, branched_from, branch_turn, cycle, notes, status, ending_id, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, story.ID, story.CharacterID, story.WorldID, story.SceneID, story.CurrentPlotNodeID, story.PlotProgress, story.StalledTurns, story.UndoCount, inspirationJSON, romanceJSON,
+		story.Turn, story.Day, story.Period, story.PeriodActions, narrativeJSON, snapshotsJSON, flagsJSON, chaptersJSON, choiceJSON, attrMapJSON,
+		charStateJSON, memoriesJSON, story.BranchedFrom, story.BranchTurn, story.Cycle, story.Notes, story.Status, story.EndingID, story.Version, story.CreatedAt, story.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := syncNarrativeIndex(tx, story.ID, story.Narrative); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateStoryState 以 story.Version 为预期版本做CAS更新，成功后版本号加一；
+// 版本不匹配（期间被其他请求更新过）时返回 ErrVersionConflict
+func (s *Storage) UpdateStoryState(story *models.StoryState) error {
+	return s.CommitStory(story, nil, nil)
+}
+
+// CommitStory 在一个事务中保存一次结算：先以 story.Version 为预期版本做CAS更新故事，
+// 版本不匹配时返回 ErrVersionConflict 且不写入任何数据；再保存角色、角色世界状态和改动过的场景
+// （char、state 为空时不保存）。成功后故事的版本号加一
+func (s *Storage) CommitStory(story *models.StoryState, char *models.Character, state *models.CharacterState,
+	scenes ...*models.Scene) error {
+	narrativeJSON, _ := json.Marshal(story.Narrative)
+	snapshotsJSON, _ := json.Marshal(story.Snapshots)
+	flagsJSON, _ := json.Marshal(story.Flags)
+	chaptersJSON, _ := json.Marshal(story.Chapters)
+	choiceJSON, _ := json.Marshal(story.PendingChoice)
+	attrMapJSON, _ := json.Marshal(story.AttributeMap)
+	charStateJSON, _ := json.Marshal(story.CharState)
+	memoriesJSON, _ := json.Marshal(story.NPCMemories)
+	inspirationJSON, _ := json.Marshal(story.InspirationUses)
+	romanceJSON, _ := json.Marshal(story.RomanceStages)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE story_states 
+		SET scene_id=?, current_plot_node_id=?, plot_progress=?, stalled_turns=?, undo_count=?, inspiration_uses=?, romance_stages=?, turn=?, day=?, period=?, period_actions=?, narrative=?, snapshots=?, flags=?, chapters=?, pending_choice=?, attribute_map=?, char_state=?, npc_memories=?, notes=?, status=?, ending_id=?, version=version+1, updated_at=?
+		WHERE id=? AND version=?
+	`, story.SceneID, story.CurrentPlotNodeID, story.PlotProgress, story.StalledTurns, story.UndoCount, inspirationJSON, romanceJSON, story.Turn, story.Day, story.Period, story.PeriodActions, narrativeJSON, snapshotsJSON, flagsJSON, chaptersJSON, choiceJSON, attrMapJSON,
+		charStateJSON, memoriesJSON, story.Notes, story.Status, story.EndingID, time.Now(), story.ID, story.Version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+
+	if char != nil {
+		if err := updateCharacter(tx, char); err != nil {
+			return err
+		}
+	}
+	if state != nil {
+		if err := saveCharacterState(tx, state); err != nil {
+			return err
+		}
+	}
+	for _, scene := range scenes {
+		if err := updateScene(tx, scene); err != nil {
+			return err
+		}
+	}
+
+	// 叙事全文索引随故事一起增量更新
+	if err := syncNarrativeIndex(tx, story.ID, story.Narrative); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	story.Version++
+	if char != nil {
+		char.Version++
+	}
+	return nil
 }
 
-func (s *Storage) GetActiveStoryByCharacter(characterID string) (*models.StoryState, error) {
+const storyColumns = `id, character_id, world_id, scene_id, current_plot_node_id, plot_progress, stalled_turns, undo_count, inspiration_uses, romance_stages, turn, day, period, period_actions, narrative, snapshots, flags, chapters, pending_choice, attribute_map, char_state, npc_memories, branched_from, branch_turn, cycle, notes, status, ending_id, version, created_at, updated_at`
+
+// scanStory 从一行结果中解析故事状态
+func scanStory(row rowScanner) (*models.StoryState, error) {
 	var story models.StoryState
-	var narrativeJSON, snapshotsJSON string
+	var narrativeJSON, snapshotsJSON, flagsJSON, chaptersJSON, choiceJSON, attrMapJSON, charStateJSON, memoriesJSON, inspirationJSON, romanceJSON string
+
+	err := row.Scan(&story.ID, &story.CharacterID, &story.WorldID, &story.SceneID,
+		&story.CurrentPlotNodeID, &story.PlotProgress, &story.StalledTurns, &story.UndoCount, &inspirationJSON, &romanceJSON, &story.Turn, &story.Day, &story.Period, &story.PeriodActions, &narrativeJSON, &snapshotsJSON, &flagsJSON, &chaptersJSON, &choiceJSON, &attrMapJSON,
+		&charStateJSON, &memoriesJSON, &story.BranchedFrom, &story.BranchTurn, &story.Cycle, &story.Notes, &story.Status, &story.EndingID, &story.Version, &story.CreatedAt, &story.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields jsonFields
+	fields.decode("narrative", narrativeJSON, &story.Narrative)
+	fields.decode("snapshots", snapshotsJSON, &story.Snapshots)
+	fields.decode("flags", flagsJSON, &story.Flags)
+	fields.decode("chapters", chaptersJSON, &story.Chapters)
+	fields.decode("pending_choice", choiceJSON, &story.PendingChoice)
+	fields.decode("attribute_map", attrMapJSON, &story.AttributeMap)
+	fields.decode("char_state", charStateJSON, &story.CharState)
+	fields.decode("npc_memories", memoriesJSON, &story.NPCMemories)
+	fields.decode("inspiration_uses", inspirationJSON, &story.InspirationUses)
+	fields.decode("romance_stages", romanceJSON, &story.RomanceStages)
+	if err := fields.err("故事", story.ID); err != nil {
+		return nil, err
+	}
+
+	return &story, nil
+}
+
+func (s *Storage) GetStoryState(id string) (*models.StoryState, error) {
+	return scanStory(s.db.QueryRow(`SELECT `+storyColumns+` FROM story_states WHERE id = ?`, id))
+}
+
+// GetDiceTimeline 按回合顺序取出故事叙事日志中的检定结果，limit > 0 时只取最近 limit 次。
+// 直接在数据库里展开叙事JSON，只抽取带 dice_roll 的日志项，不加载快照等大字段
+func (s *Storage) GetDiceTimeline(storyID string, limit int) ([]models.DicePoint, error) {
+	var exists int
+	if err := s.db.QueryRow(`SELECT 1 FROM story_states WHERE id = ?`, storyID).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT json_extract(log.value, '$.turn'),
+			json_extract(log.value, '$.dice_roll.result'),
+			json_extract(log.value, '$.dice_roll.modifier'),
+			json_extract(log.value, '$.dice_roll.target'),
+			json_extract(log.value, '$.dice_roll.success'),
+			json_extract(log.value, '$.dice_roll.critical')
+		FROM story_states, json_each(story_states.narrative) AS log
+		WHERE story_states.id = ? AND json_type(log.value, '$.dice_roll') = 'object'
+		ORDER BY log.key DESC`
+	args := []interface{}{storyID}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []models.DicePoint{}
+	corrupt := corruptRows{list: "骰点时间线"}
+	for rows.Next() {
+		var point models.DicePoint
+		if err := rows.Scan(&point.Turn, &point.Result, &point.Modifier, &point.Target,
+			&point.Success, &point.Critical); err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		points = append(points, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 查询按最新在前取最近的记录，返回时恢复为回合顺序
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	return points, nil
+}
+
+// GetActiveStoryByCharacter 获取角色在指定世界中最近更新的进行中故事（同一角色可以在多个世界各有一条）
+func (s *Storage) GetActiveStoryByCharacter(characterID, worldID string) (*models.StoryState, error) {
+	return scanStory(s.db.QueryRow(`
+		SELECT `+storyColumns+`
+		FROM story_states WHERE character_id = ? AND world_id = ? AND status = 'active'
+		ORDER BY updated_at DESC LIMIT 1
+	`, characterID, worldID))
+}
 
+// MaxClearedCycle 返回角色在指定世界已通关的最高周目，没有通关过时返回0
+func (s *Storage) MaxClearedCycle(characterID, worldID string) (int, error) {
+	var cycle int
 	err := s.db.QueryRow(`
-		SELECT id, character_id, world_id, scene_id, turn, narrative, snapshots, status, created_at, updated_at
+		SELECT COALESCE(MAX(MAX(cycle, 1)), 0)
+		FROM story_states WHERE character_id = ? AND world_id = ? AND status = 'completed'
+	`, characterID, worldID).Scan(&cycle)
+	return cycle, err
+}
+
+// ListActiveStoriesByCharacter 列出角色所有进行中的故事概要，最近更新的在前
+func (s *Storage) ListActiveStoriesByCharacter(characterID string) ([]models.ActiveStory, error) {
+	rows, err := s.db.Query(`
+		SELECT id, world_id, turn, day, period, plot_progress, updated_at
 		FROM story_states WHERE character_id = ? AND status = 'active'
-		ORDER BY updated_at DESC LIMIT 1
-	`, characterID).Scan(&story.ID, &story.CharacterID, &story.WorldID, &story.SceneID,
-		&story.Turn, &narrativeJSON, &snapshotsJSON, &story.Status, &story.CreatedAt, &story.UpdatedAt)
+		ORDER BY updated_at DESC, id
+	`, characterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stories := []models.ActiveStory{}
+	corrupt := corruptRows{list: "进行中的故事"}
+	for rows.Next() {
+		var story models.ActiveStory
+		if err := rows.Scan(&story.StoryID, &story.WorldID, &story.Turn, &story.Day, &story.Period,
+			&story.PlotProgress, &story.UpdatedAt); err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		stories = append(stories, story)
+	}
+	return stories, rows.Err()
+}
+
+// StateChangeLog operations
+
+// RecordStateChanges 写入一条回合状态变更日志
+func (s *Storage) RecordStateChanges(entry *models.ChangeLogEntry) error {
+	changesJSON, _ := json.Marshal(entry.Changes)
+	result, err := s.db.Exec(`
+		INSERT INTO state_change_log (story_id, turn, action, changes, undone, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, entry.StoryID, entry.Turn, entry.Action, changesJSON, entry.Undone, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// MarkStateChangesUndone 把故事中晚于 turn 的变更日志标记为已撤销（回退时调用，日志本身保留）
+func (s *Storage) MarkStateChangesUndone(storyID string, turn int) error {
+	_, err := s.db.Exec(`UPDATE state_change_log SET undone = 1 WHERE story_id = ? AND turn > ? AND undone = 0`,
+		storyID, turn)
+	return err
+}
+
+// GetStateChangeLog 分页获取故事的状态变更日志（最新的在前），同时返回总数和本页跳过的损坏记录数
+func (s *Storage) GetStateChangeLog(storyID string, page models.Page) ([]models.ChangeLogEntry, models.ListCount, error) {
+	var count models.ListCount
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM state_change_log WHERE story_id = ?`, storyID).Scan(&count.Total); err != nil {
+		return nil, count, err
+	}
+
+	page = NormalizePage(page)
+	rows, err := s.db.Query(`
+		SELECT id, story_id, turn, COALESCE(action, ''), COALESCE(changes, '{}'), undone, created_at
+		FROM state_change_log WHERE story_id = ?
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, storyID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, count, err
+	}
+	defer rows.Close()
+
+	entries := []models.ChangeLogEntry{}
+	corrupt := corruptRows{list: "状态变更日志"}
+	for rows.Next() {
+		var entry models.ChangeLogEntry
+		var changesJSON string
+		if err := rows.Scan(&entry.ID, &entry.StoryID, &entry.Turn, &entry.Action, &changesJSON,
+			&entry.Undone, &entry.CreatedAt); err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		var fields jsonFields
+		fields.decode("changes", changesJSON, &entry.Changes)
+		if err := fields.err("变更记录", fmt.Sprint(entry.ID)); err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	count.Corrupt = corrupt.count
+	return entries, count, rows.Err()
+}
+
+// StateTimeline operations
+
+// RecordStatePoint 写入一个回合结算后的状态轨迹点
+func (s *Storage) RecordStatePoint(point *models.StatePoint) error {
+	attributesJSON, _ := json.Marshal(point.Attributes)
+	result, err := s.db.Exec(`
+		INSERT INTO state_timeline (story_id, turn, hp, max_hp, san, max_san, attributes, relation_total,
+			morality, undone, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, point.StoryID, point.Turn, point.HP, point.MaxHP, point.SAN, point.MaxSAN, attributesJSON,
+		point.RelationTotal, point.Morality, point.Undone, point.CreatedAt)
+	if err != nil {
+		return err
+	}
+	point.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// MarkStatePointsUndone 把故事中晚于 turn 的状态轨迹点标记为已撤销（回退时调用，轨迹本身保留）
+func (s *Storage) MarkStatePointsUndone(storyID string, turn int) error {
+	_, err := s.db.Exec(`UPDATE state_timeline SET undone = 1 WHERE story_id = ? AND turn > ? AND undone = 0`,
+		storyID, turn)
+	return err
+}
 
+// GetStateTimeline 按记录顺序获取故事的全部状态轨迹点
+func (s *Storage) GetStateTimeline(storyID string) ([]models.StatePoint, error) {
+	rows, err := s.db.Query(`
+		SELECT id, story_id, turn, hp, max_hp, san, max_san, COALESCE(attributes, '{}'), relation_total,
+			morality, undone, created_at
+		FROM state_timeline WHERE story_id = ?
+		ORDER BY id
+	`, storyID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	points := []models.StatePoint{}
+	corrupt := corruptRows{list: "状态轨迹"}
+	for rows.Next() {
+		var point models.StatePoint
+		var attributesJSON string
+		if err := rows.Scan(&point.ID, &point.StoryID, &point.Turn, &point.HP, &point.MaxHP, &point.SAN,
+			&point.MaxSAN, &attributesJSON, &point.RelationTotal, &point.Morality, &point.Undone,
+			&point.CreatedAt); err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		var fields jsonFields
+		fields.decode("attributes", attributesJSON, &point.Attributes)
+		if err := fields.err("状态轨迹", fmt.Sprint(point.ID)); err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
 
-	json.Unmarshal([]byte(narrativeJSON), &story.Narrative)
-	json.Unmarshal([]byte(snapshotsJSON), &story.Snapshots)
+// WorldClear operations
 
-	return &story, nil
+// CreateWorldClear 写入一条通关记录，同一故事只记录一次
+func (s *Storage) CreateWorldClear(clear *models.WorldClear) error {
+	_, err := s.db.Exec(`
+		INSERT OR IGNORE INTO world_clears (id, world_id, story_id, character_id, character_name, turns, days,
+			ending_id, maxed_relations, all_relations_maxed, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, clear.ID, clear.WorldID, clear.StoryID, clear.CharacterID, clear.CharacterName, clear.Turns, clear.Days,
+		clear.EndingID, clear.MaxedRelations, clear.AllRelationsMaxed, clear.CreatedAt)
+
+	return err
+}
+
+// GetWorldLeaderboard 分页获取世界的通关排行：回合数少的在前，同回合数时满好感的、先通关的在前
+func (s *Storage) GetWorldLeaderboard(worldID string, page models.Page) ([]models.WorldClear, models.ListCount, error) {
+	var count models.ListCount
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM world_clears WHERE world_id = ?`, worldID).Scan(&count.Total); err != nil {
+		return nil, count, err
+	}
+
+	page = NormalizePage(page)
+	rows, err := s.db.Query(`
+		SELECT id, world_id, story_id, character_id, character_name, turns, days, ending_id,
+			maxed_relations, all_relations_maxed, created_at
+		FROM world_clears WHERE world_id = ?
+		ORDER BY turns, all_relations_maxed DESC, maxed_relations DESC, created_at, id
+		LIMIT ? OFFSET ?
+	`, worldID, page.Limit, page.Offset)
+	if err != nil {
+		return nil, count, err
+	}
+	defer rows.Close()
+
+	clears := []models.WorldClear{}
+	corrupt := corruptRows{list: "通关排行"}
+	for rows.Next() {
+		var clear models.WorldClear
+		var characterName, endingID sql.NullString
+		if err := rows.Scan(&clear.ID, &clear.WorldID, &clear.StoryID, &clear.CharacterID, &characterName,
+			&clear.Turns, &clear.Days, &endingID, &clear.MaxedRelations, &clear.AllRelationsMaxed, &clear.CreatedAt); err != nil {
+			corrupt.skip(err)
+			continue
+		}
+		clear.CharacterName = characterName.String
+		clear.EndingID = endingID.String
+		// 名次按排行中的位置计算，跳过的损坏记录也占一个名次
+		clear.Rank = page.Offset + len(clears) + corrupt.count + 1
+		clears = append(clears, clear)
+	}
+	count.Corrupt = corrupt.count
+	return clears, count, rows.Err()
+}
+
+// ShareToken operations
+
+func (s *Storage) CreateShareToken(share *models.ShareToken) error {
+	var expiresAt sql.NullTime
+	if share.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *share.ExpiresAt, Valid: true}
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO share_tokens (token, resource_type, resource_id, permission, expires_at, revoked, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, share.Token, share.ResourceType, share.ResourceID, share.Permission, expiresAt, share.Revoked, share.CreatedAt)
+
+	return err
+}
+
+func (s *Storage) GetShareToken(token string) (*models.ShareToken, error) {
+	var share models.ShareToken
+	var expiresAt sql.NullTime
+
+	err := s.db.QueryRow(`
+		SELECT token, resource_type, resource_id, permission, expires_at, revoked, created_at
+		FROM share_tokens WHERE token = ?
+	`, token).Scan(&share.Token, &share.ResourceType, &share.ResourceID, &share.Permission,
+		&expiresAt, &share.Revoked, &share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		share.ExpiresAt = &expiresAt.Time
+	}
+	return &share, nil
+}
+
+// RevokeShareToken 撤销分享令牌，令牌不存在时返回 sql.ErrNoRows
+func (s *Storage) RevokeShareToken(token string) error {
+	result, err := s.db.Exec(`UPDATE share_tokens SET revoked = 1 WHERE token = ?`, token)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 // SaveGame operations
@@ -412,33 +1615,210 @@ func (s *Storage) CreateSaveGame(save *models.SaveGame) error {
 	return err
 }
 
-func (s *Storage) GetSaveGamesByCharacter(characterID string) ([]models.SaveGame, error) {
+// GetSaveGamesByCharacter 分页获取角色的存档，同时返回存档总数和本页跳过的损坏记录数
+func (s *Storage) GetSaveGamesByCharacter(characterID string, page models.Page) ([]models.SaveGame, models.ListCount, error) {
+	var count models.ListCount
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM save_games WHERE character_id = ?`, characterID).Scan(&count.Total); err != nil {
+		return nil, count, err
+	}
+
+	page = NormalizePage(page)
 	rows, err := s.db.Query(`
 		SELECT id, name, story_id, character_id, world_id, turn, description, created_at
 		FROM save_games WHERE character_id = ?
-		ORDER BY created_at DESC
-	`, characterID)
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?
+	`, characterID, page.Limit, page.Offset)
 
 	if err != nil {
-		return nil, err
+		return nil, count, err
 	}
 	defer rows.Close()
 
-	var saves []models.SaveGame
+	saves := []models.SaveGame{}
+	corrupt := corruptRows{list: "存档列表"}
 	for rows.Next() {
 		var save models.SaveGame
 		err := rows.Scan(&save.ID, &save.Name, &save.StoryID, &save.CharacterID,
 			&save.WorldID, &save.Turn, &save.Description, &save.CreatedAt)
 		if err != nil {
+			corrupt.skip(err)
 			continue
 		}
 		saves = append(saves, save)
 	}
 
-	return saves, nil
+	count.Corrupt = corrupt.count
+	return saves, count, rows.Err()
+}
+
+func (s *Storage) GetSaveGame(id string) (*models.SaveGame, error) {
+	var save models.SaveGame
+	err := s.db.QueryRow(`
+		SELECT id, name, story_id, character_id, world_id, turn, description, created_at
+		FROM save_games WHERE id = ?
+	`, id).Scan(&save.ID, &save.Name, &save.StoryID, &save.CharacterID,
+		&save.WorldID, &save.Turn, &save.Description, &save.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &save, nil
 }
 
 func (s *Storage) DeleteSaveGame(id string) error {
 	_, err := s.db.Exec(`DELETE FROM save_games WHERE id = ?`, id)
 	return err
 }
+
+// Task operations
+func (s *Storage) CreateTask(task *models.Task) error {
+	_, err := s.db.Exec(`
+		INSERT INTO tasks (id, type, status, result, error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, task.ID, task.Type, task.Status, string(task.Result), task.Error, task.CreatedAt, task.UpdatedAt)
+
+	return err
+}
+
+func (s *Storage) UpdateTask(task *models.Task) error {
+	_, err := s.db.Exec(`
+		UPDATE tasks SET status=?, result=?, error=?, updated_at=?
+		WHERE id=?
+	`, task.Status, string(task.Result), task.Error, task.UpdatedAt, task.ID)
+
+	return err
+}
+
+func (s *Storage) GetTask(id string) (*models.Task, error) {
+	var task models.Task
+	var result string
+
+	err := s.db.QueryRow(`
+		SELECT id, type, status, result, error, created_at, updated_at
+		FROM tasks WHERE id = ?
+	`, id).Scan(&task.ID, &task.Type, &task.Status, &result, &task.Error, &task.CreatedAt, &task.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result != "" {
+		task.Result = json.RawMessage(result)
+	}
+
+	return &task, nil
+}
+
+// DeleteFinishedTasksBefore 删除在指定时间之前结束的任务，返回删除数量
+func (s *Storage) DeleteFinishedTasksBefore(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`
+		DELETE FROM tasks WHERE status IN ('done', 'failed') AND updated_at < ?
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// FailUnfinishedTasks 把未完成的任务标记为失败（服务重启后这些任务不会再继续执行）
+func (s *Storage) FailUnfinishedTasks(reason string) error {
+	_, err := s.db.Exec(`
+		UPDATE tasks SET status='failed', error=?, updated_at=?
+		WHERE status IN ('pending', 'running')
+	`, reason, time.Now())
+	return err
+}
+
+// RecordLLMUsage 记录一次LLM调用的token用量
+func (s *Storage) RecordLLMUsage(usage *models.LLMUsage) error {
+	_, err := s.db.Exec(`
+		INSERT INTO llm_usage (call_type, model, prompt_tokens, completion_tokens, total_tokens, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, usage.CallType, usage.Model, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, usage.CreatedAt)
+
+	return err
+}
+
+// GetStoryStats 按状态统计故事数量和平均回合数
+func (s *Storage) GetStoryStats() (models.StoryStats, error) {
+	var stats models.StoryStats
+	rows, err := s.db.Query(`SELECT status, COUNT(*), COALESCE(SUM(turn), 0) FROM story_states GROUP BY status`)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	totalTurns := 0
+	for rows.Next() {
+		var status string
+		var count, turns int
+		if err := rows.Scan(&status, &count, &turns); err != nil {
+			return stats, err
+		}
+		switch status {
+		case "active":
+			stats.Active = count
+		case "completed":
+			stats.Completed = count
+		case "failed":
+			stats.Failed = count
+		}
+		stats.Total += count
+		totalTurns += turns
+	}
+	if stats.Total > 0 {
+		stats.AvgTurns = float64(totalTurns) / float64(stats.Total)
+	}
+
+	return stats, rows.Err()
+}
+
+// GetGenreDistribution 统计各类型的世界数量
+func (s *Storage) GetGenreDistribution() (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT COALESCE(genre, ''), COUNT(*) FROM worlds GROUP BY genre`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	distribution := make(map[string]int)
+	for rows.Next() {
+		var genre string
+		var count int
+		if err := rows.Scan(&genre, &count); err != nil {
+			return nil, err
+		}
+		distribution[genre] = count
+	}
+
+	return distribution, rows.Err()
+}
+
+// GetLLMUsageSince 统计指定时间之后的LLM调用次数和token用量
+func (s *Storage) GetLLMUsageSince(since time.Time) (models.LLMUsageStats, error) {
+	stats := models.LLMUsageStats{ByType: make(map[string]int)}
+	rows, err := s.db.Query(`
+		SELECT call_type, COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(total_tokens), 0)
+		FROM llm_usage WHERE created_at >= ?
+		GROUP BY call_type
+	`, since)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var callType string
+		var calls, prompt, completion, total int
+		if err := rows.Scan(&callType, &calls, &prompt, &completion, &total); err != nil {
+			return stats, err
+		}
+		stats.ByType[callType] = calls
+		stats.Calls += calls
+		stats.PromptTokens += prompt
+		stats.CompletionTokens += completion
+		stats.TotalTokens += total
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aiwuxian/project-abyss/internal/models"
+)
+
+// newTestStorage 创建内存数据库，测试结束时关闭
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := New(MemoryPath)
+	if err != nil {
+		t.Fatalf("创建内存数据库失败: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// corrupt 把一条记录的JSON列改成无法解析的内容
+func corrupt(t *testing.T, s *Storage, table, column, id string) {
+	t.Helper()
+	if _, err := s.db.Exec(`UPDATE `+table+` SET `+column+` = '{broken' WHERE id = ?`, id); err != nil {
+		t.Fatalf("写入损坏数据失败: %v", err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	s := newTestStorage(t)
+	if s.Path() != MemoryPath {
+		t.Errorf("内存库的路径应为 %q，实际 %q", MemoryPath, s.Path())
+	}
+	created := &models.Character{ID: "c1", Name: "旅人", Level: 1}
+	if err := s.CreateCharacter(created); err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	// 事务和后续查询必须落在同一个内存库上
+	story := &models.StoryState{ID: "s1", CharacterID: "c1", WorldID: "w1", Turn: 1, Status: "active"}
+	if err := s.CreateStoryState(story); err != nil {
+		t.Fatalf("创建故事失败: %v", err)
+	}
+	story.Turn = 2
+	created.Level = 2
+	if err := s.CommitStory(story, created, nil); err != nil {
+		t.Fatalf("提交故事失败: %v", err)
+	}
+	saved, err := s.GetStoryState("s1")
+	if err != nil {
+		t.Fatalf("读取故事失败: %v", err)
+	}
+	char, err := s.GetCharacter("c1")
+	if err != nil {
+		t.Fatalf("读取角色失败: %v", err)
+	}
+	if saved.Turn != 2 || saved.Version != story.Version || char.Level != 2 {
+		t.Errorf("提交后应为第2回合、版本 %d、角色2级，实际第%d回合、版本 %d、角色%d级",
+			story.Version, saved.Turn, saved.Version, char.Level)
+	}
+
+	// 每个内存库互相独立
+	other := newTestStorage(t)
+	if _, err := other.GetCharacter("c1"); err == nil {
+		t.Error("新建的内存库不应看到其他内存库的数据")
+	}
+}
+
+func TestCommitStoryRejectsStaleVersion(t *testing.T) {
+	s := newTestStorage(t)
+	if err := s.CreateCharacter(&models.Character{ID: "c1", Name: "旅人", Level: 1}); err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	story := &models.StoryState{ID: "s1", CharacterID: "c1", WorldID: "w1", Turn: 1, Status: "active"}
+	if err := s.CreateStoryState(story); err != nil {
+		t.Fatalf("创建故事失败: %v", err)
+	}
+
+	stale := *story
+	stale.Version--
+	stale.Turn = 5
+	err := s.CommitStory(&stale, &models.Character{ID: "c1", Name: "旅人", Level: 9, Version: 1}, nil)
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("过期版本应返回 ErrVersionConflict，实际 %v", err)
+	}
+	saved, err := s.GetStoryState("s1")
+	if err != nil {
+		t.Fatalf("读取故事失败: %v", err)
+	}
+	char, err := s.GetCharacter("c1")
+	if err != nil {
+		t.Fatalf("读取角色失败: %v", err)
+	}
+	if saved.Turn != 1 || saved.Version != story.Version || char.Level != 1 {
+		t.Errorf("版本冲突时不应写入任何数据，实际第%d回合、版本 %d、角色%d级", saved.Turn, saved.Version, char.Level)
+	}
+}
+
+func TestCommitStoryRejectsStaleCharacter(t *testing.T) {
+	s := newTestStorage(t)
+	if err := s.CreateCharacter(&models.Character{ID: "c1", Name: "旅人", Level: 1, XP: 100}); err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	story := &models.StoryState{ID: "s1", CharacterID: "c1", WorldID: "w1", Turn: 1, Status: "active"}
+	if err := s.CreateStoryState(story); err != nil {
+		t.Fatalf("创建故事失败: %v", err)
+	}
+
+	// 回合开始时读到的角色，之后被训练抢先更新
+	inFlight, err := s.GetCharacter("c1")
+	if err != nil {
+		t.Fatalf("读取角色失败: %v", err)
+	}
+	trained, err := s.GetCharacter("c1")
+	if err != nil {
+		t.Fatalf("读取角色失败: %v", err)
+	}
+	trained.XP = 40
+	if err := s.UpdateCharacter(trained); err != nil {
+		t.Fatalf("更新角色失败: %v", err)
+	}
+
+	story.Turn = 2
+	inFlight.XP = 150
+	if err := s.CommitStory(story, inFlight, nil); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("过期的角色应返回 ErrVersionConflict，实际 %v", err)
+	}
+	saved, err := s.GetStoryState("s1")
+	if err != nil {
+		t.Fatalf("读取故事失败: %v", err)
+	}
+	char, err := s.GetCharacter("c1")
+	if err != nil {
+		t.Fatalf("读取角色失败: %v", err)
+	}
+	if saved.Turn != 1 || char.XP != 40 {
+		t.Errorf("角色冲突时应整体回滚并保留训练结果，实际第%d回合、经验 %d", saved.Turn, char.XP)
+	}
+}
+
+func TestListsSkipCorruptRows(t *testing.T) {
+	s := newTestStorage(t)
+	for _, id := range []string{"good", "bad"} {
+		if err := s.CreateCharacter(&models.Character{ID: id, Name: id, Level: 1}); err != nil {
+			t.Fatalf("创建角色失败: %v", err)
+		}
+		if err := s.CreateWorld(&models.World{ID: id, Name: id, SegmentText: "段落"}); err != nil {
+			t.Fatalf("创建世界失败: %v", err)
+		}
+	}
+	corrupt(t, s, "characters", "traits", "bad")
+	corrupt(t, s, "worlds", "npcs", "bad")
+
+	characters, count, err := s.GetAllCharacters(models.Page{})
+	if err != nil {
+		t.Fatalf("角色列表不应因一条坏数据失败: %v", err)
+	}
+	if len(characters) != 1 || characters[0].ID != "good" || count.Total != 2 || count.Corrupt != 1 {
+		t.Errorf("角色列表应只返回 good 并报告 1 条损坏，实际 %d 条，计数 %+v", len(characters), count)
+	}
+
+	worlds, count, err := s.GetWorlds(models.WorldFilter{}, models.Page{})
+	if err != nil {
+		t.Fatalf("世界列表不应因一条坏数据失败: %v", err)
+	}
+	if len(worlds) != 1 || worlds[0].ID != "good" || count.Total != 2 || count.Corrupt != 1 {
+		t.Errorf("世界列表应只返回 good 并报告 1 条损坏，实际 %d 条，计数 %+v", len(worlds), count)
+	}
+
+	byID, err := s.GetCharactersByIDs([]string{"good", "bad"})
+	if err != nil {
+		t.Fatalf("批量获取角色失败: %v", err)
+	}
+	if _, ok := byID["bad"]; ok || byID["good"] == nil {
+		t.Errorf("批量获取应跳过损坏的角色，实际 %v", byID)
+	}
+
+	// 按ID读取单条记录时仍然报告损坏
+	if _, err := s.GetCharacter("bad"); !errors.Is(err, ErrCorruptData) {
+		t.Errorf("读取损坏的角色应返回 ErrCorruptData，实际 %v", err)
+	}
+	if _, err := s.GetWorld("bad"); !errors.Is(err, ErrCorruptData) {
+		t.Errorf("读取损坏的世界应返回 ErrCorruptData，实际 %v", err)
+	}
+}
+
+func TestChangeLogSkipsCorruptRows(t *testing.T) {
+	s := newTestStorage(t)
+	for turn := 1; turn <= 3; turn++ {
+		entry := &models.ChangeLogEntry{StoryID: "story", Turn: turn, Action: "行动", CreatedAt: time.Now()}
+		if err := s.RecordStateChanges(entry); err != nil {
+			t.Fatalf("写入变更日志失败: %v", err)
+		}
+	}
+	if _, err := s.db.Exec(`UPDATE state_change_log SET changes = '[1,' WHERE turn = 2`); err != nil {
+		t.Fatalf("写入损坏数据失败: %v", err)
+	}
+
+	entries, count, err := s.GetStateChangeLog("story", models.Page{})
+	if err != nil {
+		t.Fatalf("变更日志不应因一条坏数据失败: %v", err)
+	}
+	if len(entries) != 2 || count.Total != 3 || count.Corrupt != 1 {
+		t.Errorf("应返回 2 条日志并报告 1 条损坏，实际 %d 条，计数 %+v", len(entries), count)
+	}
+	for _, entry := range entries {
+		if entry.Turn == 2 {
+			t.Errorf("损坏的第2回合日志不应出现在结果中")
+		}
+	}
+}
+
+func TestBatchLookupsMatchSingleReads(t *testing.T) {
+	s := newTestStorage(t)
+	ids := []string{"a", "b", "c"}
+	for i, id := range ids {
+		char := &models.Character{ID: id, Name: "角色" + id, Level: i + 1, XP: i * 10,
+			Traits: []string{"天选之人"}}
+		if err := s.CreateCharacter(char); err != nil {
+			t.Fatalf("创建角色失败: %v", err)
+		}
+		world := &models.World{ID: id, Name: "世界" + id, SegmentText: "段落", Difficulty: i + 1,
+			NPCs: []models.NPC{{ID: "npc_" + id, Name: "NPC" + id}}}
+		if err := s.CreateWorld(world); err != nil {
+			t.Fatalf("创建世界失败: %v", err)
+		}
+	}
+
+	// 重复ID和不存在的ID都不影响结果
+	lookup := append(ids, "a", "missing")
+	characters, err := s.GetCharactersByIDs(lookup)
+	if err != nil {
+		t.Fatalf("批量获取角色失败: %v", err)
+	}
+	worlds, err := s.GetWorldsByIDs(lookup)
+	if err != nil {
+		t.Fatalf("批量获取世界失败: %v", err)
+	}
+	if len(characters) != len(ids) || len(worlds) != len(ids) {
+		t.Fatalf("应批量取回 %d 个角色和世界，实际 %d 和 %d", len(ids), len(characters), len(worlds))
+	}
+
+	for _, id := range ids {
+		char, err := s.GetCharacter(id)
+		if err != nil {
+			t.Fatalf("获取角色失败: %v", err)
+		}
+		if !reflect.DeepEqual(characters[id], char) {
+			t.Errorf("角色 %s 批量结果与单条结果不一致：\n%+v\n%+v", id, characters[id], char)
+		}
+		world, err := s.GetWorld(id)
+		if err != nil {
+			t.Fatalf("获取世界失败: %v", err)
+		}
+		if !reflect.DeepEqual(worlds[id], world) {
+			t.Errorf("世界 %s 批量结果与单条结果不一致：\n%+v\n%+v", id, worlds[id], world)
+		}
+	}
+}
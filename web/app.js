@@ -72,6 +72,18 @@ const APIConfig = {
 // 页面加载时初始化API配置
 APIConfig.load();
 
+// 解析API响应，失败时抛出带错误码的异常
+async function parseResponse(res, fallbackMessage) {
+    const data = await res.json();
+    if (!res.ok) {
+        const error = new Error(data.message || fallbackMessage);
+        error.code = data.code;
+        error.details = data.details;
+        throw error;
+    }
+    return data;
+}
+
 // API 调用
 const API = {
     async createCharacter(charData) {
@@ -80,62 +92,153 @@ const API = {
             headers: APIConfig.getHeaders(),
             body: JSON.stringify(charData)
         });
-        const data = await res.json();
-        if (!res.ok) {
-            throw new Error(data.error || '创建失败');
-        }
-        return data;
+        return parseResponse(res, '创建失败');
     },
 
-    async generateCharacter(name, gender, age, prompt) {
+    async generateCharacter(name, gender, age, prompt, requestID) {
         const res = await fetch('/api/characters/generate', {
             method: 'POST',
             headers: APIConfig.getHeaders(),
-            body: JSON.stringify({ name, gender, age, prompt })
+            body: JSON.stringify({ name, gender, age, prompt, request_id: requestID })
         });
-        const data = await res.json();
-        if (!res.ok) {
-            throw new Error(data.error || '生成失败');
-        }
-        return data;
+        return parseResponse(res, '生成失败');
+    },
+
+    async getStatus() {
+        const res = await fetch('/api/status', {
+            headers: APIConfig.getHeaders()
+        });
+        return parseResponse(res, '获取服务状态失败');
     },
 
     async listCharacters() {
-        const res = await fetch('/api/characters', {
+        const res = await fetch('/api/characters?limit=100', {
             headers: APIConfig.getHeaders()
         });
-        const data = await res.json();
-        if (!res.ok) {
-            throw new Error(data.error || '获取角色列表失败');
-        }
-        return data;
+        return parseResponse(res, '获取角色列表失败');
     },
 
     async parseSegment(segmentText) {
-        const res = await fetch('/api/worlds/parse', {
+        // 长文本解析耗时较长，使用异步任务并轮询结果
+        const res = await fetch('/api/worlds/parse?async=true', {
             method: 'POST',
             headers: APIConfig.getHeaders(),
             body: JSON.stringify({ segment_text: segmentText })
         });
-        return res.json();
+        const { task_id } = await parseResponse(res, '解析失败');
+
+        while (true) {
+            await new Promise(resolve => setTimeout(resolve, 2000));
+            const task = await this.getTask(task_id);
+            if (task.status === 'done') {
+                return task.result;
+            }
+            if (task.status === 'failed') {
+                throw new Error(task.error || '解析失败');
+            }
+        }
+    },
+
+    async getTask(taskID) {
+        const res = await fetch(`/api/tasks/${taskID}`, {
+            headers: APIConfig.getHeaders()
+        });
+        return parseResponse(res, '查询任务失败');
     },
 
-    async startStory(characterID, worldID) {
+    async startStory(characterID, worldID, newGamePlus = false) {
         const res = await fetch('/api/stories/start', {
             method: 'POST',
             headers: APIConfig.getHeaders(),
-            body: JSON.stringify({ character_id: characterID, world_id: worldID })
+            body: JSON.stringify({ character_id: characterID, world_id: worldID, new_game_plus: newGamePlus })
         });
-        return res.json();
+        return parseResponse(res, '开始冒险失败');
     },
 
-    async takeAction(storyID, action) {
+    async takeAction(storyID, action, version, confirmed = false) {
         const res = await fetch('/api/stories/action', {
             method: 'POST',
             headers: APIConfig.getHeaders(),
-            body: JSON.stringify({ story_id: storyID, action })
+            body: JSON.stringify({ story_id: storyID, action, version, confirmed })
+        });
+        return parseResponse(res, '执行行动失败');
+    },
+
+    // 流式执行行动：叙事片段到达时调用 onDelta，返回与 takeAction 相同的结果
+    // confirmed 表示玩家已确认执行重大不可逆行动
+    async takeActionStream(storyID, action, version, onDelta, confirmed = false) {
+        const res = await fetch('/api/stories/action/stream', {
+            method: 'POST',
+            headers: APIConfig.getHeaders(),
+            body: JSON.stringify({ story_id: storyID, action, version, confirmed })
+        });
+        // 开始输出前就失败时返回的是普通的错误响应
+        if (!res.ok || !(res.headers.get('Content-Type') || '').includes('text/event-stream')) {
+            return parseResponse(res, '执行行动失败');
+        }
+
+        const reader = res.body.getReader();
+        const decoder = new TextDecoder();
+        let buffer = '';
+        while (true) {
+            const { value, done } = await reader.read();
+            if (done) break;
+            buffer += decoder.decode(value, { stream: true });
+
+            let boundary;
+            while ((boundary = buffer.indexOf('\n\n')) >= 0) {
+                const block = buffer.slice(0, boundary);
+                buffer = buffer.slice(boundary + 2);
+
+                let event = 'message';
+                const dataLines = [];
+                block.split('\n').forEach(line => {
+                    if (line.startsWith('event:')) event = line.slice(6).trim();
+                    else if (line.startsWith('data:')) dataLines.push(line.slice(5));
+                });
+                const data = JSON.parse(dataLines.join('\n'));
+
+                if (event === 'delta') {
+                    onDelta(data.text);
+                } else if (event === 'result') {
+                    return data;
+                } else if (event === 'error') {
+                    const error = new Error(data.message || '执行行动失败');
+                    error.code = data.code;
+                    error.details = data.details;
+                    throw error;
+                }
+            }
+        }
+        throw new Error('连接中断，请刷新查看本回合结果');
+    },
+
+    async getStory(storyID) {
+        const res = await fetch(`/api/stories/${storyID}`);
+        return parseResponse(res, '获取故事失败');
+    },
+
+    async getDiceTimeline(storyID, limit = 0) {
+        const res = await fetch(`/api/stories/${storyID}/dice-timeline?limit=${limit}`);
+        return parseResponse(res, '获取检定历史失败');
+    },
+
+    async getStoryReport(storyID) {
+        const res = await fetch(`/api/stories/${storyID}/report`);
+        return parseResponse(res, '生成战报失败');
+    },
+
+    storyReportURL(storyID) {
+        return `/api/stories/${storyID}/report?format=markdown`;
+    },
+
+    async resolveQuickChoice(storyID, choiceID, option) {
+        const res = await fetch(`/api/stories/${storyID}/quick-choice`, {
+            method: 'POST',
+            headers: APIConfig.getHeaders(),
+            body: JSON.stringify({ choice_id: choiceID, option })
         });
-        return res.json();
+        return parseResponse(res, '快速选择失败');
     },
 
     async undoTurn(storyID) {
@@ -144,7 +247,7 @@ const API = {
             headers: APIConfig.getHeaders(),
             body: JSON.stringify({ story_id: storyID })
         });
-        return res.json();
+        return parseResponse(res, '回退失败');
     },
 
     async saveGame(storyID, name, description) {
@@ -153,12 +256,12 @@ const API = {
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ story_id: storyID, name, description })
         });
-        return res.json();
+        return parseResponse(res, '存档失败');
     },
 
     async listSaves(characterID) {
         const res = await fetch(`/api/saves?character_id=${characterID}`);
-        return res.json();
+        return parseResponse(res, '获取存档列表失败');
     },
 
     async loadGame(storyID) {
@@ -167,12 +270,40 @@ const API = {
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ story_id: storyID })
         });
-        return res.json();
+        return parseResponse(res, '读档失败');
+    },
+
+    async listActiveStories(characterID) {
+        const res = await fetch(`/api/characters/${characterID}/active-stories`);
+        return parseResponse(res, '获取进行中的故事失败');
+    },
+
+    async continueStory(characterID, worldID = '') {
+        const res = await fetch(`/api/characters/${characterID}/continue`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ world_id: worldID })
+        });
+        return parseResponse(res, '继续游戏失败');
     }
 };
 
 // UI 更新函数
 const UI = {
+    // 演示模式下标注"演示模式"，并预填一段示例小说方便直接开始
+    async refreshDemoMode() {
+        try {
+            const status = await API.getStatus();
+            document.getElementById('demo-badge').style.display = status.demo_mode ? 'block' : 'none';
+            const segment = document.getElementById('segment-text');
+            if (status.demo_mode && !segment.value.trim()) {
+                segment.value = '【演示】常年被浓雾笼罩的港口旧城里，灯塔守夜人在一个钟声响了十三下的夜晚失踪了……';
+            }
+        } catch (error) {
+            console.warn('⚠️ 获取服务状态失败', error);
+        }
+    },
+
     showCharacterInfo(character) {
         const info = document.getElementById('character-info');
         const genderIcon = character.gender === 'female' ? '♀️' : '♂️';
@@ -261,6 +392,14 @@ const UI = {
             goalsDiv.innerHTML = '<h3>通关目标</h3><div class="goal-item">自由探索</div>';
         }
 
+        // 世界规则（禁忌）
+        const rules = Array.isArray(world.rules) ? world.rules : [];
+        if (rules.length > 0) {
+            goalsDiv.innerHTML += '<h3>世界规则</h3>' + rules.map((rule, i) =>
+                `<div class="goal-item">⛔ ${i + 1}. ${rule}</div>`
+            ).join('');
+        }
+
         // 安全地显示NPC（确保 npcs 是数组）
         const npcList = document.getElementById('npc-list');
         const npcs = Array.isArray(world.npcs) ? world.npcs : [];
@@ -318,6 +457,7 @@ const UI = {
     showNarrative(story) {
         const logDiv = document.getElementById('narrative-log');
         logDiv.style.display = 'block';
+        this.showGameTime(story);
 
         const logContent = document.getElementById('log-content');
         const narrative = Array.isArray(story.narrative) ? story.narrative : [];
@@ -327,8 +467,11 @@ const UI = {
                 const dr = entry.dice_roll;
                 const successClass = dr.success ? 'success' : '';
                 const criticalClass = dr.critical ? 'critical' : '';
+                const modeText = Array.isArray(dr.rolls) && dr.rolls.length === 2
+                    ? `（${dr.mode === 'advantage' ? '优势' : '劣势'}${dr.mode_source ? '·' + dr.mode_source : ''}：${dr.rolls.join(' / ')}）`
+                    : '';
                 diceInfo = `<div class="dice-roll ${successClass} ${criticalClass}">
-                    🎲 ${dr.result} + ${dr.modifier} = ${dr.result + dr.modifier} 
+                    🎲 ${dr.result}${modeText} + ${dr.modifier} = ${dr.result + dr.modifier} 
                     (目标: ${dr.target}) 
                     ${dr.critical ? (dr.success ? '大成功!' : '大失败!') : (dr.success ? '成功' : '失败')}
                 </div>`;
@@ -342,22 +485,62 @@ const UI = {
                     ${diceInfo}
                 </div>
             `;
-        }).join('');
+        }).join('') + this.renderQuickChoice(story.pending_choice);
+
+        document.querySelectorAll('.quick-choice-btn').forEach(btn => {
+            btn.onclick = () => this.resolveQuickChoice(btn.dataset.choice, Number(btn.dataset.option));
+        });
 
         // 滚动到底部
         logContent.scrollTop = logContent.scrollHeight;
     },
 
+    renderQuickChoice(choice) {
+        if (!choice) return '';
+        return `
+            <div class="log-entry quick-choice">
+                <div class="quick-choice-prompt">⚡ ${choice.prompt}</div>
+                ${choice.options.map((opt, i) => `
+                    <button class="btn quick-choice-btn" data-choice="${choice.id}" data-option="${i}">${opt}</button>
+                `).join('')}
+            </div>
+        `;
+    },
+
+    async resolveQuickChoice(choiceID, option) {
+        document.querySelectorAll('.quick-choice-btn').forEach(btn => btn.disabled = true);
+        try {
+            const result = await API.resolveQuickChoice(state.story.id, choiceID, option);
+            state.story = result.story;
+            this.showNarrative(state.story);
+        } catch (error) {
+            alert('快速选择失败: ' + error.message);
+            document.querySelectorAll('.quick-choice-btn').forEach(btn => btn.disabled = false);
+        }
+    },
+
     translateType(type) {
         const map = {
             system: '系统',
             action: '行动',
             result: '结果',
-            dialogue: '对话'
+            dialogue: '对话',
+            quick_choice: '抉择'
         };
         return map[type] || type;
     },
 
+    formatConsequence(preview) {
+        const parts = [`成功率 ${Math.round(preview.success_chance * 100)}%`];
+        if (preview.hp_loss_max) {
+            parts.push(`失败扣血 ${preview.hp_loss_min}-${preview.hp_loss_max}`);
+        }
+        if (preview.san_loss_max) {
+            parts.push(`失败扣理智 ${preview.san_loss_min}-${preview.san_loss_max}`);
+        }
+        return '⚠️ ' + parts.join(' | ');
+    },
+
     showOptions(options) {
         const optionsDiv = document.getElementById('action-options');
         optionsDiv.style.display = 'block';
@@ -369,9 +552,12 @@ const UI = {
                 <span class="option-label">${opt.label}</span>
                 <div class="option-description">${opt.description}</div>
                 <div class="option-meta">
-                    难度: ${opt.difficulty} | 
+                    ${opt.trivial ? '无需检定' : `难度: ${opt.difficulty}`} | 
                     风险: <span class="risk-${opt.risk}">${opt.risk === 'low' ? '低' : opt.risk === 'medium' ? '中' : '高'}</span>
                 </div>
+                ${opt.personality_conflict ? `<div class="option-conflict">😣 违背本性「${opt.personality_conflict}」</div>` : ''}
+                ${opt.requires_confirm ? `<div class="option-conflict">⚠️ 无法挽回的重大行动</div>` : ''}
+                ${opt.consequence ? `<div class="option-consequence">${this.formatConsequence(opt.consequence)}</div>` : ''}
             </button>
         `).join('');
 
@@ -379,20 +565,32 @@ const UI = {
         document.querySelectorAll('.option-btn').forEach(btn => {
             btn.onclick = () => {
                 const opt = JSON.parse(btn.dataset.option);
+                if (opt.personality_conflict &&
+                    !confirm(`这个行动违背了角色「${opt.personality_conflict}」的本性，检定会更困难。确定要这么做吗？`)) {
+                    return;
+                }
+                if (opt.requires_confirm &&
+                    !confirm(`「${opt.label}」一旦执行就无法挽回。确定要这么做吗？`)) {
+                    return;
+                }
                 // 弹出输入框让用户输入具体行动
                 const detail = prompt(`请输入具体行动内容（默认：${opt.label}）`, opt.description);
                 if (detail !== null) {  // null表示用户取消
                     this.executeAction({
                         type: opt.action_type,
-                        content: detail || opt.label  // 如果为空，使用label
-                    });
+                        content: detail || opt.label,  // 如果为空，使用label
+                        trivial: !!opt.trivial,
+                        requires_confirm: !!opt.requires_confirm
+                    }, !!opt.requires_confirm);
                 }
             };
         });
     },
 
-    async executeAction(action) {
+    // confirmed 表示玩家已确认执行重大不可逆行动；未确认的此类行动服务端会要求确认后重新提交
+    async executeAction(action, confirmed = false) {
         if (!state.story) return;
+        let retryConfirmed = false;
 
         // 禁用所有按钮
         document.querySelectorAll('.option-btn, #custom-action-btn').forEach(btn => {
@@ -400,18 +598,39 @@ const UI = {
             btn.style.opacity = '0.5';
         });
 
+        // 流式显示生成中的叙事，完成后由 showNarrative 替换为整理后的完整叙事
+        const logContent = document.getElementById('log-content');
+        const streaming = document.createElement('div');
+        streaming.className = 'log-entry result streaming';
+        const streamingText = document.createElement('p');
+        streaming.appendChild(streamingText);
+
         try {
-            const result = await API.takeAction(state.story.id, action);
+            const result = await API.takeActionStream(state.story.id, action, state.story.version, text => {
+                if (!streaming.isConnected) logContent.appendChild(streaming);
+                streamingText.textContent += text;
+                logContent.scrollTop = logContent.scrollHeight;
+            }, confirmed);
+
+            // 没有收到流式片段（如行动被角色状态阻止、不调用LLM）或流式叙事因与上文矛盾被重写时，
+            // 按后端切好的段落逐段呈现最终叙事，再换成完整叙事
+            if (!streamingText.textContent || result.result.revised) {
+                await this.revealParagraphs(streaming, result.result.paragraphs);
+            }
 
             // 更新状态
             state.story = result.story;
+            if (result.result.new_scene) {
+                state.scene = result.result.new_scene;
+            }
 
             // 更新UI
             this.showNarrative(state.story);
+            this.showPlotProgress(result.result.plot_progress);
+            this.showEvents(result.result.events);
 
             if (result.result.scene_end) {
                 // 场景结束
-                const logContent = document.getElementById('log-content');
                 logContent.innerHTML += `
                     <div class="log-entry system">
                         <h3>🎯 场景结束</h3>
@@ -437,14 +656,91 @@ const UI = {
             }
 
         } catch (error) {
-            alert('执行行动失败: ' + error.message);
+            if (error.code === 'VERSION_CONFLICT') {
+                // 故事在其他页面被更新过，刷新到最新状态
+                const latest = await API.getStory(state.story.id);
+                state.story = latest.story;
+                state.scene = latest.scene;
+                state.charState = latest.char_state;
+                this.showNarrative(state.story);
+                this.showCharacterState(state.charState);
+                alert('故事已在其他页面更新，已刷新到最新状态，请重新选择行动');
+            } else if (error.code === 'CONFIRM_REQUIRED') {
+                retryConfirmed = confirm(`${error.message}。确定要这么做吗？`);
+            } else {
+                alert('执行行动失败: ' + error.message);
+            }
         } finally {
+            streaming.remove();
             // 重新启用按钮
             document.querySelectorAll('.option-btn, #custom-action-btn').forEach(btn => {
                 btn.disabled = false;
                 btn.style.opacity = '1';
             });
         }
+        if (retryConfirmed) {
+            await this.executeAction(action, true);
+        }
+    },
+
+    // 逐段显示叙事段落，营造阅读节奏
+    async revealParagraphs(container, paragraphs) {
+        if (!Array.isArray(paragraphs) || paragraphs.length < 2) return;
+        const logContent = document.getElementById('log-content');
+        container.innerHTML = '';
+        logContent.appendChild(container);
+        for (const text of paragraphs) {
+            const p = document.createElement('p');
+            p.textContent = text;
+            container.appendChild(p);
+            logContent.scrollTop = logContent.scrollHeight;
+            await new Promise(resolve => setTimeout(resolve, 600));
+        }
+    },
+
+    // 展示本回合触发的规则事件（升级、获得物品、关系里程碑等）
+    showEvents(events) {
+        if (!events || events.length === 0) return;
+        const icons = {
+            critical_success: '✨', critical_failure: '💥', level_up: '⬆️',
+            item_gained: '🎁', item_lost: '📦', trait_gained: '🌟',
+            status_added: '🩸', status_removed: '💊', relation_milestone: '💞',
+            objective_done: '🎯', threat_triggered: '⚠️', threat_weakened: '⚔️', rule_violated: '☠️', chapter_started: '📖',
+            time_advanced: '🕰️', base_attribute_changed: '🧬', off_scene_action: '🧭', romance_stage: '💘'
+        };
+        const logContent = document.getElementById('log-content');
+        logContent.innerHTML += events.map(ev => `
+            <div class="log-entry system event-${ev.type}">
+                <p>${icons[ev.type] || '🔔'} ${ev.message}</p>
+            </div>
+        `).join('');
+        logContent.scrollTop = logContent.scrollHeight;
+    },
+
+    showPlotProgress(progress) {
+        const panel = document.getElementById('plot-progress');
+        if (!progress) {
+            panel.style.display = 'none';
+            return;
+        }
+        panel.style.display = 'block';
+
+        const percent = Math.round((progress.progress || 0) * 100);
+        document.getElementById('plot-bar').style.width = `${percent}%`;
+        const target = progress.next_node_name ? ` → ${progress.next_node_name}` : '';
+        document.getElementById('plot-text').textContent = `${progress.current_node_name}${target} ${percent}%`;
+    },
+
+    showGameTime(story) {
+        const panel = document.getElementById('game-time');
+        if (!story || !story.day) {
+            panel.style.display = 'none';
+            return;
+        }
+        const periodNames = { morning: '早上', afternoon: '下午', evening: '傍晚', night: '深夜' };
+        panel.style.display = 'block';
+        document.getElementById('game-time-text').textContent =
+            `第${story.day}天 ${periodNames[story.period] || periodNames.morning}`;
     },
 
     hideSegmentInput() {
@@ -464,7 +760,14 @@ const UI = {
             this.showNarrative(state.story);
             this.showCharacterState(state.charState);
 
-            alert('✅ 已回退到上一回合');
+            const undo = result.undo;
+            let note = '';
+            if (undo && !undo.unlimited) {
+                note = undo.free_left > 0
+                    ? `（剩余免费回退 ${undo.free_left} 次）`
+                    : (undo.allowed ? `（免费次数已用完，下次回退消耗 ${undo.xp_cost} 经验值）` : '（本局回退次数已用完）');
+            }
+            alert('✅ 已回退到上一回合' + note);
         } catch (error) {
             alert('回退失败: ' + error.message);
         }
@@ -500,7 +803,7 @@ const UI = {
             }
 
             const saveList = saves.map((save, index) =>
-                `${index + 1}. ${save.name} (${save.description || '回合' + save.turn})`
+                `${index + 1}. ${save.name}${save.world_name ? ' 【' + save.world_name + '】' : ''} (${save.description || '回合' + save.turn})`
             ).join('\n');
 
             const choice = prompt(`选择要读取的存档（输入序号）：\n\n${saveList}`);
@@ -525,6 +828,9 @@ const UI = {
             // 更新UI
             this.showNarrative(state.story);
             this.showCharacterState(state.charState);
+            if (result.options && result.options.length > 0) {
+                this.showOptions(result.options);
+            }
             document.getElementById('narrative-log').style.display = 'block';
             document.getElementById('action-options').style.display = 'block';
 
@@ -537,6 +843,8 @@ const UI = {
 
 // 初始化
 document.addEventListener('DOMContentLoaded', () => {
+    UI.refreshDemoMode();
+
     // 创建角色按钮
     document.getElementById('create-character-btn').onclick = () => {
         document.getElementById('create-character-modal').classList.add('show');
@@ -545,7 +853,8 @@ document.addEventListener('DOMContentLoaded', () => {
     // 加载角色
     document.getElementById('load-character-btn').onclick = async () => {
         try {
-            const characters = await API.listCharacters();
+            const result = await API.listCharacters();
+            const characters = result.characters || [];
 
             if (!characters || characters.length === 0) {
                 alert('还没有保存的角色，请先创建角色');
@@ -582,11 +891,8 @@ document.addEventListener('DOMContentLoaded', () => {
     // 全局函数：根据ID加载角色
     window.loadCharacterById = async (characterId) => {
         try {
-            const character = await fetch(`/api/characters/${characterId}`).then(res => res.json());
-
-            if (character.error) {
-                throw new Error(character.error);
-            }
+            const character = await fetch(`/api/characters/${characterId}`)
+                .then(res => parseResponse(res, '加载角色失败'));
 
             state.character = character;
             UI.showCharacterInfo(character);
@@ -658,15 +964,20 @@ document.addEventListener('DOMContentLoaded', () => {
             if (mode === 'ai') {
                 // AI自动生成
                 const prompt = document.getElementById('character-prompt').value.trim();
-                const result = await API.generateCharacter(name, gender, age, prompt);
-
-                // 检查是否有错误
-                if (result.error) {
-                    throw new Error(result.error);
+                // 同一次创建的重试共用request_id，避免重复生成
+                const requestID = `${Date.now()}-${Math.random().toString(36).slice(2)}`;
+                while (true) {
+                    try {
+                        character = await API.generateCharacter(name, gender, age, prompt, requestID);
+                        break;
+                    } catch (error) {
+                        if (!(error.details && error.details.retryable) ||
+                            !confirm(`AI生成失败：${error.message}\n\n是否用相同的输入重试？`)) {
+                            throw error;
+                        }
+                    }
                 }
 
-                character = result;
-
                 // 验证返回的数据
                 if (!character.appearance || !character.personality || !character.background) {
                     throw new Error('AI生成的数据不完整，请重试');
@@ -690,13 +1001,7 @@ document.addEventListener('DOMContentLoaded', () => {
                         perception: parseInt(document.getElementById('attr-perception').value)
                     }
                 };
-                const result = await API.createCharacter(charData);
-
-                if (result.error) {
-                    throw new Error(result.error);
-                }
-
-                character = result;
+                character = await API.createCharacter(charData);
             }
 
             state.character = character;
@@ -707,7 +1012,7 @@ document.addEventListener('DOMContentLoaded', () => {
             document.getElementById('segment-input-section').style.display = 'block';
         } catch (error) {
             console.error('创建角色错误:', error);
-            alert('创建角色失败: ' + (error.message || error.error || '未知错误'));
+            alert('创建角色失败: ' + (error.message || '未知错误'));
         } finally {
             btn.disabled = false;
             btn.textContent = '创建角色';
@@ -730,8 +1035,8 @@ document.addEventListener('DOMContentLoaded', () => {
             const world = await API.parseSegment(segmentText);
 
             // 检查返回的数据是否有效
-            if (!world || world.error) {
-                throw new Error(world?.error || '解析返回数据无效');
+            if (!world) {
+                throw new Error('解析返回数据无效');
             }
 
             // 确保必要的字段存在
@@ -749,7 +1054,7 @@ document.addEventListener('DOMContentLoaded', () => {
             UI.hideSegmentInput();
         } catch (error) {
             console.error('解析错误:', error);
-            alert('解析失败: ' + (error.message || error.error || '未知错误'));
+            alert('解析失败: ' + (error.message || '未知错误'));
         } finally {
             btn.disabled = false;
             btn.textContent = '生成世界';
@@ -915,6 +1220,7 @@ document.addEventListener('DOMContentLoaded', () => {
         };
 
         APIConfig.save(config);
+        UI.refreshDemoMode();
 
         // 显示成功提示
         const resultDiv = document.getElementById('api-test-result');
@@ -991,6 +1297,7 @@ document.addEventListener('DOMContentLoaded', () => {
     document.getElementById('clear-api-settings').onclick = () => {
         if (confirm('确定要清除API设置吗？将恢复使用服务器默认配置。')) {
             APIConfig.clear();
+            UI.refreshDemoMode();
 
             // 清空表单
             document.getElementById('api-base-url').value = 'https://api.x.ai/v1';